@@ -82,6 +82,7 @@ fn run_command(
             }
             CommandKind::MotionMode(_) => {}
             CommandKind::MultiSelection(_) => {}
+            CommandKind::Plugin(_) => {}
         }
         CommandExecuted::Yes
     }
@@ -0,0 +1,37 @@
+//! Keyboard-only use of the UI.
+
+use std::rc::Rc;
+
+use floem::{
+    View,
+    event::{Event, EventListener, EventPropagation},
+    keyboard::{Key, NamedKey},
+    views::Decorators,
+};
+
+/// Lets a clickable view be reached with Tab and activated with Enter or
+/// Space, as well as with a click, so it can be used without a mouse.
+pub trait KeyboardActivate: View + Sized {
+    fn on_activate(self, action: impl Fn() + 'static) -> Self {
+        let action = Rc::new(action);
+        let key_action = action.clone();
+        self.keyboard_navigable()
+            .on_click_stop(move |_| action())
+            .on_event(EventListener::KeyDown, move |event| {
+                if let Event::KeyDown(key_event) = event {
+                    if key_event.modifiers.is_empty()
+                        && matches!(
+                            key_event.key.logical_key,
+                            Key::Named(NamedKey::Enter | NamedKey::Space)
+                        )
+                    {
+                        key_action();
+                        return EventPropagation::Stop;
+                    }
+                }
+                EventPropagation::Continue
+            })
+    }
+}
+
+impl<V: View> KeyboardActivate for V {}
@@ -3,7 +3,7 @@
 use std::{
     io::{BufReader, IsTerminal, Read, Write},
     ops::Range,
-    path::PathBuf,
+    path::{Path, PathBuf},
     process::Stdio,
     rc::Rc,
     sync::{
@@ -17,7 +17,7 @@
 use clap::Parser;
 use floem::{
     IntoView, View,
-    action::show_context_menu,
+    action::{exec_after, show_context_menu},
     event::{Event, EventListener, EventPropagation},
     ext_event::{create_ext_action, create_signal_from_channel},
     menu::{Menu, MenuItem},
@@ -48,7 +48,7 @@
         scroll::{PropagatePointerWheel, VerticalScrollAsHorizontal, scroll},
         stack, svg, tab, text, tooltip, virtual_stack,
     },
-    window::{ResizeDirection, WindowConfig, WindowId},
+    window::{ResizeDirection, Theme, WindowConfig, WindowId},
 };
 use lapce_core::{
     command::{EditCommand, FocusCommand},
@@ -67,15 +67,17 @@
 use tracing_subscriber::{filter::Targets, reload::Handle};
 
 use crate::{
-    about, alert,
+    about,
+    accessibility::KeyboardActivate,
+    alert,
     code_action::CodeActionStatus,
     command::{
         CommandKind, InternalCommand, LapceCommand, LapceWorkbenchCommand,
         WindowCommand,
     },
     config::{
-        LapceConfig, color::LapceColor, icon::LapceIcons, ui::TabSeparatorHeight,
-        watcher::ConfigWatcher,
+        LapceConfig, color::LapceColor, core::Appearance, icon::LapceIcons,
+        ui::TabSeparatorHeight, vscode_theme, watcher::ConfigWatcher,
     },
     db::LapceDb,
     debug::RunDebugMode,
@@ -87,13 +89,15 @@
     editor_tab::{EditorTabChild, EditorTabData},
     focus_text::focus_text,
     id::{EditorTabId, SplitId},
+    image_preview::image_preview_view,
     keymap::keymap_view,
-    keypress::keymap::KeyMap,
+    keypress::{KeyPressData, keymap::KeyMap, vscode},
     listener::Listener,
     main_split::{
         SplitContent, SplitData, SplitDirection, SplitMoveDirection, TabCloseKind,
     },
     markdown::MarkdownContent,
+    markdown_preview::markdown_preview_view,
     palette::{
         PaletteStatus,
         item::{PaletteItem, PaletteItemContent},
@@ -101,8 +105,10 @@
     panel::{position::PanelContainerPosition, view::panel_container_view},
     plugin::{PluginData, plugin_info_view},
     settings::{settings_view, theme_color_settings_view},
+    settings_sync::{self, SyncLocation},
     status::status,
     text_input::TextInputBuilder,
+    theme_editor,
     title::{title, window_controls_view},
     tracing::*,
     update::ReleaseInfo,
@@ -133,6 +139,22 @@ struct Cli {
     #[clap(long, action)]
     plugin_path: Vec<PathBuf>,
 
+    /// Convert a VS Code color theme `.json` file into a Lapce theme in the
+    /// themes directory, then exit.
+    #[clap(long, value_name = "FILE")]
+    import_theme: Option<PathBuf>,
+
+    /// Convert a VS Code `keybindings.json` file and add the keybindings to
+    /// the keymaps file, then exit.
+    #[clap(long, value_name = "FILE")]
+    import_keybindings: Option<PathBuf>,
+
+    /// Sync the settings with a folder, a git repository on disk or a git url,
+    /// optionally followed by `#branch`, then exit. Later starts keep syncing
+    /// with it.
+    #[clap(long, value_name = "LOCATION")]
+    settings_sync: Option<String>,
+
     /// Paths to file(s) and/or folder(s) to open.
     /// When path is a file (that exists or not),
     /// it accepts `path:line:column` syntax
@@ -150,10 +172,14 @@ pub struct AppInfo {
 #[derive(Clone)]
 pub enum AppCommand {
     SaveApp,
-    NewWindow { folder: Option<PathBuf> },
+    NewWindow {
+        folder: Option<PathBuf>,
+    },
     CloseWindow(WindowId),
     WindowGotFocus(WindowId),
     WindowClosed(WindowId),
+    /// The OS switched between light and dark mode.
+    OsThemeChanged(Theme),
 }
 
 #[derive(Clone)]
@@ -294,9 +320,30 @@ pub fn run_app_command(&self, cmd: AppCommand) {
             AppCommand::WindowGotFocus(window_id) => {
                 self.active_window.set(window_id);
             }
+            AppCommand::OsThemeChanged(theme) => {
+                let appearance = match theme {
+                    Theme::Light => Appearance::Light,
+                    Theme::Dark => Appearance::Dark,
+                };
+                if LapceConfig::set_os_appearance(appearance) {
+                    self.reload_config();
+                }
+            }
         }
     }
 
+    /// Reloads the config whenever `core.color-theme-schedule` moves on to
+    /// the light or dark color theme.
+    fn schedule_color_theme_check(&self) {
+        let app_data = self.clone();
+        exec_after(std::time::Duration::from_secs(60), move |_| {
+            if app_data.config.get_untracked().color_theme_outdated() {
+                app_data.reload_config();
+            }
+            app_data.schedule_color_theme_check();
+        });
+    }
+
     fn create_windows(
         &self,
         db: Arc<LapceDb>,
@@ -648,6 +695,11 @@ fn app_view(
             .on_event_stop(EventListener::WindowClosed, move |_| {
                 app_command.send(AppCommand::WindowClosed(window_id));
             })
+            .on_event_stop(EventListener::ThemeChanged, move |event| {
+                if let Event::ThemeChanged(theme) = event {
+                    app_command.send(AppCommand::OsThemeChanged(*theme));
+                }
+            })
             .on_event_stop(EventListener::DroppedFile, move |event: &Event| {
                 if let Event::DroppedFile(file) = event {
                     if file.path.is_dir() {
@@ -1227,6 +1279,7 @@ fn editor_tab_content(
     let workspace = common.workspace.clone();
     let editors = main_split.editors;
     let diff_editors = main_split.diff_editors;
+    let docs = main_split.docs;
     let config = common.config;
     let focus = common.focus;
     let items = move || {
@@ -1404,6 +1457,12 @@ fn editor_tab_content(
             EditorTabChild::Volt(_, id) => {
                 plugin_info_view(plugin.clone(), id).into_any()
             }
+            EditorTabChild::ImagePreview(_, path) => {
+                image_preview_view(common, docs, path).into_any()
+            }
+            EditorTabChild::MarkdownPreview(_, path) => {
+                markdown_preview_view(main_split.clone(), path).into_any()
+            }
         };
         child.style(|s| s.size_full())
     };
@@ -2131,9 +2190,7 @@ pub fn clickable_icon_base(
     });
 
     if let Some(on_click) = on_click {
-        view.on_click_stop(move |_| {
-            on_click();
-        })
+        view.on_activate(on_click)
     } else {
         view
     }
@@ -2558,6 +2615,8 @@ fn palette_item(
         | PaletteItemContent::SshHost { .. }
         | PaletteItemContent::Language { .. }
         | PaletteItemContent::LineEnding { .. }
+        | PaletteItemContent::ReopenWithEncoding { .. }
+        | PaletteItemContent::SaveWithEncoding { .. }
         | PaletteItemContent::ColorTheme { .. }
         | PaletteItemContent::SCMReference { .. }
         | PaletteItemContent::TerminalProfile { .. }
@@ -3708,9 +3767,104 @@ fn window(window_data: WindowData) -> impl View {
     .debug_name("Window")
 }
 
+/// Imports a VS Code color theme from the command line, listing what could
+/// not be mapped.
+fn import_theme(path: &Path) {
+    let imported =
+        vscode_theme::import_vscode_theme_file(path).and_then(|imported| {
+            theme_editor::save_theme(&imported.theme, &imported.theme.name)?;
+            Ok(imported)
+        });
+    match imported {
+        Ok(imported) => {
+            println!("Imported the color theme {}", imported.theme.name);
+            if !imported.unmapped.is_empty() {
+                println!("These entries could not be mapped:");
+                for entry in &imported.unmapped {
+                    println!("  {entry}");
+                }
+            }
+        }
+        Err(err) => {
+            eprintln!("Failed to import {}: {err}", path.display());
+            std::process::exit(1);
+        }
+    }
+}
+
+/// Imports VS Code keybindings from the command line, listing what could
+/// not be converted.
+fn import_keybindings(path: &Path) {
+    let imported =
+        vscode::import_vscode_keybindings_file(path).and_then(|imported| {
+            KeyPressData::append_to_file(&imported.keymaps)?;
+            Ok(imported)
+        });
+    match imported {
+        Ok(imported) => {
+            println!("Imported {} keybindings", imported.keymaps.len());
+            if !imported.unconverted.is_empty() {
+                println!("These keybindings could not be converted:");
+                for entry in &imported.unconverted {
+                    println!("  {entry}");
+                }
+            }
+        }
+        Err(err) => {
+            eprintln!("Failed to import {}: {err}", path.display());
+            std::process::exit(1);
+        }
+    }
+}
+
+/// Sets up settings sync from the command line, and syncs once.
+fn set_up_settings_sync(location: &str) {
+    let location = SyncLocation::parse(location);
+    let synced = settings_sync::set_location(Some(&location)).and_then(|()| {
+        let db = LapceDb::new()?;
+        settings_sync::sync(&location, &db)
+    });
+    match synced {
+        Ok(result) => {
+            println!("Synced the settings with {location}");
+            for name in &result.pulled {
+                println!("  updated {name}");
+            }
+            for conflict in &result.conflicts {
+                println!(
+                    "  {} was changed both here and in the sync location, resolve it in Lapce",
+                    conflict.name
+                );
+            }
+            if result.volts.is_some() {
+                println!("The synced volts are installed when Lapce starts");
+            }
+        }
+        Err(err) => {
+            eprintln!("Failed to sync the settings with {location}: {err:#}");
+            std::process::exit(1);
+        }
+    }
+}
+
 pub fn launch() {
     let cli = Cli::parse();
 
+    if let Some(path) = cli.import_theme {
+        import_theme(&path);
+        return;
+    }
+
+    if let Some(path) = cli.import_keybindings {
+        import_keybindings(&path);
+        return;
+    }
+
+    if let Some(location) = cli.settings_sync {
+        set_up_settings_sync(&location);
+        return;
+    }
+
     if !cli.wait {
         logging::panic_hook();
     }
@@ -3858,6 +4012,10 @@ pub fn launch() {
     }
 
     let windows = scope.create_rw_signal(im::HashMap::new());
+    // Windows only report the OS appearance when it changes
+    if let Some(appearance) = Appearance::from_os() {
+        LapceConfig::set_os_appearance(appearance);
+    }
     let config = LapceConfig::load(&LapceWorkspace::default(), &[], &plugin_paths);
 
     // Restore scale from config
@@ -3878,6 +4036,24 @@ pub fn launch() {
     };
 
     let app = app_data.create_windows(db.clone(), cli.paths);
+    app_data.schedule_color_theme_check();
+
+    // The config watcher reloads the settings and keymaps that get pulled
+    if let Some(location) = settings_sync::location() {
+        let app_data = app_data.clone();
+        let send = create_ext_action(scope, move |result| {
+            if let Some(window_tab) = app_data.active_window_tab() {
+                window_tab.settings_synced(result, true);
+            }
+        });
+        let db = db.clone();
+        std::thread::Builder::new()
+            .name("SettingsSync".to_owned())
+            .spawn(move || {
+                send(settings_sync::sync(&location, &db));
+            })
+            .unwrap();
+    }
 
     {
         let app_data = app_data.clone();
@@ -77,6 +77,7 @@ fn run_command(
             }
             CommandKind::MotionMode(_) => {}
             CommandKind::MultiSelection(_) => {}
+            CommandKind::Plugin(_) => {}
         }
         CommandExecuted::Yes
     }
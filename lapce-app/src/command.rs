@@ -12,7 +12,7 @@
 };
 use lapce_rpc::{
     dap_types::{DapId, RunDebugConfig},
-    plugin::{PluginId, VoltID},
+    plugin::{PluginCommand, PluginId, VoltID},
     proxy::ProxyStatus,
     terminal::{TermId, TerminalProfile},
 };
@@ -47,10 +47,12 @@ pub enum CommandKind {
     Focus(FocusCommand),
     MotionMode(MotionModeCommand),
     MultiSelection(MultiSelectionCommand),
+    /// A command registered by a plugin, run by the proxy.
+    Plugin(PluginCommand),
 }
 
 impl CommandKind {
-    pub fn desc(&self) -> Option<&'static str> {
+    pub fn desc(&self) -> Option<&str> {
         match &self {
             CommandKind::Workbench(cmd) => cmd.get_message(),
             CommandKind::Edit(cmd) => cmd.get_message(),
@@ -59,10 +61,11 @@ pub fn desc(&self) -> Option<&'static str> {
             CommandKind::Focus(cmd) => cmd.get_message(),
             CommandKind::MotionMode(cmd) => cmd.get_message(),
             CommandKind::MultiSelection(cmd) => cmd.get_message(),
+            CommandKind::Plugin(cmd) => Some(&cmd.title),
         }
     }
 
-    pub fn str(&self) -> &'static str {
+    pub fn str(&self) -> &str {
         match &self {
             CommandKind::Workbench(cmd) => cmd.into(),
             CommandKind::Edit(cmd) => cmd.into(),
@@ -71,6 +74,7 @@ pub fn str(&self) -> &'static str {
             CommandKind::Focus(cmd) => cmd.into(),
             CommandKind::MotionMode(cmd) => cmd.into(),
             CommandKind::MultiSelection(cmd) => cmd.into(),
+            CommandKind::Plugin(cmd) => &cmd.command,
         }
     }
 }
@@ -261,6 +265,22 @@ pub enum LapceWorkbenchCommand {
     #[strum(message = "Open Keyboard Shortcuts File")]
     OpenKeyboardShortcutsFile,
 
+    #[strum(serialize = "import_vscode_keybindings")]
+    #[strum(message = "Import VS Code Keybindings")]
+    ImportVsCodeKeybindings,
+
+    #[strum(serialize = "set_up_settings_sync")]
+    #[strum(message = "Set Up Settings Sync")]
+    SetUpSettingsSync,
+
+    #[strum(serialize = "sync_settings")]
+    #[strum(message = "Sync Settings")]
+    SyncSettings,
+
+    #[strum(serialize = "turn_off_settings_sync")]
+    #[strum(message = "Turn Off Settings Sync")]
+    TurnOffSettingsSync,
+
     #[strum(serialize = "open_log_file")]
     #[strum(message = "Open Log File")]
     OpenLogFile,
@@ -442,6 +462,26 @@ pub enum LapceWorkbenchCommand {
     #[strum(serialize = "toggle_panel_bottom_visual")]
     TogglePanelBottomVisual,
 
+    #[strum(message = "Focus Next Panel")]
+    #[strum(serialize = "focus_next_panel")]
+    FocusNextPanel,
+
+    #[strum(message = "Focus Previous Panel")]
+    #[strum(serialize = "focus_previous_panel")]
+    FocusPreviousPanel,
+
+    #[strum(message = "Increase Focused Panel Size")]
+    #[strum(serialize = "increase_panel_size")]
+    IncreasePanelSize,
+
+    #[strum(message = "Decrease Focused Panel Size")]
+    #[strum(serialize = "decrease_panel_size")]
+    DecreasePanelSize,
+
+    #[strum(message = "Move Focused Panel to Next Position")]
+    #[strum(serialize = "move_panel_to_next_position")]
+    MovePanelToNextPosition,
+
     // Focus toggle commands
     #[strum(message = "Toggle Terminal Focus")]
     #[strum(serialize = "toggle_terminal_focus")]
@@ -520,10 +560,18 @@ pub enum LapceWorkbenchCommand {
     #[strum(message = "Export current settings to a theme file")]
     ExportCurrentThemeSettings,
 
+    #[strum(serialize = "import_vscode_theme")]
+    #[strum(message = "Import VS Code Color Theme")]
+    ImportVsCodeTheme,
+
     #[strum(serialize = "install_theme")]
     #[strum(message = "Install current theme file")]
     InstallTheme,
 
+    #[strum(serialize = "install_volt_from_path")]
+    #[strum(message = "Install Plugin from File")]
+    InstallVoltFromPath,
+
     #[strum(serialize = "change_file_language")]
     #[strum(message = "Change current file language")]
     ChangeFileLanguage,
@@ -532,6 +580,38 @@ pub enum LapceWorkbenchCommand {
     #[strum(message = "Change current file line ending")]
     ChangeFileLineEnding,
 
+    #[strum(serialize = "change_file_encoding")]
+    #[strum(message = "Change current file encoding")]
+    ChangeFileEncoding,
+
+    #[strum(serialize = "reopen_with_encoding")]
+    #[strum(message = "Reopen with Encoding")]
+    ReopenWithEncoding,
+
+    #[strum(serialize = "save_with_encoding")]
+    #[strum(message = "Save with Encoding")]
+    SaveWithEncoding,
+
+    #[strum(serialize = "go_to_offset")]
+    #[strum(message = "Go to Offset")]
+    GoToOffset,
+
+    #[strum(serialize = "search_bytes")]
+    #[strum(message = "Search Bytes")]
+    SearchBytes,
+
+    #[strum(serialize = "toggle_hex_insert_mode")]
+    #[strum(message = "Toggle Hex Editor Insert Mode")]
+    ToggleHexInsertMode,
+
+    #[strum(serialize = "toggle_svg_source")]
+    #[strum(message = "Toggle SVG Source")]
+    ToggleSvgSource,
+
+    #[strum(serialize = "markdown_preview_to_side")]
+    #[strum(message = "Open Markdown Preview to the Side")]
+    MarkdownPreviewToSide,
+
     #[strum(serialize = "next_editor_tab")]
     #[strum(message = "Next Editor Tab")]
     NextEditorTab,
@@ -7,9 +7,11 @@
 use ::core::slice;
 use floem::{peniko::Color, prelude::palette::css};
 use itertools::Itertools;
-use lapce_core::directory::Directory;
+use lapce_core::{directory::Directory, language::LapceLanguage};
 use lapce_proxy::plugin::wasi::find_all_volts;
-use lapce_rpc::plugin::VoltID;
+use lapce_rpc::plugin::{
+    DEBUGGERS_SECTION, LANGUAGE_SERVERS_SECTION, VoltID, VoltKeymap,
+};
 use lsp_types::{CompletionItemKind, SymbolKind};
 use once_cell::sync::Lazy;
 use parking_lot::RwLock;
@@ -20,25 +22,31 @@
 use self::{
     color::LapceColor,
     color_theme::{ColorThemeConfig, ThemeColor, ThemeColorPreference},
-    core::CoreConfig,
-    editor::{EditorConfig, SCALE_OR_SIZE_LIMIT, WrapStyle},
+    core::{Appearance, CoreConfig},
+    editor::{EditorConfig, Rulers, SCALE_OR_SIZE_LIMIT, WrapStyle},
+    font::{FontContext, FontSettings, Fonts, parse_font_features},
     icon::LapceIcons,
     icon_theme::IconThemeConfig,
     svg::SvgStore,
     terminal::TerminalConfig,
     ui::UIConfig,
 };
-use crate::workspace::{LapceWorkspace, LapceWorkspaceType};
+use crate::{
+    keypress::KEYMAP_PRESETS,
+    workspace::{LapceWorkspace, LapceWorkspaceType},
+};
 
 pub mod color;
 pub mod color_theme;
 pub mod core;
 pub mod editor;
+pub mod font;
 pub mod icon;
 pub mod icon_theme;
 pub mod svg;
 pub mod terminal;
 pub mod ui;
+pub mod vscode_theme;
 pub mod watcher;
 
 pub const LOGO: &str = include_str!("../../extra/images/logo.svg");
@@ -48,6 +56,10 @@
 const DEFAULT_ICON_THEME: &str = include_str!("../../defaults/icon-theme.toml");
 
 static DEFAULT_CONFIG: Lazy<config::Config> = Lazy::new(LapceConfig::default_config);
+/// The appearance the OS last reported, which picks between the light and
+/// dark color themes.
+static OS_APPEARANCE: Lazy<RwLock<Option<Appearance>>> =
+    Lazy::new(|| RwLock::new(None));
 static DEFAULT_LAPCE_CONFIG: Lazy<LapceConfig> =
     Lazy::new(LapceConfig::default_lapce_config);
 
@@ -113,6 +125,9 @@ pub struct LapceConfig {
     #[serde(skip)]
     pub available_icon_themes:
         HashMap<String, (String, config::Config, Option<PathBuf>)>,
+    /// Keybindings declared by the enabled volts.
+    #[serde(skip)]
+    pub volt_keymaps: Vec<(VoltID, VoltKeymap)>,
     // #[serde(skip)]
     // tab_layout_info: Arc<RwLock<HashMap<(FontFamily, usize), f64>>>,
     #[serde(skip)]
@@ -126,6 +141,13 @@ pub struct LapceConfig {
     /// The couple names for the wrap style
     #[serde(skip)]
     wrap_style_list: im::Vector<String>,
+    /// The fonts of the editor, terminal, inlay hints and error lens,
+    /// resolved from their settings.
+    #[serde(skip)]
+    fonts: Arc<Fonts>,
+    /// The ruler columns of every language, resolved from the settings.
+    #[serde(skip)]
+    rulers: Arc<Rulers>,
 }
 
 impl LapceConfig {
@@ -147,6 +169,8 @@ pub fn load(
             Self::load_color_themes(disabled_volts, extra_plugin_paths);
         lapce_config.available_icon_themes =
             Self::load_icon_themes(disabled_volts, extra_plugin_paths);
+        lapce_config.volt_keymaps =
+            Self::load_plugin_keymaps(disabled_volts, extra_plugin_paths);
         lapce_config.resolve_theme(workspace);
 
         lapce_config.color_theme_list = lapce_config
@@ -232,6 +256,34 @@ fn merge_config(
         config
     }
 
+    /// Replaces the settings tables that declare programs to run with the
+    /// ones in the user's settings.toml, so that opening a folder can't start
+    /// the language servers or debug adapters in its `.lapce/settings.toml`.
+    fn keep_user_sections(
+        plugins: &mut HashMap<String, HashMap<String, serde_json::Value>>,
+    ) {
+        let user_config = Self::settings_file().and_then(|path| {
+            config::Config::builder()
+                .add_source(config::File::from(path.as_path()).required(false))
+                .build()
+                .ok()
+        });
+        for section in [LANGUAGE_SERVERS_SECTION, DEBUGGERS_SECTION] {
+            match user_config.as_ref().and_then(|config| {
+                config
+                    .get::<HashMap<String, serde_json::Value>>(section)
+                    .ok()
+            }) {
+                Some(declared) => {
+                    plugins.insert(section.to_string(), declared);
+                }
+                None => {
+                    plugins.remove(section);
+                }
+            }
+        }
+    }
+
     fn update_id(&mut self) {
         self.id = std::time::SystemTime::now()
             .duration_since(std::time::UNIX_EPOCH)
@@ -255,15 +307,22 @@ fn default_lapce_config() -> LapceConfig {
         default_lapce_config.color_theme = DEFAULT_DARK_THEME_COLOR_CONFIG.clone();
         default_lapce_config.icon_theme = DEFAULT_ICON_THEME_ICON_CONFIG.clone();
         default_lapce_config.resolve_colors(None);
+        default_lapce_config.resolve_fonts();
+        default_lapce_config.resolve_rulers();
         default_lapce_config
     }
 
     fn resolve_theme(&mut self, workspace: &LapceWorkspace) {
+        let color_theme = self.active_color_theme().1.to_string();
+        self.resolve_theme_with(workspace, &color_theme);
+    }
+
+    fn resolve_theme_with(&mut self, workspace: &LapceWorkspace, color_theme: &str) {
         let default_lapce_config = DEFAULT_LAPCE_CONFIG.clone();
 
         let color_theme_config = self
             .available_color_themes
-            .get(&self.core.color_theme.to_lowercase())
+            .get(&color_theme.to_lowercase())
             .map(|(_, config)| config)
             .unwrap_or(&DEFAULT_DARK_THEME_CONFIG);
 
@@ -298,7 +357,10 @@ fn resolve_theme(&mut self, workspace: &LapceWorkspace) {
             }
             self.plugins = new.plugins;
         }
+        Self::keep_user_sections(&mut self.plugins);
         self.resolve_colors(Some(&default_lapce_config));
+        self.resolve_fonts();
+        self.resolve_rulers();
         self.update_id();
     }
 
@@ -328,11 +390,48 @@ pub fn default_color_theme(&self) -> &ColorThemeConfig {
         &DEFAULT_DARK_THEME_COLOR_CONFIG
     }
 
+    /// The bundled light or dark theme.
+    pub fn bundled_color_theme(light: bool) -> ColorThemeConfig {
+        if !light {
+            return DEFAULT_DARK_THEME_COLOR_CONFIG.clone();
+        }
+        let (_, theme) = Self::load_color_theme_from_str(DEFAULT_LIGHT_THEME)
+            .expect("Failed to load default light theme");
+        theme
+            .get::<ColorThemeConfig>("color-theme")
+            .expect("Failed to load default light theme")
+    }
+
     /// Set the active color theme.
     /// Note that this does not save the config.
     pub fn set_color_theme(&mut self, workspace: &LapceWorkspace, theme: &str) {
         self.core.color_theme = theme.to_string();
-        self.resolve_theme(workspace);
+        self.resolve_theme_with(workspace, theme);
+    }
+
+    /// Records the light or dark mode the OS reported. Returns whether it
+    /// changed, in which case the config should be reloaded.
+    pub fn set_os_appearance(appearance: Appearance) -> bool {
+        let mut os_appearance = OS_APPEARANCE.write();
+        let changed = *os_appearance != Some(appearance);
+        *os_appearance = Some(appearance);
+        changed
+    }
+
+    /// The setting that picks the color theme right now, following the OS
+    /// appearance and `color-theme-schedule`, and the theme it names.
+    pub fn active_color_theme(&self) -> (&'static str, &str) {
+        self.core
+            .active_color_theme(*OS_APPEARANCE.read(), chrono::Local::now().time())
+    }
+
+    /// Whether the schedule has moved on to another color theme than the one
+    /// that is loaded.
+    pub fn color_theme_outdated(&self) -> bool {
+        let (_, name) = self.active_color_theme();
+        self.available_color_themes
+            .contains_key(&name.to_lowercase())
+            && !name.eq_ignore_ascii_case(&self.color_theme.name)
     }
 
     /// Set the active icon theme.  
@@ -508,6 +607,23 @@ fn load_plugin_color_themes(
         themes
     }
 
+    fn load_plugin_keymaps(
+        disabled_volts: &[VoltID],
+        extra_plugin_paths: &[PathBuf],
+    ) -> Vec<(VoltID, VoltKeymap)> {
+        find_all_volts(extra_plugin_paths)
+            .into_iter()
+            .filter(|meta| !disabled_volts.contains(&meta.id()))
+            .flat_map(|meta| {
+                let id = meta.id();
+                meta.keymaps
+                    .into_iter()
+                    .flatten()
+                    .map(move |keymap| (id.clone(), keymap))
+            })
+            .collect()
+    }
+
     fn load_plugin_icon_themes(
         disabled_volts: &[VoltID],
         extra_plugin_paths: &[PathBuf],
@@ -606,6 +722,22 @@ pub fn ui_svg(&self, icon: &'static str) -> String {
         })
     }
 
+    /// Like [`Self::ui_svg`], but for icon names that come from plugins and
+    /// might not exist.
+    pub fn ui_svg_by_name(&self, icon: &str) -> Option<String> {
+        self.icon_theme
+            .ui
+            .get(icon)
+            .and_then(|path| {
+                let path = self.icon_theme.path.join(path);
+                self.svg_store.write().get_svg_on_disk(&path)
+            })
+            .or_else(|| {
+                let name = DEFAULT_ICON_THEME_ICON_CONFIG.ui.get(icon)?;
+                Some(self.svg_store.write().get_default_svg(name))
+            })
+    }
+
     pub fn files_svg(&self, paths: &[&Path]) -> (String, Option<Color>) {
         let svg = self
             .icon_theme
@@ -713,6 +845,75 @@ pub fn terminal_font_family(&self) -> &str {
         }
     }
 
+    /// The font family chain and OpenType features of `context`.
+    pub fn font(&self, context: FontContext) -> &FontSettings {
+        self.fonts.get(context)
+    }
+
+    /// Empty font settings fall back like the font sizes do: the terminal and
+    /// inlay hints to the editor, and the error lens to the inlay hints.
+    fn resolve_fonts(&mut self) {
+        let features = |s: &str| {
+            let (features, errors) = parse_font_features(s);
+            for err in errors {
+                error!("{err}");
+            }
+            features
+        };
+        let editor = &self.editor;
+        let inlay_hint_family =
+            non_empty(&editor.inlay_hint_font_family, &editor.font_family);
+        let inlay_hint_features =
+            non_empty(&editor.inlay_hint_font_features, &editor.font_features);
+        let fonts = Fonts {
+            editor: FontSettings::new(
+                &editor.font_family,
+                &features(&editor.font_features),
+                editor.font_ligatures,
+                true,
+            ),
+            terminal: FontSettings::new(
+                self.terminal_font_family(),
+                &features(non_empty(
+                    &self.terminal.font_features,
+                    &editor.font_features,
+                )),
+                self.terminal.font_ligatures,
+                true,
+            ),
+            inlay_hint: FontSettings::new(
+                inlay_hint_family,
+                &features(inlay_hint_features),
+                editor.font_ligatures,
+                false,
+            ),
+            error_lens: FontSettings::new(
+                non_empty(&editor.error_lens_font_family, inlay_hint_family),
+                &features(non_empty(
+                    &editor.error_lens_font_features,
+                    inlay_hint_features,
+                )),
+                editor.font_ligatures,
+                false,
+            ),
+        };
+        self.fonts = Arc::new(fonts);
+    }
+
+    /// The columns to show rulers at in `language` files.
+    pub fn rulers(&self, language: LapceLanguage) -> &[usize] {
+        self.rulers.columns(language)
+    }
+
+    fn resolve_rulers(&mut self) {
+        let (rulers, errors) =
+            Rulers::parse(&self.editor.rulers, &self.editor.language_rulers);
+        for err in errors {
+            error!("{err}");
+        }
+        self.rulers = Arc::new(rulers);
+    }
+
     pub fn terminal_font_size(&self) -> usize {
         if self.terminal.font_size > 0 {
             self.terminal.font_size
@@ -898,6 +1099,19 @@ pub fn get_dropdown_info(&self, kind: &str, key: &str) -> Option<DropdownInfo> {
                     .unwrap_or(0),
                 items: self.icon_theme_list.clone(),
             }),
+            ("core", "keymap-preset") => {
+                let items: im::Vector<String> = std::iter::once("default")
+                    .chain(KEYMAP_PRESETS.iter().map(|(name, _)| *name))
+                    .map(str::to_string)
+                    .collect();
+                Some(DropdownInfo {
+                    active_index: items
+                        .iter()
+                        .position(|s| s == &self.core.keymap_preset)
+                        .unwrap_or(0),
+                    items,
+                })
+            }
             ("editor", "wrap-style") => Some(DropdownInfo {
                 // TODO: it would be better to have the text not be the default kebab-case when
                 // displayed in settings, but we would need to map back from the dropdown's value
@@ -1018,3 +1232,7 @@ pub fn update_file(
         Some(())
     }
 }
+
+fn non_empty<'a>(s: &'a str, fallback: &'a str) -> &'a str {
+    if s.is_empty() { fallback } else { s }
+}
@@ -73,6 +73,17 @@ impl LapceColor {
     pub const EDITOR_LINK: &'static str = "editor.link";
     pub const EDITOR_VISIBLE_WHITESPACE: &'static str = "editor.visible_whitespace";
     pub const EDITOR_INDENT_GUIDE: &'static str = "editor.indent_guide";
+    pub const EDITOR_INDENT_GUIDE_ACTIVE: &'static str =
+        "editor.indent_guide.active";
+    pub const EDITOR_INDENT_GUIDE_LEVELS: [&'static str; 6] = [
+        "editor.indent_guide.level.1",
+        "editor.indent_guide.level.2",
+        "editor.indent_guide.level.3",
+        "editor.indent_guide.level.4",
+        "editor.indent_guide.level.5",
+        "editor.indent_guide.level.6",
+    ];
+    pub const EDITOR_RULER: &'static str = "editor.ruler";
     pub const EDITOR_DRAG_DROP_BACKGROUND: &'static str =
         "editor.drag_drop_background";
     pub const EDITOR_STICKY_HEADER_BACKGROUND: &'static str =
@@ -1,13 +1,120 @@
+use chrono::NaiveTime;
 use serde::{Deserialize, Serialize};
 use structdesc::FieldNames;
 
+/// Whether light or dark colors are wanted, as reported by the OS or picked
+/// by `color-theme-schedule`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Appearance {
+    Light,
+    Dark,
+}
+
+impl Appearance {
+    /// Asks the OS whether it's in light or dark mode, so that the first
+    /// window opens with the right color theme instead of waiting for a
+    /// change to be reported.
+    pub fn from_os() -> Option<Self> {
+        #[cfg(target_os = "macos")]
+        {
+            // Only set while in dark mode, so reading it fails otherwise
+            let output = std::process::Command::new("defaults")
+                .args(["read", "-g", "AppleInterfaceStyle"])
+                .output()
+                .ok()?;
+            let dark = output.status.success()
+                && String::from_utf8_lossy(&output.stdout).trim() == "Dark";
+            Some(if dark {
+                Appearance::Dark
+            } else {
+                Appearance::Light
+            })
+        }
+
+        #[cfg(windows)]
+        {
+            use std::os::windows::process::CommandExt;
+
+            let output = std::process::Command::new("reg")
+                .args([
+                    "query",
+                    r"HKCU\Software\Microsoft\Windows\CurrentVersion\Themes\Personalize",
+                    "/v",
+                    "AppsUseLightTheme",
+                ])
+                .creation_flags(0x08000000) // CREATE_NO_WINDOW
+                .output()
+                .ok()?;
+            if !output.status.success() {
+                return None;
+            }
+            match String::from_utf8_lossy(&output.stdout)
+                .split_whitespace()
+                .last()
+            {
+                Some("0x0") => Some(Appearance::Dark),
+                Some("0x1") => Some(Appearance::Light),
+                _ => None,
+            }
+        }
+
+        #[cfg(not(any(target_os = "macos", windows)))]
+        {
+            // The freedesktop preference, as GNOME and most desktops expose it
+            let output = std::process::Command::new("gsettings")
+                .args(["get", "org.gnome.desktop.interface", "color-scheme"])
+                .output()
+                .ok()?;
+            if !output.status.success() {
+                return None;
+            }
+            let scheme = String::from_utf8_lossy(&output.stdout);
+            if scheme.contains("dark") {
+                Some(Appearance::Dark)
+            } else if scheme.contains("light") {
+                Some(Appearance::Light)
+            } else {
+                None
+            }
+        }
+    }
+}
+
 #[derive(FieldNames, Debug, Clone, Deserialize, Serialize, Default)]
 #[serde(rename_all = "kebab-case")]
 pub struct CoreConfig {
     #[field_names(desc = "Enable modal editing (Vim like)")]
     pub modal: bool,
+    #[field_names(
+        desc = "Keymaps of another editor to use on top of the defaults: vscode, sublime, jetbrains or emacs. Bindings in keymaps.toml still take priority."
+    )]
+    pub keymap_preset: String,
     #[field_names(desc = "Set the color theme of Lapce")]
     pub color_theme: String,
+    #[field_names(
+        desc = "The color theme used when the OS is in light mode. Leave empty to always use the color theme."
+    )]
+    pub color_theme_light: String,
+    #[field_names(
+        desc = "The color theme used when the OS is in dark mode. Leave empty to always use the color theme."
+    )]
+    pub color_theme_dark: String,
+    #[field_names(
+        desc = "The color theme used in light mode when high contrast is preferred"
+    )]
+    pub color_theme_high_contrast_light: String,
+    #[field_names(
+        desc = "The color theme used in dark mode when high contrast is preferred"
+    )]
+    pub color_theme_high_contrast_dark: String,
+    #[field_names(
+        desc = "Use the high contrast variants of the light and dark color themes"
+    )]
+    pub prefer_high_contrast: bool,
+    #[field_names(
+        desc = "Switch between the light and dark color themes at fixed times instead of following the OS, e.g. \"07:00-19:00\" for light mode during the day. Leave empty to follow the OS."
+    )]
+    pub color_theme_schedule: String,
     #[field_names(desc = "Set the icon theme of Lapce")]
     pub icon_theme: String,
     #[field_names(
@@ -22,4 +129,134 @@ pub struct CoreConfig {
         desc = "Enable auto-reload for the plugin when its configuration changes."
     )]
     pub auto_reload_plugin: bool,
+    #[field_names(
+        desc = "How often to check for plugin updates, in minutes. Set to 0 to disable update checks."
+    )]
+    pub plugin_update_check_interval: u64,
+    /// Plugin registries to search, in order of priority. Each entry is the url
+    /// of a registry server, the url of a static `index.json` or a local
+    /// directory.
+    #[field_names(skip)]
+    pub plugin_registries: Vec<String>,
+}
+
+impl CoreConfig {
+    /// Whether the schedule, or else the OS, asks for light or dark colors.
+    fn appearance(
+        &self,
+        os: Option<Appearance>,
+        now: NaiveTime,
+    ) -> Option<Appearance> {
+        let Some((light, dark)) = parse_schedule(&self.color_theme_schedule) else {
+            return os;
+        };
+        let is_light = if light <= dark {
+            now >= light && now < dark
+        } else {
+            // light mode runs over midnight
+            now >= light || now < dark
+        };
+        Some(if is_light {
+            Appearance::Light
+        } else {
+            Appearance::Dark
+        })
+    }
+
+    /// The setting that picks the color theme right now and the theme it
+    /// names. The high contrast variants fall back to the plain light and
+    /// dark ones, and those to `color-theme`, when they're left empty.
+    pub fn active_color_theme(
+        &self,
+        os: Option<Appearance>,
+        now: NaiveTime,
+    ) -> (&'static str, &str) {
+        let variants = match self.appearance(os, now) {
+            Some(Appearance::Light) => [
+                (
+                    "color-theme-high-contrast-light",
+                    &self.color_theme_high_contrast_light,
+                ),
+                ("color-theme-light", &self.color_theme_light),
+            ],
+            Some(Appearance::Dark) => [
+                (
+                    "color-theme-high-contrast-dark",
+                    &self.color_theme_high_contrast_dark,
+                ),
+                ("color-theme-dark", &self.color_theme_dark),
+            ],
+            None => return ("color-theme", &self.color_theme),
+        };
+        variants
+            .into_iter()
+            .skip(if self.prefer_high_contrast { 0 } else { 1 })
+            .find(|(_, name)| !name.is_empty())
+            .map(|(key, name)| (key, name.as_str()))
+            .unwrap_or(("color-theme", &self.color_theme))
+    }
+}
+
+/// Parses a schedule like `07:00-19:00` into the start of light mode and
+/// the start of dark mode.
+fn parse_schedule(schedule: &str) -> Option<(NaiveTime, NaiveTime)> {
+    let (light, dark) = schedule.split_once('-')?;
+    let parse = |time: &str| NaiveTime::parse_from_str(time.trim(), "%H:%M").ok();
+    Some((parse(light)?, parse(dark)?))
+}
+
+#[cfg(test)]
+mod tests {
+    use chrono::NaiveTime;
+
+    use super::{Appearance, CoreConfig};
+
+    #[test]
+    fn test_active_color_theme() {
+        let noon = NaiveTime::from_hms_opt(12, 0, 0).unwrap();
+        let night = NaiveTime::from_hms_opt(23, 0, 0).unwrap();
+        let mut config = CoreConfig {
+            color_theme: "Lapce Dark".to_string(),
+            ..Default::default()
+        };
+        assert_eq!(
+            config.active_color_theme(Some(Appearance::Light), noon),
+            ("color-theme", "Lapce Dark")
+        );
+
+        config.color_theme_light = "Lapce Light".to_string();
+        config.color_theme_high_contrast_dark = "High Contrast".to_string();
+        assert_eq!(
+            config.active_color_theme(Some(Appearance::Light), noon),
+            ("color-theme-light", "Lapce Light")
+        );
+        assert_eq!(
+            config.active_color_theme(None, noon),
+            ("color-theme", "Lapce Dark")
+        );
+        assert_eq!(
+            config.active_color_theme(Some(Appearance::Dark), noon),
+            ("color-theme", "Lapce Dark")
+        );
+
+        config.prefer_high_contrast = true;
+        assert_eq!(
+            config.active_color_theme(Some(Appearance::Dark), noon),
+            ("color-theme-high-contrast-dark", "High Contrast")
+        );
+        assert_eq!(
+            config.active_color_theme(Some(Appearance::Light), noon),
+            ("color-theme-light", "Lapce Light")
+        );
+
+        config.color_theme_schedule = "07:00-19:00".to_string();
+        assert_eq!(
+            config.active_color_theme(Some(Appearance::Dark), noon),
+            ("color-theme-light", "Lapce Light")
+        );
+        assert_eq!(
+            config.active_color_theme(Some(Appearance::Light), night),
+            ("color-theme-high-contrast-dark", "High Contrast")
+        );
+    }
 }
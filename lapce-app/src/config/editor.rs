@@ -1,4 +1,8 @@
+use std::collections::HashMap;
+
+use anyhow::anyhow;
 use floem::views::editor::text::RenderWhitespace;
+use lapce_core::language::LapceLanguage;
 use serde::{Deserialize, Serialize};
 use structdesc::FieldNames;
 
@@ -60,8 +64,16 @@ fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
 #[derive(FieldNames, Debug, Clone, Deserialize, Serialize, Default)]
 #[serde(rename_all = "kebab-case")]
 pub struct EditorConfig {
-    #[field_names(desc = "Set the editor font family")]
+    #[field_names(
+        desc = "Set the editor font family. Fonts separated by commas are used for the characters missing from the ones before, e.g. `Fira Code, Noto Sans CJK SC`."
+    )]
     pub font_family: String,
+    #[field_names(
+        desc = "Set the OpenType features of the editor font, separated by commas, e.g. `ss01, zero, -calt` or `cv01=2`"
+    )]
+    pub font_features: String,
+    #[field_names(desc = "If the editor font should use ligatures")]
+    pub font_ligatures: bool,
     #[field_names(desc = "Set the editor font size")]
     font_size: usize,
     #[field_names(desc = "Set the font size in the code glance")]
@@ -153,6 +165,10 @@ pub struct EditorConfig {
         desc = "Set the inlay hint font family. If empty, it uses the editor font family."
     )]
     pub inlay_hint_font_family: String,
+    #[field_names(
+        desc = "Set the inlay hint font features. If empty, it uses the editor font features."
+    )]
+    pub inlay_hint_font_features: String,
     #[field_names(
         desc = "Set the inlay hint font size. If less than 5 or greater than editor font size, it uses the editor font size."
     )]
@@ -178,6 +194,10 @@ pub struct EditorConfig {
         desc = "Set error lens font family. If empty, it uses the inlay hint font family."
     )]
     pub error_lens_font_family: String,
+    #[field_names(
+        desc = "Set the error lens font features. If empty, it uses the inlay hint font features."
+    )]
+    pub error_lens_font_features: String,
     #[field_names(
         desc = "Set the error lens font size. If 0 it uses the inlay hint font size."
     )]
@@ -214,6 +234,22 @@ pub struct EditorConfig {
     pub render_whitespace: RenderWhitespace,
     #[field_names(desc = "Whether the editor show indent guide.")]
     pub show_indent_guide: bool,
+    #[field_names(
+        desc = "Whether indent guides are colored by their indent level, with the `editor.indent_guide.level.1` to `editor.indent_guide.level.6` theme colors"
+    )]
+    pub indent_guide_colorization: bool,
+    #[field_names(
+        desc = "If the indent guide of the scope around the cursor is highlighted. The scope comes from the syntax tree when the language has one, else from the indentation."
+    )]
+    pub highlight_active_indent_guide: bool,
+    #[field_names(
+        desc = "Show vertical rulers at these columns, separated by commas, e.g. `80, 100`"
+    )]
+    pub rulers: String,
+    #[field_names(
+        desc = "Set the ruler columns of specific languages, overriding `Rulers`, e.g. `rust: 100; python: 79, 88; markdown:`"
+    )]
+    pub language_rulers: String,
     #[field_names(
         desc = "Set the auto save delay (in milliseconds), Set to 0 to completely disable"
     )]
@@ -240,6 +276,10 @@ pub struct EditorConfig {
     pub bracket_pair_colorization: bool,
     #[field_names(desc = "Bracket colorization Limit")]
     pub bracket_colorization_limit: u64,
+    #[field_names(
+        desc = "Files larger than this many megabytes are opened in large-file mode, which loads them in pages and turns off syntax highlighting and language server features (0 to disable)"
+    )]
+    pub large_file_threshold: u64,
     #[field_names(
         desc = "Glob patterns for excluding files and folders (in file explorer)"
     )]
@@ -304,3 +344,79 @@ pub fn blink_interval(&self) -> u64 {
         self.blink_interval.max(200)
     }
 }
+
+/// The ruler columns from the `rulers` and `language-rulers` settings.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct Rulers {
+    default: Vec<usize>,
+    languages: HashMap<LapceLanguage, Vec<usize>>,
+}
+
+impl Rulers {
+    /// Parses the settings, skipping the invalid columns and languages.
+    pub fn parse(rulers: &str, language_rulers: &str) -> (Self, Vec<anyhow::Error>) {
+        let mut errors = Vec::new();
+        let default = parse_columns(rulers, &mut errors);
+
+        let mut languages = HashMap::new();
+        for entry in language_rulers
+            .split(';')
+            .map(str::trim)
+            .filter(|entry| !entry.is_empty())
+        {
+            let Some((language, columns)) = entry.split_once(':') else {
+                errors.push(anyhow!(
+                    "invalid language rulers {entry}, expected `language: columns`"
+                ));
+                continue;
+            };
+            let Some(language) = LapceLanguage::from_name(language.trim()) else {
+                errors
+                    .push(anyhow!("unknown language {} in rulers", language.trim()));
+                continue;
+            };
+            languages.insert(language, parse_columns(columns, &mut errors));
+        }
+
+        (Self { default, languages }, errors)
+    }
+
+    pub fn columns(&self, language: LapceLanguage) -> &[usize] {
+        self.languages.get(&language).unwrap_or(&self.default)
+    }
+}
+
+fn parse_columns(s: &str, errors: &mut Vec<anyhow::Error>) -> Vec<usize> {
+    let mut columns = Vec::new();
+    for column in s.split(',').map(str::trim).filter(|c| !c.is_empty()) {
+        match column.parse() {
+            Ok(column) => columns.push(column),
+            Err(_) => errors.push(anyhow!("invalid ruler column {column}")),
+        }
+    }
+    columns.sort_unstable();
+    columns.dedup();
+    columns
+}
+
+#[cfg(test)]
+mod tests {
+    use lapce_core::language::LapceLanguage;
+
+    use super::Rulers;
+
+    #[test]
+    fn test_rulers() {
+        let (rulers, errors) =
+            Rulers::parse("100, 80", "rust: 100; Python: 88, 79; markdown:");
+        assert!(errors.is_empty());
+        assert_eq!(rulers.columns(LapceLanguage::Go), &[80, 100]);
+        assert_eq!(rulers.columns(LapceLanguage::Rust), &[100]);
+        assert_eq!(rulers.columns(LapceLanguage::Python), &[79, 88]);
+        assert!(rulers.columns(LapceLanguage::Markdown).is_empty());
+
+        let (rulers, errors) = Rulers::parse("80, x", "nolang: 1; rust 100");
+        assert_eq!(rulers.columns(LapceLanguage::Rust), &[80]);
+        assert_eq!(errors.len(), 3);
+    }
+}
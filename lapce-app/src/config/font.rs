@@ -0,0 +1,227 @@
+use std::{fmt, str::FromStr};
+
+use anyhow::{Result, anyhow};
+use floem::text::{Attrs, FamilyOwned, FeatureTag, FontFeatures};
+
+/// The OpenType features that turning ligatures off disables.
+const LIGATURE_FEATURES: [&[u8; 4]; 4] = [b"liga", b"clig", b"calt", b"dlig"];
+
+/// The places that have their own font settings.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum FontContext {
+    Editor,
+    Terminal,
+    InlayHint,
+    ErrorLens,
+}
+
+/// An OpenType feature from a `font-features` setting. `ss01` or `+ss01`
+/// turns it on, `-calt` turns it off and `cv01=2` picks an alternate.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct FontFeature {
+    pub tag: [u8; 4],
+    pub value: u32,
+}
+
+impl FromStr for FontFeature {
+    type Err = anyhow::Error;
+
+    fn from_str(s: &str) -> Result<Self> {
+        let (tag, value) = if let Some(tag) = s.strip_prefix('-') {
+            (tag, 0)
+        } else if let Some((tag, value)) = s.split_once('=') {
+            let value = value
+                .trim()
+                .parse()
+                .map_err(|_| anyhow!("invalid value in font feature {s}"))?;
+            (tag.trim(), value)
+        } else {
+            (s.strip_prefix('+').unwrap_or(s), 1)
+        };
+
+        let tag: [u8; 4] = tag
+            .as_bytes()
+            .try_into()
+            .ok()
+            .filter(|tag: &[u8; 4]| tag.iter().all(|c| c.is_ascii_alphanumeric()))
+            .ok_or_else(|| {
+                anyhow!("invalid font feature {s}, expected a 4 letter tag")
+            })?;
+        Ok(Self { tag, value })
+    }
+}
+
+impl fmt::Display for FontFeature {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let tag = String::from_utf8_lossy(&self.tag);
+        match self.value {
+            0 => write!(f, "-{tag}"),
+            1 => write!(f, "{tag}"),
+            value => write!(f, "{tag}={value}"),
+        }
+    }
+}
+
+/// Parses a list of font features separated by commas or spaces, skipping
+/// the invalid ones.
+pub fn parse_font_features(s: &str) -> (Vec<FontFeature>, Vec<anyhow::Error>) {
+    let mut features = Vec::new();
+    let mut errors = Vec::new();
+    for feature in s
+        .split(|c: char| c == ',' || c.is_whitespace())
+        .filter(|feature| !feature.is_empty())
+    {
+        match feature.parse() {
+            Ok(feature) => features.push(feature),
+            Err(err) => errors.push(err),
+        }
+    }
+    (features, errors)
+}
+
+/// The font family chain and OpenType features of a [`FontContext`].
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct FontSettings {
+    family: Vec<FamilyOwned>,
+    features: Vec<FontFeature>,
+}
+
+impl FontSettings {
+    /// `family` is a comma separated list of fonts, where the later ones are
+    /// used for the characters missing from the earlier ones. Monospace fonts
+    /// always fall back to the system monospace font.
+    pub fn new(
+        family: &str,
+        features: &[FontFeature],
+        ligatures: bool,
+        monospace: bool,
+    ) -> Self {
+        let mut family: Vec<FamilyOwned> = FamilyOwned::parse_list(family).collect();
+        if monospace && !family.contains(&FamilyOwned::Monospace) {
+            family.push(FamilyOwned::Monospace);
+        }
+
+        let mut all_features = Vec::new();
+        if !ligatures {
+            all_features.extend(LIGATURE_FEATURES.iter().map(|tag| FontFeature {
+                tag: **tag,
+                value: 0,
+            }));
+        }
+        // Features given explicitly override the ligatures setting
+        for feature in features {
+            all_features.retain(|f: &FontFeature| f.tag != feature.tag);
+            all_features.push(*feature);
+        }
+
+        Self {
+            family,
+            features: all_features,
+        }
+    }
+
+    pub fn family(&self) -> &[FamilyOwned] {
+        &self.family
+    }
+
+    pub fn features(&self) -> &[FontFeature] {
+        &self.features
+    }
+
+    /// Sets the font family chain and features of `attrs`, replacing the
+    /// features it had.
+    pub fn attrs<'a>(&'a self, attrs: Attrs<'a>) -> Attrs<'a> {
+        let mut features = FontFeatures::new();
+        for feature in &self.features {
+            features.set(FeatureTag::new(&feature.tag), feature.value);
+        }
+        attrs.family(&self.family).font_features(features)
+    }
+}
+
+/// The fonts of every [`FontContext`], resolved from the settings.
+#[derive(Clone, Debug, Default)]
+pub struct Fonts {
+    pub editor: FontSettings,
+    pub terminal: FontSettings,
+    pub inlay_hint: FontSettings,
+    pub error_lens: FontSettings,
+}
+
+impl Fonts {
+    pub fn get(&self, context: FontContext) -> &FontSettings {
+        match context {
+            FontContext::Editor => &self.editor,
+            FontContext::Terminal => &self.terminal,
+            FontContext::InlayHint => &self.inlay_hint,
+            FontContext::ErrorLens => &self.error_lens,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_font_features() {
+        let (features, errors) = parse_font_features("calt, +ss01 -liga cv01=2");
+        assert!(errors.is_empty());
+        assert_eq!(
+            features,
+            vec![
+                FontFeature {
+                    tag: *b"calt",
+                    value: 1
+                },
+                FontFeature {
+                    tag: *b"ss01",
+                    value: 1
+                },
+                FontFeature {
+                    tag: *b"liga",
+                    value: 0
+                },
+                FontFeature {
+                    tag: *b"cv01",
+                    value: 2
+                },
+            ]
+        );
+        assert_eq!(
+            features.iter().map(|f| f.to_string()).collect::<Vec<_>>(),
+            vec!["calt", "ss01", "-liga", "cv01=2"]
+        );
+
+        let (features, errors) = parse_font_features("zero, ligatures, ss0=x");
+        assert_eq!(features.len(), 1);
+        assert_eq!(errors.len(), 2);
+    }
+
+    #[test]
+    fn test_font_settings() {
+        let (features, _) = parse_font_features("calt ss01");
+        let font =
+            FontSettings::new("Fira Code, Noto Sans CJK SC", &features, false, true);
+        assert_eq!(
+            font.family(),
+            &[
+                FamilyOwned::Name("Fira Code".into()),
+                FamilyOwned::Name("Noto Sans CJK SC".into()),
+                FamilyOwned::Monospace,
+            ]
+        );
+        // `calt` stays on, the other ligatures are turned off
+        assert_eq!(
+            font.features()
+                .iter()
+                .map(|f| f.to_string())
+                .collect::<Vec<_>>(),
+            vec!["-liga", "-clig", "-dlig", "calt", "ss01"]
+        );
+
+        let font = FontSettings::new("monospace", &[], true, true);
+        assert_eq!(font.family(), &[FamilyOwned::Monospace]);
+        assert!(font.features().is_empty());
+    }
+}
@@ -39,6 +39,8 @@ impl LapceIcons {
     pub const BREADCRUMB_SEPARATOR: &'static str = "breadcrumb_separator";
     pub const SYMBOL_COLOR: &'static str = "symbol_color";
     pub const TYPE_HIERARCHY: &'static str = "type_hierarchy";
+    pub const PLUGIN_VIEWS: &'static str = "plugin_views";
+    pub const OUTPUT: &'static str = "output";
 
     pub const FILE: &'static str = "file";
     pub const FILE_EXPLORER: &'static str = "file_explorer";
@@ -11,6 +11,12 @@ pub struct TerminalConfig {
         desc = "Set the terminal font family. If empty, it uses editor font family."
     )]
     pub font_family: String,
+    #[field_names(
+        desc = "Set the OpenType features of the terminal font. If empty, it uses the editor font features."
+    )]
+    pub font_features: String,
+    #[field_names(desc = "If the terminal font should use ligatures")]
+    pub font_ligatures: bool,
     #[field_names(
         desc = "Set the terminal font size, If 0, it uses editor font size."
     )]
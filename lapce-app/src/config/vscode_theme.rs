@@ -0,0 +1,577 @@
+//! Converts VS Code (and TextMate) color themes into Lapce color themes.
+//!
+//! The imported theme starts as a copy of the bundled theme of the same type,
+//! so the keys that can't be mapped keep their `$variable` references and
+//! follow the base colors taken from the VS Code theme.
+
+use std::{collections::BTreeMap, fs, path::Path};
+
+use anyhow::{Result, anyhow};
+use serde::Deserialize;
+use serde_json::Value;
+
+use super::{LapceConfig, color_theme::ColorThemeConfig};
+
+/// Base variables and the VS Code colors they are taken from, by priority.
+const BASE_COLORS: &[(&str, &[&str])] = &[
+    ("primary-background", &["editor.background"]),
+    (
+        "secondary-background",
+        &[
+            "sideBar.background",
+            "panel.background",
+            "activityBar.background",
+        ],
+    ),
+    (
+        "current-background",
+        &[
+            "list.activeSelectionBackground",
+            "list.hoverBackground",
+            "editor.lineHighlightBackground",
+        ],
+    ),
+    ("text", &["editor.foreground", "foreground"]),
+    (
+        "dim-text",
+        &["editorLineNumber.foreground", "descriptionForeground"],
+    ),
+    ("black", &["terminal.ansiBlack"]),
+    ("white", &["terminal.ansiWhite"]),
+    ("grey", &["terminal.ansiBrightBlack"]),
+    ("red", &["terminal.ansiRed", "errorForeground"]),
+    ("green", &["terminal.ansiGreen"]),
+    ("yellow", &["terminal.ansiYellow"]),
+    ("blue", &["terminal.ansiBlue"]),
+    ("cyan", &["terminal.ansiCyan"]),
+    ("magenta", &["terminal.ansiMagenta"]),
+    ("purple", &["terminal.ansiMagenta"]),
+    ("orange", &["terminal.ansiBrightYellow"]),
+];
+
+/// VS Code colors and the ui keys they set.
+const UI_COLORS: &[(&str, &[&str])] = &[
+    ("errorForeground", &["lapce.error"]),
+    ("editorWarning.foreground", &["lapce.warn"]),
+    ("widget.shadow", &["lapce.dropdown_shadow"]),
+    ("contrastBorder", &["lapce.border"]),
+    ("scrollbarSlider.background", &["lapce.scroll_bar"]),
+    ("button.background", &["lapce.button.primary.background"]),
+    ("button.foreground", &["lapce.button.primary.foreground"]),
+    ("tab.activeBackground", &["lapce.tab.active.background"]),
+    ("tab.activeForeground", &["lapce.tab.active.foreground"]),
+    ("tab.activeBorderTop", &["lapce.tab.active.underline"]),
+    ("tab.inactiveBackground", &["lapce.tab.inactive.background"]),
+    ("tab.inactiveForeground", &["lapce.tab.inactive.foreground"]),
+    ("tab.border", &["lapce.tab.separator"]),
+    ("activityBar.foreground", &["lapce.icon.active"]),
+    ("activityBar.inactiveForeground", &["lapce.icon.inactive"]),
+    ("editor.background", &["editor.background"]),
+    ("editor.foreground", &["editor.foreground"]),
+    ("editorLineNumber.foreground", &["editor.dim"]),
+    ("editorLineNumber.activeForeground", &["editor.focus"]),
+    ("editorCursor.foreground", &["editor.caret"]),
+    ("editor.selectionBackground", &["editor.selection"]),
+    ("editor.lineHighlightBackground", &["editor.current_line"]),
+    ("textLink.foreground", &["editor.link"]),
+    (
+        "editorWhitespace.foreground",
+        &["editor.visible_whitespace"],
+    ),
+    ("editorIndentGuide.background", &["editor.indent_guide"]),
+    (
+        "editorIndentGuide.background1",
+        &["editor.indent_guide", "editor.indent_guide.level.1"],
+    ),
+    (
+        "editorIndentGuide.background2",
+        &["editor.indent_guide.level.2"],
+    ),
+    (
+        "editorIndentGuide.background3",
+        &["editor.indent_guide.level.3"],
+    ),
+    (
+        "editorIndentGuide.background4",
+        &["editor.indent_guide.level.4"],
+    ),
+    (
+        "editorIndentGuide.background5",
+        &["editor.indent_guide.level.5"],
+    ),
+    (
+        "editorIndentGuide.background6",
+        &["editor.indent_guide.level.6"],
+    ),
+    (
+        "editorIndentGuide.activeBackground",
+        &["editor.indent_guide.active"],
+    ),
+    (
+        "editorIndentGuide.activeBackground1",
+        &["editor.indent_guide.active"],
+    ),
+    ("editorRuler.foreground", &["editor.ruler"]),
+    (
+        "editorStickyScroll.background",
+        &["editor.sticky_header_background"],
+    ),
+    ("editorInlayHint.foreground", &["inlay_hint.foreground"]),
+    ("editorInlayHint.background", &["inlay_hint.background"]),
+    ("editorError.foreground", &["error_lens.error.foreground"]),
+    (
+        "editorWarning.foreground",
+        &["error_lens.warning.foreground"],
+    ),
+    ("editorInfo.foreground", &["error_lens.other.foreground"]),
+    (
+        "editorGhostText.foreground",
+        &["completion_lens.foreground"],
+    ),
+    ("editorGutter.addedBackground", &["source_control.added"]),
+    (
+        "editorGutter.deletedBackground",
+        &["source_control.removed"],
+    ),
+    (
+        "editorGutter.modifiedBackground",
+        &["source_control.modified"],
+    ),
+    ("editorHoverWidget.background", &["hover.background"]),
+    ("editorWidget.background", &["tooltip.background"]),
+    ("editorWidget.foreground", &["tooltip.foreground"]),
+    ("quickInput.background", &["palette.background"]),
+    ("quickInput.foreground", &["palette.foreground"]),
+    (
+        "quickInputList.focusBackground",
+        &["palette.current.background"],
+    ),
+    (
+        "quickInputList.focusForeground",
+        &["palette.current.foreground"],
+    ),
+    ("editorSuggestWidget.background", &["completion.background"]),
+    (
+        "editorSuggestWidget.selectedBackground",
+        &["completion.current"],
+    ),
+    ("activityBar.background", &["activity.background"]),
+    ("activityBar.activeBackground", &["activity.current"]),
+    ("debugIcon.breakpointForeground", &["debug.breakpoint"]),
+    ("sideBar.background", &["panel.background"]),
+    ("sideBar.foreground", &["panel.foreground"]),
+    (
+        "list.activeSelectionBackground",
+        &["panel.current.background"],
+    ),
+    (
+        "list.activeSelectionForeground",
+        &["panel.current.foreground"],
+    ),
+    ("list.hoverBackground", &["panel.hovered.background"]),
+    ("list.hoverForeground", &["panel.hovered.foreground"]),
+    ("statusBar.background", &["status.background"]),
+    ("statusBar.foreground", &["status.foreground"]),
+    ("textBlockQuote.border", &["markdown.blockquote"]),
+    ("terminalCursor.foreground", &["terminal.cursor"]),
+    ("terminal.foreground", &["terminal.foreground"]),
+    ("terminal.background", &["terminal.background"]),
+    ("terminal.ansiWhite", &["terminal.white"]),
+    ("terminal.ansiBlack", &["terminal.black"]),
+    ("terminal.ansiRed", &["terminal.red"]),
+    ("terminal.ansiBlue", &["terminal.blue"]),
+    ("terminal.ansiGreen", &["terminal.green"]),
+    ("terminal.ansiYellow", &["terminal.yellow"]),
+    ("terminal.ansiCyan", &["terminal.cyan"]),
+    ("terminal.ansiMagenta", &["terminal.magenta"]),
+    ("terminal.ansiBrightWhite", &["terminal.bright_white"]),
+    ("terminal.ansiBrightRed", &["terminal.bright_red"]),
+    ("terminal.ansiBrightBlue", &["terminal.bright_blue"]),
+    ("terminal.ansiBrightGreen", &["terminal.bright_green"]),
+    ("terminal.ansiBrightYellow", &["terminal.bright_yellow"]),
+    ("terminal.ansiBrightCyan", &["terminal.bright_cyan"]),
+    ("terminal.ansiBrightMagenta", &["terminal.bright_magenta"]),
+    ("terminal.ansiBrightBlack", &["terminal.bright_black"]),
+];
+
+/// Syntax keys and the TextMate scopes whose color they take, by priority.
+const SYNTAX_SCOPES: &[(&str, &[&str])] = &[
+    ("comment", &["comment"]),
+    ("constant", &["constant.language", "constant"]),
+    ("number", &["constant.numeric", "constant"]),
+    ("string", &["string"]),
+    ("escape", &["constant.character.escape", "string"]),
+    ("string.escape", &["constant.character.escape", "string"]),
+    ("embedded", &["meta.embedded", "source"]),
+    ("keyword", &["keyword", "storage"]),
+    (
+        "selfKeyword",
+        &["variable.language.self", "variable.language"],
+    ),
+    ("type", &["entity.name.type", "support.type"]),
+    ("typeAlias", &["entity.name.type.alias", "entity.name.type"]),
+    ("struct", &["entity.name.type.struct", "entity.name.type"]),
+    (
+        "structure",
+        &["entity.name.type.struct", "entity.name.type"],
+    ),
+    ("enum", &["entity.name.type.enum", "entity.name.type"]),
+    (
+        "interface",
+        &["entity.name.type.interface", "entity.name.type"],
+    ),
+    ("type.builtin", &["support.type.primitive", "support.type"]),
+    ("builtinType", &["support.type.primitive", "support.type"]),
+    ("constructor", &["entity.name.function.constructor"]),
+    ("attribute", &["entity.other.attribute-name"]),
+    ("function", &["entity.name.function", "support.function"]),
+    (
+        "method",
+        &["entity.name.function.member", "entity.name.function"],
+    ),
+    (
+        "function.method",
+        &["entity.name.function.member", "entity.name.function"],
+    ),
+    ("variable", &["variable.other", "variable"]),
+    (
+        "variable.other.member",
+        &["variable.other.member", "variable.other.property"],
+    ),
+    (
+        "field",
+        &["variable.other.member", "variable.other.property"],
+    ),
+    (
+        "property",
+        &["variable.other.property", "support.variable.property"],
+    ),
+    ("enumMember", &["variable.other.enummember", "constant"]),
+    ("enum-member", &["variable.other.enummember", "constant"]),
+    ("tag", &["entity.name.tag"]),
+    (
+        "punctuation.delimiter",
+        &["punctuation.separator", "punctuation"],
+    ),
+    ("text.title", &["markup.heading"]),
+    ("text.uri", &["markup.underline.link"]),
+    ("text.reference", &["string.other.link"]),
+    ("markup.heading", &["markup.heading"]),
+    ("markup.bold", &["markup.bold"]),
+    ("markup.italic", &["markup.italic"]),
+    ("markup.list", &["markup.list"]),
+    ("markup.link.url", &["markup.underline.link"]),
+    ("markup.link.label", &["string.other.link"]),
+    ("markup.link.text", &["string.other.link"]),
+];
+
+#[derive(Deserialize)]
+#[serde(rename_all = "camelCase")]
+struct VsCodeTheme {
+    name: Option<String>,
+    #[serde(rename = "type")]
+    kind: Option<String>,
+    #[serde(default)]
+    colors: BTreeMap<String, Value>,
+    #[serde(default)]
+    token_colors: Vec<TokenColor>,
+    #[serde(default)]
+    semantic_token_colors: BTreeMap<String, Value>,
+}
+
+#[derive(Deserialize)]
+struct TokenColor {
+    #[serde(default)]
+    scope: Option<Value>,
+    #[serde(default)]
+    settings: TokenSettings,
+}
+
+#[derive(Default, Deserialize)]
+struct TokenSettings {
+    foreground: Option<String>,
+}
+
+/// A converted theme along with the VS Code entries that have no Lapce
+/// equivalent.
+#[derive(Debug)]
+pub struct ImportedTheme {
+    pub theme: ColorThemeConfig,
+    /// `colors` keys, `tokenColors` scopes and `semanticTokenColors`
+    /// selectors that were not used.
+    pub unmapped: Vec<String>,
+}
+
+impl ImportedTheme {
+    /// The unmapped entries, listing at most `limit` of them.
+    pub fn unmapped_summary(&self, limit: usize) -> String {
+        let mut summary = self
+            .unmapped
+            .iter()
+            .take(limit)
+            .cloned()
+            .collect::<Vec<_>>()
+            .join("\n");
+        if self.unmapped.len() > limit {
+            summary.push_str(&format!("\nand {} more", self.unmapped.len() - limit));
+        }
+        summary
+    }
+}
+
+/// Converts a VS Code theme file, naming the theme after the file if it has
+/// no name.
+pub fn import_vscode_theme_file(path: &Path) -> Result<ImportedTheme> {
+    let json = fs::read_to_string(path)?;
+    import_vscode_theme(&json, path.file_stem().and_then(|s| s.to_str()))
+}
+
+/// Converts the contents of a VS Code theme `.json` file, which may have
+/// comments and trailing commas. `default_name` is used when the theme has no
+/// `name`.
+pub fn import_vscode_theme(
+    json: &str,
+    default_name: Option<&str>,
+) -> Result<ImportedTheme> {
+    let vscode: VsCodeTheme = serde_json::from_str(&strip_jsonc(json))
+        .map_err(|err| anyhow!("not a VS Code color theme: {err}"))?;
+
+    let is_light = vscode
+        .kind
+        .as_deref()
+        .is_some_and(|kind| kind == "light" || kind == "hcLight");
+    let mut theme = LapceConfig::bundled_color_theme(is_light);
+    theme.name = vscode
+        .name
+        .clone()
+        .or_else(|| default_name.map(str::to_string))
+        .ok_or_else(|| anyhow!("the theme has no name"))?;
+    theme.high_contrast = vscode
+        .kind
+        .as_deref()
+        .is_some_and(|kind| kind.starts_with("hc"))
+        .then_some(true);
+
+    let colors: BTreeMap<&str, &str> = vscode
+        .colors
+        .iter()
+        .filter_map(|(key, value)| Some((key.as_str(), value.as_str()?)))
+        .collect();
+    let mut unmapped = Vec::new();
+
+    for (variable, sources) in BASE_COLORS {
+        if let Some(color) = sources.iter().find_map(|key| colors.get(key)) {
+            theme.base.0.insert(variable.to_string(), color.to_string());
+        }
+    }
+    for (key, color) in &colors {
+        let mut mapped =
+            BASE_COLORS.iter().any(|(_, sources)| sources.contains(key));
+        for (_, ui_keys) in UI_COLORS.iter().filter(|(source, _)| source == key) {
+            for ui_key in *ui_keys {
+                theme.ui.insert(ui_key.to_string(), color.to_string());
+            }
+            mapped = true;
+        }
+        if !mapped {
+            unmapped.push(format!("colors: {key}"));
+        }
+    }
+
+    let rules: Vec<(&str, &str)> = vscode
+        .token_colors
+        .iter()
+        .filter_map(|token| {
+            Some((token.scope.as_ref(), token.settings.foreground.as_deref()?))
+        })
+        .flat_map(|(scope, color)| {
+            scopes(scope).into_iter().map(move |scope| (scope, color))
+        })
+        .collect();
+    let mut used = vec![false; rules.len()];
+    for (key, scopes) in SYNTAX_SCOPES {
+        let matches: Vec<usize> = scopes
+            .iter()
+            .filter_map(|scope| best_rule(&rules, scope))
+            .collect();
+        for i in &matches {
+            used[*i] = true;
+        }
+        if let Some(i) = matches.first() {
+            theme
+                .syntax
+                .insert(key.to_string(), rules[*i].1.to_string());
+        }
+    }
+    // a rule is only unmapped if no rule for the same selector was used
+    for (i, (selector, _)) in rules.iter().enumerate() {
+        if !used[i]
+            && !rules
+                .iter()
+                .zip(&used)
+                .any(|((other, _), used)| *used && other == selector)
+        {
+            let entry = format!("tokenColors: {selector}");
+            if !unmapped.contains(&entry) {
+                unmapped.push(entry);
+            }
+        }
+    }
+
+    // semantic token types are the syntax keys of semantic styles
+    for (selector, value) in &vscode.semantic_token_colors {
+        let color = match value {
+            Value::String(color) => Some(color.as_str()),
+            Value::Object(style) => style.get("foreground").and_then(Value::as_str),
+            _ => None,
+        };
+        match color {
+            // modifiers and language specific colors have no equivalent
+            Some(color) if !selector.contains(['.', ':', '*']) => {
+                theme.syntax.insert(selector.clone(), color.to_string());
+            }
+            _ => unmapped.push(format!("semanticTokenColors: {selector}")),
+        }
+    }
+
+    Ok(ImportedTheme { theme, unmapped })
+}
+
+/// The scope selectors of a `tokenColors` rule. A rule without a scope sets
+/// the default colors, which come from `colors` instead.
+fn scopes(scope: Option<&Value>) -> Vec<&str> {
+    let scopes: Vec<&str> = match scope {
+        Some(Value::String(scope)) => scope.split(',').collect(),
+        Some(Value::Array(scopes)) => {
+            scopes.iter().filter_map(Value::as_str).collect()
+        }
+        _ => Vec::new(),
+    };
+    scopes
+        .into_iter()
+        .map(str::trim)
+        .filter(|scope| !scope.is_empty())
+        .collect()
+}
+
+/// The rule that colors `scope`, which is the one with the longest matching
+/// selector, the later one on ties. Descendant selectors like
+/// `source.rust keyword` only match within their parent, so they are skipped.
+fn best_rule(rules: &[(&str, &str)], scope: &str) -> Option<usize> {
+    rules
+        .iter()
+        .enumerate()
+        .filter(|(_, (selector, _))| {
+            !selector.contains(' ')
+                && (scope == *selector
+                    || scope
+                        .strip_prefix(selector)
+                        .is_some_and(|rest| rest.starts_with('.')))
+        })
+        .max_by_key(|(i, (selector, _))| (selector.len(), *i))
+        .map(|(i, _)| i)
+}
+
+/// Removes the comments and trailing commas JSON doesn't allow.
+pub(crate) fn strip_jsonc(s: &str) -> String {
+    let mut out = String::with_capacity(s.len());
+    let mut chars = s.chars().peekable();
+    let mut in_string = false;
+    while let Some(c) = chars.next() {
+        if in_string {
+            out.push(c);
+            match c {
+                '\\' => out.extend(chars.next()),
+                '"' => in_string = false,
+                _ => {}
+            }
+            continue;
+        }
+        match (c, chars.peek()) {
+            ('"', _) => {
+                in_string = true;
+                out.push(c);
+            }
+            ('/', Some('/')) => while chars.next_if(|c| *c != '\n').is_some() {},
+            ('/', Some('*')) => {
+                chars.next();
+                let mut last = ' ';
+                for c in chars.by_ref() {
+                    if last == '*' && c == '/' {
+                        break;
+                    }
+                    last = c;
+                }
+            }
+            (']' | '}', _) => {
+                let trimmed = out.trim_end().len();
+                if out[..trimmed].ends_with(',') {
+                    out.truncate(trimmed - 1);
+                }
+                out.push(c);
+            }
+            _ => out.push(c),
+        }
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{import_vscode_theme, strip_jsonc};
+
+    #[test]
+    fn test_strip_jsonc() {
+        assert_eq!(
+            strip_jsonc(
+                "{\n  // a\n  \"a\": \"//b\", /* c */\n  \"d\": [1, 2,],\n}"
+            ),
+            "{\n  \n  \"a\": \"//b\", \n  \"d\": [1, 2]}"
+        );
+    }
+
+    #[test]
+    fn test_import_vscode_theme() {
+        let json = r##"{
+            "name": "Test",
+            "type": "dark",
+            "colors": {
+                "editor.background": "#101010",
+                "statusBar.background": "#202020",
+                "minimap.background": "#303030",
+            },
+            "tokenColors": [
+                { "settings": { "foreground": "#EEEEEE" } },
+                { "scope": "keyword", "settings": { "foreground": "#FF0000" } },
+                {
+                    "scope": ["entity.name.function", "support.function"],
+                    "settings": { "foreground": "#00FF00" }
+                },
+                { "scope": "source.rust keyword", "settings": { "foreground": "#0000FF" } },
+                { "scope": "entity.name.function.member", "settings": { "fontStyle": "italic" } },
+            ],
+            "semanticTokenColors": {
+                "enumMember": "#123456",
+                "variable.readonly": { "foreground": "#654321" },
+            },
+        }"##;
+        let imported = import_vscode_theme(json, None).unwrap();
+        let theme = imported.theme;
+        assert_eq!(theme.name, "Test");
+        assert_eq!(theme.base.get("primary-background").unwrap(), "#101010");
+        assert_eq!(theme.ui["status.background"], "#202020");
+        // follows the imported base
+        assert_eq!(theme.ui["palette.background"], "$secondary-background");
+        assert_eq!(theme.syntax["keyword"], "#FF0000");
+        assert_eq!(theme.syntax["method"], "#00FF00");
+        assert_eq!(theme.syntax["enumMember"], "#123456");
+        assert_eq!(
+            imported.unmapped,
+            vec![
+                "colors: minimap.background",
+                "tokenColors: source.rust keyword",
+                "semanticTokenColors: variable.readonly",
+            ]
+        );
+    }
+}
@@ -26,6 +26,7 @@
 const WORKSPACE_FILES: &str = "workspace_files";
 const PANEL_ORDERS: &str = "panel_orders";
 const DISABLED_VOLTS: &str = "disabled_volts";
+const PINNED_VOLTS: &str = "pinned_volts";
 const RECENT_WORKSPACES: &str = "recent_workspaces";
 
 pub enum SaveEvent {
@@ -35,6 +36,7 @@ pub enum SaveEvent {
     Doc(DocInfo),
     DisabledVolts(Vec<VoltID>),
     WorkspaceDisabledVolts(Arc<LapceWorkspace>, Vec<VoltID>),
+    PinnedVolts(Vec<VoltID>),
     PanelOrder(PanelOrder),
 }
 
@@ -105,6 +107,11 @@ pub fn new() -> Result<Self> {
                                 tracing::error!("{:?}", err);
                             }
                         }
+                        SaveEvent::PinnedVolts(volts) => {
+                            if let Err(err) = local_db.insert_pinned_volts(volts) {
+                                tracing::error!("{:?}", err);
+                            }
+                        }
                         SaveEvent::PanelOrder(order) => {
                             if let Err(err) = local_db.insert_panel_orders(&order) {
                                 tracing::error!("{:?}", err);
@@ -129,6 +136,20 @@ pub fn save_disabled_volts(&self, volts: Vec<VoltID>) {
         }
     }
 
+    /// Volts that are kept at their installed version and skipped by update
+    /// checks.
+    pub fn get_pinned_volts(&self) -> Result<Vec<VoltID>> {
+        let volts = std::fs::read_to_string(self.folder.join(PINNED_VOLTS))?;
+        let volts: Vec<VoltID> = serde_json::from_str(&volts)?;
+        Ok(volts)
+    }
+
+    pub fn save_pinned_volts(&self, volts: Vec<VoltID>) {
+        if let Err(err) = self.save_tx.send(SaveEvent::PinnedVolts(volts)) {
+            tracing::error!("{:?}", err);
+        }
+    }
+
     pub fn save_workspace_disabled_volts(
         &self,
         workspace: Arc<LapceWorkspace>,
@@ -148,6 +169,12 @@ pub fn insert_disabled_volts(&self, volts: Vec<VoltID>) -> Result<()> {
         Ok(())
     }
 
+    pub fn insert_pinned_volts(&self, volts: Vec<VoltID>) -> Result<()> {
+        let volts = serde_json::to_string_pretty(&volts)?;
+        std::fs::write(self.folder.join(PINNED_VOLTS), volts)?;
+        Ok(())
+    }
+
     pub fn insert_workspace_disabled_volts(
         &self,
         workspace: Arc<LapceWorkspace>,
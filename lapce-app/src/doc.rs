@@ -21,7 +21,7 @@
     reactive::{
         ReadSignal, RwSignal, Scope, SignalGet, SignalUpdate, SignalWith, batch,
     },
-    text::{Attrs, AttrsList, FamilyOwned, TextLayout},
+    text::{Attrs, AttrsList, TextLayout},
     views::editor::{
         CursorInfo, Editor, EditorStyle,
         actions::CommonAction,
@@ -50,19 +50,20 @@
     mode::MotionMode,
     register::Register,
     rope_text_pos::RopeTextPosition,
-    selection::{InsertDrift, Selection},
+    selection::{InsertDrift, SelRegion, Selection},
     style::line_styles,
     syntax::{BracketParser, Syntax, edit::SyntaxEdit},
     word::{CharClassification, WordCursor, get_char_property},
 };
 use lapce_rpc::{
-    buffer::BufferId,
+    buffer::{BufferId, FileEncoding, LargeFileInfo},
     plugin::PluginId,
     proxy::ProxyResponse,
     style::{LineStyle, LineStyles, Style},
 };
 use lapce_xi_rope::{
     Interval, Rope, RopeDelta, Transformer,
+    find::CaseMatching,
     spans::{Spans, SpansBuilder},
 };
 use lsp_types::{
@@ -73,10 +74,11 @@
 use smallvec::SmallVec;
 
 use crate::{
-    command::{CommandKind, LapceCommand},
-    config::{LapceConfig, color::LapceColor},
+    command::{CommandKind, InternalCommand, LapceCommand},
+    config::{LapceConfig, color::LapceColor, font::FontContext},
     editor::{EditorData, compute_screen_lines, gutter::FoldingRanges},
     find::{Find, FindProgress, FindResult},
+    hex::HexData,
     history::DocumentHistory,
     keypress::KeyPressFocus,
     main_split::Editors,
@@ -117,6 +119,8 @@ pub enum DocContent {
     History(DocHistory),
     /// A new file which doesn't exist in the file system
     Scratch { id: BufferId, name: String },
+    /// A file that isn't text, which is viewed and edited as bytes
+    Binary { path: PathBuf },
 }
 
 impl DocContent {
@@ -134,6 +138,8 @@ pub fn read_only(&self) -> bool {
             DocContent::Local => false,
             DocContent::History(_) => true,
             DocContent::Scratch { .. } => false,
+            // The bytes are edited in the hex editor, not in the text buffer
+            DocContent::Binary { .. } => true,
         }
     }
 
@@ -143,6 +149,7 @@ pub fn path(&self) -> Option<&PathBuf> {
             DocContent::Local => None,
             DocContent::History(_) => None,
             DocContent::Scratch { .. } => None,
+            DocContent::Binary { path } => Some(path),
         }
     }
 }
@@ -161,6 +168,19 @@ pub struct DocInfo {
 
 pub type AllCodeLens = im::HashMap<usize, (PluginId, usize, im::Vector<CodeLens>)>;
 
+/// A file opened in large-file mode, which is loaded a page at a time as it's
+/// scrolled through.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct LargeFile {
+    pub info: LargeFileInfo,
+    /// Whether the whole file has been loaded
+    pub done: bool,
+    /// Whether the next page is being fetched
+    pub loading: bool,
+    /// The length of the page loaded last, which undo doesn't go past
+    pub last_page_len: Option<usize>,
+}
+
 #[derive(Clone)]
 pub struct Doc {
     pub scope: Scope,
@@ -214,6 +234,15 @@ pub struct Doc {
     pub common: Rc<CommonData>,
 
     pub document_symbol_data: RwSignal<Option<SymbolData>>,
+
+    /// The encoding the file is read and saved with
+    pub encoding: RwSignal<FileEncoding>,
+
+    /// Set when the file is opened in large-file mode
+    pub large_file: RwSignal<Option<LargeFile>>,
+
+    /// Set when the file isn't text, and is shown in the hex editor
+    pub binary: RwSignal<Option<HexData>>,
 }
 impl Doc {
     pub fn new(
@@ -259,6 +288,9 @@ pub fn new(
             common,
             code_lens: cx.create_rw_signal(im::HashMap::new()),
             document_symbol_data: cx.create_rw_signal(None),
+            encoding: cx.create_rw_signal(FileEncoding::default()),
+            large_file: cx.create_rw_signal(None),
+            binary: cx.create_rw_signal(None),
             folding_ranges: cx.create_rw_signal(FoldingRanges::default()),
         }
     }
@@ -310,6 +342,9 @@ pub fn new_content(
             common,
             code_lens: cx.create_rw_signal(im::HashMap::new()),
             document_symbol_data: cx.create_rw_signal(None),
+            encoding: cx.create_rw_signal(FileEncoding::default()),
+            large_file: cx.create_rw_signal(None),
+            binary: cx.create_rw_signal(None),
             folding_ranges: cx.create_rw_signal(FoldingRanges::default()),
         }
     }
@@ -361,6 +396,9 @@ pub fn new_history(
             common,
             code_lens: cx.create_rw_signal(im::HashMap::new()),
             document_symbol_data: cx.create_rw_signal(None),
+            encoding: cx.create_rw_signal(FileEncoding::default()),
+            large_file: cx.create_rw_signal(None),
+            binary: cx.create_rw_signal(None),
             folding_ranges: cx.create_rw_signal(FoldingRanges::default()),
         }
     }
@@ -458,6 +496,9 @@ pub fn init_content(&self, content: Rope) {
     }
 
     fn init_parser(&self) {
+        if self.is_large() {
+            return;
+        }
         let code = self.buffer.get_untracked().to_string();
         self.syntax.with_untracked(|syntax| {
             if syntax.styles.is_some() {
@@ -476,6 +517,152 @@ fn init_parser(&self) {
         });
     }
 
+    /// Whether the document is in large-file mode. Large files aren't opened in
+    /// language servers, so nothing is asked of them for it.
+    pub fn is_large(&self) -> bool {
+        self.large_file
+            .with_untracked(|large_file| large_file.is_some())
+    }
+
+    /// Put the document in large-file mode, before its first page is loaded.
+    /// Syntax highlighting, bracket colorization and language server features
+    /// are off for large files.
+    pub fn set_large_file(&self, info: LargeFileInfo) {
+        self.large_file.set(Some(LargeFile {
+            info,
+            done: false,
+            loading: false,
+            last_page_len: None,
+        }));
+        self.syntax.set(Syntax::plaintext());
+        self.parser.borrow_mut().active = false;
+    }
+
+    /// Open the document in the hex editor, because the file isn't text. Its
+    /// bytes are read from the proxy rather than sent as a buffer.
+    pub fn set_binary(&self) {
+        let DocContent::File { path, .. } = self.content.get_untracked() else {
+            return;
+        };
+        let hex = HexData::new(self.scope, path.clone(), self.common.clone());
+        hex.load();
+        self.binary.set(Some(hex));
+        self.syntax.set(Syntax::plaintext());
+        self.content.set(DocContent::Binary { path });
+    }
+
+    /// Fetch the next page of a large file from the proxy and append it, unless
+    /// the whole file is loaded or a page is already on its way.
+    pub fn load_next_page(&self) {
+        let Some(large_file) = self.large_file.get_untracked() else {
+            return;
+        };
+        if large_file.done || large_file.loading {
+            return;
+        }
+        let DocContent::File { path, .. } = self.content.get_untracked() else {
+            return;
+        };
+        self.large_file.update(|large_file| {
+            if let Some(large_file) = large_file {
+                large_file.loading = true;
+            }
+        });
+        let doc = self.clone();
+        let send = create_ext_action(self.scope, move |result| {
+            doc.large_file.update(|large_file| {
+                if let Some(large_file) = large_file {
+                    large_file.loading = false;
+                }
+            });
+            if let Ok(ProxyResponse::BufferPageResponse {
+                content,
+                loaded,
+                done,
+            }) = result
+            {
+                doc.append_page(content, loaded, done);
+            }
+        });
+        self.common.proxy.get_buffer_page(path, move |result| {
+            send(result);
+        });
+    }
+
+    /// Append a page of a large file. The proxy has it already, so rather than
+    /// being sent the edit it's told the page was loaded.
+    fn append_page(&self, content: String, loaded: u64, done: bool) {
+        let DocContent::File { path, .. } = self.content.get_untracked() else {
+            return;
+        };
+        if !content.is_empty() {
+            let was_pristine = self.is_pristine();
+            let end = self.buffer.with_untracked(|b| b.len());
+            let delta = self
+                .buffer
+                .try_update(|buffer| {
+                    let delta = buffer.edit(
+                        &[(Selection::caret(end), content.as_str())],
+                        EditType::Other,
+                    );
+                    // Loading more of the file isn't a change to it
+                    if was_pristine {
+                        buffer.set_pristine();
+                    }
+                    delta
+                })
+                .unwrap();
+            self.common
+                .proxy
+                .buffer_page_loaded(path, content.len(), self.rev());
+            self.apply_deltas_inner(&[delta], false);
+        }
+        self.large_file.update(|large_file| {
+            if let Some(large_file) = large_file {
+                large_file.info.loaded = loaded;
+                large_file.done = done;
+                large_file.last_page_len = Some(content.len());
+            }
+        });
+    }
+
+    /// Undoing the load of a page of a large file would take those lines out of
+    /// it, so the page is put back, which stops undo history there.
+    fn restore_undone_page(
+        &self,
+        mut deltas: Vec<(Rope, RopeDelta, InvalLines)>,
+    ) -> Vec<(Rope, RopeDelta, InvalLines)> {
+        let Some(page_len) = self
+            .large_file
+            .with_untracked(|l| l.and_then(|l| l.last_page_len))
+        else {
+            return deltas;
+        };
+        let Some((before_text, delta, _)) = deltas.last() else {
+            return deltas;
+        };
+        let (start, end) = delta.summary().0.start_end();
+        if !delta.is_simple_delete()
+            || end != before_text.len()
+            || end - start != page_len
+        {
+            return deltas;
+        }
+
+        let page = before_text.slice_to_cow(start..end).into_owned();
+        let restored = self
+            .buffer
+            .try_update(|buffer| {
+                buffer.edit(
+                    &[(Selection::caret(start), page.as_str())],
+                    EditType::Other,
+                )
+            })
+            .unwrap();
+        deltas.push(restored);
+        deltas
+    }
+
     /// Reload the document's content, and is what you should typically use when you want to *set*
     /// an existing document's content.
     pub fn reload(&self, content: Rope, set_pristine: bool) {
@@ -494,6 +681,45 @@ pub fn handle_file_changed(&self, content: Rope) {
         }
     }
 
+    /// Read the file again decoded with `encoding`, discarding unsaved changes.
+    pub fn reopen_with_encoding(&self, encoding: FileEncoding) {
+        let DocContent::File { path, .. } = self.content.get_untracked() else {
+            return;
+        };
+        let doc = self.clone();
+        let send = create_ext_action(self.scope, move |result| match result {
+            Ok(ProxyResponse::ReopenBufferResponse {
+                content,
+                encoding,
+                read_only,
+            }) => {
+                doc.encoding.set(encoding);
+                doc.reload(Rope::from(content), true);
+                // Text that didn't decode cleanly can't be saved back
+                doc.content.update(|content| {
+                    if let DocContent::File { read_only: r, .. } = content {
+                        *r = read_only;
+                    }
+                });
+            }
+            Ok(_) => {}
+            Err(err) => {
+                doc.common
+                    .internal_command
+                    .send(InternalCommand::ShowAlert {
+                        title: "Failed to reopen the file".to_string(),
+                        msg: err.message,
+                        buttons: Vec::new(),
+                    });
+            }
+        });
+        self.common
+            .proxy
+            .reopen_buffer(path, encoding, move |result| {
+                send(result);
+            });
+    }
+
     pub fn do_insert(
         &self,
         cursor: &mut Cursor,
@@ -584,6 +810,12 @@ pub fn do_edit(
                 .unwrap()
         });
 
+        let deltas = if matches!(cmd, EditCommand::Undo) {
+            self.restore_undone_page(deltas)
+        } else {
+            deltas
+        };
+
         if !deltas.is_empty() {
             self.buffer.update(|buffer| {
                 buffer.set_cursor_before(old_cursor);
@@ -596,6 +828,16 @@ pub fn do_edit(
     }
 
     pub fn apply_deltas(&self, deltas: &[(Rope, RopeDelta, InvalLines)]) {
+        self.apply_deltas_inner(deltas, true);
+    }
+
+    /// Update everything that depends on the text after `deltas`, sending them to
+    /// the proxy if `sync` is set.
+    fn apply_deltas_inner(
+        &self,
+        deltas: &[(Rope, RopeDelta, InvalLines)],
+        sync: bool,
+    ) {
         let rev = self.rev() - deltas.len() as u64;
         batch(|| {
             for (i, (_, delta, inval)) in deltas.iter().enumerate() {
@@ -606,11 +848,13 @@ pub fn apply_deltas(&self, deltas: &[(Rope, RopeDelta, InvalLines)]) {
                 self.update_find_result(delta);
                 if let DocContent::File { path, .. } = self.content.get_untracked() {
                     self.update_breakpoints(delta, &path, &inval.old_text);
-                    self.common.proxy.update(
-                        path,
-                        delta.clone(),
-                        rev + i as u64 + 1,
-                    );
+                    if sync {
+                        self.common.proxy.update(
+                            path,
+                            delta.clone(),
+                            rev + i as u64 + 1,
+                        );
+                    }
                 }
             }
         });
@@ -629,6 +873,17 @@ pub fn apply_deltas(&self, deltas: &[(Rope, RopeDelta, InvalLines)]) {
 
     pub fn is_pristine(&self) -> bool {
         self.buffer.with_untracked(|b| b.is_pristine())
+            && self.binary.with_untracked(|hex| {
+                hex.as_ref().is_none_or(|hex| !hex.is_dirty_untracked())
+            })
+    }
+
+    /// Like [`Doc::is_pristine`], but tracked.
+    pub fn is_pristine_tracked(&self) -> bool {
+        self.buffer.with(|b| b.is_pristine())
+            && self
+                .binary
+                .with(|hex| hex.as_ref().is_none_or(|hex| !hex.is_dirty()))
     }
 
     /// Get the buffer's current revision. This is used to track whether the buffer has changed.
@@ -859,7 +1114,7 @@ pub fn line_style(&self, line: usize) -> Arc<Vec<LineStyle>> {
 
     /// Request semantic styles for the buffer from the LSP through the proxy.
     pub fn get_semantic_styles(&self) {
-        if !self.loaded() {
+        if !self.loaded() || self.is_large() {
             return;
         }
 
@@ -922,6 +1177,9 @@ pub fn get_code_lens(&self) {
         self.code_lens.update(|code_lens| {
             code_lens.clear();
         });
+        if self.is_large() {
+            return;
+        }
         let rev = self.rev();
         if let DocContent::File { path, .. } = doc.content.get_untracked() {
             let send = create_ext_action(cx, move |result| {
@@ -964,6 +1222,9 @@ pub fn get_code_lens(&self) {
     }
 
     pub fn get_document_symbol(&self) {
+        if self.is_large() {
+            return;
+        }
         let cx = self.scope;
         let doc = self.clone();
         let rev = self.rev();
@@ -1005,7 +1266,7 @@ pub fn get_document_symbol(&self) {
 
     /// Request inlay hints for the buffer from the LSP through the proxy.
     pub fn get_inlay_hints(&self) {
-        if !self.loaded() {
+        if !self.loaded() || self.is_large() {
             return;
         }
 
@@ -1265,6 +1526,14 @@ pub fn update_find(&self) {
             .set(FindProgress::InProgress(Selection::new()));
 
         let find_result = self.find_result.clone();
+        if let Some(path) = self
+            .content
+            .with_untracked(|c| c.path().cloned())
+            .filter(|_| self.is_large())
+        {
+            self.find_in_large_file(path, search.content);
+            return;
+        }
         let send = create_ext_action(self.scope, move |occurrences: Selection| {
             find_result.occurrences.set(occurrences);
             find_result.progress.set(FindProgress::Ready);
@@ -1289,6 +1558,41 @@ pub fn update_find(&self) {
         });
     }
 
+    /// Search a large file through the proxy, which doesn't need a copy of the
+    /// text on this side.
+    fn find_in_large_file(&self, path: PathBuf, pattern: String) {
+        let find_result = self.find_result.clone();
+        let rev = self.rev();
+        let doc = self.clone();
+        let send = create_ext_action(self.scope, move |result| {
+            if doc.rev() != rev {
+                // Look again with the edited text
+                find_result.reset();
+                return;
+            }
+            let mut occurrences = Selection::new();
+            if let Ok(ProxyResponse::FindInBufferResponse { matches }) = result {
+                for (start, end) in matches {
+                    occurrences.add_region(SelRegion::new(start, end, None));
+                }
+            }
+            find_result.occurrences.set(occurrences);
+            find_result.progress.set(FindProgress::Ready);
+        });
+
+        let find = &self.common.find;
+        self.common.proxy.find_in_buffer(
+            path,
+            pattern,
+            find.case_matching.get_untracked() == CaseMatching::Exact,
+            find.whole_words.get_untracked(),
+            find.is_regex.get_untracked(),
+            move |result| {
+                send(result);
+            },
+        );
+    }
+
     /// Get the sticky headers for a particular line, creating them if necessary.
     pub fn sticky_headers(&self, line: usize) -> Option<Vec<usize>> {
         if let Some(lines) = self.sticky_headers.borrow().get(&line) {
@@ -1320,6 +1624,9 @@ pub fn head_changes(&self) -> RwSignal<im::Vector<DiffLines>> {
 
     /// Retrieve the `head` version of the buffer
     pub fn retrieve_head(&self) {
+        if self.is_large() {
+            return;
+        }
         if let DocContent::File { path, .. } = self.content.get_untracked() {
             let histories = self.histories;
 
@@ -1399,25 +1706,45 @@ pub fn trigger_head_change(&self) {
     }
 
     pub fn save(&self, after_action: impl FnOnce() + 'static) {
+        if let Some(hex) = self.binary.get_untracked() {
+            hex.save(after_action);
+            return;
+        }
         let content = self.content.get_untracked();
         if let DocContent::File { path, .. } = content {
             let rev = self.rev();
             let buffer = self.buffer;
+            let internal_command = self.common.internal_command;
             let send = create_ext_action(self.scope, move |result| {
-                if let Ok(ProxyResponse::SaveResponse {}) = result {
-                    let current_rev = buffer.with_untracked(|buffer| buffer.rev());
-                    if current_rev == rev {
-                        buffer.update(|buffer| {
-                            buffer.set_pristine();
+                match result {
+                    Ok(ProxyResponse::SaveResponse {}) => {
+                        let current_rev =
+                            buffer.with_untracked(|buffer| buffer.rev());
+                        if current_rev == rev {
+                            buffer.update(|buffer| {
+                                buffer.set_pristine();
+                            });
+                            after_action();
+                        }
+                    }
+                    Ok(_) => {}
+                    // e.g. the text can't be represented in the file's encoding
+                    Err(err) => {
+                        internal_command.send(InternalCommand::ShowAlert {
+                            title: "Failed to save the file".to_string(),
+                            msg: err.message,
+                            buttons: Vec::new(),
                         });
-                        after_action();
                     }
                 }
             });
 
-            self.common.proxy.save(rev, path, true, move |result| {
-                send(result);
-            })
+            let encoding = self.encoding.get_untracked();
+            self.common
+                .proxy
+                .save(rev, path, true, encoding, move |result| {
+                    send(result);
+                })
         }
     }
 
@@ -1506,6 +1833,27 @@ pub fn find_enclosing_brackets(&self, offset: usize) -> Option<(usize, usize)> {
                 })
             })
     }
+
+    /// Returns the first and last lines of the syntax nodes around the given
+    /// offset that span more than one line, innermost first. Empty if there is
+    /// no syntax tree for the current language, or it is out of date.
+    pub fn find_enclosing_scope_lines(&self, offset: usize) -> Vec<(usize, usize)> {
+        let rev = self.rev();
+        let scopes = self.syntax.with_untracked(|syntax| {
+            if syntax.text.is_empty() || syntax.rev != rev {
+                return Vec::new();
+            }
+            syntax.find_enclosing_scopes(offset)
+        });
+        self.buffer.with_untracked(|buffer| {
+            scopes
+                .into_iter()
+                .map(|(start, end)| {
+                    (buffer.line_of_offset(start), buffer.line_of_offset(end))
+                })
+                .collect()
+        })
+    }
 }
 impl Document for Doc {
     fn text(&self) -> Rope {
@@ -1950,7 +2298,7 @@ fn font_family(
     ) -> std::borrow::Cow<'_, [floem::text::FamilyOwned]> {
         // TODO: cache this
         Cow::Owned(self.config.with_untracked(|config| {
-            FamilyOwned::parse_list(&config.editor.font_family).collect()
+            config.font(FontContext::Editor).family().to_vec()
         }))
     }
 
@@ -1999,9 +2347,30 @@ fn apply_attr_styles(
     ) {
         let config = self.doc.common.config.get_untracked();
 
+        // The spans below are based on `default`, so they all get the
+        // editor font features
+        let default = config.font(FontContext::Editor).attrs(default);
+        attrs_list.add_span(0..usize::MAX, default.clone());
+
         self.apply_colorization(edid, style, line, &default, attrs_list);
 
         let phantom_text = self.doc.phantom_text(edid, style, line);
+        for (col_shift, size, col, phantom) in phantom_text.offset_size_iter() {
+            let font = match phantom.kind {
+                PhantomTextKind::InlayHint => FontContext::InlayHint,
+                PhantomTextKind::Diagnostic => FontContext::ErrorLens,
+                _ => continue,
+            };
+            let start = col + col_shift;
+            let mut attrs = config.font(font).attrs(default.clone());
+            if let Some(fg) = phantom.fg {
+                attrs = attrs.color(fg);
+            }
+            if let Some(font_size) = phantom.font_size {
+                attrs = attrs.font_size(font_size as f32);
+            }
+            attrs_list.add_span(start..start + size, attrs);
+        }
         for line_style in self.doc.line_style(line).iter() {
             if let Some(fg_color) = line_style.style.fg_color.as_ref() {
                 if let Some(fg_color) = config.style_color(fg_color) {
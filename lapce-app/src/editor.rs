@@ -66,13 +66,16 @@
 use crate::{
     command::{CommandKind, InternalCommand, LapceCommand, LapceWorkbenchCommand},
     completion::CompletionStatus,
-    config::LapceConfig,
+    config::{LapceConfig, color::LapceColor},
     db::LapceDb,
     doc::{Doc, DocContent},
     editor_tab::EditorTabChild,
     id::{DiffEditorId, EditorTabId},
     inline_completion::{InlineCompletionItem, InlineCompletionStatus},
-    keypress::{KeyPressFocus, condition::Condition},
+    keypress::{
+        KeyPressFocus,
+        condition::{Condition, ContextKey},
+    },
     lsp::path_from_url,
     main_split::{Editors, MainSplitData, SplitDirection, SplitMoveDirection},
     markdown::{
@@ -84,12 +87,14 @@
         kind::PanelKind,
     },
     snippet::Snippet,
+    theme_editor::syntax_key_at,
     tracing::*,
     window_tab::{CommonData, Focus, WindowTabData},
 };
 
 pub mod diff;
 pub mod gutter;
+pub mod indent_guide;
 pub mod location;
 pub mod view;
 
@@ -116,7 +121,7 @@ pub fn to_data(
         let editors = &data.editors;
         let common = data.common.clone();
         match &self.content {
-            DocContent::File { path, .. } => {
+            DocContent::File { path, .. } | DocContent::Binary { path } => {
                 let (doc, new_doc) =
                     data.get_doc(path.clone(), self.unsaved.clone());
                 let editor = editors.make_from_doc(
@@ -352,7 +357,12 @@ pub fn editor_info(&self, _data: &WindowTabData) -> EditorInfo {
         let scroll_offset = self.viewport().get_untracked().origin();
         let doc = self.doc();
         let is_pristine = doc.is_pristine();
-        let unsaved = if is_pristine {
+        // Only part of a large file may be loaded, which can't be restored as is,
+        // and the edits to a binary file aren't in the text buffer
+        let unsaved = if is_pristine
+            || doc.is_large()
+            || doc.binary.with_untracked(Option::is_some)
+        {
             None
         } else {
             Some(doc.buffer.with_untracked(|b| b.to_string()))
@@ -1234,7 +1244,7 @@ fn on_screen_find(&self, pattern: &str) -> Vec<SelRegion> {
 
     fn go_to_definition(&self) {
         let doc = self.doc();
-        let path = match if doc.loaded() {
+        let path = match if doc.loaded() && !doc.is_large() {
             doc.content.with_untracked(|c| c.path().cloned())
         } else {
             None
@@ -1373,7 +1383,7 @@ enum DefinitionOrReferece {
 
     pub fn call_hierarchy(&self, window_tab_data: WindowTabData) {
         let doc = self.doc();
-        let path = match if doc.loaded() {
+        let path = match if doc.loaded() && !doc.is_large() {
             doc.content.with_untracked(|c| c.path().cloned())
         } else {
             None
@@ -1429,7 +1439,7 @@ pub fn call_hierarchy(&self, window_tab_data: WindowTabData) {
 
     pub fn find_refenrence(&self, window_tab_data: WindowTabData) {
         let doc = self.doc();
-        let path = match if doc.loaded() {
+        let path = match if doc.loaded() && !doc.is_large() {
             doc.content.with_untracked(|c| c.path().cloned())
         } else {
             None
@@ -1485,7 +1495,7 @@ pub fn find_refenrence(&self, window_tab_data: WindowTabData) {
 
     pub fn go_to_implementation(&self, window_tab_data: WindowTabData) {
         let doc = self.doc();
-        let path = match if doc.loaded() {
+        let path = match if doc.loaded() && !doc.is_large() {
             doc.content.with_untracked(|c| c.path().cloned())
         } else {
             None
@@ -1627,7 +1637,7 @@ fn update_inline_completion(&self, trigger_kind: InlineCompletionTriggerKind) {
         }
 
         let doc = self.doc();
-        let path = match if doc.loaded() {
+        let path = match if doc.loaded() && !doc.is_large() {
             doc.content.with_untracked(|c| c.path().cloned())
         } else {
             None
@@ -1786,7 +1796,7 @@ fn update_completion(&self, display_if_empty_input: bool) {
         }
 
         let doc = self.doc();
-        let path = match if doc.loaded() {
+        let path = match if doc.loaded() && !doc.is_large() {
             doc.content.with_untracked(|c| c.path().cloned())
         } else {
             None
@@ -2220,7 +2230,7 @@ pub fn go_to_position(
 
     pub fn get_code_actions(&self) {
         let doc = self.doc();
-        let path = match if doc.loaded() {
+        let path = match if doc.loaded() && !doc.is_large() {
             doc.content.with_untracked(|c| c.path().cloned())
         } else {
             None
@@ -2333,6 +2343,12 @@ pub fn save(
             return;
         }
 
+        // Binary files have nothing to format
+        if let DocContent::Binary { .. } = &content {
+            self.do_save(after_action);
+            return;
+        }
+
         let config = self.common.config.get_untracked();
         let DocContent::File { path, .. } = content else {
             return;
@@ -2518,7 +2534,7 @@ pub fn save_doc_position(&self) {
 
     fn rename(&self) {
         let doc = self.doc();
-        let path = match if doc.loaded() {
+        let path = match if doc.loaded() && !doc.is_large() {
             doc.content.with_untracked(|c| c.path().cloned())
         } else {
             None
@@ -2657,6 +2673,9 @@ fn search(&self) {
     }
 
     pub fn pointer_down(&self, pointer_event: &PointerInputEvent) {
+        if self.inspect_theme(pointer_event) {
+            return;
+        }
         self.cancel_completion();
         self.cancel_inline_completion();
         if let Some(editor_tab_id) = self.editor_tab_id.get_untracked() {
@@ -2798,6 +2817,25 @@ fn left_click(&self, pointer_event: &PointerInputEvent) {
         }
     }
 
+    /// Reveals the syntax key of the clicked token, or the editor background,
+    /// when the theme inspector is active.
+    fn inspect_theme(&self, pointer_event: &PointerInputEvent) -> bool {
+        let inspector = self.common.theme_inspector;
+        if !inspector.active.get_untracked()
+            || self
+                .doc()
+                .content
+                .with_untracked(|content| content.is_local())
+        {
+            return false;
+        }
+        let mode = self.cursor().with_untracked(|c| c.get_mode());
+        let (offset, _) = self.editor.offset_of_point(mode, pointer_event.pos);
+        let key = syntax_key_at(&self.doc(), offset)
+            .unwrap_or_else(|| LapceColor::EDITOR_BACKGROUND.to_string());
+        inspector.reveal(&key)
+    }
+
     #[instrument]
     fn single_click(&self, pointer_event: &PointerInputEvent) {
         self.editor.single_click(pointer_event);
@@ -2890,7 +2928,7 @@ fn right_click(&self, pointer_event: &PointerInputEvent) {
         }
 
         let (path, is_file) = doc.content.with_untracked(|content| match content {
-            DocContent::File { path, .. } => {
+            DocContent::File { path, .. } | DocContent::Binary { path } => {
                 (Some(path.to_path_buf()), path.is_file())
             }
             DocContent::Local
@@ -3003,6 +3041,9 @@ fn right_click(&self, pointer_event: &PointerInputEvent) {
     #[instrument]
     fn update_hover(&self, offset: usize) {
         let doc = self.doc();
+        if doc.is_large() {
+            return;
+        }
         let path = doc
             .content
             .with_untracked(|content| content.path().cloned());
@@ -3236,7 +3277,10 @@ pub fn actual_line(&self, visual_line: usize, bottom_affinity: bool) -> usize {
 
 impl KeyPressFocus for EditorData {
     fn get_mode(&self) -> Mode {
-        if self.common.find.visual.get_untracked() && self.find_focus.get_untracked()
+        // The hex editor takes typed characters in any mode
+        if (self.common.find.visual.get_untracked()
+            && self.find_focus.get_untracked())
+            || self.doc().binary.with_untracked(Option::is_some)
         {
             Mode::Insert
         } else {
@@ -3285,6 +3329,37 @@ fn check_condition(&self, condition: Condition) -> bool {
         }
     }
 
+    fn context_values(&self, key: ContextKey) -> Vec<String> {
+        let doc = self.doc();
+        match key {
+            ContextKey::EditorLang => {
+                let language = doc.syntax().with_untracked(|s| s.language);
+                vec![<&str>::from(language).to_lowercase()]
+            }
+            ContextKey::ResourceExtname => doc
+                .content
+                .with_untracked(|content| {
+                    content
+                        .path()
+                        .and_then(|path| path.extension())
+                        .map(|ext| format!(".{}", ext.to_string_lossy()))
+                })
+                .into_iter()
+                .collect(),
+            ContextKey::ResourceFilename => doc
+                .content
+                .with_untracked(|content| {
+                    content
+                        .path()
+                        .and_then(|path| path.file_name())
+                        .map(|name| name.to_string_lossy().into_owned())
+                })
+                .into_iter()
+                .collect(),
+            ContextKey::PanelVisible | ContextKey::DebugState => Vec::new(),
+        }
+    }
+
     #[instrument]
     fn run_command(
         &self,
@@ -3321,8 +3396,15 @@ fn run_command(
             }
         }
 
+        if let Some(hex) = self.doc().binary.get_untracked() {
+            if let Some(executed) = hex.run_command(&command.kind, count) {
+                return executed;
+            }
+        }
+
         match &command.kind {
-            crate::command::CommandKind::Workbench(_) => CommandExecuted::No,
+            crate::command::CommandKind::Workbench(_)
+            | crate::command::CommandKind::Plugin(_) => CommandExecuted::No,
             crate::command::CommandKind::Edit(cmd) => self.run_edit_command(cmd),
             crate::command::CommandKind::Move(cmd) => {
                 let movement = cmd.to_movement(count);
@@ -3380,6 +3462,8 @@ fn receive_char(&self, c: &str) {
                     InternalCommand::FindEditorReceiveChar { s: c.to_string() },
                 );
             }
+        } else if let Some(hex) = self.doc().binary.get_untracked() {
+            hex.receive_char(c);
         } else {
             // normal editor receive char
             if self.get_mode() == Mode::Insert {
@@ -54,7 +54,7 @@ pub fn to_data(
             let data = data.clone();
             let common = data.common.clone();
             move |content: &DocContent| match content {
-                DocContent::File { path, .. } => {
+                DocContent::File { path, .. } | DocContent::Binary { path } => {
                     let (doc, _) = data.get_doc(path.clone(), None);
                     doc
                 }
@@ -3,14 +3,14 @@
     context::PaintCx,
     peniko::kurbo::{Point, Rect, Size},
     reactive::{Memo, SignalGet, SignalWith},
-    text::{Attrs, AttrsList, FamilyOwned, TextLayout},
+    text::{Attrs, AttrsList, TextLayout},
 };
 use im::HashMap;
 use lapce_core::{buffer::rope_text::RopeText, mode::Mode};
 use serde::{Deserialize, Serialize};
 
 use super::{EditorData, view::changes_colors_screen};
-use crate::config::{LapceConfig, color::LapceColor};
+use crate::config::{LapceConfig, color::LapceColor, font::FontContext};
 
 pub struct EditorGutterView {
     id: ViewId,
@@ -141,10 +141,9 @@ fn paint(&mut self, cx: &mut floem::context::PaintCx) {
             .buffer
             .with_untracked(|buffer| buffer.line_of_offset(offset));
 
-        let family: Vec<FamilyOwned> =
-            FamilyOwned::parse_list(&config.editor.font_family).collect();
-        let attrs = Attrs::new()
-            .family(&family)
+        let attrs = config
+            .font(FontContext::Editor)
+            .attrs(Attrs::new())
             .color(config.color(LapceColor::EDITOR_DIM))
             .font_size(config.editor.font_size() as f32);
         let attrs_list = AttrsList::new(attrs.clone());
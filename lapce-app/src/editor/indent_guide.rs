@@ -0,0 +1,239 @@
+use lapce_core::{
+    buffer::{Buffer, rope_text::RopeText},
+    indent::IndentStyle,
+};
+
+/// How many lines to look through for the non-blank lines around a blank one,
+/// or for the lines of an indentation scope.
+const SEARCH_LIMIT: usize = 1000;
+
+/// The width in columns of the leading whitespace of `line`, or `None` if the
+/// line is blank.
+pub fn indent_width(line: &str, tab_width: usize) -> Option<usize> {
+    let tab_width = tab_width.max(1);
+    let mut width = 0;
+    for c in line.chars() {
+        match c {
+            ' ' => width += 1,
+            '\t' => width += tab_width - width % tab_width,
+            '\n' | '\r' => return None,
+            _ => return Some(width),
+        }
+    }
+    None
+}
+
+/// The highlighted guide of the scope around the cursor.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub struct ActiveGuide {
+    pub level: usize,
+    /// The line that opens the scope, which the guide starts below.
+    pub start_line: usize,
+    pub end_line: usize,
+}
+
+impl ActiveGuide {
+    pub fn contains(&self, line: usize) -> bool {
+        line > self.start_line && line <= self.end_line
+    }
+}
+
+/// Works out the indent guides of the lines of a buffer. A line has a guide
+/// for every indent level before its text, at the columns `0`, `unit`,
+/// `2 * unit` and so on.
+pub struct IndentGuides<'a> {
+    buffer: &'a Buffer,
+    unit: usize,
+    tab_width: usize,
+}
+
+impl<'a> IndentGuides<'a> {
+    pub fn new(
+        buffer: &'a Buffer,
+        indent_style: IndentStyle,
+        tab_width: usize,
+    ) -> Self {
+        let unit = match indent_style {
+            IndentStyle::Tabs => tab_width,
+            IndentStyle::Spaces(n) => n as usize,
+        };
+        Self {
+            buffer,
+            unit: unit.max(1),
+            tab_width,
+        }
+    }
+
+    /// The number of columns of an indent level.
+    pub fn unit(&self) -> usize {
+        self.unit
+    }
+
+    /// The number of guides on `line`. Blank lines take theirs from the lines
+    /// around them, so the guides aren't broken up by them.
+    pub fn levels(&self, line: usize) -> usize {
+        let width = self
+            .line_indent(line)
+            .unwrap_or_else(|| self.blank_line_indent(line));
+        width.div_ceil(self.unit)
+    }
+
+    /// Find the guide of the scope around `line`. `scopes` are the first and
+    /// last lines of the syntax nodes around the cursor, innermost first. The
+    /// first of them with a guide to draw is used, and without any the scope is
+    /// the block of lines indented deeper than the line that opens it.
+    pub fn active(
+        &self,
+        line: usize,
+        scopes: &[(usize, usize)],
+    ) -> Option<ActiveGuide> {
+        scopes
+            .iter()
+            .find_map(|&(start_line, end_line)| {
+                self.scope_guide(start_line, end_line)
+            })
+            .or_else(|| self.indentation_scope_guide(line))
+    }
+
+    fn scope_guide(
+        &self,
+        start_line: usize,
+        end_line: usize,
+    ) -> Option<ActiveGuide> {
+        let level = self.line_indent(start_line)?.div_ceil(self.unit);
+        ((start_line + 1)..=end_line)
+            .any(|line| self.levels(line) > level)
+            .then_some(ActiveGuide {
+                level,
+                start_line,
+                end_line,
+            })
+    }
+
+    fn indentation_scope_guide(&self, line: usize) -> Option<ActiveGuide> {
+        let width = self
+            .line_indent(line)
+            .unwrap_or_else(|| self.blank_line_indent(line));
+        let next = self.next_indent(line);
+
+        // The line opens a scope if the one after it is indented deeper,
+        // otherwise it's in the scope of the closest line above indented less.
+        let (start_line, level) = if next.is_some_and(|next| next > width) {
+            (line, width.div_ceil(self.unit))
+        } else {
+            let level = width.div_ceil(self.unit).checked_sub(1)?;
+            let start_line =
+                (line.saturating_sub(SEARCH_LIMIT)..line).rev().find(|&l| {
+                    self.line_indent(l)
+                        .is_some_and(|indent| indent.div_ceil(self.unit) <= level)
+                })?;
+            (start_line, level)
+        };
+
+        let last_line = self.buffer.last_line().min(start_line + SEARCH_LIMIT);
+        let end_line = ((start_line + 1)..=last_line)
+            .take_while(|&l| self.levels(l) > level)
+            .last()?;
+        Some(ActiveGuide {
+            level,
+            start_line,
+            end_line,
+        })
+    }
+
+    fn line_indent(&self, line: usize) -> Option<usize> {
+        indent_width(&self.buffer.line_content(line), self.tab_width)
+    }
+
+    fn next_indent(&self, line: usize) -> Option<usize> {
+        let last_line = self.buffer.last_line().min(line + SEARCH_LIMIT);
+        ((line + 1)..=last_line).find_map(|l| self.line_indent(l))
+    }
+
+    /// A blank line is indented like the next non-blank line, or at most one
+    /// level less than the previous one if that is deeper, which keeps the
+    /// guides of a block going across blank lines before its end.
+    fn blank_line_indent(&self, line: usize) -> usize {
+        let prev = (line.saturating_sub(SEARCH_LIMIT)..line)
+            .rev()
+            .find_map(|l| self.line_indent(l));
+        match (prev, self.next_indent(line)) {
+            (Some(prev), Some(next)) if prev > next => prev.min(next + self.unit),
+            (_, Some(next)) => next,
+            (_, None) => 0,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use lapce_core::{buffer::Buffer, indent::IndentStyle};
+
+    use super::{ActiveGuide, IndentGuides, indent_width};
+
+    const TEXT: &str = "fn main() {
+    if a {
+        b();
+
+        c();
+
+    }
+}
+
+fn other() {}
+";
+
+    #[test]
+    fn test_indent_width() {
+        assert_eq!(indent_width("    a", 4), Some(4));
+        assert_eq!(indent_width("\t  a", 4), Some(6));
+        assert_eq!(indent_width("  \ta", 4), Some(4));
+        assert_eq!(indent_width("a", 4), Some(0));
+        assert_eq!(indent_width("   \n", 4), None);
+        assert_eq!(indent_width("", 4), None);
+    }
+
+    #[test]
+    fn test_levels() {
+        let buffer = Buffer::new(TEXT);
+        let guides = IndentGuides::new(&buffer, IndentStyle::Spaces(4), 4);
+        let levels: Vec<usize> = (0..=buffer.last_line())
+            .map(|line| guides.levels(line))
+            .collect();
+        assert_eq!(levels, vec![0, 1, 2, 2, 2, 2, 1, 0, 0, 0, 0]);
+    }
+
+    #[test]
+    fn test_active_guide() {
+        let buffer = Buffer::new(TEXT);
+        let guides = IndentGuides::new(&buffer, IndentStyle::Spaces(4), 4);
+
+        // From the indentation
+        let if_block = ActiveGuide {
+            level: 1,
+            start_line: 1,
+            end_line: 5,
+        };
+        assert_eq!(guides.active(2, &[]), Some(if_block));
+        assert_eq!(guides.active(1, &[]), Some(if_block));
+        assert_eq!(
+            guides.active(6, &[]),
+            Some(ActiveGuide {
+                level: 0,
+                start_line: 0,
+                end_line: 6,
+            })
+        );
+        assert_eq!(guides.active(9, &[]), None);
+
+        // From the syntax tree, skipping the scopes without a guide
+        assert_eq!(
+            guides.active(4, &[(2, 4), (1, 6)]),
+            Some(ActiveGuide {
+                level: 1,
+                start_line: 1,
+                end_line: 6,
+            })
+        );
+    }
+}
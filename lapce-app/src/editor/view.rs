@@ -20,8 +20,9 @@
     },
     style::{CursorColor, CursorStyle, Style, TextColor},
     taffy::prelude::NodeId,
+    text::{Attrs, AttrsList, TextLayout},
     views::{
-        Decorators, clip, container, dyn_stack,
+        Decorators, clip, container, dyn_container, dyn_stack,
         editor::{
             CurrentLineColor, CursorSurroundingLines, Editor, EditorStyle,
             IndentGuideColor, IndentStyleProp, Modal, ModalRelativeLine,
@@ -47,20 +48,27 @@
     selection::SelRegion,
 };
 use lapce_rpc::{
+    buffer::LARGE_FILE_PAGE_LINES,
     dap_types::{DapId, SourceBreakpoint},
     plugin::PluginId,
 };
 use lapce_xi_rope::find::CaseMatching;
 use lsp_types::CodeLens;
 
-use super::{DocSignal, EditorData, gutter::editor_gutter_view};
+use super::{
+    DocSignal, EditorData, gutter::editor_gutter_view, indent_guide::IndentGuides,
+};
 use crate::{
     app::clickable_icon,
     command::InternalCommand,
-    config::{LapceConfig, color::LapceColor, editor::WrapStyle, icon::LapceIcons},
+    config::{
+        LapceConfig, color::LapceColor, editor::WrapStyle, font::FontContext,
+        icon::LapceIcons,
+    },
     debug::{DapData, LapceBreakpoint},
     doc::DocContent,
     editor::gutter::FoldingDisplayItem,
+    hex::hex_editor_view,
     text_input::TextInputBuilder,
     window_tab::{CommonData, Focus, WindowTabData},
     workspace::LapceWorkspace,
@@ -121,7 +129,8 @@ pub fn editor_style(
         PreeditUnderlineColor,
         config.color(LapceColor::EDITOR_FOREGROUND),
     )
-    .set(ShowIndentGuide, config.editor.show_indent_guide)
+    // The indent guides are painted by `EditorView::paint_indent_guides`
+    .set(ShowIndentGuide, false)
     .set(Modal, config.core.modal)
     .set(
         ModalRelativeLine,
@@ -182,6 +191,25 @@ pub fn editor_view(
         rev
     });
 
+    // Large files are loaded a page at a time, fetching the next one once the end
+    // of what's loaded comes into view
+    create_effect(move |_| {
+        let doc = doc.get();
+        if doc.large_file.with(|l| l.is_none_or(|l| l.done)) {
+            return;
+        }
+        let Some(last_visible) = screen_lines.with(|lines| {
+            let vline = *lines.lines.last()?;
+            Some(lines.info(vline)?.vline_info.rvline.line)
+        }) else {
+            return;
+        };
+        let last_line = doc.buffer.with(|b| b.last_line());
+        if last_visible + LARGE_FILE_PAGE_LINES / 10 >= last_line {
+            doc.load_next_page();
+        }
+    });
+
     let config = e_data.common.config;
     let sticky_header_height_signal = e_data.sticky_header_height;
     let editor2 = e_data.clone();
@@ -770,6 +798,116 @@ fn paint_scroll_bar(
         }
     }
 
+    /// The width of a space in the editor font, which indent guides and rulers
+    /// are spaced by.
+    fn space_width(config: &LapceConfig) -> f64 {
+        let attrs = config
+            .font(FontContext::Editor)
+            .attrs(Attrs::new())
+            .font_size(config.editor.font_size() as f32);
+        let mut text_layout = TextLayout::new();
+        text_layout.set_text(" x", AttrsList::new(attrs), None);
+        text_layout.hit_position(1).point.x
+    }
+
+    /// Paint the indent guides, colored by their level if enabled, with the
+    /// guide of the scope around the cursor highlighted.
+    fn paint_indent_guides(
+        &self,
+        cx: &mut PaintCx,
+        screen_lines: &ScreenLines,
+        config: &LapceConfig,
+        space_width: f64,
+    ) {
+        if !config.editor.show_indent_guide {
+            return;
+        }
+
+        let e_data = &self.editor;
+        let doc = e_data.doc();
+        let line_height = config.editor.line_height() as f64;
+        let offset = e_data
+            .editor
+            .cursor
+            .with_untracked(|cursor| cursor.mode.offset());
+        let scopes = if config.editor.highlight_active_indent_guide {
+            doc.find_enclosing_scope_lines(offset)
+        } else {
+            Vec::new()
+        };
+
+        doc.buffer.with_untracked(|buffer| {
+            let guides = IndentGuides::new(
+                buffer,
+                buffer.indent_style(),
+                config.editor.tab_width,
+            );
+            let active = if config.editor.highlight_active_indent_guide {
+                guides.active(buffer.line_of_offset(offset), &scopes)
+            } else {
+                None
+            };
+
+            let mut line_levels = None;
+            for rvline in screen_lines.lines.iter() {
+                let Some(info) = screen_lines.info(*rvline) else {
+                    continue;
+                };
+                let line = rvline.line;
+                // Wrapped lines have several visual lines
+                let levels = match line_levels {
+                    Some((l, levels)) if l == line => levels,
+                    _ => guides.levels(line),
+                };
+                line_levels = Some((line, levels));
+
+                for level in 0..levels {
+                    let color = if active.is_some_and(|active| {
+                        active.level == level && active.contains(line)
+                    }) {
+                        config.color(LapceColor::EDITOR_INDENT_GUIDE_ACTIVE)
+                    } else if config.editor.indent_guide_colorization {
+                        let levels = LapceColor::EDITOR_INDENT_GUIDE_LEVELS;
+                        config.color(levels[level % levels.len()])
+                    } else {
+                        config.color(LapceColor::EDITOR_INDENT_GUIDE)
+                    };
+                    let x = (level * guides.unit()) as f64 * space_width;
+                    let guide = Line::new(
+                        Point::new(x, info.vline_y),
+                        Point::new(x, info.vline_y + line_height),
+                    );
+                    cx.stroke(&guide, color, &Stroke::new(1.0));
+                }
+            }
+        });
+    }
+
+    /// Paint the rulers of the language of the document.
+    fn paint_rulers(
+        &self,
+        cx: &mut PaintCx,
+        viewport: Rect,
+        config: &LapceConfig,
+        space_width: f64,
+    ) {
+        let language = self
+            .editor
+            .doc()
+            .syntax()
+            .with_untracked(|syntax| syntax.language);
+        let color = config.color(LapceColor::EDITOR_RULER);
+        for column in config.rulers(language) {
+            let x = *column as f64 * space_width;
+            if x < viewport.x0 || x > viewport.x1 {
+                continue;
+            }
+            let line =
+                Line::new(Point::new(x, viewport.y0), Point::new(x, viewport.y1));
+            cx.stroke(&line, color, &Stroke::new(1.0));
+        }
+    }
+
     /// Paint a highlight around the characters at the given positions.
     fn paint_char_highlights(
         &self,
@@ -1144,6 +1282,12 @@ fn paint(&mut self, cx: &mut PaintCx) {
         self.paint_diff_sections(cx, viewport, &screen_lines, &config);
         let screen_lines = ed.screen_lines.get_untracked();
         self.paint_find(cx, &screen_lines);
+        if !is_local {
+            let space_width = Self::space_width(&config);
+            self.paint_rulers(cx, viewport, &config, space_width);
+            let screen_lines = ed.screen_lines.get_untracked();
+            self.paint_indent_guides(cx, &screen_lines, &config, space_width);
+        }
         let screen_lines = ed.screen_lines.get_untracked();
         self.paint_bracket_highlights_scope_lines(cx, viewport, &screen_lines);
         let screen_lines = ed.screen_lines.get_untracked();
@@ -1305,8 +1449,9 @@ pub fn editor_container_view(
     let viewport = ed.viewport;
     let screen_lines = ed.screen_lines;
 
-    stack((
-        editor_breadcrumbs(workspace, editor.get_untracked(), config),
+    // Binary files are shown in the hex editor instead, once they're known
+    // not to be text
+    let text_editor_view = move || {
         stack((
             editor_gutter(window_tab_data.clone(), editor),
             editor_gutter_folding_range(
@@ -1335,15 +1480,27 @@ pub fn editor_container_view(
             }),
             find_view(
                 editor,
-                find_editor,
+                find_editor.clone(),
                 find_focus,
-                replace_editor,
+                replace_editor.clone(),
                 replace_active,
                 replace_focus,
                 is_active,
             )
             .debug_name("find view"),
         ))
+        .style(|s| s.size_full())
+    };
+
+    stack((
+        editor_breadcrumbs(workspace, editor.get_untracked(), config),
+        dyn_container(
+            move || doc.get().binary.get(),
+            move |binary| match binary {
+                Some(hex) => hex_editor_view(editor.get_untracked(), hex).into_any(),
+                None => text_editor_view().into_any(),
+            },
+        )
         .style(|s| s.width_full().flex_basis(0).flex_grow(1.0)),
     ))
     .on_cleanup(move || {
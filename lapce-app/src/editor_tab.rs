@@ -27,8 +27,8 @@
         location::EditorLocation,
     },
     id::{
-        DiffEditorId, EditorTabId, KeymapId, SettingsId, SplitId,
-        ThemeColorSettingsId, VoltViewId,
+        DiffEditorId, EditorTabId, ImagePreviewId, KeymapId, MarkdownPreviewId,
+        SettingsId, SplitId, ThemeColorSettingsId, VoltViewId,
     },
     main_split::{Editors, MainSplitData},
     plugin::PluginData,
@@ -43,6 +43,8 @@ pub enum EditorTabChildInfo {
     ThemeColorSettings,
     Keymap,
     Volt(VoltID),
+    ImagePreview(PathBuf),
+    MarkdownPreview(PathBuf),
 }
 
 impl EditorTabChildInfo {
@@ -70,6 +72,15 @@ pub fn to_data(
             EditorTabChildInfo::Volt(id) => {
                 EditorTabChild::Volt(VoltViewId::next(), id.to_owned())
             }
+            EditorTabChildInfo::ImagePreview(path) => {
+                EditorTabChild::ImagePreview(ImagePreviewId::next(), path.to_owned())
+            }
+            EditorTabChildInfo::MarkdownPreview(path) => {
+                EditorTabChild::MarkdownPreview(
+                    MarkdownPreviewId::next(),
+                    path.to_owned(),
+                )
+            }
         }
     }
 }
@@ -131,6 +142,7 @@ pub enum EditorTabChildSource {
     ThemeColorSettings,
     Keymap,
     Volt(VoltID),
+    ImagePreview(PathBuf),
 }
 
 #[derive(Clone, Debug, PartialEq, Eq)]
@@ -141,6 +153,8 @@ pub enum EditorTabChild {
     ThemeColorSettings(ThemeColorSettingsId),
     Keymap(KeymapId),
     Volt(VoltViewId, VoltID),
+    ImagePreview(ImagePreviewId, PathBuf),
+    MarkdownPreview(MarkdownPreviewId, PathBuf),
 }
 
 #[derive(PartialEq)]
@@ -162,6 +176,8 @@ pub fn id(&self) -> u64 {
             EditorTabChild::ThemeColorSettings(id) => id.to_raw(),
             EditorTabChild::Keymap(id) => id.to_raw(),
             EditorTabChild::Volt(id, _) => id.to_raw(),
+            EditorTabChild::ImagePreview(id, _) => id.to_raw(),
+            EditorTabChild::MarkdownPreview(id, _) => id.to_raw(),
         }
     }
 
@@ -195,6 +211,12 @@ pub fn child_info(&self, data: &WindowTabData) -> EditorTabChildInfo {
             }
             EditorTabChild::Keymap(_) => EditorTabChildInfo::Keymap,
             EditorTabChild::Volt(_, id) => EditorTabChildInfo::Volt(id.to_owned()),
+            EditorTabChild::ImagePreview(_, path) => {
+                EditorTabChildInfo::ImagePreview(path.to_owned())
+            }
+            EditorTabChild::MarkdownPreview(_, path) => {
+                EditorTabChildInfo::MarkdownPreview(path.to_owned())
+            }
         }
     }
 
@@ -213,11 +235,12 @@ pub fn view_info(
                     let doc = editor_data.doc_signal().get();
                     let (content, is_pristine, confirmed) = (
                         doc.content.get(),
-                        doc.buffer.with(|b| b.is_pristine()),
+                        doc.is_pristine_tracked(),
                         editor_data.confirmed,
                     );
                     match content {
-                        DocContent::File { path, .. } => {
+                        DocContent::File { path, .. }
+                        | DocContent::Binary { path } => {
                             Some((path, confirmed, is_pristine))
                         }
                         DocContent::Local => None,
@@ -271,13 +294,11 @@ pub fn view_info(
                         [diff_editor_data.left, diff_editor_data.right].map(|data| {
                             let (content, is_pristine) =
                                 data.doc_signal().with(|doc| {
-                                    (
-                                        doc.content.get(),
-                                        doc.buffer.with(|b| b.is_pristine()),
-                                    )
+                                    (doc.content.get(), doc.is_pristine_tracked())
                                 });
                             match content {
-                                DocContent::File { path, .. } => {
+                                DocContent::File { path, .. }
+                                | DocContent::Binary { path } => {
                                     Some((path, is_pristine))
                                 }
                                 DocContent::Local => None,
@@ -398,6 +419,36 @@ pub fn view_info(
                     is_pristine: true,
                 }
             }),
+            EditorTabChild::ImagePreview(_, path) => create_memo(move |_| {
+                let config = config.get();
+                let (icon, color) = config.file_svg(&path);
+                EditorTabChildViewInfo {
+                    icon,
+                    color,
+                    name: path
+                        .file_name()
+                        .unwrap_or_default()
+                        .to_string_lossy()
+                        .into_owned(),
+                    path: Some(path.clone()),
+                    confirmed: None,
+                    is_pristine: true,
+                }
+            }),
+            EditorTabChild::MarkdownPreview(_, path) => create_memo(move |_| {
+                let config = config.get();
+                let (icon, color) = config.file_svg(&path);
+                let file_name =
+                    path.file_name().unwrap_or_default().to_string_lossy();
+                EditorTabChildViewInfo {
+                    icon,
+                    color,
+                    name: format!("Preview {file_name}"),
+                    path: Some(path.clone()),
+                    confirmed: None,
+                    is_pristine: true,
+                }
+            }),
         }
     }
 }
@@ -440,6 +491,18 @@ pub fn get_editor(
         None
     }
 
+    pub fn get_image_preview(&self, path: &Path) -> Option<usize> {
+        self.children.iter().position(|(_, _, child)| {
+            matches!(child, EditorTabChild::ImagePreview(_, p) if p == path)
+        })
+    }
+
+    pub fn get_markdown_preview(&self, path: &Path) -> Option<usize> {
+        self.children.iter().position(|(_, _, child)| {
+            matches!(child, EditorTabChild::MarkdownPreview(_, p) if p == path)
+        })
+    }
+
     pub fn get_unconfirmed_editor_tab_child(
         &self,
         editors: Editors,
@@ -24,6 +24,7 @@
 
 use super::{data::FileExplorerData, node::FileNodeVirtualList};
 use crate::{
+    accessibility::KeyboardActivate,
     app::clickable_icon,
     command::InternalCommand,
     config::{LapceConfig, color::LapceColor, icon::LapceIcons},
@@ -432,9 +433,9 @@ fn file_explorer_view(
                     let double_click_path = path.clone();
                     let secondary_click_path = path.clone();
                     let aux_click_path = path.clone();
-                    view.on_click_stop({
+                    view.on_activate({
                         let kind = kind.clone();
-                        move |_| {
+                        move || {
                             click_data.click(&click_path, config);
                             select.update(|x| *x = Some(kind.clone()));
                         }
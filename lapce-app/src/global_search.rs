@@ -71,6 +71,7 @@ fn run_command(
                 return self.editor.run_command(command, count, mods);
             }
             CommandKind::MotionMode(_) => {}
+            CommandKind::Plugin(_) => {}
         }
         CommandExecuted::No
     }
@@ -0,0 +1,1228 @@
+//! Viewing and editing files that aren't text as bytes, with offset, hex and
+//! text columns.
+
+use std::{
+    collections::{HashMap, HashSet},
+    ops::Range,
+    path::PathBuf,
+    rc::Rc,
+    sync::Arc,
+};
+
+use floem::{
+    View,
+    event::EventListener,
+    ext_event::create_ext_action,
+    kurbo::Rect,
+    reactive::{
+        ReadSignal, RwSignal, Scope, SignalGet, SignalUpdate, SignalWith,
+        create_memo,
+    },
+    style::CursorStyle,
+    views::{
+        Decorators, VirtualVector, editor::command::CommandExecuted,
+        editor::text::SystemClipboard, label, scroll, stack, stack_from_iter,
+        virtual_stack,
+    },
+};
+use lapce_core::{
+    command::{EditCommand, FocusCommand, ScrollCommand},
+    movement::{LinePosition, Movement},
+    register::Clipboard,
+};
+use lapce_rpc::{file::FilePiece, proxy::ProxyResponse};
+
+use crate::{
+    app::tooltip_label,
+    command::{CommandKind, InternalCommand, LapceCommand, LapceWorkbenchCommand},
+    config::{LapceConfig, color::LapceColor},
+    editor::EditorData,
+    window_tab::{CommonData, Focus},
+};
+
+/// The number of bytes shown on each row
+pub const BYTES_PER_ROW: usize = 16;
+/// How much of the file is read from the proxy at a time, as it's scrolled to
+const BLOCK_LEN: u64 = 64 * 1024;
+/// How many blocks of the file are kept once read. The ones furthest from the
+/// block read last are dropped first.
+const MAX_BLOCKS: usize = 256;
+
+/// A change to a single byte, kept for undo and redo
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+enum ByteEdit {
+    Replace { offset: usize, old: u8, new: u8 },
+    Insert { offset: usize, byte: u8 },
+    Remove { offset: usize, byte: u8 },
+}
+
+impl ByteEdit {
+    fn offset(self) -> usize {
+        match self {
+            ByteEdit::Replace { offset, .. }
+            | ByteEdit::Insert { offset, .. }
+            | ByteEdit::Remove { offset, .. } => offset,
+        }
+    }
+
+    fn apply(self, pieces: &mut Pieces) {
+        match self {
+            ByteEdit::Replace { offset, new, .. } => pieces.replace(offset, new),
+            ByteEdit::Insert { offset, byte } => pieces.insert(offset, byte),
+            ByteEdit::Remove { offset, .. } => pieces.remove(offset),
+        }
+    }
+
+    fn inverse(self) -> ByteEdit {
+        match self {
+            ByteEdit::Replace { offset, old, new } => ByteEdit::Replace {
+                offset,
+                old: new,
+                new: old,
+            },
+            ByteEdit::Insert { offset, byte } => ByteEdit::Remove { offset, byte },
+            ByteEdit::Remove { offset, byte } => ByteEdit::Insert { offset, byte },
+        }
+    }
+}
+
+/// Where a byte of the edited file comes from
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+enum Located {
+    /// The file on disk, at this offset
+    File(u64),
+    /// The bytes put in the file, which this one is
+    Byte(u8),
+}
+
+/// The file as edited, made of pieces of the file on disk and the bytes put
+/// between them. Only these pieces are sent to the proxy to save or search the
+/// file, so the bytes that weren't changed are never read for them.
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+struct Pieces(Vec<FilePiece>);
+
+impl Pieces {
+    fn new(file_len: u64) -> Self {
+        let file = FilePiece::File {
+            offset: 0,
+            len: file_len,
+        };
+        Pieces(if file_len > 0 { vec![file] } else { Vec::new() })
+    }
+
+    fn len(&self) -> usize {
+        self.0.iter().map(|piece| piece.len() as usize).sum()
+    }
+
+    fn locate(&self, offset: usize) -> Option<Located> {
+        let mut start = 0;
+        for piece in &self.0 {
+            let len = piece.len() as usize;
+            if offset < start + len {
+                let at = offset - start;
+                return Some(match piece {
+                    FilePiece::File { offset, .. } => {
+                        Located::File(offset + at as u64)
+                    }
+                    FilePiece::Bytes(bytes) => Located::Byte(bytes[at]),
+                });
+            }
+            start += len;
+        }
+        None
+    }
+
+    /// Split the piece `offset` is in so that a piece starts there, returning
+    /// the index of that piece.
+    fn split(&mut self, offset: usize) -> usize {
+        let mut start = 0;
+        for i in 0..self.0.len() {
+            let len = self.0[i].len() as usize;
+            if offset == start {
+                return i;
+            }
+            if offset < start + len {
+                let at = offset - start;
+                let (before, after) = match &self.0[i] {
+                    FilePiece::File { offset, len } => (
+                        FilePiece::File {
+                            offset: *offset,
+                            len: at as u64,
+                        },
+                        FilePiece::File {
+                            offset: offset + at as u64,
+                            len: len - at as u64,
+                        },
+                    ),
+                    FilePiece::Bytes(bytes) => (
+                        FilePiece::Bytes(bytes[..at].to_vec()),
+                        FilePiece::Bytes(bytes[at..].to_vec()),
+                    ),
+                };
+                self.0[i] = before;
+                self.0.insert(i + 1, after);
+                return i + 1;
+            }
+            start += len;
+        }
+        self.0.len()
+    }
+
+    fn replace(&mut self, offset: usize, byte: u8) {
+        let i = self.split(offset);
+        self.split(offset + 1);
+        self.0[i] = FilePiece::Bytes(vec![byte]);
+        self.join();
+    }
+
+    fn insert(&mut self, offset: usize, byte: u8) {
+        let i = self.split(offset);
+        self.0.insert(i, FilePiece::Bytes(vec![byte]));
+        self.join();
+    }
+
+    fn remove(&mut self, offset: usize) {
+        let i = self.split(offset);
+        self.split(offset + 1);
+        self.0.remove(i);
+        self.join();
+    }
+
+    /// Join the pieces that follow on from each other, so typing doesn't leave
+    /// a piece per byte.
+    fn join(&mut self) {
+        let mut joined: Vec<FilePiece> = Vec::with_capacity(self.0.len());
+        for piece in self.0.drain(..) {
+            match (joined.last_mut(), piece) {
+                (Some(FilePiece::Bytes(last)), FilePiece::Bytes(bytes)) => {
+                    last.extend_from_slice(&bytes);
+                }
+                (
+                    Some(FilePiece::File { offset, len }),
+                    FilePiece::File {
+                        offset: next,
+                        len: next_len,
+                    },
+                ) if *offset + *len == next => *len += next_len,
+                (_, piece) => joined.push(piece),
+            }
+        }
+        self.0 = joined;
+    }
+}
+
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+pub struct HexCursor {
+    pub offset: usize,
+    /// Whether the next hex digit typed sets the low half of the byte
+    pub low_nibble: bool,
+    /// Whether typing goes to the text column rather than the hex one
+    pub text_column: bool,
+}
+
+/// A binary file, with the cursor and edit history of the hex editor showing
+/// it. Only the blocks of the file that are scrolled to are read.
+#[derive(Clone)]
+pub struct HexData {
+    pub path: PathBuf,
+    pieces: RwSignal<Pieces>,
+    /// The blocks of the file that have been read, by their index
+    blocks: RwSignal<HashMap<u64, Rc<Vec<u8>>>>,
+    /// The blocks being read
+    reading: RwSignal<HashSet<u64>>,
+    /// Counts the saves of the file, after which the blocks read before are
+    /// out of date
+    generation: RwSignal<u64>,
+    /// Whether the start of the file is still being read, until which its
+    /// length isn't known and it can't be edited
+    pub loading: RwSignal<bool>,
+    pub cursor: RwSignal<HexCursor>,
+    /// Whether typing inserts bytes rather than overwriting them
+    pub insert_mode: RwSignal<bool>,
+    /// The number of matches of the last search, if there was one
+    pub search_matches: RwSignal<Option<usize>>,
+    search: RwSignal<Option<Vec<u8>>>,
+    /// The offsets of the matches of the last search, and the revision they
+    /// were found in
+    matches: RwSignal<Option<(u64, Vec<usize>)>>,
+    /// How many rows fit in the view, for paging
+    page_rows: RwSignal<usize>,
+    rev: RwSignal<u64>,
+    saved_rev: RwSignal<u64>,
+    undos: RwSignal<Vec<Vec<ByteEdit>>>,
+    redos: RwSignal<Vec<Vec<ByteEdit>>>,
+    scope: Scope,
+    common: Rc<CommonData>,
+}
+
+impl HexData {
+    pub fn new(cx: Scope, path: PathBuf, common: Rc<CommonData>) -> Self {
+        Self {
+            path,
+            pieces: cx.create_rw_signal(Pieces::default()),
+            blocks: cx.create_rw_signal(HashMap::new()),
+            reading: cx.create_rw_signal(HashSet::new()),
+            generation: cx.create_rw_signal(0),
+            loading: cx.create_rw_signal(false),
+            cursor: cx.create_rw_signal(HexCursor::default()),
+            insert_mode: cx.create_rw_signal(false),
+            search_matches: cx.create_rw_signal(None),
+            search: cx.create_rw_signal(None),
+            matches: cx.create_rw_signal(None),
+            page_rows: cx.create_rw_signal(1),
+            rev: cx.create_rw_signal(0),
+            saved_rev: cx.create_rw_signal(0),
+            undos: cx.create_rw_signal(Vec::new()),
+            redos: cx.create_rw_signal(Vec::new()),
+            scope: cx,
+            common,
+        }
+    }
+
+    /// Read the start of the file, which tells its length.
+    pub fn load(&self) {
+        self.loading.set(true);
+        self.read_block(0);
+    }
+
+    /// Read a block of the file from the proxy, unless it's being read already.
+    fn read_block(&self, block: u64) {
+        if self
+            .reading
+            .with_untracked(|reading| reading.contains(&block))
+        {
+            return;
+        }
+        self.reading.update(|reading| {
+            reading.insert(block);
+        });
+        let generation = self.generation.get_untracked();
+        let hex = self.clone();
+        let send = create_ext_action(self.scope, move |result| {
+            hex.reading.update(|reading| {
+                reading.remove(&block);
+            });
+            if hex.generation.get_untracked() != generation {
+                return;
+            }
+            match result {
+                Ok(ProxyResponse::ReadFileRangeResponse { data, file_len }) => {
+                    hex.blocks.update(|blocks| {
+                        while blocks.len() >= MAX_BLOCKS {
+                            let Some(furthest) = blocks
+                                .keys()
+                                .copied()
+                                .max_by_key(|b| b.abs_diff(block))
+                            else {
+                                break;
+                            };
+                            blocks.remove(&furthest);
+                        }
+                        blocks.insert(block, Rc::new(data));
+                    });
+                    if hex.loading.get_untracked() {
+                        hex.pieces.set(Pieces::new(file_len));
+                        hex.loading.set(false);
+                    }
+                }
+                Ok(_) => {}
+                Err(err) => {
+                    hex.loading.set(false);
+                    hex.common
+                        .internal_command
+                        .send(InternalCommand::ShowAlert {
+                            title: "Failed to read the file".to_string(),
+                            msg: err.message,
+                            buttons: Vec::new(),
+                        });
+                }
+            }
+        });
+        self.common.proxy.read_file_range(
+            self.path.clone(),
+            block * BLOCK_LEN,
+            BLOCK_LEN,
+            move |result| {
+                send(result);
+            },
+        );
+    }
+
+    /// The byte at `offset`, if its block of the file has been read. The block
+    /// is read otherwise, and the byte is there once the signals update.
+    pub fn byte_at(&self, offset: usize) -> Option<u8> {
+        let located = self.pieces.with(|pieces| pieces.locate(offset))?;
+        let byte = self.blocks.with(|blocks| resolve(blocks, located));
+        self.read_missing(byte, located)
+    }
+
+    fn byte_at_untracked(&self, offset: usize) -> Option<u8> {
+        let located = self.pieces.with_untracked(|pieces| pieces.locate(offset))?;
+        let byte = self
+            .blocks
+            .with_untracked(|blocks| resolve(blocks, located));
+        self.read_missing(byte, located)
+    }
+
+    fn read_missing(&self, byte: Option<u8>, located: Located) -> Option<u8> {
+        if let (None, Located::File(offset)) = (byte, located) {
+            self.read_block(offset / BLOCK_LEN);
+        }
+        byte
+    }
+
+    /// Write the edits back to the file. Only the pieces of it are sent, for
+    /// the proxy to write the bytes that changed.
+    pub fn save(&self, after_action: impl FnOnce() + 'static) {
+        let rev = self.rev.get_untracked();
+        // The pieces sent have to stay as they are until the file is written
+        self.loading.set(true);
+        let hex = self.clone();
+        let send = create_ext_action(self.scope, move |result| match result {
+            Ok(_) => {
+                hex.loading.set(false);
+                hex.saved_rev.set(rev);
+                // The file now has the bytes where the pieces put them
+                hex.generation.update(|generation| *generation += 1);
+                hex.blocks.set(HashMap::new());
+                let len = hex.pieces.with_untracked(|pieces| pieces.len());
+                hex.pieces.set(Pieces::new(len as u64));
+                after_action();
+            }
+            Err(err) => {
+                hex.loading.set(false);
+                hex.common
+                    .internal_command
+                    .send(InternalCommand::ShowAlert {
+                        title: "Failed to save the file".to_string(),
+                        msg: err.message,
+                        buttons: Vec::new(),
+                    });
+            }
+        });
+        self.common.proxy.write_file(
+            self.path.clone(),
+            self.pieces.get_untracked().0,
+            move |result| {
+                send(result);
+            },
+        );
+    }
+
+    pub fn is_dirty(&self) -> bool {
+        self.rev.get() != self.saved_rev.get()
+    }
+
+    pub fn is_dirty_untracked(&self) -> bool {
+        self.rev.get_untracked() != self.saved_rev.get_untracked()
+    }
+
+    pub fn len(&self) -> usize {
+        self.pieces.with_untracked(|pieces| pieces.len())
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+
+    /// Put the cursor on `offset`, which may be just past the last byte so
+    /// bytes can be appended.
+    pub fn go_to(&self, offset: usize) {
+        let offset = offset.min(self.len());
+        self.cursor.update(|cursor| {
+            cursor.offset = offset;
+            cursor.low_nibble = false;
+        });
+    }
+
+    fn move_by(&self, delta: isize) {
+        let offset = self.cursor.get_untracked().offset;
+        self.go_to(offset.saturating_add_signed(delta));
+    }
+
+    pub fn toggle_insert_mode(&self) {
+        self.insert_mode
+            .update(|insert_mode| *insert_mode = !*insert_mode);
+    }
+
+    /// Handle a command sent to the editor showing the file. `None` is returned
+    /// for the commands the editor should run itself, like saving or splitting.
+    pub fn run_command(
+        &self,
+        kind: &CommandKind,
+        count: Option<usize>,
+    ) -> Option<CommandExecuted> {
+        let count = count.unwrap_or(1);
+        let row = BYTES_PER_ROW as isize;
+        match kind {
+            CommandKind::Move(cmd) => {
+                let offset = self.cursor.get_untracked().offset;
+                let row_start = offset - offset % BYTES_PER_ROW;
+                match cmd.to_movement(Some(count)) {
+                    Movement::Left => self.move_by(-(count as isize)),
+                    Movement::Right => self.move_by(count as isize),
+                    Movement::Up => self.move_by(-row * count as isize),
+                    Movement::Down => self.move_by(row * count as isize),
+                    Movement::StartOfLine | Movement::FirstNonBlank => {
+                        self.go_to(row_start)
+                    }
+                    Movement::EndOfLine => self.go_to(row_start + BYTES_PER_ROW - 1),
+                    Movement::DocumentStart
+                    | Movement::Line(LinePosition::First) => self.go_to(0),
+                    Movement::DocumentEnd | Movement::Line(LinePosition::Last) => {
+                        self.go_to(self.len())
+                    }
+                    Movement::Line(LinePosition::Line(line)) => {
+                        self.go_to(line.saturating_sub(1) * BYTES_PER_ROW)
+                    }
+                    Movement::Offset(offset) => self.go_to(offset),
+                    _ => return Some(CommandExecuted::No),
+                }
+            }
+            CommandKind::Scroll(cmd) => {
+                let page = self.page_rows.get_untracked().max(1) as isize * row;
+                match cmd {
+                    ScrollCommand::PageUp => self.move_by(-page),
+                    ScrollCommand::PageDown => self.move_by(page),
+                    ScrollCommand::ScrollUp => self.move_by(-row * count as isize),
+                    ScrollCommand::ScrollDown => self.move_by(row * count as isize),
+                    ScrollCommand::CenterOfWindow
+                    | ScrollCommand::TopOfWindow
+                    | ScrollCommand::BottomOfWindow => {}
+                }
+            }
+            CommandKind::Edit(cmd) => match cmd {
+                EditCommand::DeleteBackward => self.delete(false),
+                EditCommand::DeleteForward => self.delete(true),
+                EditCommand::Undo => self.undo(),
+                EditCommand::Redo => self.redo(),
+                EditCommand::InsertTab => self.switch_column(),
+                EditCommand::ClipboardPaste => {
+                    if let Some(s) = SystemClipboard::new().get_string() {
+                        self.paste(&s);
+                    }
+                }
+                EditCommand::InsertMode | EditCommand::NormalMode => {}
+                _ => return Some(CommandExecuted::No),
+            },
+            CommandKind::Focus(cmd) => match cmd {
+                FocusCommand::Search => {
+                    self.common.lapce_command.send(LapceCommand {
+                        kind: CommandKind::Workbench(
+                            LapceWorkbenchCommand::SearchBytes,
+                        ),
+                        data: None,
+                    });
+                }
+                FocusCommand::SearchForward => self.find_next(true),
+                FocusCommand::SearchBackward => self.find_next(false),
+                _ => return None,
+            },
+            CommandKind::MotionMode(_) | CommandKind::MultiSelection(_) => {
+                return Some(CommandExecuted::No);
+            }
+            CommandKind::Workbench(_) | CommandKind::Plugin(_) => return None,
+        }
+        Some(CommandExecuted::Yes)
+    }
+
+    fn switch_column(&self) {
+        self.cursor.update(|cursor| {
+            cursor.text_column = !cursor.text_column;
+            cursor.low_nibble = false;
+        });
+    }
+
+    /// Type `c` into the column the cursor is in.
+    pub fn receive_char(&self, c: &str) {
+        if self.cursor.get_untracked().text_column {
+            self.write_bytes(c.as_bytes());
+        } else {
+            for digit in c.chars().filter_map(|c| c.to_digit(16)) {
+                self.write_nibble(digit as u8);
+            }
+        }
+    }
+
+    /// Paste text into the text column, or hex bytes into the hex column.
+    fn paste(&self, s: &str) {
+        if self.cursor.get_untracked().text_column {
+            self.write_bytes(s.as_bytes());
+        } else if let Some(bytes) = parse_byte_pattern(s) {
+            self.write_bytes(&bytes);
+        }
+    }
+
+    /// Write `new` at the cursor, as one undo step. Bytes past the end of the
+    /// file are always inserted.
+    fn write_bytes(&self, new: &[u8]) {
+        let offset = self.cursor.get_untracked().offset;
+        let insert_mode = self.insert_mode.get_untracked();
+        let len = self.len();
+        // The bytes written over have to be read, to be put back on undo
+        let Some(edits) = new
+            .iter()
+            .enumerate()
+            .map(|(i, &byte)| {
+                let offset = offset + i;
+                if insert_mode || offset >= len {
+                    return Some(ByteEdit::Insert { offset, byte });
+                }
+                let old = self.byte_at_untracked(offset)?;
+                Some(ByteEdit::Replace {
+                    offset,
+                    old,
+                    new: byte,
+                })
+            })
+            .collect::<Option<Vec<_>>>()
+        else {
+            return;
+        };
+        if self.edit(edits) {
+            self.go_to(offset + new.len());
+        }
+    }
+
+    fn write_nibble(&self, digit: u8) {
+        let cursor = self.cursor.get_untracked();
+        let offset = cursor.offset;
+        let old = self.byte_at_untracked(offset);
+        if old.is_none() && offset < self.len() {
+            return;
+        }
+        let edit = match old {
+            Some(old) if cursor.low_nibble => ByteEdit::Replace {
+                offset,
+                old,
+                new: (old & 0xf0) | digit,
+            },
+            Some(old) if !self.insert_mode.get_untracked() => ByteEdit::Replace {
+                offset,
+                old,
+                new: (old & 0x0f) | (digit << 4),
+            },
+            _ => ByteEdit::Insert {
+                offset,
+                byte: digit << 4,
+            },
+        };
+        if !self.edit(vec![edit]) {
+            return;
+        }
+        if cursor.low_nibble {
+            self.go_to(offset + 1);
+        } else {
+            self.cursor.update(|cursor| cursor.low_nibble = true);
+        }
+    }
+
+    /// Remove the byte before or under the cursor in insert mode. Overwriting
+    /// keeps the length of the file, so it only moves the cursor back.
+    fn delete(&self, forward: bool) {
+        let offset = self.cursor.get_untracked().offset;
+        if !self.insert_mode.get_untracked() {
+            if !forward {
+                self.move_by(-1);
+            }
+            return;
+        }
+        let offset = if forward {
+            offset
+        } else if let Some(offset) = offset.checked_sub(1) {
+            offset
+        } else {
+            return;
+        };
+        let Some(byte) = self.byte_at_untracked(offset) else {
+            return;
+        };
+        if self.edit(vec![ByteEdit::Remove { offset, byte }]) {
+            self.go_to(offset);
+        }
+    }
+
+    /// Apply `edits` as one undo step. Nothing is changed while the file is
+    /// still being read.
+    fn edit(&self, edits: Vec<ByteEdit>) -> bool {
+        if self.loading.get_untracked() || edits.is_empty() {
+            return false;
+        }
+        self.pieces.update(|pieces| {
+            for edit in &edits {
+                edit.apply(pieces);
+            }
+        });
+        self.undos.update(|undos| undos.push(edits));
+        self.redos.update(|redos| redos.clear());
+        self.rev.update(|rev| *rev += 1);
+        true
+    }
+
+    fn undo(&self) {
+        let Some(edits) = self.undos.try_update(|undos| undos.pop()).flatten()
+        else {
+            return;
+        };
+        self.pieces.update(|pieces| {
+            for edit in edits.iter().rev() {
+                edit.inverse().apply(pieces);
+            }
+        });
+        if let Some(edit) = edits.first() {
+            self.go_to(edit.offset());
+        }
+        self.redos.update(|redos| redos.push(edits));
+        self.rev.update(|rev| *rev += 1);
+    }
+
+    fn redo(&self) {
+        let Some(edits) = self.redos.try_update(|redos| redos.pop()).flatten()
+        else {
+            return;
+        };
+        self.pieces.update(|pieces| {
+            for edit in &edits {
+                edit.apply(pieces);
+            }
+        });
+        if let Some(edit) = edits.last() {
+            self.go_to(edit.offset());
+        }
+        self.undos.update(|undos| undos.push(edits));
+        self.rev.update(|rev| *rev += 1);
+    }
+
+    /// Search for `pattern`, moving the cursor to its first match from there.
+    pub fn find(&self, pattern: Vec<u8>) {
+        let offset = self.cursor.get_untracked().offset;
+        self.search.set(Some(pattern.clone()));
+        self.search_matches.set(None);
+        self.search_file(pattern, offset, true);
+    }
+
+    /// Move the cursor to the next or previous match of the last search,
+    /// wrapping around the ends of the file. The file is searched again if it
+    /// was edited since.
+    pub fn find_next(&self, forward: bool) {
+        let Some(pattern) = self.search.get_untracked() else {
+            return;
+        };
+        let offset = self.cursor.get_untracked().offset;
+        let from = if forward { offset + 1 } else { offset };
+        let rev = self.rev.get_untracked();
+        let found = self.matches.with_untracked(|matches| {
+            matches
+                .as_ref()
+                .filter(|(matches_rev, _)| *matches_rev == rev)
+                .map(|(_, matches)| next_match(matches, from, forward))
+        });
+        match found {
+            Some(found) => {
+                if let Some(found) = found {
+                    self.go_to(found);
+                }
+            }
+            None => self.search_file(pattern, from, forward),
+        }
+    }
+
+    /// Have the proxy search the file as edited, then move the cursor to the
+    /// match from `from`.
+    fn search_file(&self, pattern: Vec<u8>, from: usize, forward: bool) {
+        let rev = self.rev.get_untracked();
+        let hex = self.clone();
+        let send = create_ext_action(self.scope, move |result| {
+            if let Ok(ProxyResponse::FindBytesResponse { matches, count }) = result {
+                let matches: Vec<usize> =
+                    matches.into_iter().map(|offset| offset as usize).collect();
+                hex.search_matches.set(Some(count as usize));
+                if let Some(found) = next_match(&matches, from, forward) {
+                    hex.go_to(found);
+                }
+                hex.matches.set(Some((rev, matches)));
+            }
+        });
+        self.common.proxy.find_bytes(
+            self.path.clone(),
+            self.pieces.get_untracked().0,
+            pattern,
+            move |result| {
+                send(result);
+            },
+        );
+    }
+}
+
+/// The byte at `located` if it's been read, out of the `blocks` of the file.
+fn resolve(blocks: &HashMap<u64, Rc<Vec<u8>>>, located: Located) -> Option<u8> {
+    match located {
+        Located::Byte(byte) => Some(byte),
+        Located::File(offset) => blocks
+            .get(&(offset / BLOCK_LEN))
+            .and_then(|block| block.get((offset % BLOCK_LEN) as usize))
+            .copied(),
+    }
+}
+
+/// Parse an offset typed to go to, either decimal or hex with a `0x` prefix.
+pub fn parse_offset(input: &str) -> Option<usize> {
+    let input = input.trim().replace('_', "");
+    match input
+        .strip_prefix("0x")
+        .or_else(|| input.strip_prefix("0X"))
+    {
+        Some(hex) => usize::from_str_radix(hex, 16).ok(),
+        None => input.parse().ok(),
+    }
+}
+
+/// Parse the bytes to search for or paste. Text in double quotes is taken as
+/// its UTF-8 bytes, anything else as hex digits, which may be separated by
+/// whitespace.
+pub fn parse_byte_pattern(input: &str) -> Option<Vec<u8>> {
+    let input = input.trim();
+    if let Some(text) = input
+        .strip_prefix('"')
+        .and_then(|input| input.strip_suffix('"'))
+    {
+        return (!text.is_empty()).then(|| text.as_bytes().to_vec());
+    }
+
+    let digits: Vec<u8> = input
+        .split_whitespace()
+        .flat_map(|word| {
+            let word = word
+                .strip_prefix("0x")
+                .or_else(|| word.strip_prefix("0X"))
+                .unwrap_or(word);
+            word.chars().map(|c| c.to_digit(16).map(|d| d as u8))
+        })
+        .collect::<Option<_>>()?;
+    if digits.is_empty() || digits.len() % 2 != 0 {
+        return None;
+    }
+    Some(digits.chunks(2).map(|d| (d[0] << 4) | d[1]).collect())
+}
+
+/// The match at or after `from` out of the sorted offsets of the `matches`, or
+/// before it when searching backwards, wrapping around the ends of the file.
+pub fn next_match(matches: &[usize], from: usize, forward: bool) -> Option<usize> {
+    if forward {
+        matches
+            .iter()
+            .find(|offset| **offset >= from)
+            .or(matches.first())
+            .copied()
+    } else {
+        matches
+            .iter()
+            .rev()
+            .find(|offset| **offset < from)
+            .or(matches.last())
+            .copied()
+    }
+}
+
+/// The character shown for a byte in the text column.
+pub fn byte_char(byte: u8) -> char {
+    if byte.is_ascii_graphic() || byte == b' ' {
+        byte as char
+    } else {
+        '.'
+    }
+}
+
+/// Describe the `bytes` at `offset` as the numbers they'd be read as, in both
+/// byte orders, for the data inspector.
+pub fn inspect(bytes: &[u8], offset: usize) -> String {
+    if bytes.is_empty() {
+        return String::new();
+    }
+    let mut lines = vec![format!(
+        "Offset: {offset} (0x{offset:X})\nu8: {}  i8: {}  bin: {:08b}",
+        bytes[0], bytes[0] as i8, bytes[0]
+    )];
+    if let Some(b) = bytes.first_chunk::<2>() {
+        lines.push(format!(
+            "u16: {} LE, {} BE",
+            u16::from_le_bytes(*b),
+            u16::from_be_bytes(*b)
+        ));
+        lines.push(format!(
+            "i16: {} LE, {} BE",
+            i16::from_le_bytes(*b),
+            i16::from_be_bytes(*b)
+        ));
+    }
+    if let Some(b) = bytes.first_chunk::<4>() {
+        lines.push(format!(
+            "u32: {} LE, {} BE",
+            u32::from_le_bytes(*b),
+            u32::from_be_bytes(*b)
+        ));
+        lines.push(format!(
+            "i32: {} LE, {} BE",
+            i32::from_le_bytes(*b),
+            i32::from_be_bytes(*b)
+        ));
+        lines.push(format!(
+            "f32: {} LE, {} BE",
+            f32::from_le_bytes(*b),
+            f32::from_be_bytes(*b)
+        ));
+    }
+    lines.join("\n")
+}
+
+struct HexRows(usize);
+
+impl VirtualVector<usize> for HexRows {
+    fn total_len(&self) -> usize {
+        self.0
+    }
+
+    fn slice(&mut self, range: Range<usize>) -> impl Iterator<Item = usize> {
+        range
+    }
+}
+
+/// The hex editor shown in place of the text editor for binary files.
+pub fn hex_editor_view(editor: EditorData, hex: HexData) -> impl View {
+    let config = editor.common.config;
+    let editor_tab_id = editor.editor_tab_id;
+    let internal_command = editor.common.internal_command;
+    let focus = editor.common.focus;
+    let HexData {
+        pieces,
+        reading,
+        cursor,
+        insert_mode,
+        page_rows,
+        ..
+    } = hex.clone();
+
+    let click = move |offset: usize, text_column: bool| {
+        if let Some(editor_tab_id) = editor_tab_id.get_untracked() {
+            internal_command.send(InternalCommand::FocusEditorTab { editor_tab_id });
+        }
+        focus.set(Focus::Workbench);
+        cursor.set(HexCursor {
+            offset: offset.min(pieces.with_untracked(|pieces| pieces.len())),
+            low_nibble: false,
+            text_column,
+        });
+    };
+
+    let row_view = move |row: usize| {
+        let start = row * BYTES_PER_ROW;
+        let hex = hex.clone();
+        // Blank until the block of the file the row is in has been read
+        let row_bytes = create_memo({
+            let hex = hex.clone();
+            move |_| {
+                (start..start + BYTES_PER_ROW)
+                    .map(|offset| hex.byte_at(offset))
+                    .collect::<Vec<_>>()
+            }
+        });
+        let byte_at = move |i: usize| row_bytes.with(|row| row[i]);
+        // Only the rows the cursor moves to or from are restyled
+        let row_cursor = create_memo(move |_| {
+            cursor.with(|cursor| {
+                (cursor.offset / BYTES_PER_ROW == row).then_some(*cursor)
+            })
+        });
+        let row_cursor = move || row_cursor.get();
+        stack((
+            offset_label(move || format!("{start:08X}"), config),
+            stack_from_iter((0..BYTES_PER_ROW).map(move |i| {
+                let offset = start + i;
+                tooltip_label(
+                    config,
+                    byte_cell(
+                        move || {
+                            byte_at(i)
+                                .map(|byte| format!("{byte:02X}"))
+                                .unwrap_or_else(|| "  ".to_string())
+                        },
+                        i,
+                        Some(offset),
+                        false,
+                        row_cursor,
+                        insert_mode,
+                        config,
+                    ),
+                    {
+                        let hex = hex.clone();
+                        move || {
+                            // The widest type the inspector shows is 4 bytes
+                            let bytes = (offset..offset + 4)
+                                .map_while(|offset| hex.byte_at(offset))
+                                .collect::<Vec<_>>();
+                            inspect(&bytes, offset)
+                        }
+                    },
+                )
+                .on_event_stop(
+                    EventListener::PointerDown,
+                    move |_| {
+                        click(offset, false);
+                    },
+                )
+            })),
+            stack_from_iter((0..BYTES_PER_ROW).map(move |i| {
+                let offset = start + i;
+                byte_cell(
+                    move || byte_at(i).map(byte_char).unwrap_or(' '),
+                    i,
+                    Some(offset),
+                    true,
+                    row_cursor,
+                    insert_mode,
+                    config,
+                )
+                .on_event_stop(
+                    EventListener::PointerDown,
+                    move |_| {
+                        click(offset, true);
+                    },
+                )
+            }))
+            .style(|s| s.padding_left(12.0)),
+        ))
+        .style(move |s| {
+            s.items_center()
+                .height(config.get().editor.line_height() as f32)
+                .padding_horiz(10.0)
+        })
+    };
+
+    stack((
+        stack((
+            offset_label(|| "Offset", config),
+            stack_from_iter((0..BYTES_PER_ROW).map(move |i| {
+                byte_cell(
+                    move || format!("{i:02X}"),
+                    i,
+                    None,
+                    false,
+                    || None,
+                    insert_mode,
+                    config,
+                )
+            })),
+            label(|| "Text").style(|s| s.padding_left(12.0)),
+            label(|| "Reading the file").style(move |s| {
+                s.padding_left(20.0)
+                    .apply_if(reading.with(|reading| reading.is_empty()), |s| {
+                        s.hide()
+                    })
+            }),
+        ))
+        .style(move |s| {
+            let config = config.get();
+            s.items_center()
+                .height(config.editor.line_height() as f32)
+                .padding_horiz(10.0)
+                .color(config.color(LapceColor::EDITOR_DIM))
+                .border_bottom(1.0)
+                .border_color(config.color(LapceColor::LAPCE_BORDER))
+        }),
+        scroll(
+            virtual_stack(
+                move || {
+                    HexRows(pieces.with(|pieces| pieces.len()) / BYTES_PER_ROW + 1)
+                },
+                |row| *row,
+                row_view,
+            )
+            .item_size_fixed(move || config.get().editor.line_height() as f64)
+            .style(|s| s.flex_col().min_width_full()),
+        )
+        .ensure_visible(move || {
+            let line_height = config.get_untracked().editor.line_height() as f64;
+            let row = cursor.get().offset / BYTES_PER_ROW;
+            Rect::from_origin_size(
+                (0.0, row as f64 * line_height),
+                (1.0, line_height),
+            )
+        })
+        .on_resize(move |rect| {
+            let line_height = config.get_untracked().editor.line_height() as f64;
+            page_rows.set((rect.height() / line_height) as usize);
+        })
+        .style(|s| s.width_full().flex_basis(0.0).flex_grow(1.0)),
+    ))
+    .style(move |s| {
+        let config = config.get();
+        s.flex_col()
+            .size_full()
+            .cursor(CursorStyle::Text)
+            .font_family(config.editor.font_family.clone())
+            .font_size(config.editor.font_size() as f32)
+            .color(config.color(LapceColor::EDITOR_FOREGROUND))
+            .background(config.color(LapceColor::EDITOR_BACKGROUND))
+    })
+    .debug_name("Hex Editor")
+}
+
+fn offset_label<S: std::fmt::Display + 'static>(
+    text: impl Fn() -> S + 'static,
+    config: ReadSignal<Arc<LapceConfig>>,
+) -> impl View {
+    // Wide enough for the 8 digits of an offset
+    label(move || format!("{:<8}", text())).style(move |s| {
+        s.padding_right(12.0)
+            .color(config.get().color(LapceColor::EDITOR_DIM))
+    })
+}
+
+/// A byte in the hex or text column, highlighted when the cursor is on it. The
+/// cursor's column is highlighted more strongly, with a caret in insert mode.
+fn byte_cell<S: std::fmt::Display + 'static>(
+    text: impl Fn() -> S + 'static,
+    column: usize,
+    offset: Option<usize>,
+    text_column: bool,
+    cursor: impl Fn() -> Option<HexCursor> + 'static,
+    insert_mode: RwSignal<bool>,
+    config: ReadSignal<Arc<LapceConfig>>,
+) -> impl View {
+    label(text).style(move |s| {
+        let config = config.get();
+        let cursor = cursor();
+        let at_cursor = cursor.is_some_and(|cursor| offset == Some(cursor.offset));
+        let in_column =
+            cursor.is_some_and(|cursor| cursor.text_column == text_column);
+        s.apply_if(!text_column, |s| {
+            s.padding_horiz(4.0)
+                .apply_if(column == BYTES_PER_ROW / 2, |s| s.margin_left(8.0))
+        })
+        .apply_if(at_cursor, |s| {
+            s.background(config.color(if in_column {
+                LapceColor::EDITOR_SELECTION
+            } else {
+                LapceColor::EDITOR_CURRENT_LINE
+            }))
+        })
+        .apply_if(at_cursor && in_column && insert_mode.get(), |s| {
+            s.border_left(2.0)
+                .border_color(config.color(LapceColor::EDITOR_CARET))
+        })
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_offset() {
+        assert_eq!(parse_offset("1024"), Some(1024));
+        assert_eq!(parse_offset(" 0x400 "), Some(1024));
+        assert_eq!(parse_offset("0X1_0000"), Some(0x10000));
+        assert_eq!(parse_offset("400h"), None);
+        assert_eq!(parse_offset(""), None);
+    }
+
+    #[test]
+    fn test_parse_byte_pattern() {
+        assert_eq!(parse_byte_pattern("4c 61 70"), Some(vec![0x4c, 0x61, 0x70]));
+        assert_eq!(
+            parse_byte_pattern("0xDEADbeef"),
+            Some(vec![0xde, 0xad, 0xbe, 0xef])
+        );
+        assert_eq!(parse_byte_pattern("\"Lap\""), Some(b"Lap".to_vec()));
+        assert_eq!(parse_byte_pattern("4c 6"), None);
+        assert_eq!(parse_byte_pattern("Lap"), None);
+        assert_eq!(parse_byte_pattern("\"\""), None);
+    }
+
+    #[test]
+    fn test_next_match() {
+        let matches = [1, 4];
+        assert_eq!(next_match(&matches, 0, true), Some(1));
+        assert_eq!(next_match(&matches, 1, true), Some(1));
+        assert_eq!(next_match(&matches, 2, true), Some(4));
+        // Wraps around to the start
+        assert_eq!(next_match(&matches, 5, true), Some(1));
+        assert_eq!(next_match(&matches, 4, false), Some(1));
+        // Wraps around to the end
+        assert_eq!(next_match(&matches, 1, false), Some(4));
+        assert_eq!(next_match(&[], 0, true), None);
+    }
+
+    #[test]
+    fn test_pieces() {
+        let mut pieces = Pieces::new(8);
+        assert_eq!(pieces.locate(3), Some(Located::File(3)));
+        assert_eq!(pieces.locate(8), None);
+
+        pieces.replace(2, 9);
+        pieces.insert(3, 7);
+        assert_eq!(pieces.len(), 9);
+        assert_eq!(
+            pieces.0,
+            vec![
+                FilePiece::File { offset: 0, len: 2 },
+                FilePiece::Bytes(vec![9, 7]),
+                FilePiece::File { offset: 3, len: 5 },
+            ]
+        );
+        assert_eq!(pieces.locate(3), Some(Located::Byte(7)));
+        assert_eq!(pieces.locate(4), Some(Located::File(3)));
+
+        // Taking out an inserted byte joins the file back up
+        pieces.insert(6, 1);
+        assert_eq!(pieces.0.len(), 5);
+        pieces.remove(6);
+        pieces.remove(3);
+        assert_eq!(
+            pieces.0,
+            vec![
+                FilePiece::File { offset: 0, len: 2 },
+                FilePiece::Bytes(vec![9]),
+                FilePiece::File { offset: 3, len: 5 },
+            ]
+        );
+        assert_eq!(Pieces::new(0).0, Vec::new());
+    }
+
+    #[test]
+    fn test_byte_edit_inverse() {
+        let mut pieces = Pieces(vec![FilePiece::Bytes(vec![1, 2, 3])]);
+        let edits = [
+            ByteEdit::Replace {
+                offset: 0,
+                old: 1,
+                new: 9,
+            },
+            ByteEdit::Insert { offset: 3, byte: 4 },
+            ByteEdit::Remove { offset: 1, byte: 2 },
+        ];
+        for edit in edits {
+            edit.apply(&mut pieces);
+        }
+        assert_eq!(pieces.0, vec![FilePiece::Bytes(vec![9, 3, 4])]);
+        for edit in edits.iter().rev() {
+            edit.inverse().apply(&mut pieces);
+        }
+        assert_eq!(pieces.0, vec![FilePiece::Bytes(vec![1, 2, 3])]);
+    }
+
+    #[test]
+    fn test_inspect() {
+        let bytes = [0x00, 0x00, 0x80, 0x3f];
+        let info = inspect(&bytes, 0);
+        assert!(info.contains("u16: 0 LE, 0 BE"));
+        assert!(info.contains("u32: 1065353216 LE, 32831 BE"));
+        assert!(info.contains("f32: 1 LE"));
+        // Too few bytes left for the wider types
+        let info = inspect(&bytes[3..], 3);
+        assert!(info.contains("Offset: 3"));
+        assert!(info.contains("u8: 63"));
+        assert!(!info.contains("u16"));
+        assert_eq!(inspect(&[], 4), "");
+    }
+}
@@ -7,5 +7,7 @@
 pub type KeymapId = Id;
 pub type ThemeColorSettingsId = Id;
 pub type VoltViewId = Id;
+pub type ImagePreviewId = Id;
+pub type MarkdownPreviewId = Id;
 pub type DiffEditorId = Id;
 pub type TerminalTabId = Id;
@@ -0,0 +1,751 @@
+//! Previewing image files in an editor tab, with zoom, fit to window and a
+//! pixel grid.
+
+use std::{
+    path::{Path, PathBuf},
+    rc::Rc,
+    sync::Arc,
+};
+
+use floem::{
+    Renderer, View, ViewId,
+    context::PaintCx,
+    event::{Event, EventListener, EventPropagation},
+    ext_event::create_ext_action,
+    kurbo::Stroke,
+    peniko::kurbo::{Line, Point, Rect, Size},
+    reactive::{
+        ReadSignal, RwSignal, Scope, SignalGet, SignalUpdate, SignalWith,
+        create_effect, create_memo,
+    },
+    style::{CursorStyle, TextColor},
+    views::{Decorators, container, empty, img, label, scroll, stack, svg},
+};
+use lapce_rpc::proxy::ProxyResponse;
+
+use crate::{
+    accessibility::KeyboardActivate,
+    command::{CommandKind, LapceCommand, LapceWorkbenchCommand},
+    config::{LapceConfig, color::LapceColor},
+    doc::Doc,
+    window_tab::CommonData,
+};
+
+/// The file extensions that open in the image preview
+const IMAGE_EXTENSIONS: &[&str] =
+    &["png", "jpg", "jpeg", "gif", "bmp", "ico", "webp", "svg"];
+/// How much of the image is read from the proxy per request
+const READ_CHUNK_LEN: u64 = 4 * 1024 * 1024;
+/// Images bigger than this aren't previewed
+const MAX_IMAGE_LEN: u64 = 64 * 1024 * 1024;
+/// The zoom levels that zooming in and out steps through
+const ZOOM_LEVELS: &[f64] = &[
+    0.05, 0.1, 0.25, 0.5, 0.75, 1.0, 1.5, 2.0, 3.0, 4.0, 6.0, 8.0, 12.0, 16.0, 24.0,
+    32.0,
+];
+/// The zoom from which the pixel grid is drawn
+const PIXEL_GRID_MIN_ZOOM: f64 = 4.0;
+/// The space kept around the image
+const PADDING: f64 = 20.0;
+
+pub fn is_image_path(path: &Path) -> bool {
+    path.extension()
+        .and_then(|ext| ext.to_str())
+        .map(|ext| {
+            IMAGE_EXTENSIONS
+                .iter()
+                .any(|image_ext| ext.eq_ignore_ascii_case(image_ext))
+        })
+        .unwrap_or(false)
+}
+
+pub fn is_svg_path(path: &Path) -> bool {
+    path.extension()
+        .and_then(|ext| ext.to_str())
+        .map(|ext| ext.eq_ignore_ascii_case("svg"))
+        .unwrap_or(false)
+}
+
+#[derive(Clone)]
+pub struct ImagePreviewData {
+    pub path: PathBuf,
+    pub is_svg: bool,
+    /// The file's bytes, once all of them have been read
+    pub bytes: RwSignal<Option<Rc<Vec<u8>>>>,
+    pub file_len: RwSignal<Option<u64>>,
+    pub error: RwSignal<Option<String>>,
+    pub zoom: RwSignal<f64>,
+    /// Whether the zoom follows the size of the tab, so the image fits in it
+    pub fit: RwSignal<bool>,
+    pub pixel_grid: RwSignal<bool>,
+    viewport: RwSignal<Rect>,
+    scope: Scope,
+    common: Rc<CommonData>,
+}
+
+impl ImagePreviewData {
+    pub fn new(cx: Scope, path: PathBuf, common: Rc<CommonData>) -> Self {
+        Self {
+            is_svg: is_svg_path(&path),
+            path,
+            bytes: cx.create_rw_signal(None),
+            file_len: cx.create_rw_signal(None),
+            error: cx.create_rw_signal(None),
+            zoom: cx.create_rw_signal(1.0),
+            fit: cx.create_rw_signal(true),
+            pixel_grid: cx.create_rw_signal(false),
+            viewport: cx.create_rw_signal(Rect::ZERO),
+            scope: cx,
+            common,
+        }
+    }
+
+    /// Read the image through the proxy, so it can be previewed in remote
+    /// workspaces too.
+    pub fn load(&self) {
+        self.load_chunk(Vec::new());
+    }
+
+    fn load_chunk(&self, mut buf: Vec<u8>) {
+        let preview = self.clone();
+        let offset = buf.len() as u64;
+        let send = create_ext_action(self.scope, move |result| match result {
+            Ok(ProxyResponse::ReadFileRangeResponse { data, file_len }) => {
+                preview.file_len.set(Some(file_len));
+                if file_len > MAX_IMAGE_LEN {
+                    preview.error.set(Some(format!(
+                        "The image is too big to preview ({})",
+                        format_file_size(file_len)
+                    )));
+                    return;
+                }
+                let read = data.len() as u64;
+                buf.extend_from_slice(&data);
+                if read == 0 || offset + read >= file_len {
+                    preview.bytes.set(Some(Rc::new(buf)));
+                } else {
+                    preview.load_chunk(buf);
+                }
+            }
+            Ok(_) => {}
+            Err(err) => preview.error.set(Some(err.message)),
+        });
+        self.common.proxy.read_file_range(
+            self.path.clone(),
+            offset,
+            READ_CHUNK_LEN,
+            move |result| {
+                send(result);
+            },
+        );
+    }
+
+    /// The zoom the image is shown at, which is the fitting one when fit is on.
+    pub fn effective_zoom(&self, size: (u32, u32)) -> f64 {
+        if self.fit.get() {
+            fit_zoom(size, self.viewport.get().size())
+        } else {
+            self.zoom.get()
+        }
+    }
+
+    pub fn zoom_in(&self, size: (u32, u32)) {
+        self.set_zoom(next_zoom(self.current_zoom(size), true));
+    }
+
+    pub fn zoom_out(&self, size: (u32, u32)) {
+        self.set_zoom(next_zoom(self.current_zoom(size), false));
+    }
+
+    pub fn set_zoom(&self, zoom: f64) {
+        self.fit.set(false);
+        self.zoom.set(zoom);
+    }
+
+    fn current_zoom(&self, size: (u32, u32)) -> f64 {
+        if self.fit.get_untracked() {
+            fit_zoom(size, self.viewport.get_untracked().size())
+        } else {
+            self.zoom.get_untracked()
+        }
+    }
+}
+
+/// The zoom that makes the image fit in the viewport, without enlarging
+/// images that are already smaller than it.
+fn fit_zoom((width, height): (u32, u32), viewport: Size) -> f64 {
+    let available_width = viewport.width - PADDING * 2.0;
+    let available_height = viewport.height - PADDING * 2.0;
+    if width == 0 || height == 0 || available_width <= 0.0 || available_height <= 0.0
+    {
+        return 1.0;
+    }
+    (available_width / width as f64)
+        .min(available_height / height as f64)
+        .min(1.0)
+}
+
+/// The next zoom level in or out from `zoom`.
+fn next_zoom(zoom: f64, zoom_in: bool) -> f64 {
+    if zoom_in {
+        ZOOM_LEVELS
+            .iter()
+            .copied()
+            .find(|level| *level > zoom + f64::EPSILON)
+            .unwrap_or(ZOOM_LEVELS[ZOOM_LEVELS.len() - 1])
+    } else {
+        ZOOM_LEVELS
+            .iter()
+            .rev()
+            .copied()
+            .find(|level| *level < zoom - f64::EPSILON)
+            .unwrap_or(ZOOM_LEVELS[0])
+    }
+}
+
+/// Read the width and height of a PNG, JPEG, GIF, BMP, ICO or WebP image from
+/// its header.
+pub fn image_size(bytes: &[u8]) -> Option<(u32, u32)> {
+    let be_u16 = |i: usize| -> Option<u32> {
+        Some(u16::from_be_bytes(bytes.get(i..i + 2)?.try_into().ok()?) as u32)
+    };
+    let le_u16 = |i: usize| -> Option<u32> {
+        Some(u16::from_le_bytes(bytes.get(i..i + 2)?.try_into().ok()?) as u32)
+    };
+    let le_u24 = |i: usize| -> Option<u32> {
+        let b = bytes.get(i..i + 3)?;
+        Some(b[0] as u32 | (b[1] as u32) << 8 | (b[2] as u32) << 16)
+    };
+    let le_u32 = |i: usize| -> Option<u32> {
+        Some(u32::from_le_bytes(bytes.get(i..i + 4)?.try_into().ok()?))
+    };
+
+    if bytes.starts_with(b"\x89PNG\r\n\x1a\n") {
+        if bytes.get(12..16)? != b"IHDR" {
+            return None;
+        }
+        let width = u32::from_be_bytes(bytes.get(16..20)?.try_into().ok()?);
+        let height = u32::from_be_bytes(bytes.get(20..24)?.try_into().ok()?);
+        Some((width, height))
+    } else if bytes.starts_with(b"GIF87a") || bytes.starts_with(b"GIF89a") {
+        Some((le_u16(6)?, le_u16(8)?))
+    } else if bytes.starts_with(b"BM") {
+        if le_u32(14)? == 12 {
+            // The old OS/2 header keeps the size in 16 bits
+            Some((le_u16(18)?, le_u16(20)?))
+        } else {
+            let width = le_u32(18)? as i32;
+            let height = le_u32(22)? as i32;
+            Some((width.unsigned_abs(), height.unsigned_abs()))
+        }
+    } else if bytes.starts_with(&[0, 0, 1, 0]) {
+        // A size of 0 in an icon entry means 256
+        let dimension = |b: u8| if b == 0 { 256 } else { b as u32 };
+        Some((dimension(*bytes.get(6)?), dimension(*bytes.get(7)?)))
+    } else if bytes.starts_with(b"RIFF") && bytes.get(8..12)? == b"WEBP" {
+        match bytes.get(12..16)? {
+            b"VP8 " => Some((le_u16(26)? & 0x3fff, le_u16(28)? & 0x3fff)),
+            b"VP8L" => {
+                let bits = le_u32(21)?;
+                Some(((bits & 0x3fff) + 1, ((bits >> 14) & 0x3fff) + 1))
+            }
+            b"VP8X" => Some((le_u24(24)? + 1, le_u24(27)? + 1)),
+            _ => None,
+        }
+    } else if bytes.starts_with(&[0xff, 0xd8]) {
+        let mut i = 2;
+        while i + 4 <= bytes.len() {
+            if bytes[i] != 0xff {
+                return None;
+            }
+            let marker = bytes[i + 1];
+            match marker {
+                0xff => i += 1,
+                0x01 | 0xd0..=0xd8 => i += 2,
+                // Start of frame markers, except the ones that reuse the range
+                0xc0..=0xcf if !matches!(marker, 0xc4 | 0xc8 | 0xcc) => {
+                    return Some((be_u16(i + 7)?, be_u16(i + 5)?));
+                }
+                _ => i += 2 + be_u16(i + 2)? as usize,
+            }
+        }
+        None
+    } else {
+        None
+    }
+}
+
+/// Read the size an SVG is drawn at from the `width`, `height` and `viewBox`
+/// attributes of its root element.
+pub fn svg_size(text: &str) -> Option<(u32, u32)> {
+    let start = text.find("<svg")?;
+    let end = start + text[start..].find('>')?;
+    let tag = &text[start..end];
+
+    let width = svg_attribute(tag, "width").and_then(svg_length);
+    let height = svg_attribute(tag, "height").and_then(svg_length);
+    let view_box = svg_attribute(tag, "viewBox").and_then(|view_box| {
+        let values = view_box
+            .split(|c: char| c.is_whitespace() || c == ',')
+            .filter(|v| !v.is_empty())
+            .map(|v| v.parse::<f64>().ok())
+            .collect::<Option<Vec<_>>>()?;
+        match values[..] {
+            [_, _, width, height] if width > 0.0 && height > 0.0 => {
+                Some((width, height))
+            }
+            _ => None,
+        }
+    });
+
+    let (width, height) = match (width, height, view_box) {
+        (Some(width), Some(height), _) => (width, height),
+        (Some(width), None, Some((vw, vh))) => (width, width * vh / vw),
+        (None, Some(height), Some((vw, vh))) => (height * vw / vh, height),
+        (_, _, Some(view_box)) => view_box,
+        _ => return None,
+    };
+    Some((
+        (width.round() as u32).max(1),
+        (height.round() as u32).max(1),
+    ))
+}
+
+fn svg_attribute<'a>(tag: &'a str, name: &str) -> Option<&'a str> {
+    let mut rest = tag;
+    while let Some(i) = rest.find(name) {
+        // Skip names that are only the end of another one, like `stroke-width`
+        let follows_space = rest[..i]
+            .chars()
+            .next_back()
+            .is_some_and(char::is_whitespace);
+        let after = rest[i + name.len()..].trim_start();
+        rest = &rest[i + name.len()..];
+        if !follows_space {
+            continue;
+        }
+        let Some(value) = after.strip_prefix('=') else {
+            continue;
+        };
+        let value = value.trim_start();
+        let quote = value.chars().next().filter(|c| *c == '"' || *c == '\'')?;
+        let value = &value[1..];
+        return value.find(quote).map(|end| &value[..end]);
+    }
+    None
+}
+
+/// Parse an SVG length in pixels. Relative units like `%` and `em` can't be
+/// resolved without a viewport, so they give `None`.
+fn svg_length(value: &str) -> Option<f64> {
+    let value = value.trim();
+    let value = value.strip_suffix("px").unwrap_or(value);
+    value.parse::<f64>().ok().filter(|value| *value > 0.0)
+}
+
+fn format_file_size(len: u64) -> String {
+    if len < 1024 {
+        return format!("{len} bytes");
+    }
+    let mut size = len as f64 / 1024.0;
+    for unit in ["KB", "MB"] {
+        if size < 1024.0 {
+            return format!("{size:.1} {unit}");
+        }
+        size /= 1024.0;
+    }
+    format!("{size:.1} GB")
+}
+
+pub fn image_preview_view(
+    common: Rc<CommonData>,
+    docs: RwSignal<im::HashMap<PathBuf, Rc<Doc>>>,
+    path: PathBuf,
+) -> impl View {
+    let config = common.config;
+    let lapce_command = common.lapce_command;
+    let preview = ImagePreviewData::new(Scope::current(), path.clone(), common);
+    preview.load();
+
+    let is_svg = preview.is_svg;
+    let bytes = preview.bytes;
+    let error = preview.error;
+    let file_len = preview.file_len;
+    let fit = preview.fit;
+    let pixel_grid = preview.pixel_grid;
+    let viewport = preview.viewport;
+
+    // An SVG that is open in an editor is previewed with its unsaved changes
+    let svg_text = create_memo(move |_| {
+        if !is_svg {
+            return None;
+        }
+        let doc = docs
+            .with(|docs| docs.get(&path).cloned())
+            .filter(|doc| doc.loaded.get());
+        if let Some(doc) = doc {
+            return Some(doc.buffer.with(|b| b.to_string()));
+        }
+        bytes.with(|bytes| {
+            bytes
+                .as_ref()
+                .map(|bytes| String::from_utf8_lossy(bytes).into_owned())
+        })
+    });
+    let size = create_memo(move |_| {
+        if is_svg {
+            svg_text.with(|text| text.as_deref().and_then(svg_size))
+        } else {
+            bytes.with(|bytes| bytes.as_ref().and_then(|bytes| image_size(bytes)))
+        }
+    });
+    let zoom = {
+        let preview = preview.clone();
+        create_memo(move |_| {
+            size.get()
+                .map(|size| preview.effective_zoom(size))
+                .unwrap_or(1.0)
+        })
+    };
+    let scaled_size = move || {
+        let (width, height) = size.get().unwrap_or((0, 0));
+        let zoom = zoom.get();
+        (width as f64 * zoom, height as f64 * zoom)
+    };
+
+    let zoom_in = {
+        let preview = preview.clone();
+        move || {
+            if let Some(size) = size.get_untracked() {
+                preview.zoom_in(size);
+            }
+        }
+    };
+    let zoom_out = {
+        let preview = preview.clone();
+        move || {
+            if let Some(size) = size.get_untracked() {
+                preview.zoom_out(size);
+            }
+        }
+    };
+    let wheel_preview = preview.clone();
+
+    let toolbar = stack((
+        toolbar_button(
+            || "Fit".to_string(),
+            move || fit.get(),
+            move || fit.set(true),
+            config,
+        ),
+        toolbar_button(|| "−".to_string(), || false, zoom_out, config),
+        label(move || format!("{:.0}%", zoom.get() * 100.0))
+            .style(|s| s.min_width(48.0).justify_center()),
+        toolbar_button(|| "+".to_string(), || false, zoom_in, config),
+        {
+            let preview = preview.clone();
+            toolbar_button(
+                || "1:1".to_string(),
+                move || !fit.get() && zoom.get() == 1.0,
+                move || preview.set_zoom(1.0),
+                config,
+            )
+        },
+        toolbar_button(
+            || "Pixel Grid".to_string(),
+            move || pixel_grid.get(),
+            move || pixel_grid.update(|pixel_grid| *pixel_grid = !*pixel_grid),
+            config,
+        )
+        .style(move |s| s.apply_if(is_svg, |s| s.hide())),
+        toolbar_button(
+            || "Source".to_string(),
+            || false,
+            move || {
+                lapce_command.send(LapceCommand {
+                    kind: CommandKind::Workbench(
+                        LapceWorkbenchCommand::ToggleSvgSource,
+                    ),
+                    data: None,
+                })
+            },
+            config,
+        )
+        .style(move |s| s.apply_if(!is_svg, |s| s.hide())),
+        empty().style(|s| s.flex_grow(1.0)),
+        label(move || {
+            let dimensions = size
+                .get()
+                .map(|(width, height)| format!("{width} × {height} px"));
+            let file_size = file_len.get().map(format_file_size);
+            match (dimensions, file_size) {
+                (Some(dimensions), Some(file_size)) => {
+                    format!("{dimensions} · {file_size}")
+                }
+                (None, Some(file_size)) => file_size,
+                (dimensions, None) => dimensions.unwrap_or_default(),
+            }
+        })
+        .style(move |s| s.color(config.get().color(LapceColor::EDITOR_DIM))),
+    ))
+    .style(move |s| {
+        let config = config.get();
+        s.width_pct(100.0)
+            .items_center()
+            .gap(6.0)
+            .padding(6.0)
+            .border_bottom(1.0)
+            .border_color(config.color(LapceColor::LAPCE_BORDER))
+    });
+
+    let image = if is_svg {
+        svg(move || svg_text.get().unwrap_or_default()).into_any()
+    } else {
+        img(move || {
+            bytes
+                .get()
+                .map(|bytes| bytes.as_ref().clone())
+                .unwrap_or_default()
+        })
+        .into_any()
+    };
+    let canvas = stack((
+        image.style(move |s| {
+            let (width, height) = scaled_size();
+            s.width(width).height(height)
+        }),
+        pixel_grid_view(move || zoom.get()).style(move |s| {
+            let (width, height) = scaled_size();
+            s.absolute()
+                .width(width)
+                .height(height)
+                .color(config.get().color(LapceColor::EDITOR_INDENT_GUIDE))
+                .apply_if(is_svg || !pixel_grid.get(), |s| s.hide())
+        }),
+    ));
+
+    let message = move || {
+        if let Some(error) = error.get() {
+            Some(error)
+        } else if bytes.with(|bytes| bytes.is_none()) {
+            Some("Reading the image…".to_string())
+        } else if size.with(|size| size.is_none()) {
+            Some(
+                "The image format isn't supported or the file is damaged"
+                    .to_string(),
+            )
+        } else {
+            None
+        }
+    };
+
+    stack((
+        toolbar,
+        stack((
+            scroll(container(canvas).style(|s| {
+                s.min_size_full()
+                    .items_center()
+                    .justify_center()
+                    .padding(PADDING as f32)
+            }))
+            .on_resize(move |rect| viewport.set(rect))
+            .on_event(EventListener::PointerWheel, move |event| {
+                if let Event::PointerWheel(pointer_event) = event {
+                    let zoom_modifier = if cfg!(target_os = "macos") {
+                        pointer_event.modifiers.meta()
+                    } else {
+                        pointer_event.modifiers.control()
+                    };
+                    if zoom_modifier {
+                        if let Some(size) = size.get_untracked() {
+                            if pointer_event.delta.y < 0.0 {
+                                wheel_preview.zoom_in(size);
+                            } else if pointer_event.delta.y > 0.0 {
+                                wheel_preview.zoom_out(size);
+                            }
+                        }
+                        return EventPropagation::Stop;
+                    }
+                }
+                EventPropagation::Continue
+            })
+            .style(|s| s.absolute().size_full()),
+            label(move || message().unwrap_or_default()).style(move |s| {
+                s.absolute()
+                    .size_full()
+                    .items_center()
+                    .justify_center()
+                    .color(config.get().color(LapceColor::EDITOR_DIM))
+                    .apply_if(message().is_none(), |s| s.hide())
+            }),
+        ))
+        .style(|s| s.size_full().flex_grow(1.0).flex_basis(0.0)),
+    ))
+    .style(move |s| {
+        s.flex_col()
+            .size_full()
+            .background(config.get().color(LapceColor::EDITOR_BACKGROUND))
+    })
+    .debug_name("Image Preview")
+}
+
+fn toolbar_button(
+    text: impl Fn() -> String + 'static,
+    is_active: impl Fn() -> bool + 'static,
+    on_click: impl Fn() + 'static,
+    config: ReadSignal<Arc<LapceConfig>>,
+) -> impl View {
+    label(text).on_activate(on_click).style(move |s| {
+        let config = config.get();
+        s.padding_horiz(8.0)
+            .padding_vert(4.0)
+            .border_radius(6.0)
+            .apply_if(is_active(), |s| {
+                s.background(config.color(LapceColor::PANEL_CURRENT_BACKGROUND))
+            })
+            .hover(|s| {
+                s.cursor(CursorStyle::Pointer)
+                    .background(config.color(LapceColor::PANEL_HOVERED_BACKGROUND))
+            })
+    })
+}
+
+/// Lines between the pixels of a zoomed in image, drawn in the text color.
+struct PixelGrid {
+    id: ViewId,
+    cell_size: f64,
+}
+
+fn pixel_grid_view(cell_size: impl Fn() -> f64 + 'static) -> PixelGrid {
+    let id = ViewId::new();
+    create_effect(move |_| {
+        id.update_state(cell_size());
+    });
+    PixelGrid { id, cell_size: 1.0 }
+}
+
+impl View for PixelGrid {
+    fn id(&self) -> ViewId {
+        self.id
+    }
+
+    fn update(
+        &mut self,
+        _cx: &mut floem::context::UpdateCx,
+        state: Box<dyn std::any::Any>,
+    ) {
+        if let Ok(cell_size) = state.downcast::<f64>() {
+            self.cell_size = *cell_size;
+            self.id.request_paint();
+        }
+    }
+
+    fn paint(&mut self, cx: &mut PaintCx) {
+        if self.cell_size < PIXEL_GRID_MIN_ZOOM {
+            return;
+        }
+        let Some(color) = self.id.get_combined_style().get(TextColor) else {
+            return;
+        };
+        let size = self.id.get_layout().unwrap_or_default().size;
+        let (width, height) = (size.width as f64, size.height as f64);
+        let stroke = Stroke::new(1.0);
+
+        let mut x = 0.0;
+        while x <= width {
+            let line = Line::new(Point::new(x, 0.0), Point::new(x, height));
+            cx.stroke(&line, color, &stroke);
+            x += self.cell_size;
+        }
+        let mut y = 0.0;
+        while y <= height {
+            let line = Line::new(Point::new(0.0, y), Point::new(width, y));
+            cx.stroke(&line, color, &stroke);
+            y += self.cell_size;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_image_size() {
+        let mut png = b"\x89PNG\r\n\x1a\n\0\0\0\x0dIHDR".to_vec();
+        png.extend_from_slice(&640u32.to_be_bytes());
+        png.extend_from_slice(&480u32.to_be_bytes());
+        assert_eq!(image_size(&png), Some((640, 480)));
+
+        let gif = b"GIF89a\x20\x00\x10\x00";
+        assert_eq!(image_size(gif), Some((32, 16)));
+
+        let mut bmp = vec![0; 26];
+        bmp[..2].copy_from_slice(b"BM");
+        bmp[14..18].copy_from_slice(&40u32.to_le_bytes());
+        bmp[18..22].copy_from_slice(&100i32.to_le_bytes());
+        bmp[22..26].copy_from_slice(&(-50i32).to_le_bytes());
+        assert_eq!(image_size(&bmp), Some((100, 50)));
+
+        assert_eq!(image_size(&[0, 0, 1, 0, 1, 0, 0, 48]), Some((256, 48)));
+
+        // A quantization table segment followed by a baseline frame
+        let jpeg = [
+            0xff, 0xd8, 0xff, 0xdb, 0x00, 0x03, 0x00, 0xff, 0xc0, 0x00, 0x11, 0x08,
+            0x00, 0x78, 0x00, 0xa0,
+        ];
+        assert_eq!(image_size(&jpeg), Some((160, 120)));
+
+        let mut webp = b"RIFF\0\0\0\0WEBPVP8X".to_vec();
+        webp.resize(30, 0);
+        webp[24..27].copy_from_slice(&[199, 0, 0]);
+        webp[27..30].copy_from_slice(&[99, 0, 0]);
+        assert_eq!(image_size(&webp), Some((200, 100)));
+
+        assert_eq!(image_size(b"not an image"), None);
+        assert_eq!(image_size(b"\x89PNG\r\n\x1a\n"), None);
+    }
+
+    #[test]
+    fn test_svg_size() {
+        assert_eq!(
+            svg_size(r#"<svg width="24" height="16px" stroke-width="2">"#),
+            Some((24, 16))
+        );
+        assert_eq!(
+            svg_size(r#"<?xml?><svg xmlns="x" viewBox="0 0 100 50">"#),
+            Some((100, 50))
+        );
+        assert_eq!(
+            svg_size(r#"<svg width="200" viewBox="0,0,100,50">"#),
+            Some((200, 100))
+        );
+        assert_eq!(
+            svg_size(r#"<svg width='100%' height='100%' viewBox='0 0 8 8'>"#),
+            Some((8, 8))
+        );
+        assert_eq!(svg_size(r#"<svg width="100%">"#), None);
+        assert_eq!(svg_size("plain text"), None);
+    }
+
+    #[test]
+    fn test_zoom() {
+        assert_eq!(next_zoom(1.0, true), 1.5);
+        assert_eq!(next_zoom(1.0, false), 0.75);
+        assert_eq!(next_zoom(0.33, true), 0.5);
+        assert_eq!(next_zoom(32.0, true), 32.0);
+        assert_eq!(next_zoom(0.05, false), 0.05);
+
+        let viewport = Size::new(240.0, 1040.0);
+        assert_eq!(fit_zoom((400, 100), viewport), 0.5);
+        assert_eq!(fit_zoom((10, 10), viewport), 1.0);
+        assert_eq!(fit_zoom((10, 10), Size::ZERO), 1.0);
+    }
+
+    #[test]
+    fn test_format_file_size() {
+        assert_eq!(format_file_size(512), "512 bytes");
+        assert_eq!(format_file_size(1536), "1.5 KB");
+        assert_eq!(format_file_size(5 * 1024 * 1024), "5.0 MB");
+    }
+}
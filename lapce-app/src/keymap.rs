@@ -1,7 +1,7 @@
 use std::{rc::Rc, sync::Arc};
 
 use floem::{
-    View,
+    IntoView, View,
     event::{Event, EventListener},
     reactive::{
         Memo, ReadSignal, RwSignal, Scope, SignalGet, SignalUpdate, SignalWith,
@@ -9,9 +9,11 @@
     },
     style::CursorStyle,
     views::{
-        Decorators, container, dyn_stack, label, scroll, stack, text, virtual_stack,
+        Decorators, container, dyn_stack, empty, label, scroll, stack, text,
+        virtual_stack,
     },
 };
+use itertools::Itertools;
 use lapce_core::mode::Modes;
 
 use crate::{
@@ -19,6 +21,7 @@
     config::{LapceConfig, color::LapceColor},
     keypress::{
         KeyPressData,
+        conflict::{KeymapConflict, conflicting_keymaps},
         keymap::{KeyMap, KeyMapPress},
     },
     main_split::Editors,
@@ -26,7 +29,7 @@
     window_tab::CommonData,
 };
 
-#[derive(Clone)]
+#[derive(Clone, Copy)]
 pub struct KeymapPicker {
     cmd: RwSignal<Option<LapceCommand>>,
     keymap: RwSignal<Option<KeyMap>>,
@@ -39,6 +42,9 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
     let ui_line_height_memo = common.ui_line_height;
     let ui_line_height = move || ui_line_height_memo.get() * 1.2;
     let modal = create_memo(move |_| config.get().core.modal);
+    let context = keypress.with_untracked(|keypress| keypress.context);
+    let conflicts = create_memo(move |_| keypress.with(|k| k.conflicts.clone()));
+    let conflicts_only = create_rw_signal(false);
     let picker = KeymapPicker {
         cmd: create_rw_signal(None),
         keymap: create_rw_signal(None),
@@ -53,10 +59,16 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
         let doc = doc.get();
         let pattern = doc.buffer.with(|b| b.to_string().to_lowercase());
         let keypress = keypress.get();
+        let conflicts_only = conflicts_only.get();
         let mut items = keypress
             .commands_with_keymap
             .iter()
             .filter_map(|keymap| {
+                if conflicts_only
+                    && !keypress.conflicts.iter().any(|c| c.involves(keymap))
+                {
+                    return None;
+                }
                 let cmd = keypress.commands.get(&keymap.command).cloned()?;
 
                 let cmd_name_contains_pattern =
@@ -88,6 +100,9 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
             })
             .collect::<im::Vector<(LapceCommand, Option<KeyMap>)>>();
         items.extend(keypress.commands_without_keymap.iter().filter_map(|cmd| {
+            if conflicts_only {
+                return None;
+            }
             let match_pattern = cmd.kind.str().replace('_', " ").contains(&pattern)
                 || cmd
                     .kind
@@ -136,6 +151,16 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
                 }),
                 {
                     let keymap = keymap.clone();
+                    let has_conflicts = {
+                        let keymap = keymap.clone();
+                        create_memo(move |_| {
+                            keymap.as_ref().is_some_and(|keymap| {
+                                conflicts.with(|conflicts| {
+                                    conflicts.iter().any(|c| c.involves(keymap))
+                                })
+                            })
+                        })
+                    };
                     dyn_stack(
                         move || {
                             keymap
@@ -153,14 +178,19 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
                         |k| k.clone(),
                         move |key| {
                             text(key.clone()).style(move |s| {
+                                let config = config.get();
                                 s.padding_horiz(5.0)
                                     .padding_vert(1.0)
                                     .margin_right(5.0)
                                     .border(1.0)
                                     .border_radius(3.0)
-                                    .border_color(
-                                        config.get().color(LapceColor::LAPCE_BORDER),
-                                    )
+                                    .border_color(config.color(
+                                        if has_conflicts.get() {
+                                            LapceColor::LAPCE_WARN
+                                        } else {
+                                            LapceColor::LAPCE_BORDER
+                                        },
+                                    ))
                             })
                         },
                     )
@@ -225,22 +255,33 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
                             .apply_if(!modal.get(), |s| s.hide())
                     })
                 },
-                container(
-                    text(
-                        keymap
-                            .as_ref()
-                            .and_then(|keymap| keymap.when.clone())
-                            .unwrap_or_default(),
-                    )
-                    .style(|s| {
+                container({
+                    let when = keymap
+                        .as_ref()
+                        .and_then(|keymap| keymap.when.clone())
+                        .unwrap_or_default();
+                    // whether the condition held at the last key press
+                    let holds = {
+                        let when = when.clone();
+                        create_memo(move |_| {
+                            !when.is_empty()
+                                && context.with(|context| {
+                                    KeyPressData::check_condition(&when, context)
+                                })
+                        })
+                    };
+                    text(when).style(move |s| {
                         s.text_ellipsis()
+                            .apply_if(holds.get(), |s| {
+                                s.color(config.get().color(LapceColor::EDITOR_FOCUS))
+                            })
                             .absolute()
                             .items_center()
                             .min_width(0.0)
                             .padding_horiz(10.0)
                             .size_pct(100.0, 100.0)
-                    }),
-                )
+                    })
+                })
                 .style(move |s| {
                     s.height_pct(100.0)
                         .min_width(0.0)
@@ -292,6 +333,51 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
                 }),
         )
         .style(|s| s.padding_bottom(10.0).width_pct(100.0)),
+        stack((
+            label(move || {
+                let conditions = context.with(|context| context.describe());
+                if conditions.is_empty() {
+                    "No conditions held at the last key press".to_string()
+                } else {
+                    format!(
+                        "Conditions at the last key press: {}",
+                        conditions.join(", ")
+                    )
+                }
+            })
+            .style(move |s| {
+                s.text_ellipsis()
+                    .min_width(0.0)
+                    .flex_basis(0.0)
+                    .flex_grow(1.0)
+                    .color(config.get().color(LapceColor::EDITOR_DIM))
+            }),
+            label(move || {
+                let count = conflicts.with(|conflicts| conflicts.len());
+                if conflicts_only.get() {
+                    "Show All Key Bindings".to_string()
+                } else if count == 1 {
+                    "1 Conflict".to_string()
+                } else {
+                    format!("{count} Conflicts")
+                }
+            })
+            .on_click_stop(move |_| {
+                conflicts_only.update(|conflicts_only| {
+                    *conflicts_only = !*conflicts_only;
+                });
+            })
+            .style(move |s| {
+                let config = config.get();
+                let count = conflicts.with(|conflicts| conflicts.len());
+                s.margin_left(10.0)
+                    .apply_if(count > 0, |s| {
+                        s.color(config.color(LapceColor::LAPCE_WARN))
+                    })
+                    .hover(|s| s.cursor(CursorStyle::Pointer))
+            }),
+        ))
+        .style(|s| s.items_center().width_pct(100.0).padding_bottom(10.0)),
         stack((
             container(text("Command").style(move |s| {
                 s.text_ellipsis().padding_horiz(10.0).min_width(0.0)
@@ -350,7 +436,9 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
                     |(i, (cmd, keymap)): &(
                         usize,
                         (LapceCommand, Option<KeyMap>),
-                    )| { (*i, cmd.kind.str(), keymap.clone()) },
+                    )| {
+                        (*i, cmd.kind.str().to_string(), keymap.clone())
+                    },
                     view_fn,
                 )
                 .item_size_fixed(ui_line_height)
@@ -359,7 +447,7 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
             .style(|s| s.absolute().size_pct(100.0, 100.0)),
         )
         .style(|s| s.width_pct(100.0).flex_basis(0.0).flex_grow(1.0)),
-        keyboard_picker_view(picker, common.ui_line_height, config),
+        keyboard_picker_view(picker, keypress, common.ui_line_height, config),
     ))
     .style(|s| {
         s.absolute()
@@ -373,10 +461,52 @@ pub fn keymap_view(editors: Editors, common: Rc<CommonData>) -> impl View {
 
 fn keyboard_picker_view(
     picker: KeymapPicker,
+    keypress: RwSignal<KeyPressData>,
     ui_line_height: Memo<f64>,
     config: ReadSignal<Arc<LapceConfig>>,
 ) -> impl View {
     let picker_cmd = picker.cmd;
+    // the keymaps the captured keys would conflict with
+    let taken = create_memo(move |_| {
+        let keys: Vec<KeyMapPress> = picker.keys.with(|keys| {
+            keys.iter()
+                .map(|(key, _)| key.clone())
+                .filter(|key| !key.is_modifiers())
+                .collect()
+        });
+        let Some(keymap) = picker.keymap.get() else {
+            return Vec::new();
+        };
+        if keys.is_empty() {
+            return Vec::new();
+        }
+        keypress.with(|keypress| {
+            conflicting_keymaps(&keypress.keymaps, &keys, &keymap)
+                .into_iter()
+                .map(|other| {
+                    format!(
+                        "{} ({})",
+                        command_label(keypress, &other.command),
+                        other.key.iter().map(|key| key.label()).join(" ")
+                    )
+                })
+                .collect::<Vec<_>>()
+        })
+    });
+    let picked_conflicts = create_memo(move |_| {
+        let Some(keymap) = picker.keymap.get() else {
+            return Vec::new();
+        };
+        keypress.with(|keypress| {
+            keypress
+                .conflicts
+                .iter()
+                .filter(|c| c.involves(&keymap))
+                .cloned()
+                .enumerate()
+                .collect::<Vec<_>>()
+        })
+    });
     let view = container(
         stack((
             label(move || {
@@ -429,6 +559,30 @@ fn keyboard_picker_view(
                     .border_color(config.color(LapceColor::LAPCE_BORDER))
                     .background(config.color(LapceColor::EDITOR_BACKGROUND))
             }),
+            label(move || {
+                taken.with(|taken| {
+                    if taken.is_empty() {
+                        String::new()
+                    } else {
+                        format!("Already bound to {}", taken.join(", "))
+                    }
+                })
+            })
+            .style(move |s| {
+                s.margin_top(10.0)
+                    .width_pct(100.0)
+                    .text_ellipsis()
+                    .color(config.get().color(LapceColor::LAPCE_WARN))
+                    .apply_if(taken.with(|taken| taken.is_empty()), |s| s.hide())
+            }),
+            dyn_stack(
+                move || picked_conflicts.get(),
+                |(i, conflict)| (*i, conflict.clone()),
+                move |(_, conflict)| {
+                    conflict_view(picker, keypress, conflict, config)
+                },
+            )
+            .style(|s| s.flex_col().width_pct(100.0)),
             stack((
                 text("Save")
                     .style(move |s| {
@@ -506,7 +660,7 @@ fn keyboard_picker_view(
             s.items_center()
                 .flex_col()
                 .padding(20.0)
-                .width(400.0)
+                .width(500.0)
                 .border(1.0)
                 .border_radius(6.0)
                 .border_color(config.color(LapceColor::LAPCE_BORDER))
@@ -560,3 +714,87 @@ fn keyboard_picker_view(
 
     view
 }
+
+/// A conflict of the picked keymap, with quick fixes for it. The keymap can
+/// also be rebound by pressing new keys in the picker.
+fn conflict_view(
+    picker: KeymapPicker,
+    keypress: RwSignal<KeyPressData>,
+    conflict: KeymapConflict,
+    config: ReadSignal<Arc<LapceConfig>>,
+) -> impl View {
+    let Some(keymap) = picker.keymap.get_untracked() else {
+        return empty().into_any();
+    };
+    let other = conflict.other(&keymap).clone();
+    let other_name =
+        keypress.with_untracked(|keypress| command_label(keypress, &other.command));
+    let when = conflict.disambiguating_when(&keymap);
+    let has_when = when.is_some();
+
+    let remove_keymap = keymap.clone();
+    let when_keymap = keymap;
+    stack((
+        label(move || conflict.description()).style(move |s| {
+            s.width_pct(100.0)
+                .text_ellipsis()
+                .color(config.get().color(LapceColor::LAPCE_WARN))
+        }),
+        stack((
+            quick_fix_button("Remove This Binding", config, move || {
+                KeyPressData::update_file(&remove_keymap, &[]);
+                picker.keymap.set(None);
+            }),
+            quick_fix_button(format!("Remove {other_name}"), config, move || {
+                KeyPressData::update_file(&other, &[]);
+                picker.keymap.set(None);
+            }),
+            quick_fix_button("Add Condition", config, move || {
+                if let Some(when) = when.as_deref() {
+                    KeyPressData::update_file_when(&when_keymap, when);
+                    picker.keymap.set(None);
+                }
+            })
+            .style(move |s| s.apply_if(!has_when, |s| s.hide())),
+        ))
+        .style(|s| s.margin_top(5.0)),
+    ))
+    .style(|s| s.flex_col().width_pct(100.0).margin_top(10.0))
+    .into_any()
+}
+
+fn quick_fix_button(
+    name: impl Into<String>,
+    config: ReadSignal<Arc<LapceConfig>>,
+    on_click: impl Fn() + 'static,
+) -> impl View {
+    text(name.into())
+        .on_click_stop(move |_| on_click())
+        .style(move |s| {
+            let config = config.get();
+            s.margin_right(10.0)
+                .padding_horiz(10.0)
+                .padding_vert(4.0)
+                .border(1.0)
+                .border_radius(6.0)
+                .border_color(config.color(LapceColor::LAPCE_BORDER))
+                .hover(|s| {
+                    s.cursor(CursorStyle::Pointer).background(
+                        config.color(LapceColor::PANEL_HOVERED_BACKGROUND),
+                    )
+                })
+                .active(|s| {
+                    s.background(
+                        config.color(LapceColor::PANEL_HOVERED_ACTIVE_BACKGROUND),
+                    )
+                })
+        })
+}
+
+fn command_label(keypress: &KeyPressData, command: &str) -> String {
+    keypress
+        .commands
+        .get(command)
+        .and_then(|cmd| cmd.kind.desc().map(|desc| desc.to_string()))
+        .unwrap_or_else(|| command.replace('_', " "))
+}
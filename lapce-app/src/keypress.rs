@@ -1,12 +1,14 @@
 pub mod condition;
+pub mod conflict;
 mod key;
 pub mod keymap;
 mod loader;
 mod press;
+pub mod vscode;
 
-use std::{path::PathBuf, rc::Rc, str::FromStr, time::SystemTime};
+use std::{path::PathBuf, rc::Rc, time::SystemTime};
 
-use anyhow::Result;
+use anyhow::{Result, anyhow};
 use floem::{
     keyboard::{Key, KeyEvent, KeyEventExtModifierSupplement, Modifiers, NamedKey},
     pointer::{MouseButton, PointerButton, PointerInputEvent},
@@ -15,6 +17,7 @@
 use indexmap::IndexMap;
 use itertools::Itertools;
 use lapce_core::mode::{Mode, Modes};
+use lapce_rpc::plugin::{PluginCommand, VoltID};
 
 pub use self::press::KeyPress;
 use self::{
@@ -26,7 +29,8 @@
     command::{CommandExecuted, CommandKind, LapceCommand, lapce_internal_commands},
     config::LapceConfig,
     keypress::{
-        condition::{CheckCondition, Condition},
+        condition::{Condition, ConditionContext, ConditionExpr, ContextKey},
+        conflict::{KeymapConflict, find_conflicts},
         keymap::KeymapMatch,
     },
     tracing::*,
@@ -39,11 +43,38 @@
 const DEFAULT_KEYMAPS_NONMACOS: &str =
     include_str!("../../defaults/keymaps-nonmacos.toml");
 
+/// The presets `core.keymap-preset` can layer over the default keymaps, by
+/// name. Any other name keeps just the defaults.
+pub const KEYMAP_PRESETS: &[(&str, &str)] = &[
+    (
+        "vscode",
+        include_str!("../../defaults/keymaps-preset-vscode.toml"),
+    ),
+    (
+        "sublime",
+        include_str!("../../defaults/keymaps-preset-sublime.toml"),
+    ),
+    (
+        "jetbrains",
+        include_str!("../../defaults/keymaps-preset-jetbrains.toml"),
+    ),
+    (
+        "emacs",
+        include_str!("../../defaults/keymaps-preset-emacs.toml"),
+    ),
+];
+
 pub trait KeyPressFocus: std::fmt::Debug {
     fn get_mode(&self) -> Mode;
 
     fn check_condition(&self, condition: Condition) -> bool;
 
+    /// The values of a context key that `when` clauses compare against, e.g.
+    /// the language of the focused editor.
+    fn context_values(&self, _key: ContextKey) -> Vec<String> {
+        Vec::new()
+    }
+
     fn run_command(
         &self,
         command: &LapceCommand,
@@ -98,6 +129,10 @@ fn check_condition(&self, condition: Condition) -> bool {
         (**self).check_condition(condition)
     }
 
+    fn context_values(&self, key: ContextKey) -> Vec<String> {
+        (**self).context_values(key)
+    }
+
     fn run_command(
         &self,
         command: &LapceCommand,
@@ -120,6 +155,54 @@ fn receive_char(&self, c: &str) {
     }
 }
 
+/// A focus inside a window tab, which answers the context keys it doesn't
+/// know itself, such as the visible panels, from the window tab.
+#[derive(Debug)]
+struct WindowFocus<'a, T: KeyPressFocus + ?Sized> {
+    focus: &'a T,
+    window: &'a dyn KeyPressFocus,
+}
+
+impl<T: KeyPressFocus + ?Sized> KeyPressFocus for WindowFocus<'_, T> {
+    fn get_mode(&self) -> Mode {
+        self.focus.get_mode()
+    }
+
+    fn check_condition(&self, condition: Condition) -> bool {
+        self.focus.check_condition(condition)
+    }
+
+    fn context_values(&self, key: ContextKey) -> Vec<String> {
+        let values = self.focus.context_values(key);
+        if values.is_empty() {
+            self.window.context_values(key)
+        } else {
+            values
+        }
+    }
+
+    fn run_command(
+        &self,
+        command: &LapceCommand,
+        count: Option<usize>,
+        mods: Modifiers,
+    ) -> CommandExecuted {
+        self.focus.run_command(command, count, mods)
+    }
+
+    fn expect_char(&self) -> bool {
+        self.focus.expect_char()
+    }
+
+    fn focus_only(&self) -> bool {
+        self.focus.focus_only()
+    }
+
+    fn receive_char(&self, c: &str) {
+        self.focus.receive_char(c)
+    }
+}
+
 #[derive(Clone, Copy, Debug)]
 pub enum EventRef<'a> {
     Keyboard(&'a floem::keyboard::KeyEvent),
@@ -153,6 +236,11 @@ pub struct KeyPressData {
     pub command_keymaps: Rc<IndexMap<String, Vec<KeyMap>>>,
     pub commands_with_keymap: Rc<Vec<KeyMap>>,
     pub commands_without_keymap: Rc<Vec<LapceCommand>>,
+    /// Keymaps that can't run because another keymap takes their keys.
+    pub conflicts: Rc<Vec<KeymapConflict>>,
+    /// The conditions and context values at the last key press in a window
+    /// tab, shown in the keymap view.
+    pub context: RwSignal<ConditionContext>,
 }
 
 impl KeyPressData {
@@ -167,6 +255,8 @@ pub fn new(cx: Scope, config: &LapceConfig) -> Self {
             commands: Rc::new(lapce_internal_commands()),
             commands_with_keymap: Rc::new(Vec::new()),
             commands_without_keymap: Rc::new(Vec::new()),
+            conflicts: Rc::new(Vec::new()),
+            context: cx.create_rw_signal(ConditionContext::default()),
         };
         keypress.load_commands();
         keypress
@@ -180,6 +270,41 @@ pub fn update_keymaps(&mut self, config: &LapceConfig) {
         }
     }
 
+    /// Make a command registered by a plugin available to the palette and
+    /// keymaps.
+    pub fn add_plugin_command(&mut self, command: PluginCommand) {
+        if !command.is_namespaced() {
+            trace!(
+                TraceLevel::ERROR,
+                "{} can't register {}, which isn't prefixed with its id",
+                command.volt,
+                command.command
+            );
+            return;
+        }
+        let mut commands = (*self.commands).clone();
+        commands.insert(
+            command.command.clone(),
+            LapceCommand {
+                kind: CommandKind::Plugin(command),
+                data: None,
+            },
+        );
+        self.commands = Rc::new(commands);
+        self.load_commands();
+    }
+
+    pub fn remove_plugin_commands(&mut self, volt: &VoltID) {
+        let mut commands = (*self.commands).clone();
+        commands.retain(
+            |_, cmd| !matches!(&cmd.kind, CommandKind::Plugin(c) if &c.volt == volt),
+        );
+        if commands.len() != self.commands.len() {
+            self.commands = Rc::new(commands);
+            self.load_commands();
+        }
+    }
+
     fn load_commands(&mut self) {
         let mut commands_with_keymap = Vec::new();
         let mut commands_without_keymap = Vec::new();
@@ -204,6 +329,15 @@ fn load_commands(&mut self) {
 
         self.commands_with_keymap = Rc::new(commands_with_keymap);
         self.commands_without_keymap = Rc::new(commands_without_keymap);
+        self.conflicts = Rc::new(
+            find_conflicts(&self.keymaps)
+                .into_iter()
+                .filter(|conflict| {
+                    self.commands.contains_key(&conflict.shadowed.command)
+                        && self.commands.contains_key(&conflict.by.command)
+                })
+                .collect(),
+        );
     }
 
     fn handle_count<T: KeyPressFocus + ?Sized>(
@@ -328,6 +462,22 @@ pub fn key_down<'a, T: KeyPressFocus + ?Sized>(
         self.handle_keymatch(focus, keymatch, keypress)
     }
 
+    /// Like [`Self::key_down`], for a focus inside a window tab, so that
+    /// conditions can also check the context values of the window tab.
+    pub fn window_key_down<'a, T: KeyPressFocus + ?Sized>(
+        &self,
+        event: impl Into<EventRef<'a>>,
+        focus: &T,
+        window: &dyn KeyPressFocus,
+    ) -> KeyPressHandle {
+        let focus = WindowFocus { focus, window };
+        let context = ConditionContext::capture(&focus);
+        if self.context.with_untracked(|c| c != &context) {
+            self.context.set(context);
+        }
+        self.key_down(event, &focus)
+    }
+
     pub fn handle_keymatch<T: KeyPressFocus + ?Sized>(
         &self,
         focus: &T,
@@ -521,45 +671,11 @@ fn match_keymap<T: KeyPressFocus + ?Sized>(
         }
     }
 
-    fn check_condition<T: KeyPressFocus + ?Sized>(
+    pub fn check_condition<T: KeyPressFocus + ?Sized>(
         condition: &str,
         check: &T,
     ) -> bool {
-        fn check_one_condition<T: KeyPressFocus + ?Sized>(
-            condition: &str,
-            check: &T,
-        ) -> bool {
-            let trimmed = condition.trim();
-            if let Some(stripped) = trimmed.strip_prefix('!') {
-                if let Ok(condition) = Condition::from_str(stripped) {
-                    !check.check_condition(condition)
-                } else {
-                    true
-                }
-            } else if let Ok(condition) = Condition::from_str(trimmed) {
-                check.check_condition(condition)
-            } else {
-                false
-            }
-        }
-
-        match CheckCondition::parse_first(condition) {
-            CheckCondition::Single(condition) => {
-                check_one_condition(condition, check)
-            }
-            CheckCondition::Or(left, right) => {
-                let left = check_one_condition(left, check);
-                let right = Self::check_condition(right, check);
-
-                left || right
-            }
-            CheckCondition::And(left, right) => {
-                let left = check_one_condition(left, check);
-                let right = Self::check_condition(right, check);
-
-                left && right
-            }
-        }
+        ConditionExpr::parse(condition).is_ok_and(|expr| expr.eval(check))
     }
 
     #[allow(clippy::type_complexity)]
@@ -587,6 +703,17 @@ fn get_keymaps(
             trace!(TraceLevel::ERROR, "Failed to load OS defaults: {err}");
         }
 
+        if let Some((name, preset)) = KEYMAP_PRESETS
+            .iter()
+            .find(|(name, _)| *name == config.core.keymap_preset)
+        {
+            if let Err(err) = loader.load_from_str(preset, is_modal) {
+                trace!(TraceLevel::ERROR, "Failed to load the {name} preset: {err}");
+            }
+        }
+
+        loader.load_from_volts(&config.volt_keymaps, is_modal);
+
         if let Some(path) = Self::file() {
             if let Ok(content) = std::fs::read_to_string(&path) {
                 if let Err(err) = loader.load_from_str(&content, is_modal) {
@@ -613,7 +740,64 @@ fn get_file_array() -> Option<toml_edit::ArrayOfTables> {
             .cloned()
     }
 
+    /// Append keymaps to the user's keymaps file, after the ones already
+    /// there so they take priority.
+    pub fn append_to_file(keymaps: &[KeyMap]) -> Result<()> {
+        let path = Self::file().ok_or_else(|| anyhow!("no keymaps file"))?;
+        // Edit the file in place, so what's already there keeps its comments
+        // and formatting, and leave it alone if it can't be parsed.
+        let content = match std::fs::read_to_string(&path) {
+            Ok(content) => content,
+            Err(err) if err.kind() == std::io::ErrorKind::NotFound => String::new(),
+            Err(err) => return Err(err.into()),
+        };
+        let mut document: toml_edit::Document = content.parse().map_err(|err| {
+            anyhow!("can't add keymaps to {}: {err}", path.display())
+        })?;
+        let array = document
+            .entry("keymaps")
+            .or_insert(toml_edit::Item::ArrayOfTables(Default::default()))
+            .as_array_of_tables_mut()
+            .ok_or_else(|| {
+                anyhow!(
+                    "can't add keymaps to {}: keymaps isn't an array of tables",
+                    path.display()
+                )
+            })?;
+        for keymap in keymaps {
+            let mut table = toml_edit::Table::new();
+            table.insert("key", toml_edit::value(keymap.key.iter().join(" ")));
+            table.insert("command", toml_edit::value(keymap.command.clone()));
+            if !keymap.modes.is_empty() {
+                table.insert("mode", toml_edit::value(keymap.modes.to_string()));
+            }
+            if let Some(when) = keymap.when.as_ref() {
+                table.insert("when", toml_edit::value(when.clone()));
+            }
+            array.push(table);
+        }
+
+        std::fs::write(path, document.to_string())?;
+        Ok(())
+    }
+
     pub fn update_file(keymap: &KeyMap, keys: &[KeyMapPress]) -> Option<()> {
+        Self::write_keymap(keymap, keys, keymap.when.as_deref())
+    }
+
+    /// Change the `when` clause of a keymap in the user's keymaps file.
+    pub fn update_file_when(keymap: &KeyMap, when: &str) -> Option<()> {
+        Self::write_keymap(keymap, &keymap.key, Some(when))
+    }
+
+    /// Write `keymap` with new keys and `when` clause to the user's keymaps
+    /// file, replacing it if it's already there and unbinding it otherwise.
+    /// Empty keys remove it.
+    fn write_keymap(
+        keymap: &KeyMap,
+        keys: &[KeyMapPress],
+        when: Option<&str>,
+    ) -> Option<()> {
         let mut array = Self::get_file_array().unwrap_or_default();
         let index = array.iter().position(|value| {
             Some(keymap.command.as_str())
@@ -630,10 +814,19 @@ pub fn update_file(keymap: &KeyMap, keys: &[KeyMapPress]) -> Option<()> {
 
         if let Some(index) = index {
             if !keys.is_empty() {
-                array.get_mut(index)?.insert(
+                let table = array.get_mut(index)?;
+                table.insert(
                     "key",
                     toml_edit::value(toml_edit::Value::from(keys.iter().join(" "))),
                 );
+                match when {
+                    Some(when) => {
+                        table.insert("when", toml_edit::value(when));
+                    }
+                    None => {
+                        table.remove("when");
+                    }
+                }
             } else {
                 array.remove(index);
             };
@@ -651,7 +844,7 @@ pub fn update_file(keymap: &KeyMap, keys: &[KeyMapPress]) -> Option<()> {
                     )),
                 );
             }
-            if let Some(when) = keymap.when.as_ref() {
+            if let Some(when) = when {
                 table.insert(
                     "when",
                     toml_edit::value(toml_edit::Value::from(when.to_string())),
@@ -667,6 +860,14 @@ pub fn update_file(keymap: &KeyMap, keys: &[KeyMapPress]) -> Option<()> {
             }
 
             if !keymap.key.is_empty() {
+                match keymap.when.as_ref() {
+                    Some(when) => {
+                        table.insert("when", toml_edit::value(when.clone()));
+                    }
+                    None => {
+                        table.remove("when");
+                    }
+                }
                 table.insert(
                     "key",
                     toml_edit::value(toml_edit::Value::from(
@@ -1,43 +1,331 @@
-use strum_macros::EnumString;
+use std::{cell::RefCell, collections::HashMap, fmt, str::FromStr};
 
-#[derive(Debug, PartialEq, Eq)]
-pub(super) enum CheckCondition<'a> {
-    Single(&'a str),
-    Or(&'a str, &'a str),
-    And(&'a str, &'a str),
+use floem::keyboard::Modifiers;
+use lapce_core::mode::Mode;
+use regex::Regex;
+use strum::IntoEnumIterator;
+use strum_macros::{EnumIter, EnumString, IntoStaticStr};
+
+use super::KeyPressFocus;
+use crate::command::{CommandExecuted, LapceCommand};
+
+/// A parsed `when` clause.
+///
+/// `!` binds tightest, then `&&`, then `||`, and parentheses group. Besides
+/// the [`Condition`] flags and `true`/`false`, a [`ContextKey`] can be
+/// compared with `==` or `!=` to a quoted or bare value, or matched with
+/// `=~` against a `/regex/`, which can have an `i` flag.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub enum ConditionExpr<'a> {
+    Bool(bool),
+    Flag(&'a str),
+    Compare(&'a str, CompareOp, &'a str),
+    Not(Box<ConditionExpr<'a>>),
+    And(Box<ConditionExpr<'a>>, Box<ConditionExpr<'a>>),
+    Or(Box<ConditionExpr<'a>>, Box<ConditionExpr<'a>>),
 }
 
-impl<'a> CheckCondition<'a> {
-    pub(super) fn parse_first(condition: &'a str) -> Self {
-        let or = condition.match_indices("||").next();
-        let and = condition.match_indices("&&").next();
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum CompareOp {
+    Eq,
+    NotEq,
+    /// The value is a `/regex/` with its flags.
+    Matches,
+}
 
-        match (or, and) {
-            (None, None) => CheckCondition::Single(condition),
-            (Some((pos, _)), None) => {
-                CheckCondition::Or(&condition[..pos], &condition[pos + 2..])
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+enum Token<'a> {
+    LParen,
+    RParen,
+    Not,
+    And,
+    Or,
+    Op(CompareOp),
+    Word(&'a str),
+    Str(&'a str),
+    Regex(&'a str),
+}
+
+impl<'a> ConditionExpr<'a> {
+    pub fn parse(condition: &'a str) -> Result<Self, String> {
+        let tokens = tokenize(condition)?;
+        let mut parser = Parser { tokens, pos: 0 };
+        let expr = parser.parse_or()?;
+        match parser.tokens.get(parser.pos) {
+            Some(token) => Err(format!("unexpected {token:?}")),
+            None => Ok(expr),
+        }
+    }
+
+    /// Evaluates the expression with `holds` deciding the flags and
+    /// comparisons.
+    pub fn eval_with(
+        &self,
+        holds: &mut impl FnMut(&ConditionExpr<'a>) -> bool,
+    ) -> bool {
+        match self {
+            ConditionExpr::Bool(value) => *value,
+            ConditionExpr::Flag(_) | ConditionExpr::Compare(..) => holds(self),
+            ConditionExpr::Not(expr) => !expr.eval_with(holds),
+            ConditionExpr::And(left, right) => {
+                left.eval_with(holds) && right.eval_with(holds)
             }
-            (None, Some((pos, _))) => {
-                CheckCondition::And(&condition[..pos], &condition[pos + 2..])
+            ConditionExpr::Or(left, right) => {
+                left.eval_with(holds) || right.eval_with(holds)
             }
-            (Some((or_pos, _)), Some((and_pos, _))) => {
-                if or_pos < and_pos {
-                    CheckCondition::Or(
-                        &condition[..or_pos],
-                        &condition[or_pos + 2..],
-                    )
-                } else {
-                    CheckCondition::And(
-                        &condition[..and_pos],
-                        &condition[and_pos + 2..],
+        }
+    }
+
+    /// The flags and comparisons in the expression.
+    pub fn leaves(&self) -> Vec<&ConditionExpr<'a>> {
+        match self {
+            ConditionExpr::Bool(_) => Vec::new(),
+            ConditionExpr::Flag(_) | ConditionExpr::Compare(..) => vec![self],
+            ConditionExpr::Not(expr) => expr.leaves(),
+            ConditionExpr::And(left, right) | ConditionExpr::Or(left, right) => {
+                let mut leaves = left.leaves();
+                leaves.extend(right.leaves());
+                leaves
+            }
+        }
+    }
+
+    pub fn eval<T: KeyPressFocus + ?Sized>(&self, check: &T) -> bool {
+        match self {
+            ConditionExpr::Bool(value) => *value,
+            // unknown flags never hold
+            ConditionExpr::Flag(flag) => Condition::from_str(flag)
+                .is_ok_and(|condition| check.check_condition(condition)),
+            ConditionExpr::Compare(key, op, value) => {
+                let values = ContextKey::from_str(key)
+                    .map(|key| check.context_values(key))
+                    .unwrap_or_default();
+                match op {
+                    CompareOp::Eq => values.iter().any(|v| v == value),
+                    CompareOp::NotEq => !values.iter().any(|v| v == value),
+                    CompareOp::Matches => regex(value)
+                        .is_ok_and(|re| values.iter().any(|v| re.is_match(v))),
+                }
+            }
+            ConditionExpr::Not(expr) => !expr.eval(check),
+            ConditionExpr::And(left, right) => left.eval(check) && right.eval(check),
+            ConditionExpr::Or(left, right) => left.eval(check) || right.eval(check),
+        }
+    }
+}
+
+impl fmt::Display for ConditionExpr<'_> {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            ConditionExpr::Bool(value) => write!(f, "{value}"),
+            ConditionExpr::Flag(flag) => f.write_str(flag),
+            ConditionExpr::Compare(key, CompareOp::Eq, value) => {
+                write!(f, "{key} == \"{value}\"")
+            }
+            ConditionExpr::Compare(key, CompareOp::NotEq, value) => {
+                write!(f, "{key} != \"{value}\"")
+            }
+            ConditionExpr::Compare(key, CompareOp::Matches, value) => {
+                write!(f, "{key} =~ {value}")
+            }
+            ConditionExpr::Not(expr) => {
+                f.write_str("!")?;
+                grouped(
+                    f,
+                    expr,
+                    matches!(
+                        **expr,
+                        ConditionExpr::And(..)
+                            | ConditionExpr::Or(..)
+                            | ConditionExpr::Compare(..)
+                    ),
+                )
+            }
+            ConditionExpr::And(left, right) => {
+                grouped(f, left, matches!(**left, ConditionExpr::Or(..)))?;
+                f.write_str(" && ")?;
+                grouped(f, right, matches!(**right, ConditionExpr::Or(..)))
+            }
+            ConditionExpr::Or(left, right) => write!(f, "{left} || {right}"),
+        }
+    }
+}
+
+/// Writes `child`, in parentheses if it binds looser than its parent.
+fn grouped(
+    f: &mut fmt::Formatter<'_>,
+    child: &ConditionExpr,
+    parens: bool,
+) -> fmt::Result {
+    if parens {
+        write!(f, "({child})")
+    } else {
+        write!(f, "{child}")
+    }
+}
+
+thread_local! {
+    /// The `/regex/` values compiled so far, as `when` clauses are parsed and
+    /// evaluated again on every key press.
+    static REGEXES: RefCell<HashMap<String, Regex>> = RefCell::new(HashMap::new());
+}
+
+/// Compiles a `/regex/` value with its flags, or reuses it if it's been
+/// compiled before.
+fn regex(value: &str) -> Result<Regex, String> {
+    let cached = REGEXES.with_borrow(|regexes| regexes.get(value).cloned());
+    if let Some(regex) = cached {
+        return Ok(regex);
+    }
+    let regex = compile_regex(value)?;
+    REGEXES.with_borrow_mut(|regexes| {
+        regexes.insert(value.to_string(), regex.clone());
+    });
+    Ok(regex)
+}
+
+fn compile_regex(value: &str) -> Result<Regex, String> {
+    let (pattern, flags) = value
+        .strip_prefix('/')
+        .and_then(|value| value.rsplit_once('/'))
+        .ok_or_else(|| format!("{value} is not a /regex/"))?;
+    let pattern = pattern.replace("\\/", "/");
+    let pattern = if flags.contains('i') {
+        format!("(?i){pattern}")
+    } else {
+        pattern
+    };
+    Regex::new(&pattern).map_err(|err| err.to_string())
+}
+
+fn tokenize(condition: &str) -> Result<Vec<Token<'_>>, String> {
+    let mut tokens = Vec::new();
+    let mut rest = condition.trim_start();
+    while let Some(c) = rest.chars().next() {
+        let (token, len) = match c {
+            '(' => (Token::LParen, 1),
+            ')' => (Token::RParen, 1),
+            _ if rest.starts_with("&&") => (Token::And, 2),
+            _ if rest.starts_with("||") => (Token::Or, 2),
+            _ if rest.starts_with("==") => (Token::Op(CompareOp::Eq), 2),
+            _ if rest.starts_with("!=") => (Token::Op(CompareOp::NotEq), 2),
+            _ if rest.starts_with("=~") => (Token::Op(CompareOp::Matches), 2),
+            '!' => (Token::Not, 1),
+            '"' | '\'' => {
+                let end = rest[1..]
+                    .find(c)
+                    .ok_or_else(|| format!("unclosed {c} in `{condition}`"))?;
+                (Token::Str(&rest[1..end + 1]), end + 2)
+            }
+            '/' => {
+                let mut escaped = false;
+                let end = rest[1..]
+                    .char_indices()
+                    .find(|(_, c)| {
+                        let end = !escaped && *c == '/';
+                        escaped = !escaped && *c == '\\';
+                        end
+                    })
+                    .map(|(i, _)| i + 2)
+                    .ok_or_else(|| format!("unclosed regex in `{condition}`"))?;
+                let flags = rest[end..]
+                    .find(|c: char| !c.is_ascii_alphabetic())
+                    .unwrap_or(rest.len() - end);
+                let regex_value = &rest[..end + flags];
+                regex(regex_value)?;
+                (Token::Regex(regex_value), end + flags)
+            }
+            _ if is_word_char(c) => {
+                let len = rest.find(|c| !is_word_char(c)).unwrap_or(rest.len());
+                (Token::Word(&rest[..len]), len)
+            }
+            _ => return Err(format!("unexpected `{c}` in `{condition}`")),
+        };
+        tokens.push(token);
+        rest = rest[len..].trim_start();
+    }
+    Ok(tokens)
+}
+
+fn is_word_char(c: char) -> bool {
+    c.is_alphanumeric() || matches!(c, '_' | '.' | '-' | ':')
+}
+
+struct Parser<'a> {
+    tokens: Vec<Token<'a>>,
+    pos: usize,
+}
+
+impl<'a> Parser<'a> {
+    fn next(&mut self) -> Option<Token<'a>> {
+        let token = self.tokens.get(self.pos).copied();
+        self.pos += 1;
+        token
+    }
+
+    fn peek(&self) -> Option<Token<'a>> {
+        self.tokens.get(self.pos).copied()
+    }
+
+    fn parse_or(&mut self) -> Result<ConditionExpr<'a>, String> {
+        let mut expr = self.parse_and()?;
+        while self.peek() == Some(Token::Or) {
+            self.pos += 1;
+            expr = ConditionExpr::Or(Box::new(expr), Box::new(self.parse_and()?));
+        }
+        Ok(expr)
+    }
+
+    fn parse_and(&mut self) -> Result<ConditionExpr<'a>, String> {
+        let mut expr = self.parse_unary()?;
+        while self.peek() == Some(Token::And) {
+            self.pos += 1;
+            expr = ConditionExpr::And(Box::new(expr), Box::new(self.parse_unary()?));
+        }
+        Ok(expr)
+    }
+
+    fn parse_unary(&mut self) -> Result<ConditionExpr<'a>, String> {
+        match self.next() {
+            Some(Token::Not) => {
+                Ok(ConditionExpr::Not(Box::new(self.parse_unary()?)))
+            }
+            Some(Token::LParen) => {
+                let expr = self.parse_or()?;
+                match self.next() {
+                    Some(Token::RParen) => Ok(expr),
+                    _ => Err("missing )".to_string()),
+                }
+            }
+            Some(Token::Word(word)) => {
+                let Some(Token::Op(op)) = self.peek() else {
+                    return Ok(match word {
+                        "true" => ConditionExpr::Bool(true),
+                        "false" => ConditionExpr::Bool(false),
+                        _ => ConditionExpr::Flag(word),
+                    });
+                };
+                self.pos += 1;
+                match (op, self.next()) {
+                    (
+                        CompareOp::Eq | CompareOp::NotEq,
+                        Some(Token::Str(value) | Token::Word(value)),
                     )
+                    | (CompareOp::Matches, Some(Token::Regex(value))) => {
+                        Ok(ConditionExpr::Compare(word, op, value))
+                    }
+                    (_, token) => {
+                        Err(format!("can't compare {word} with {token:?}"))
+                    }
                 }
             }
+            Some(token) => Err(format!("unexpected {token:?}")),
+            None => Err("missing condition".to_string()),
         }
     }
 }
 
-#[derive(Clone, Copy, Debug, EnumString, PartialEq, Eq)]
+#[derive(Clone, Copy, Debug, EnumString, EnumIter, IntoStaticStr, PartialEq, Eq)]
 pub enum Condition {
     #[strum(serialize = "editor_focus")]
     EditorFocus,
@@ -73,13 +361,99 @@ pub enum Condition {
     ReplaceFocus,
 }
 
+/// Context keys whose values `when` clauses can compare.
+#[derive(Clone, Copy, Debug, EnumString, EnumIter, IntoStaticStr, PartialEq, Eq)]
+pub enum ContextKey {
+    /// The language of the focused editor, e.g. `rust`.
+    #[strum(serialize = "editor_lang")]
+    EditorLang,
+    /// The extension of the focused file, with the dot, e.g. `.rs`.
+    #[strum(serialize = "resource_extname")]
+    ResourceExtname,
+    /// The name of the focused file, e.g. `main.rs`.
+    #[strum(serialize = "resource_filename")]
+    ResourceFilename,
+    /// Each visible panel, e.g. `terminal` or `file_explorer`.
+    #[strum(serialize = "panel_visible")]
+    PanelVisible,
+    /// `inactive`, `running` or `stopped`.
+    #[strum(serialize = "debug_state")]
+    DebugState,
+}
+
+/// The conditions and context values of a focus at one point, which the
+/// keymap view checks the `when` clauses against.
+#[derive(Clone, Debug, Default, PartialEq, Eq)]
+pub struct ConditionContext {
+    pub conditions: Vec<Condition>,
+    pub values: Vec<(ContextKey, Vec<String>)>,
+}
+
+impl ConditionContext {
+    pub fn capture<T: KeyPressFocus + ?Sized>(focus: &T) -> Self {
+        Self {
+            conditions: Condition::iter()
+                .filter(|condition| focus.check_condition(*condition))
+                .collect(),
+            values: ContextKey::iter()
+                .map(|key| (key, focus.context_values(key)))
+                .filter(|(_, values)| !values.is_empty())
+                .collect(),
+        }
+    }
+
+    /// The conditions that hold and the context values, as they'd be
+    /// written in a `when` clause.
+    pub fn describe(&self) -> Vec<String> {
+        let conditions = self
+            .conditions
+            .iter()
+            .map(|condition| <&str>::from(condition).to_string());
+        let values = self.values.iter().flat_map(|(key, values)| {
+            values
+                .iter()
+                .map(|value| format!("{} == \"{value}\"", <&str>::from(key)))
+        });
+        conditions.chain(values).collect()
+    }
+}
+
+impl KeyPressFocus for ConditionContext {
+    fn get_mode(&self) -> Mode {
+        Mode::Normal
+    }
+
+    fn check_condition(&self, condition: Condition) -> bool {
+        self.conditions.contains(&condition)
+    }
+
+    fn context_values(&self, key: ContextKey) -> Vec<String> {
+        self.values
+            .iter()
+            .find(|(k, _)| *k == key)
+            .map(|(_, values)| values.clone())
+            .unwrap_or_default()
+    }
+
+    fn run_command(
+        &self,
+        _command: &LapceCommand,
+        _count: Option<usize>,
+        _mods: Modifiers,
+    ) -> CommandExecuted {
+        CommandExecuted::No
+    }
+
+    fn receive_char(&self, _c: &str) {}
+}
+
 #[cfg(test)]
 mod test {
     use floem::keyboard::Modifiers;
     use lapce_core::mode::Mode;
 
-    use super::Condition;
-    use crate::keypress::{KeyPressData, KeyPressFocus, condition::CheckCondition};
+    use super::{CompareOp, Condition, ConditionExpr, ContextKey, REGEXES, regex};
+    use crate::keypress::{KeyPressData, KeyPressFocus};
 
     #[derive(Clone, Copy, Debug)]
     struct MockFocus {
@@ -91,6 +465,20 @@ fn check_condition(&self, condition: Condition) -> bool {
             self.accepted_conditions.contains(&condition)
         }
 
+        fn context_values(&self, key: ContextKey) -> Vec<String> {
+            match key {
+                ContextKey::EditorLang => vec!["rust".to_string()],
+                ContextKey::ResourceExtname => vec![".rs".to_string()],
+                ContextKey::ResourceFilename => {
+                    vec!["parser.test.rs".to_string()]
+                }
+                ContextKey::PanelVisible => {
+                    vec!["terminal".to_string(), "file_explorer".to_string()]
+                }
+                ContextKey::DebugState => vec!["stopped".to_string()],
+            }
+        }
+
         fn get_mode(&self) -> Mode {
             unimplemented!()
         }
@@ -111,22 +499,68 @@ fn receive_char(&self, _c: &str) {
 
     #[test]
     fn test_parse() {
+        let flag = |f| Box::new(ConditionExpr::Flag(f));
+        assert_eq!(
+            Ok(ConditionExpr::Or(flag("foo"), flag("bar"))),
+            ConditionExpr::parse("foo||bar")
+        );
         assert_eq!(
-            CheckCondition::Or("foo", "bar"),
-            CheckCondition::parse_first("foo||bar")
+            Ok(ConditionExpr::Or(
+                Box::new(ConditionExpr::And(flag("foo"), flag("bar"))),
+                flag("baz")
+            )),
+            ConditionExpr::parse("foo && bar || baz")
         );
         assert_eq!(
-            CheckCondition::And("foo", "bar"),
-            CheckCondition::parse_first("foo&&bar")
+            Ok(ConditionExpr::And(
+                flag("foo"),
+                Box::new(ConditionExpr::Or(flag("bar"), flag("baz")))
+            )),
+            ConditionExpr::parse("foo && (bar || baz)")
         );
         assert_eq!(
-            CheckCondition::And("foo", "bar||baz"),
-            CheckCondition::parse_first("foo&&bar||baz")
+            Ok(ConditionExpr::Not(Box::new(ConditionExpr::Compare(
+                "editor_lang",
+                CompareOp::Eq,
+                "rust"
+            )))),
+            ConditionExpr::parse("!(editor_lang == 'rust')")
         );
         assert_eq!(
-            CheckCondition::And("foo ", " bar || baz"),
-            CheckCondition::parse_first("foo && bar || baz")
+            Ok(ConditionExpr::Compare(
+                "resource_filename",
+                CompareOp::Matches,
+                "/\\.TEST\\./i"
+            )),
+            ConditionExpr::parse("resource_filename =~ /\\.TEST\\./i")
         );
+
+        for invalid in [
+            "",
+            "foo &&",
+            "(foo || bar",
+            "foo)",
+            "editor_lang ==",
+            "editor_lang =~ \"rust\"",
+            "editor_lang =~ /(/",
+            "editor_lang == \"rust",
+        ] {
+            assert!(ConditionExpr::parse(invalid).is_err(), "{invalid}");
+        }
+    }
+
+    #[test]
+    fn test_display() {
+        for condition in [
+            "editor_focus && (list_focus || !modal_focus)",
+            "!(editor_focus && list_focus) || true",
+            "editor_lang == \"rust\" && resource_extname =~ /\\.rs$/i",
+            "!(debug_state != \"stopped\")",
+        ] {
+            let expr = ConditionExpr::parse(condition).unwrap();
+            assert_eq!(condition, expr.to_string());
+            assert_eq!(Ok(expr.clone()), ConditionExpr::parse(&expr.to_string()));
+        }
     }
 
     #[test]
@@ -149,6 +583,23 @@ fn test_check_condition() {
             ("editor_focus && list_focus || baz", true),
             ("editor_focus && list_focus && baz", false),
             ("editor_focus && list_focus && !baz", true),
+            ("baz && editor_focus || list_focus", true),
+            ("baz && (editor_focus || list_focus)", false),
+            ("!(editor_focus && baz)", true),
+            ("true && !false", true),
+            ("editor_lang == \"rust\"", true),
+            ("editor_lang == go", false),
+            ("editor_lang != 'go' && editor_focus", true),
+            ("resource_extname =~ /\\.rs$/", true),
+            ("resource_filename =~ /\\.test\\./", true),
+            ("resource_filename =~ /\\.TEST\\./", false),
+            ("resource_filename =~ /\\.TEST\\./i", true),
+            ("panel_visible == \"terminal\"", true),
+            ("panel_visible == \"search\"", false),
+            ("panel_visible != \"search\"", true),
+            ("debug_state == \"stopped\" && !modal_focus", true),
+            ("unknown_key == \"x\"", false),
+            ("editor_focus &&", false),
         ];
 
         for (condition, should_accept) in test_cases.into_iter() {
@@ -159,4 +610,13 @@ fn test_check_condition() {
             );
         }
     }
+
+    #[test]
+    fn test_regex_cache() {
+        let first = regex("/\\.rs$/i").unwrap();
+        assert!(REGEXES.with_borrow(|regexes| regexes.contains_key("/\\.rs$/i")));
+        let second = regex("/\\.rs$/i").unwrap();
+        assert_eq!(first.as_str(), second.as_str());
+        assert!(regex("/[/").is_err());
+    }
 }
@@ -0,0 +1,347 @@
+//! Finds keymaps that can't run because another keymap takes their keys.
+//!
+//! A keymap conflicts with a chord that starts with its keys when both can
+//! apply at the same time: their modes overlap and there is a way for both
+//! `when` clauses to hold. Flags are assumed to be independent of each other,
+//! apart from the focus flags that can't be true together, so a conflict is
+//! reported whenever one is possible.
+//!
+//! Keymaps with the same keys don't conflict: the one loaded last is tried
+//! first and the others are fallbacks, tried in turn until one of their
+//! commands runs.
+
+use std::collections::HashMap;
+
+use indexmap::IndexMap;
+use itertools::Itertools;
+
+use super::{
+    condition::{CompareOp, ConditionExpr, ContextKey},
+    keymap::{KeyMap, KeyMapPress},
+};
+
+/// Above this many flags and comparisons, two conditions are assumed to
+/// overlap instead of trying every combination.
+const MAX_LEAVES: usize = 12;
+
+/// Focus flags of which at most one holds at a time.
+const EXCLUSIVE_FLAGS: &[&str] =
+    &["editor_focus", "terminal_focus", "palette_focus"];
+
+#[derive(Clone, Debug, PartialEq, Eq, Hash)]
+pub struct KeymapConflict {
+    /// The keymap that never runs, as its keys are a prefix of the other's,
+    /// so pressing them waits for the rest of the chord instead.
+    pub shadowed: KeyMap,
+    /// The chord that starts with the keys of the shadowed keymap.
+    pub by: KeyMap,
+}
+
+impl KeymapConflict {
+    pub fn involves(&self, keymap: &KeyMap) -> bool {
+        &self.shadowed == keymap || &self.by == keymap
+    }
+
+    /// The keymap in the conflict other than `keymap`.
+    pub fn other(&self, keymap: &KeyMap) -> &KeyMap {
+        if &self.shadowed == keymap {
+            &self.by
+        } else {
+            &self.shadowed
+        }
+    }
+
+    pub fn description(&self) -> String {
+        let keys =
+            |keymap: &KeyMap| keymap.key.iter().map(|key| key.label()).join(" ");
+        format!(
+            "{} is the start of {} for {}, so {} never runs",
+            keys(&self.shadowed),
+            keys(&self.by),
+            self.by.command,
+            self.shadowed.command,
+        )
+    }
+
+    /// A `when` clause for `keymap` that doesn't hold where the other keymap
+    /// of the conflict applies, if the other keymap has a condition to
+    /// negate.
+    pub fn disambiguating_when(&self, keymap: &KeyMap) -> Option<String> {
+        let other = self.other(keymap).when.as_deref()?;
+        let not_other =
+            ConditionExpr::Not(Box::new(ConditionExpr::parse(other).ok()?));
+        let when = match keymap.when.as_deref() {
+            Some(when) => ConditionExpr::And(
+                Box::new(ConditionExpr::parse(when).ok()?),
+                Box::new(not_other),
+            ),
+            None => not_other,
+        };
+        Some(when.to_string())
+    }
+}
+
+/// Finds the conflicts between the loaded keymaps, which are listed by key in
+/// the order they were loaded, with the longer keymaps under each of their
+/// prefixes as `KeyMapLoader` builds them.
+pub fn find_conflicts(
+    keymaps: &IndexMap<Vec<KeyMapPress>, Vec<KeyMap>>,
+) -> Vec<KeymapConflict> {
+    let mut conflicts = Vec::new();
+    for (keys, keymaps) in keymaps {
+        let (full, longer): (Vec<_>, Vec<_>) =
+            keymaps.iter().partition(|keymap| &keymap.key == keys);
+        for keymap in &full {
+            for chord in &longer {
+                if overlap(keymap, chord) {
+                    conflicts.push(KeymapConflict {
+                        shadowed: (*keymap).clone(),
+                        by: (*chord).clone(),
+                    });
+                }
+            }
+        }
+    }
+    conflicts
+}
+
+/// The keymaps among `keymaps` for exactly `keys` or a chord starting with
+/// them that can apply together with `keymap`.
+pub fn conflicting_keymaps<'a>(
+    keymaps: &'a IndexMap<Vec<KeyMapPress>, Vec<KeyMap>>,
+    keys: &[KeyMapPress],
+    keymap: &KeyMap,
+) -> Vec<&'a KeyMap> {
+    let keymap = KeyMap {
+        key: keys.to_vec(),
+        ..keymap.clone()
+    };
+    // the shorter keymaps are listed under each of their own keys
+    let mut conflicting: Vec<&KeyMap> = (1..keys.len())
+        .filter_map(|i| {
+            let prefix = &keys[..i];
+            keymaps
+                .get(prefix)
+                .map(|keymaps| keymaps.iter().filter(move |k| k.key == prefix))
+        })
+        .flatten()
+        .collect();
+    conflicting.extend(keymaps.get(keys).into_iter().flatten());
+    conflicting
+        .retain(|other| other.command != keymap.command && overlap(&keymap, other));
+    conflicting
+}
+
+/// Whether two keymaps can apply at the same time.
+pub fn overlap(a: &KeyMap, b: &KeyMap) -> bool {
+    let modes_overlap =
+        a.modes.is_empty() || b.modes.is_empty() || a.modes.intersects(b.modes);
+    modes_overlap && conditions_overlap(a.when.as_deref(), b.when.as_deref())
+}
+
+fn conditions_overlap(a: Option<&str>, b: Option<&str>) -> bool {
+    fn parse(when: Option<&str>) -> Option<ConditionExpr<'_>> {
+        match when {
+            Some(when) => ConditionExpr::parse(when).ok(),
+            None => Some(ConditionExpr::Bool(true)),
+        }
+    }
+
+    // a `when` that doesn't parse never holds, see `KeyPressData::check_condition`
+    let (Some(a), Some(b)) = (parse(a), parse(b)) else {
+        return false;
+    };
+
+    let mut leaves: Vec<Leaf> = Vec::new();
+    for leaf in a.leaves().into_iter().chain(b.leaves()) {
+        let leaf = Leaf::from(leaf);
+        if !leaves.contains(&leaf) {
+            leaves.push(leaf);
+        }
+    }
+    if leaves.len() > MAX_LEAVES {
+        return true;
+    }
+
+    (0..1u32 << leaves.len()).any(|assignment| {
+        let holds = |leaf: &Leaf| assignment & (1 << index_of(&leaves, leaf)) != 0;
+        if !consistent(&leaves, &holds) {
+            return false;
+        }
+        let mut eval = |expr: &ConditionExpr| {
+            let leaf = Leaf::from(expr);
+            match expr {
+                ConditionExpr::Compare(_, CompareOp::NotEq, _) => !holds(&leaf),
+                _ => holds(&leaf),
+            }
+        };
+        a.eval_with(&mut eval) && b.eval_with(&mut eval)
+    })
+}
+
+/// A flag or comparison, with `!=` turned into the `==` it negates.
+#[derive(Clone, Debug, PartialEq, Eq)]
+enum Leaf<'a> {
+    Flag(&'a str),
+    Equals(&'a str, &'a str),
+    Matches(&'a str, &'a str),
+}
+
+impl<'a> From<&ConditionExpr<'a>> for Leaf<'a> {
+    fn from(expr: &ConditionExpr<'a>) -> Self {
+        match expr {
+            ConditionExpr::Compare(key, CompareOp::Matches, value) => {
+                Leaf::Matches(key, value)
+            }
+            ConditionExpr::Compare(key, _, value) => Leaf::Equals(key, value),
+            ConditionExpr::Flag(flag) => Leaf::Flag(flag),
+            // only flags and comparisons are leaves
+            _ => Leaf::Flag(""),
+        }
+    }
+}
+
+fn index_of(leaves: &[Leaf], leaf: &Leaf) -> usize {
+    leaves.iter().position(|l| l == leaf).unwrap_or_default()
+}
+
+/// Whether the leaves can hold together: only one exclusive focus flag, and
+/// one value for the context keys that have a single value.
+fn consistent(leaves: &[Leaf], holds: &impl Fn(&Leaf) -> bool) -> bool {
+    let focused = leaves
+        .iter()
+        .filter(|leaf| {
+            matches!(leaf, Leaf::Flag(flag) if EXCLUSIVE_FLAGS.contains(flag))
+        })
+        .filter(|leaf| holds(*leaf))
+        .count();
+    if focused > 1 {
+        return false;
+    }
+
+    let mut values: HashMap<&str, &str> = HashMap::new();
+    for leaf in leaves {
+        if let Leaf::Equals(key, value) = leaf {
+            if *key == <&str>::from(ContextKey::PanelVisible) || !holds(leaf) {
+                continue;
+            }
+            if values
+                .insert(key, value)
+                .is_some_and(|other| other != *value)
+            {
+                return false;
+            }
+        }
+    }
+    true
+}
+
+#[cfg(test)]
+mod tests {
+    use indexmap::IndexMap;
+    use lapce_core::mode::Modes;
+
+    use super::{conditions_overlap, find_conflicts};
+    use crate::keypress::keymap::{KeyMap, KeyMapPress};
+
+    fn keymap(key: &str, command: &str, when: Option<&str>) -> KeyMap {
+        KeyMap {
+            key: KeyMapPress::parse(key),
+            modes: Modes::empty(),
+            when: when.map(|when| when.to_string()),
+            command: command.to_string(),
+        }
+    }
+
+    #[test]
+    fn test_conditions_overlap() {
+        let cases = [
+            (None, None, true),
+            (None, Some("list_focus"), true),
+            (Some("list_focus"), Some("!list_focus"), false),
+            (Some("editor_focus"), Some("terminal_focus"), false),
+            (Some("editor_focus"), Some("!terminal_focus"), true),
+            (
+                Some("editor_focus && list_focus"),
+                Some("list_focus || in_snippet"),
+                true,
+            ),
+            (Some("false"), None, false),
+            (
+                Some("editor_lang == \"rust\""),
+                Some("editor_lang == \"go\""),
+                false,
+            ),
+            (
+                Some("editor_lang == \"rust\""),
+                Some("editor_lang != \"go\""),
+                true,
+            ),
+            (
+                Some("editor_lang == \"rust\""),
+                Some("editor_lang != \"rust\""),
+                false,
+            ),
+            (
+                Some("panel_visible == \"terminal\""),
+                Some("panel_visible == \"search\""),
+                true,
+            ),
+            (Some("(a || b) && !c"), Some("c"), false),
+        ];
+        for (a, b, overlap) in cases {
+            assert_eq!(overlap, conditions_overlap(a, b), "{a:?} and {b:?}");
+        }
+    }
+
+    #[test]
+    fn test_find_conflicts() {
+        let keymaps = [
+            keymap("ctrl+k", "left", None),
+            keymap("ctrl+k ctrl+c", "toggle_line_comment", Some("editor_focus")),
+            keymap("ctrl+j", "down", Some("list_focus")),
+            keymap("ctrl+j", "right", Some("!list_focus")),
+            keymap("ctrl+j", "up", None),
+            keymap("ctrl+l", "right", Some("terminal_focus")),
+            keymap("ctrl+l ctrl+l", "left", Some("editor_focus")),
+        ];
+        let mut map: IndexMap<Vec<KeyMapPress>, Vec<KeyMap>> = IndexMap::new();
+        for keymap in keymaps {
+            for i in 1..keymap.key.len() + 1 {
+                map.entry(keymap.key[..i].to_vec())
+                    .or_default()
+                    .push(keymap.clone());
+            }
+        }
+
+        let conflicts = find_conflicts(&map);
+        let conflicts: Vec<_> = conflicts
+            .iter()
+            .map(|c| (c.shadowed.command.as_str(), c.by.command.as_str()))
+            .collect();
+        // ctrl+j falls back from up to right and down, which isn't a conflict
+        assert_eq!(conflicts, vec![("left", "toggle_line_comment")]);
+    }
+
+    #[test]
+    fn test_disambiguating_when() {
+        let conflict = super::KeymapConflict {
+            shadowed: keymap("ctrl+j", "down", Some("editor_focus")),
+            by: keymap("ctrl+j ctrl+k", "up", Some("list_focus || in_snippet")),
+        };
+        assert_eq!(
+            conflict.disambiguating_when(&conflict.shadowed).as_deref(),
+            Some("editor_focus && !(list_focus || in_snippet)")
+        );
+        assert_eq!(
+            conflict.disambiguating_when(&conflict.by).as_deref(),
+            Some("(list_focus || in_snippet) && !editor_focus")
+        );
+
+        let conflict = super::KeymapConflict {
+            shadowed: keymap("ctrl+k", "left", None),
+            by: keymap("ctrl+k ctrl+c", "toggle_line_comment", None),
+        };
+        assert_eq!(conflict.disambiguating_when(&conflict.shadowed), None);
+    }
+}
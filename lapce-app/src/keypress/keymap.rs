@@ -140,6 +140,15 @@ pub fn parse(key: &str) -> Vec<Self> {
                     match part {
                         "ctrl" => mods.set(Modifiers::CONTROL, true),
                         "meta" => mods.set(Modifiers::META, true),
+                        // Cmd on macOS and Ctrl elsewhere, for the keymap presets
+                        "primary" => mods.set(
+                            if std::env::consts::OS == "macos" {
+                                Modifiers::META
+                            } else {
+                                Modifiers::CONTROL
+                            },
+                            true,
+                        ),
                         "shift" => mods.set(Modifiers::SHIFT, true),
                         "alt" => mods.set(Modifiers::ALT, true),
                         "altgr" => mods.set(Modifiers::ALTGR, true),
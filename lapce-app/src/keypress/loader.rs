@@ -1,9 +1,13 @@
 use anyhow::{Result, anyhow};
 use indexmap::IndexMap;
 use lapce_core::mode::Modes;
+use lapce_rpc::plugin::{VoltID, VoltKeymap};
 use tracing::{debug, error};
 
-use super::keymap::{KeyMap, KeyMapPress};
+use super::{
+    condition::ConditionExpr,
+    keymap::{KeyMap, KeyMapPress},
+};
 
 pub struct KeyMapLoader {
     keymaps: IndexMap<Vec<KeyMapPress>, Vec<KeyMap>>,
@@ -41,39 +45,82 @@ pub fn load_from_str<'a>(
                     continue;
                 }
             };
+            self.add_keymap(keymap);
+        }
 
-            let (command, bind) = match keymap.command.strip_prefix('-') {
-                Some(cmd) => (cmd.to_string(), false),
-                None => (keymap.command.clone(), true),
-            };
+        Ok(self)
+    }
 
-            let current_keymaps = self.command_keymaps.entry(command).or_default();
-            if bind {
-                current_keymaps.push(keymap.clone());
-                for i in 1..keymap.key.len() + 1 {
-                    let key = keymap.key[..i].to_vec();
-                    self.keymaps.entry(key).or_default().push(keymap.clone());
-                }
-            } else {
-                let is_keymap = |k: &KeyMap| -> bool {
-                    k.when == keymap.when
-                        && k.modes == keymap.modes
-                        && k.key == keymap.key
-                };
-                if let Some(index) = current_keymaps.iter().position(is_keymap) {
-                    current_keymaps.remove(index);
-                }
-                for i in 1..keymap.key.len() + 1 {
-                    if let Some(keymaps) = self.keymaps.get_mut(&keymap.key[..i]) {
-                        if let Some(index) = keymaps.iter().position(is_keymap) {
-                            keymaps.remove(index);
-                        }
+    /// Load the keymaps declared by volts. These don't support unbinding
+    /// with a `-` prefix, since volts shouldn't remove the default keymaps,
+    /// and can only bind the volt's own `author.name.*` commands, since they
+    /// are loaded after the defaults and would otherwise override them.
+    pub fn load_from_volts<'a>(
+        &'a mut self,
+        keymaps: &[(VoltID, VoltKeymap)],
+        modal: bool,
+    ) -> &'a mut Self {
+        for (volt, keymap) in keymaps {
+            if keymap.command.starts_with('-') {
+                error!("Volt keymap can't unbind {}", keymap.command);
+                continue;
+            }
+            if !volt.owns_command(&keymap.command) {
+                error!(
+                    "{volt} can't bind {} to {}, which isn't one of its commands",
+                    keymap.key, keymap.command
+                );
+                continue;
+            }
+            let modes = keymap
+                .mode
+                .as_deref()
+                .map(Modes::parse)
+                .unwrap_or_else(Modes::empty);
+            if let Some(keymap) = Self::new_keymap(
+                &keymap.key,
+                modes,
+                keymap.when.clone(),
+                &keymap.command,
+                modal,
+            ) {
+                self.add_keymap(keymap);
+            }
+        }
+
+        self
+    }
+
+    fn add_keymap(&mut self, keymap: KeyMap) {
+        let (command, bind) = match keymap.command.strip_prefix('-') {
+            Some(cmd) => (cmd.to_string(), false),
+            None => (keymap.command.clone(), true),
+        };
+
+        let current_keymaps = self.command_keymaps.entry(command).or_default();
+        if bind {
+            current_keymaps.push(keymap.clone());
+            for i in 1..keymap.key.len() + 1 {
+                let key = keymap.key[..i].to_vec();
+                self.keymaps.entry(key).or_default().push(keymap.clone());
+            }
+        } else {
+            let is_keymap = |k: &KeyMap| -> bool {
+                k.when == keymap.when
+                    && k.modes == keymap.modes
+                    && k.key == keymap.key
+            };
+            if let Some(index) = current_keymaps.iter().position(is_keymap) {
+                current_keymaps.remove(index);
+            }
+            for i in 1..keymap.key.len() + 1 {
+                if let Some(keymaps) = self.keymaps.get_mut(&keymap.key[..i]) {
+                    if let Some(index) = keymaps.iter().position(is_keymap) {
+                        keymaps.remove(index);
                     }
                 }
             }
         }
-
-        Ok(self)
     }
 
     #[allow(clippy::type_complexity)]
@@ -100,7 +147,28 @@ fn get_keymap(
             .and_then(|v| v.as_str())
             .ok_or_else(|| anyhow!("no key in keymap"))?;
 
-        let modes = get_modes(toml_keymap);
+        Ok(Self::new_keymap(
+            key,
+            get_modes(toml_keymap),
+            toml_keymap
+                .get("when")
+                .and_then(|w| w.as_str())
+                .map(|w| w.to_string()),
+            toml_keymap
+                .get("command")
+                .and_then(|c| c.as_str())
+                .unwrap_or_default(),
+            modal,
+        ))
+    }
+
+    fn new_keymap(
+        key: &str,
+        modes: Modes,
+        when: Option<String>,
+        command: &str,
+        modal: bool,
+    ) -> Option<KeyMap> {
         // If not using modal editing, remove keymaps that only make sense in modal.
         if !modal
             && !modes.is_empty()
@@ -108,22 +176,20 @@ fn get_keymap(
             && !modes.contains(Modes::TERMINAL)
         {
             debug!("Keymap ignored: {}", key);
-            return Ok(None);
+            return None;
         }
 
-        Ok(Some(KeyMap {
+        if let Some(Err(err)) = when.as_deref().map(ConditionExpr::parse) {
+            error!("Keymap {key} has an invalid `when`: {err}");
+            return None;
+        }
+
+        Some(KeyMap {
             key: KeyMapPress::parse(key),
             modes,
-            when: toml_keymap
-                .get("when")
-                .and_then(|w| w.as_str())
-                .map(|w| w.to_string()),
-            command: toml_keymap
-                .get("command")
-                .and_then(|c| c.as_str())
-                .map(|w| w.trim().to_string())
-                .unwrap_or_default(),
-        }))
+            when,
+            command: command.trim().to_string(),
+        })
     }
 }
 
@@ -250,4 +316,100 @@ fn test_keymap() {
             KeyMapKey::Logical(Key::Character("+".into()))
         );
     }
+
+    #[test]
+    fn test_keymap_presets() {
+        for (name, preset) in crate::keypress::KEYMAP_PRESETS {
+            let toml_keymaps: toml_edit::Document = preset.parse().unwrap();
+            for toml_keymap in toml_keymaps["keymaps"].as_array_of_tables().unwrap()
+            {
+                let keymap = KeyMapLoader::get_keymap(toml_keymap, false)
+                    .unwrap()
+                    .unwrap();
+                let key = toml_keymap["key"].as_str().unwrap();
+                assert_eq!(
+                    keymap.key.len(),
+                    key.split(' ').count(),
+                    "{name} preset has an invalid key {key}"
+                );
+            }
+        }
+
+        let keypress = KeyMapPress::parse("primary+b");
+        let ctrl_or_cmd = if std::env::consts::OS == "macos" {
+            KeyMapPress::parse("meta+b")
+        } else {
+            KeyMapPress::parse("ctrl+b")
+        };
+        assert_eq!(keypress, ctrl_or_cmd);
+    }
+
+    #[test]
+    fn test_invalid_when() {
+        let keymaps = r#"
+[[keymaps]]
+key = "ctrl+k"
+command = "left"
+when = "(editor_focus || list_focus) && editor_lang == \"rust\""
+
+[[keymaps]]
+key = "ctrl+k"
+command = "right"
+when = "editor_focus &&"
+        "#;
+        let mut loader = KeyMapLoader::new();
+        loader.load_from_str(keymaps, false).unwrap();
+        let (keymaps, _) = loader.finalize();
+        let keymaps = keymaps.get(&KeyMapPress::parse("ctrl+k")).unwrap();
+        assert_eq!(keymaps.len(), 1);
+        assert_eq!(keymaps[0].command, "left");
+    }
+
+    #[test]
+    fn test_volt_keymaps() {
+        let volt = VoltID {
+            author: "author".to_string(),
+            name: "volt".to_string(),
+        };
+        let volt_keymap = |key: &str, command: &str| {
+            (
+                volt.clone(),
+                VoltKeymap {
+                    key: key.to_string(),
+                    command: command.to_string(),
+                    when: None,
+                    mode: None,
+                },
+            )
+        };
+        let volt_keymaps = vec![
+            volt_keymap("ctrl+shift+g", "author.volt.open"),
+            volt_keymap("ctrl+k", "-author.volt.open"),
+            volt_keymap("ctrl+s", "save"),
+            volt_keymap("ctrl+o", "other.volt.open"),
+        ];
+        let user_keymaps = r#"
+[[keymaps]]
+key = "ctrl+shift+g"
+command = "-author.volt.open"
+        "#;
+
+        let mut loader = KeyMapLoader::new();
+        loader.load_from_volts(&volt_keymaps, false);
+        let (keymaps, command_keymaps) = loader.finalize();
+        let keypress = KeyMapPress::parse("ctrl+shift+g");
+        assert_eq!(keymaps.get(&keypress).unwrap().len(), 1);
+        // Volts can't unbind keys, nor bind commands that aren't theirs
+        assert!(keymaps.get(&KeyMapPress::parse("ctrl+k")).is_none());
+        assert!(keymaps.get(&KeyMapPress::parse("ctrl+s")).is_none());
+        assert!(keymaps.get(&KeyMapPress::parse("ctrl+o")).is_none());
+        assert_eq!(command_keymaps.get("author.volt.open").unwrap().len(), 1);
+
+        // The user's keymaps are loaded after the volts', so they can unbind them
+        let mut loader = KeyMapLoader::new();
+        loader.load_from_volts(&volt_keymaps, false);
+        loader.load_from_str(user_keymaps, false).unwrap();
+        let (keymaps, _) = loader.finalize();
+        assert!(keymaps.get(&keypress).unwrap().is_empty());
+    }
 }
@@ -0,0 +1,603 @@
+//! Converts VS Code `keybindings.json` files into Lapce keymaps.
+//!
+//! Bindings are converted one by one. The ones whose command, key or `when`
+//! clause has no Lapce equivalent are listed instead, so they can be bound by
+//! hand.
+
+use std::{fs, path::Path};
+
+use anyhow::{Result, anyhow};
+use lapce_core::mode::Modes;
+use serde::Deserialize;
+use serde_json::Value;
+
+use super::{
+    condition::ConditionExpr,
+    keymap::{KeyMap, KeyMapPress},
+};
+use crate::config::vscode_theme::strip_jsonc;
+
+/// VS Code commands and the Lapce commands that do the same.
+const COMMANDS: &[(&str, &str)] = &[
+    // workbench
+    ("workbench.action.showCommands", "palette.command"),
+    ("workbench.action.quickOpen", "palette"),
+    ("workbench.action.gotoLine", "palette.line"),
+    ("workbench.action.gotoSymbol", "palette.symbol"),
+    (
+        "workbench.action.showAllSymbols",
+        "palette.workspace_symbol",
+    ),
+    ("workbench.action.openRecent", "palette.workspace"),
+    ("workbench.action.openSettings", "open_settings"),
+    ("workbench.action.openSettingsJson", "open_settings_file"),
+    (
+        "workbench.action.openGlobalKeybindings",
+        "open_keyboard_shortcuts",
+    ),
+    (
+        "workbench.action.openGlobalKeybindingsFile",
+        "open_keyboard_shortcuts_file",
+    ),
+    ("workbench.action.selectTheme", "change_color_theme"),
+    ("workbench.action.selectIconTheme", "change_icon_theme"),
+    ("workbench.action.zoomIn", "zoom_in"),
+    ("workbench.action.zoomOut", "zoom_out"),
+    ("workbench.action.zoomReset", "zoom_reset"),
+    ("workbench.action.newWindow", "new_window"),
+    ("workbench.action.closeWindow", "close_window"),
+    ("workbench.action.reloadWindow", "reload_window"),
+    ("workbench.action.quit", "quit"),
+    ("workbench.action.files.newUntitledFile", "new_file"),
+    ("workbench.action.files.openFile", "open_file"),
+    ("workbench.action.files.openFolder", "open_folder"),
+    ("workbench.action.closeFolder", "close_folder"),
+    ("workbench.action.files.save", "save"),
+    ("workbench.action.files.saveAll", "save_all"),
+    (
+        "workbench.action.files.saveWithoutFormatting",
+        "save_without_formatting",
+    ),
+    ("workbench.action.closeActiveEditor", "split_close"),
+    ("workbench.action.splitEditor", "split_vertical"),
+    ("workbench.action.splitEditorRight", "split_vertical"),
+    ("workbench.action.splitEditorDown", "split_horizontal"),
+    ("workbench.action.focusLeftGroup", "split_left"),
+    ("workbench.action.focusRightGroup", "split_right"),
+    ("workbench.action.focusAboveGroup", "split_up"),
+    ("workbench.action.focusBelowGroup", "split_down"),
+    ("workbench.action.focusActiveEditorGroup", "focus_editor"),
+    ("workbench.action.nextEditor", "next_editor_tab"),
+    ("workbench.action.previousEditor", "previous_editor_tab"),
+    ("workbench.action.navigateBack", "jump_location_backward"),
+    ("workbench.action.navigateForward", "jump_location_forward"),
+    ("workbench.action.togglePanel", "toggle_panel_bottom_visual"),
+    (
+        "workbench.action.toggleSidebarVisibility",
+        "toggle_panel_left_visual",
+    ),
+    (
+        "workbench.action.toggleAuxiliaryBar",
+        "toggle_panel_right_visual",
+    ),
+    (
+        "workbench.action.toggleMaximizedPanel",
+        "toggle_maximized_panel",
+    ),
+    ("workbench.view.explorer", "toggle_file_explorer_focus"),
+    ("workbench.view.search", "toggle_search_focus"),
+    ("workbench.action.findInFiles", "toggle_search_focus"),
+    ("workbench.view.scm", "toggle_source_control_focus"),
+    ("workbench.view.extensions", "toggle_plugin_focus"),
+    ("workbench.view.debug", "toggle_debug_visual"),
+    ("workbench.actions.view.problems", "toggle_problem_focus"),
+    (
+        "workbench.files.action.showActiveFileInExplorer",
+        "reveal_active_file_in_file_explorer",
+    ),
+    ("workbench.action.debug.start", "palette.run_and_debug"),
+    (
+        "workbench.action.debug.restart",
+        "palette.run_and_debug_restart",
+    ),
+    ("workbench.action.debug.stop", "palette.run_and_debug_stop"),
+    (
+        "workbench.action.terminal.toggleTerminal",
+        "toggle_terminal_focus",
+    ),
+    ("workbench.action.terminal.new", "new_terminal_tab"),
+    ("workbench.action.terminal.kill", "close_terminal_tab"),
+    ("workbench.action.terminal.focusNext", "next_terminal_tab"),
+    (
+        "workbench.action.terminal.focusPrevious",
+        "previous_terminal_tab",
+    ),
+    ("workbench.action.terminal.copySelection", "clipboard_copy"),
+    ("workbench.action.terminal.paste", "clipboard_paste"),
+    ("git.commit", "source_control_commit"),
+    (
+        "search.action.refreshSearchResults",
+        "global_search_refresh",
+    ),
+    // language features
+    ("editor.action.revealDefinition", "goto_definition"),
+    ("editor.action.goToDeclaration", "goto_definition"),
+    ("editor.action.goToTypeDefinition", "goto_type_definition"),
+    ("editor.action.goToImplementation", "go_to_implementation"),
+    ("editor.action.goToReferences", "get_references"),
+    ("editor.action.referenceSearch.trigger", "get_references"),
+    ("editor.action.showHover", "show_hover"),
+    ("editor.action.rename", "rename_symbol"),
+    ("acceptRenameInput", "confirm_rename"),
+    ("editor.action.quickFix", "show_code_actions"),
+    ("editor.action.formatDocument", "format_document"),
+    ("editor.action.marker.next", "next_error"),
+    ("editor.action.marker.nextInFiles", "next_error"),
+    ("editor.action.marker.prev", "previous_error"),
+    ("editor.action.marker.prevInFiles", "previous_error"),
+    ("editor.action.triggerSuggest", "get_completion"),
+    ("editor.action.triggerParameterHints", "get_signature"),
+    (
+        "editor.action.inlineSuggest.trigger",
+        "inline_completion.invoke",
+    ),
+    (
+        "editor.action.inlineSuggest.commit",
+        "inline_completion.select",
+    ),
+    (
+        "editor.action.inlineSuggest.hide",
+        "inline_completion.cancel",
+    ),
+    (
+        "editor.action.inlineSuggest.showNext",
+        "inline_completion.next",
+    ),
+    (
+        "editor.action.inlineSuggest.showPrevious",
+        "inline_completion.previous",
+    ),
+    // lists
+    ("acceptSelectedSuggestion", "list.select"),
+    ("selectNextSuggestion", "list.next"),
+    ("selectPrevSuggestion", "list.previous"),
+    ("selectNextPageSuggestion", "list.next_page"),
+    ("selectPrevPageSuggestion", "list.previous_page"),
+    ("hideSuggestWidget", "modal.close"),
+    ("workbench.action.quickOpenSelectNext", "list.next"),
+    ("workbench.action.quickOpenSelectPrevious", "list.previous"),
+    ("workbench.action.closeQuickOpen", "modal.close"),
+    // editing
+    ("undo", "undo"),
+    ("redo", "redo"),
+    ("editor.action.clipboardCopyAction", "clipboard_copy"),
+    ("editor.action.clipboardCutAction", "clipboard_cut"),
+    ("editor.action.clipboardPasteAction", "clipboard_paste"),
+    ("editor.action.commentLine", "toggle_line_comment"),
+    ("editor.action.blockComment", "toggle_block_comment"),
+    ("editor.action.indentLines", "indent_line"),
+    ("editor.action.outdentLines", "outdent_line"),
+    ("editor.action.moveLinesUpAction", "move_line_up"),
+    ("editor.action.moveLinesDownAction", "move_line_down"),
+    ("editor.action.copyLinesUpAction", "duplicate_line_up"),
+    ("editor.action.copyLinesDownAction", "duplicate_line_down"),
+    ("editor.action.deleteLines", "delete_line"),
+    ("editor.action.insertLineAfter", "new_line_below"),
+    ("editor.action.insertLineBefore", "new_line_above"),
+    ("editor.action.joinLines", "join_lines"),
+    ("editor.action.jumpToBracket", "match_pairs"),
+    ("deleteLeft", "delete_backward"),
+    ("deleteRight", "delete_forward"),
+    ("deleteWordLeft", "delete_word_backward"),
+    ("deleteWordRight", "delete_word_forward"),
+    ("deleteAllLeft", "delete_to_beginning_of_line"),
+    ("deleteAllRight", "delete_to_end_of_line"),
+    ("tab", "insert_tab"),
+    ("outdent", "outdent_line"),
+    (
+        "jumpToNextSnippetPlaceholder",
+        "jump_to_next_snippet_placeholder",
+    ),
+    (
+        "jumpToPrevSnippetPlaceholder",
+        "jump_to_prev_snippet_placeholder",
+    ),
+    // cursor and selection
+    ("cursorUp", "up"),
+    ("cursorDown", "down"),
+    ("cursorLeft", "left"),
+    ("cursorRight", "right"),
+    ("cursorHome", "line_start_non_blank"),
+    ("cursorEnd", "line_end"),
+    ("cursorTop", "document_start"),
+    ("cursorBottom", "document_end"),
+    ("cursorWordLeft", "word_backward"),
+    ("cursorWordRight", "word_end_forward"),
+    ("cursorWordEndRight", "word_end_forward"),
+    ("cursorPageUp", "page_up"),
+    ("cursorPageDown", "page_down"),
+    ("scrollLineUp", "scroll_up"),
+    ("scrollLineDown", "scroll_down"),
+    ("cursorUndo", "select_undo"),
+    ("expandLineSelection", "select_current_line"),
+    ("editor.action.selectAll", "select_all"),
+    (
+        "editor.action.addSelectionToNextFindMatch",
+        "select_next_current",
+    ),
+    (
+        "editor.action.moveSelectionToNextFindMatch",
+        "select_skip_current",
+    ),
+    ("editor.action.selectHighlights", "select_all_current"),
+    ("editor.action.insertCursorAbove", "insert_cursor_above"),
+    ("editor.action.insertCursorBelow", "insert_cursor_below"),
+    (
+        "editor.action.insertCursorAtEndOfEachLineSelected",
+        "insert_cursor_end_of_line",
+    ),
+    (
+        "editor.action.smartSelect.expand",
+        "select_next_syntax_item",
+    ),
+    (
+        "editor.action.smartSelect.shrink",
+        "select_previous_syntax_item",
+    ),
+    // find
+    ("actions.find", "search"),
+    ("editor.action.nextMatchFindAction", "search_forward"),
+    ("editor.action.previousMatchFindAction", "search_backward"),
+    ("closeFindWidget", "clear_search"),
+];
+
+/// VS Code context keys and the Lapce conditions that match them.
+const CONTEXT_KEYS: &[(&str, &str)] = &[
+    ("editorFocus", "editor_focus"),
+    ("editorTextFocus", "editor_focus"),
+    ("textInputFocus", "editor_focus"),
+    ("inputFocus", "input_focus"),
+    ("listFocus", "list_focus"),
+    ("inQuickOpen", "palette_focus"),
+    ("suggestWidgetVisible", "completion_focus"),
+    ("inlineSuggestionVisible", "inline_completion_visible"),
+    ("inSnippetMode", "in_snippet"),
+    ("terminalFocus", "terminal_focus"),
+    ("panelFocus", "panel_focus"),
+    ("renameInputVisible", "rename_focus"),
+    ("findWidgetVisible", "on_screen_find_active"),
+    ("findInputFocussed", "search_focus"),
+    ("replaceInputFocussed", "replace_focus"),
+];
+
+/// VS Code context keys with values, and the Lapce context keys with the
+/// same values.
+const CONTEXT_VALUE_KEYS: &[(&str, &str)] = &[
+    ("editorLangId", "editor_lang"),
+    ("resourceExtname", "resource_extname"),
+    ("resourceFilename", "resource_filename"),
+    ("debugState", "debug_state"),
+];
+
+/// VS Code context keys Lapce has no use for, and the value they always have
+/// in Lapce.
+const FIXED_CONTEXT_KEYS: &[(&str, bool)] = &[
+    ("true", true),
+    ("false", false),
+    ("editorReadonly", false),
+    ("isInEmbeddedEditor", false),
+    ("inDebugRepl", false),
+];
+
+/// VS Code key names that are named the same in Lapce.
+const NAMED_KEYS: &[&str] = &[
+    "escape",
+    "enter",
+    "tab",
+    "space",
+    "backspace",
+    "delete",
+    "insert",
+    "home",
+    "end",
+    "pageup",
+    "pagedown",
+    "up",
+    "down",
+    "left",
+    "right",
+    "capslock",
+    "contextmenu",
+    "f1",
+    "f2",
+    "f3",
+    "f4",
+    "f5",
+    "f6",
+    "f7",
+    "f8",
+    "f9",
+    "f10",
+    "f11",
+    "f12",
+];
+
+#[derive(Deserialize)]
+struct VsCodeKeybinding {
+    key: String,
+    command: String,
+    when: Option<String>,
+    args: Option<Value>,
+}
+
+/// Converted keymaps along with the bindings that could not be converted.
+#[derive(Debug)]
+pub struct ImportedKeymaps {
+    pub keymaps: Vec<KeyMap>,
+    /// The bindings that were skipped, and why.
+    pub unconverted: Vec<String>,
+}
+
+impl ImportedKeymaps {
+    /// The unconverted bindings, listing at most `limit` of them.
+    pub fn unconverted_summary(&self, limit: usize) -> String {
+        let mut summary = self
+            .unconverted
+            .iter()
+            .take(limit)
+            .cloned()
+            .collect::<Vec<_>>()
+            .join("\n");
+        if self.unconverted.len() > limit {
+            summary
+                .push_str(&format!("\nand {} more", self.unconverted.len() - limit));
+        }
+        summary
+    }
+}
+
+pub fn import_vscode_keybindings_file(path: &Path) -> Result<ImportedKeymaps> {
+    let json = fs::read_to_string(path)?;
+    import_vscode_keybindings(&json)
+}
+
+/// Converts the contents of a VS Code `keybindings.json` file, which may have
+/// comments and trailing commas.
+pub fn import_vscode_keybindings(json: &str) -> Result<ImportedKeymaps> {
+    let bindings: Vec<VsCodeKeybinding> =
+        serde_json::from_str(&strip_jsonc(json))
+            .map_err(|err| anyhow!("not a VS Code keybindings file: {err}"))?;
+
+    let mut keymaps = Vec::new();
+    let mut unconverted = Vec::new();
+    for binding in &bindings {
+        match convert_keybinding(binding) {
+            Ok(keymap) => keymaps.push(keymap),
+            Err(reason) => unconverted
+                .push(format!("{} {} ({reason})", binding.key, binding.command)),
+        }
+    }
+
+    Ok(ImportedKeymaps {
+        keymaps,
+        unconverted,
+    })
+}
+
+fn convert_keybinding(binding: &VsCodeKeybinding) -> Result<KeyMap, String> {
+    // a `-` prefix removes a binding in both
+    let (prefix, command) = match binding.command.strip_prefix('-') {
+        Some(command) => ("-", command),
+        None => ("", binding.command.as_str()),
+    };
+    let command = COMMANDS
+        .iter()
+        .find(|(vscode, _)| *vscode == command)
+        .map(|(_, lapce)| format!("{prefix}{lapce}"))
+        .ok_or_else(|| "no Lapce command".to_string())?;
+    if binding.args.is_some() {
+        return Err("has arguments".to_string());
+    }
+    let key =
+        convert_key(&binding.key).ok_or_else(|| "unsupported key".to_string())?;
+    let when = match binding.when.as_deref() {
+        Some(when) => convert_when(when)?,
+        None => None,
+    };
+
+    Ok(KeyMap {
+        key: KeyMapPress::parse(&key),
+        modes: Modes::empty(),
+        when,
+        command,
+    })
+}
+
+/// Converts a key like `ctrl+k ctrl+c` to the same key in Lapce. VS Code's
+/// `cmd` and `win` are Lapce's `meta`.
+fn convert_key(key: &str) -> Option<String> {
+    let presses = key
+        .split_whitespace()
+        .map(|press| {
+            let press = press.to_lowercase();
+            let (modifiers, key) = match press.strip_suffix("++") {
+                Some(modifiers) => (modifiers, "+"),
+                None => press.rsplit_once('+').unwrap_or(("", &press)),
+            };
+            let mut converted = Vec::new();
+            for modifier in modifiers.split('+').filter(|m| !m.is_empty()) {
+                converted.push(match modifier {
+                    "ctrl" | "shift" | "alt" => modifier,
+                    "cmd" | "meta" | "win" => "meta",
+                    _ => return None,
+                });
+            }
+            if !NAMED_KEYS.contains(&key) && key.chars().count() != 1 {
+                return None;
+            }
+            converted.push(key);
+            Some(converted.join("+"))
+        })
+        .collect::<Option<Vec<_>>>()?;
+    (!presses.is_empty()).then(|| presses.join(" "))
+}
+
+/// Converts a `when` clause to a Lapce condition, or to `None` if it always
+/// holds in Lapce.
+///
+/// The syntax is the same for `!`, `&&`, `||`, parentheses, `==`, `!=` and
+/// `=~`, so the clause is parsed as a Lapce condition and its context keys are
+/// renamed. VS Code's `in`, `<` and `>` operators are not supported.
+fn convert_when(when: &str) -> Result<Option<String>, String> {
+    let expr = ConditionExpr::parse(when)
+        .map_err(|err| format!("unsupported `when`: {err}"))?;
+    match convert_condition(expr)? {
+        ConditionExpr::Bool(true) => Ok(None),
+        ConditionExpr::Bool(false) => Err("`when` never holds".to_string()),
+        expr => Ok(Some(expr.to_string())),
+    }
+}
+
+/// Renames the context keys of a VS Code condition, and folds the ones that
+/// have a fixed value in Lapce.
+fn convert_condition(expr: ConditionExpr) -> Result<ConditionExpr, String> {
+    Ok(match expr {
+        ConditionExpr::Bool(value) => ConditionExpr::Bool(value),
+        ConditionExpr::Flag(key) => {
+            if let Some((_, value)) =
+                FIXED_CONTEXT_KEYS.iter().find(|(fixed, _)| *fixed == key)
+            {
+                ConditionExpr::Bool(*value)
+            } else {
+                let (_, condition) = CONTEXT_KEYS
+                    .iter()
+                    .find(|(context, _)| *context == key)
+                    .ok_or_else(|| format!("unknown context key `{key}`"))?;
+                ConditionExpr::Flag(condition)
+            }
+        }
+        ConditionExpr::Compare(key, op, value) => {
+            let (_, context_key) = CONTEXT_VALUE_KEYS
+                .iter()
+                .find(|(context, _)| *context == key)
+                .ok_or_else(|| format!("unknown context key `{key}`"))?;
+            ConditionExpr::Compare(context_key, op, value)
+        }
+        ConditionExpr::Not(expr) => match convert_condition(*expr)? {
+            ConditionExpr::Bool(value) => ConditionExpr::Bool(!value),
+            expr => ConditionExpr::Not(Box::new(expr)),
+        },
+        ConditionExpr::And(left, right) => {
+            match (convert_condition(*left)?, convert_condition(*right)?) {
+                (ConditionExpr::Bool(false), _)
+                | (_, ConditionExpr::Bool(false)) => ConditionExpr::Bool(false),
+                (ConditionExpr::Bool(true), expr)
+                | (expr, ConditionExpr::Bool(true)) => expr,
+                // e.g. `editorFocus && textInputFocus`
+                (left, right) if left == right => left,
+                (left, right) => ConditionExpr::And(Box::new(left), Box::new(right)),
+            }
+        }
+        ConditionExpr::Or(left, right) => {
+            match (convert_condition(*left)?, convert_condition(*right)?) {
+                (ConditionExpr::Bool(true), _) | (_, ConditionExpr::Bool(true)) => {
+                    ConditionExpr::Bool(true)
+                }
+                (ConditionExpr::Bool(false), expr)
+                | (expr, ConditionExpr::Bool(false)) => expr,
+                (left, right) if left == right => left,
+                (left, right) => ConditionExpr::Or(Box::new(left), Box::new(right)),
+            }
+        }
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::{convert_key, convert_when, import_vscode_keybindings};
+    use crate::keypress::keymap::KeyMapPress;
+
+    #[test]
+    fn test_convert_key() {
+        assert_eq!(convert_key("ctrl+shift+k").unwrap(), "ctrl+shift+k");
+        assert_eq!(convert_key("cmd+k cmd+c").unwrap(), "meta+k meta+c");
+        assert_eq!(convert_key("Shift+Escape").unwrap(), "shift+escape");
+        assert_eq!(convert_key("ctrl++").unwrap(), "ctrl++");
+        assert!(convert_key("ctrl+numpad_add").is_none());
+        assert!(convert_key("hyper+a").is_none());
+        assert!(convert_key("").is_none());
+    }
+
+    #[test]
+    fn test_convert_when() {
+        assert_eq!(
+            convert_when("editorTextFocus && !editorReadonly").unwrap(),
+            Some("editor_focus".to_string())
+        );
+        assert_eq!(
+            convert_when("suggestWidgetVisible && textInputFocus || listFocus")
+                .unwrap(),
+            Some("completion_focus && editor_focus || list_focus".to_string())
+        );
+        assert_eq!(convert_when("!editorReadonly").unwrap(), None);
+        assert_eq!(
+            convert_when("editorTextFocus && editorLangId == 'rust'").unwrap(),
+            Some("editor_focus && editor_lang == \"rust\"".to_string())
+        );
+        assert_eq!(
+            convert_when(
+                "resourceFilename =~ /\\.test\\./ || debugState != 'inactive'"
+            )
+            .unwrap(),
+            Some(
+                "resource_filename =~ /\\.test\\./ || debug_state != \"inactive\""
+                    .to_string()
+            )
+        );
+        assert_eq!(
+            convert_when("(editorFocus || listFocus) && !(terminalFocus || false)")
+                .unwrap(),
+            Some("(editor_focus || list_focus) && !terminal_focus".to_string())
+        );
+        assert!(convert_when("resourceScheme == 'file'").is_err());
+        assert!(convert_when("editorLangId in supportedLangs").is_err());
+        assert!(convert_when("gitlens:enabled").is_err());
+        assert!(convert_when("false").is_err());
+        assert!(convert_when("editorFocus && editorReadonly").is_err());
+    }
+
+    #[test]
+    fn test_import_vscode_keybindings() {
+        let json = r#"[
+            // Place your key bindings in this file
+            {
+                "key": "ctrl+shift+d",
+                "command": "editor.action.copyLinesDownAction",
+                "when": "editorTextFocus && !editorReadonly"
+            },
+            { "key": "ctrl+d", "command": "-editor.action.addSelectionToNextFindMatch" },
+            { "key": "ctrl+alt+t", "command": "workbench.action.terminal.new" },
+            { "key": "ctrl+k t", "command": "gitlens.toggleFileBlame" },
+            {
+                "key": "ctrl+enter",
+                "command": "workbench.action.terminal.sendSequence",
+                "args": { "text": "\n" },
+            },
+        ]"#;
+        let imported = import_vscode_keybindings(json).unwrap();
+        let keymaps = &imported.keymaps;
+        assert_eq!(keymaps.len(), 3);
+        assert_eq!(keymaps[0].key, KeyMapPress::parse("ctrl+shift+d"));
+        assert_eq!(keymaps[0].command, "duplicate_line_down");
+        assert_eq!(keymaps[0].when.as_deref(), Some("editor_focus"));
+        assert_eq!(keymaps[1].command, "-select_next_current");
+        assert_eq!(keymaps[2].command, "new_terminal_tab");
+        assert_eq!(
+            imported.unconverted,
+            vec![
+                "ctrl+k t gitlens.toggleFileBlame (no Lapce command)",
+                "ctrl+enter workbench.action.terminal.sendSequence (no Lapce command)",
+            ]
+        );
+    }
+}
@@ -1,4 +1,5 @@
 pub mod about;
+pub mod accessibility;
 pub mod alert;
 pub mod app;
 pub mod code_action;
@@ -15,9 +16,11 @@
 pub mod find;
 pub mod focus_text;
 pub mod global_search;
+pub mod hex;
 pub mod history;
 pub mod hover;
 pub mod id;
+pub mod image_preview;
 pub mod inline_completion;
 pub mod keymap;
 pub mod keypress;
@@ -25,18 +28,22 @@
 pub mod lsp;
 pub mod main_split;
 pub mod markdown;
+pub mod markdown_preview;
+pub mod output;
 pub mod palette;
 pub mod panel;
 pub mod plugin;
 pub mod proxy;
 pub mod rename;
 pub mod settings;
+pub mod settings_sync;
 pub mod snippet;
 pub mod source_control;
 pub mod status;
 pub mod terminal;
 pub mod text_area;
 pub mod text_input;
+pub mod theme_editor;
 pub mod title;
 pub mod tracing;
 pub mod update;
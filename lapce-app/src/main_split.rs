@@ -16,7 +16,8 @@
 use itertools::Itertools;
 use lapce_core::{
     buffer::rope_text::RopeText, command::FocusCommand, cursor::Cursor,
-    rope_text_pos::RopeTextPosition, selection::Selection, syntax::Syntax,
+    language::LapceLanguage, rope_text_pos::RopeTextPosition, selection::Selection,
+    syntax::Syntax,
 };
 use lapce_rpc::{
     buffer::BufferId,
@@ -46,11 +47,13 @@
     editor_tab::{
         EditorTabChild, EditorTabChildSource, EditorTabData, EditorTabInfo,
     },
+    hex::HexData,
     id::{
-        DiffEditorId, EditorTabId, KeymapId, SettingsId, SplitId,
-        ThemeColorSettingsId, VoltViewId,
+        DiffEditorId, EditorTabId, ImagePreviewId, KeymapId, MarkdownPreviewId,
+        SettingsId, SplitId, ThemeColorSettingsId, VoltViewId,
     },
-    keypress::{EventRef, KeyPressData, KeyPressHandle},
+    image_preview::{is_image_path, is_svg_path},
+    keypress::{EventRef, KeyPressData, KeyPressFocus, KeyPressHandle},
     panel::implementation_view::ReferencesRoot,
     window_tab::{CommonData, Focus, WindowTabData},
 };
@@ -505,6 +508,7 @@ pub fn key_down<'a>(
         &self,
         event: impl Into<EventRef<'a>>,
         keypress: &KeyPressData,
+        window: &dyn KeyPressFocus,
     ) -> Option<KeyPressHandle> {
         let active_editor_tab = self.active_editor_tab.get_untracked()?;
         let editor_tab = self.editor_tabs.with_untracked(|editor_tabs| {
@@ -516,7 +520,7 @@ pub fn key_down<'a>(
         match child {
             EditorTabChild::Editor(editor_id) => {
                 let editor = self.editors.editor_untracked(editor_id)?;
-                let handle = keypress.key_down(event, &editor);
+                let handle = keypress.window_key_down(event, &editor, window);
                 editor.get_code_actions();
                 Some(handle)
             }
@@ -530,7 +534,7 @@ pub fn key_down<'a>(
                 } else {
                     &diff_editor.left
                 };
-                let handle = keypress.key_down(event, editor);
+                let handle = keypress.window_key_down(event, editor, window);
                 editor.get_code_actions();
                 Some(handle)
             }
@@ -538,6 +542,8 @@ pub fn key_down<'a>(
             EditorTabChild::ThemeColorSettings(_) => None,
             EditorTabChild::Keymap(_) => None,
             EditorTabChild::Volt(_, _) => None,
+            EditorTabChild::ImagePreview(_, _) => None,
+            EditorTabChild::MarkdownPreview(_, _) => None,
         }
     }
 
@@ -644,8 +650,19 @@ pub fn get_doc(
                     if let Ok(ProxyResponse::NewBufferResponse {
                         content,
                         read_only,
+                        encoding,
+                        large_file,
+                        binary,
                     }) = result
                     {
+                        if binary {
+                            local_doc.set_binary();
+                            return;
+                        }
+                        local_doc.encoding.set(encoding);
+                        if let Some(info) = large_file {
+                            local_doc.set_large_file(info);
+                        }
                         local_doc.init_content(Rope::from(content));
                         if read_only {
                             local_doc.content.update(|content| {
@@ -653,17 +670,30 @@ pub fn get_doc(
                                     *read_only = true;
                                 }
                             });
-                        } else if let Some(unsaved) = unsaved {
+                        } else if let Some(unsaved) =
+                            unsaved.filter(|_| large_file.is_none())
+                        {
                             local_doc.reload(Rope::from(unsaved), false);
                         }
                     }
                 });
 
-                self.common
-                    .proxy
-                    .new_buffer(doc.buffer_id, path, move |result| {
+                let large_file_threshold = match self
+                    .common
+                    .config
+                    .with_untracked(|config| config.editor.large_file_threshold)
+                {
+                    0 => None,
+                    megabytes => Some(megabytes as usize * 1024 * 1024),
+                };
+                self.common.proxy.new_buffer(
+                    doc.buffer_id,
+                    path,
+                    large_file_threshold,
+                    move |result| {
                         send(result);
-                    });
+                    },
+                );
             }
             doc.get_code_lens();
             doc.get_folding_range();
@@ -681,6 +711,15 @@ pub fn go_to_location(
             self.common.focus.set(Focus::Workbench);
         }
         let path = location.path.clone();
+        // Images open in the preview, unless a position in the text was asked for
+        if location.position.is_none() && is_image_path(&path) {
+            self.get_editor_tab_child(
+                EditorTabChildSource::ImagePreview(path),
+                location.ignore_unconfirmed,
+                location.same_editor_tab,
+            );
+            return;
+        }
         let (doc, new_doc) = self.get_doc(path.clone(), None);
 
         let child = self.get_editor_tab_child(
@@ -871,6 +910,8 @@ fn get_editor_tab_child(
                         EditorTabChild::ThemeColorSettings(_) => true,
                         EditorTabChild::Keymap(_) => true,
                         EditorTabChild::Volt(_, _) => true,
+                        EditorTabChild::ImagePreview(_, _) => true,
+                        EditorTabChild::MarkdownPreview(_, _) => true,
                     };
 
                     if can_be_selected {
@@ -1036,6 +1077,28 @@ fn get_editor_tab_child(
                         })
                     }
                 }
+                EditorTabChildSource::ImagePreview(path) => {
+                    if let Some(index) =
+                        active_editor_tab.with_untracked(|editor_tab| {
+                            editor_tab.get_image_preview(path).or_else(|| {
+                                editor_tab.get_editor(editors, path).map(|(i, _)| i)
+                            })
+                        })
+                    {
+                        Some(index)
+                    } else if ignore_unconfirmed {
+                        None
+                    } else {
+                        active_editor_tab.with_untracked(|editor_tab| {
+                            editor_tab
+                                .get_unconfirmed_editor_tab_child(
+                                    editors,
+                                    &diff_editors,
+                                )
+                                .map(|(i, _)| i)
+                        })
+                    }
+                }
             }
         };
 
@@ -1093,6 +1156,12 @@ fn get_editor_tab_child(
                 EditorTabChildSource::Volt(id) => {
                     EditorTabChild::Volt(VoltViewId::next(), id.to_owned())
                 }
+                EditorTabChildSource::ImagePreview(path) => {
+                    EditorTabChild::ImagePreview(
+                        ImagePreviewId::next(),
+                        path.to_owned(),
+                    )
+                }
                 EditorTabChildSource::DiffEditor { left, right } => {
                     let diff_editor_id = DiffEditorId::next();
                     let diff_editor = DiffEditorData::new(
@@ -1129,6 +1198,8 @@ fn get_editor_tab_child(
                         EditorTabChild::ThemeColorSettings(_) => {}
                         EditorTabChild::Keymap(_) => {}
                         EditorTabChild::Volt(_, _) => {}
+                        EditorTabChild::ImagePreview(_, _) => {}
+                        EditorTabChild::MarkdownPreview(_, _) => {}
                     }
                     (editor_tab_id, current_child.clone())
                 });
@@ -1169,6 +1240,20 @@ fn get_editor_tab_child(
                 (EditorTabChild::Settings(_), EditorTabChildSource::Settings) => {
                     true
                 }
+                (
+                    EditorTabChild::ImagePreview(_, current_path),
+                    EditorTabChildSource::ImagePreview(path),
+                ) => current_path == path,
+                // An SVG that is already open as text stays that way
+                (
+                    EditorTabChild::Editor(editor_id),
+                    EditorTabChildSource::ImagePreview(path),
+                ) => editors.editor_untracked(*editor_id).is_some_and(|editor| {
+                    editor
+                        .doc()
+                        .content
+                        .with_untracked(|content| content.path() == Some(path))
+                }),
                 _ => false,
             };
             if is_same {
@@ -1195,6 +1280,8 @@ fn get_editor_tab_child(
                 EditorTabChild::ThemeColorSettings(_) => {}
                 EditorTabChild::Keymap(_) => {}
                 EditorTabChild::Volt(_, _) => {}
+                EditorTabChild::ImagePreview(_, _) => {}
+                EditorTabChild::MarkdownPreview(_, _) => {}
             }
 
             // Now loading the new child
@@ -1270,6 +1357,13 @@ fn get_editor_tab_child(
                                         false
                                     }
                                 }),
+                            EditorTabChildSource::ImagePreview(path) => {
+                                editor_tab.get_image_preview(path).or_else(|| {
+                                    editor_tab
+                                        .get_editor(editors, path)
+                                        .map(|(index, _)| index)
+                                })
+                            }
                             EditorTabChildSource::NewFileEditor => None,
                         })
                     {
@@ -1433,6 +1527,17 @@ pub fn split(
         &self,
         direction: SplitDirection,
         editor_tab_id: EditorTabId,
+    ) -> Option<()> {
+        self.split_with_child(direction, editor_tab_id, None)
+    }
+
+    /// Split the editor tab, opening `child` in the new editor tab, or a copy of
+    /// the active child of the current one when it's `None`.
+    fn split_with_child(
+        &self,
+        direction: SplitDirection,
+        editor_tab_id: EditorTabId,
+        child: Option<EditorTabChild>,
     ) -> Option<()> {
         let editor_tabs = self.editor_tabs.get_untracked();
         let editor_tab = editor_tabs.get(&editor_tab_id).copied()?;
@@ -1452,7 +1557,12 @@ pub fn split(
 
         if split_direction == direction {
             let new_editor_tab = editor_tab.with_untracked(|editor_tab| {
-                self.split_editor_tab(self.scope, split_id, editor_tab)
+                self.split_editor_tab(
+                    self.scope,
+                    split_id,
+                    editor_tab,
+                    child.clone(),
+                )
             })?;
             let new_editor_tab_id =
                 new_editor_tab.with_untracked(|editor_tab| editor_tab.editor_tab_id);
@@ -1470,7 +1580,12 @@ pub fn split(
             });
         } else if children_len == 1 {
             let new_editor_tab = editor_tab.with_untracked(|editor_tab| {
-                self.split_editor_tab(self.scope, split_id, editor_tab)
+                self.split_editor_tab(
+                    self.scope,
+                    split_id,
+                    editor_tab,
+                    child.clone(),
+                )
             })?;
             let new_editor_tab_id =
                 new_editor_tab.with_untracked(|editor_tab| editor_tab.editor_tab_id);
@@ -1491,7 +1606,12 @@ pub fn split(
                 editor_tab.split = new_split_id;
             });
             let new_editor_tab = editor_tab.with_untracked(|editor_tab| {
-                self.split_editor_tab(self.scope, new_split_id, editor_tab)
+                self.split_editor_tab(
+                    self.scope,
+                    new_split_id,
+                    editor_tab,
+                    child.clone(),
+                )
             })?;
             let new_editor_tab_id =
                 new_editor_tab.with_untracked(|editor_tab| editor_tab.editor_tab_id);
@@ -1538,41 +1658,67 @@ fn split_editor_tab(
         cx: Scope,
         split_id: SplitId,
         editor_tab: &EditorTabData,
+        new_child: Option<EditorTabChild>,
     ) -> Option<RwSignal<EditorTabData>> {
-        let (_, _, child) = editor_tab.children.get(editor_tab.active)?;
-
         let editor_tab_id = EditorTabId::next();
 
-        let new_child = match child {
-            EditorTabChild::Editor(editor_id) => {
-                let editor_id = self
-                    .editors
-                    .copy(*editor_id, cx, Some(editor_tab_id), None, None)
-                    .unwrap();
-
-                EditorTabChild::Editor(editor_id)
-            }
-            EditorTabChild::DiffEditor(diff_editor_id) => {
-                let new_diff_editor_id = DiffEditorId::next();
-                let diff_editor = self
-                    .diff_editors
-                    .get_untracked()
-                    .get(diff_editor_id)?
-                    .copy(cx, editor_tab_id, new_diff_editor_id, self.editors);
-                self.diff_editors.update(|diff_editors| {
-                    diff_editors.insert(new_diff_editor_id, diff_editor);
-                });
-                EditorTabChild::DiffEditor(new_diff_editor_id)
-            }
-            EditorTabChild::Settings(_) => {
-                EditorTabChild::Settings(SettingsId::next())
-            }
-            EditorTabChild::ThemeColorSettings(_) => {
-                EditorTabChild::ThemeColorSettings(ThemeColorSettingsId::next())
-            }
-            EditorTabChild::Keymap(_) => EditorTabChild::Keymap(KeymapId::next()),
-            EditorTabChild::Volt(_, id) => {
-                EditorTabChild::Volt(VoltViewId::next(), id.to_owned())
+        let new_child = match new_child {
+            Some(new_child) => new_child,
+            None => {
+                let (_, _, child) = editor_tab.children.get(editor_tab.active)?;
+                match child {
+                    EditorTabChild::Editor(editor_id) => {
+                        let editor_id = self
+                            .editors
+                            .copy(*editor_id, cx, Some(editor_tab_id), None, None)
+                            .unwrap();
+
+                        EditorTabChild::Editor(editor_id)
+                    }
+                    EditorTabChild::DiffEditor(diff_editor_id) => {
+                        let new_diff_editor_id = DiffEditorId::next();
+                        let diff_editor = self
+                            .diff_editors
+                            .get_untracked()
+                            .get(diff_editor_id)?
+                            .copy(
+                                cx,
+                                editor_tab_id,
+                                new_diff_editor_id,
+                                self.editors,
+                            );
+                        self.diff_editors.update(|diff_editors| {
+                            diff_editors.insert(new_diff_editor_id, diff_editor);
+                        });
+                        EditorTabChild::DiffEditor(new_diff_editor_id)
+                    }
+                    EditorTabChild::Settings(_) => {
+                        EditorTabChild::Settings(SettingsId::next())
+                    }
+                    EditorTabChild::ThemeColorSettings(_) => {
+                        EditorTabChild::ThemeColorSettings(
+                            ThemeColorSettingsId::next(),
+                        )
+                    }
+                    EditorTabChild::Keymap(_) => {
+                        EditorTabChild::Keymap(KeymapId::next())
+                    }
+                    EditorTabChild::Volt(_, id) => {
+                        EditorTabChild::Volt(VoltViewId::next(), id.to_owned())
+                    }
+                    EditorTabChild::ImagePreview(_, path) => {
+                        EditorTabChild::ImagePreview(
+                            ImagePreviewId::next(),
+                            path.to_owned(),
+                        )
+                    }
+                    EditorTabChild::MarkdownPreview(_, path) => {
+                        EditorTabChild::MarkdownPreview(
+                            MarkdownPreviewId::next(),
+                            path.to_owned(),
+                        )
+                    }
+                }
             }
         };
 
@@ -1896,7 +2042,8 @@ fn editor_tab_child_close_warning(
                     });
                     if !exists {
                         return match doc_content {
-                            DocContent::File { path, .. } => Some((
+                            DocContent::File { path, .. }
+                            | DocContent::Binary { path } => Some((
                                 path.file_name()?.to_str()?.to_string(),
                                 doc,
                                 editor,
@@ -1916,6 +2063,8 @@ fn editor_tab_child_close_warning(
             EditorTabChild::ThemeColorSettings(_) => None,
             EditorTabChild::Keymap(_) => None,
             EditorTabChild::Volt(_, _) => None,
+            EditorTabChild::ImagePreview(_, _) => None,
+            EditorTabChild::MarkdownPreview(_, _) => None,
         }
     }
 
@@ -2060,7 +2209,7 @@ pub fn editor_tab_child_close(
                             action: save_action,
                         })
                     }
-                    DocContent::File { .. } => {
+                    DocContent::File { .. } | DocContent::Binary { .. } => {
                         let editor = editor.clone();
                         let editors = self.editors;
                         let editor_id = editor.id();
@@ -2154,6 +2303,8 @@ pub fn editor_tab_child_close(
             EditorTabChild::ThemeColorSettings(_) => {}
             EditorTabChild::Keymap(_) => {}
             EditorTabChild::Volt(_, _) => {}
+            EditorTabChild::ImagePreview(_, _) => {}
+            EditorTabChild::MarkdownPreview(_, _) => {}
         }
 
         if editor_tab_children_len == 0 {
@@ -2413,6 +2564,99 @@ pub fn open_volt_view(&self, id: VoltID) {
         self.get_editor_tab_child(EditorTabChildSource::Volt(id), false, false);
     }
 
+    /// Switch the active tab between the rendered preview of an SVG and an
+    /// editor for its source.
+    pub fn toggle_svg_source(&self) -> Option<()> {
+        let editor_tab_id = self.active_editor_tab.get_untracked()?;
+        let editor_tab = self.editor_tabs.with_untracked(|editor_tabs| {
+            editor_tabs.get(&editor_tab_id).copied()
+        })?;
+        let (index, child) = editor_tab.with_untracked(|editor_tab| {
+            let (_, _, child) = editor_tab.children.get(editor_tab.active)?;
+            Some((editor_tab.active, child.clone()))
+        })?;
+
+        let new_child = match child {
+            EditorTabChild::ImagePreview(_, path) if is_svg_path(&path) => {
+                let (doc, _) = self.get_doc(path, None);
+                let editor_id = self.editors.new_from_doc(
+                    self.scope,
+                    doc,
+                    Some(editor_tab_id),
+                    None,
+                    None,
+                    self.common.clone(),
+                );
+                if let Some(editor) = self.editors.editor_untracked(editor_id) {
+                    editor.confirmed.set(true);
+                }
+                EditorTabChild::Editor(editor_id)
+            }
+            EditorTabChild::Editor(editor_id) => {
+                let path = self
+                    .editors
+                    .editor_untracked(editor_id)?
+                    .doc()
+                    .content
+                    .with_untracked(|content| content.path().cloned())
+                    .filter(|path| is_svg_path(path))?;
+                self.remove_editor(editor_id);
+                EditorTabChild::ImagePreview(ImagePreviewId::next(), path)
+            }
+            _ => return None,
+        };
+
+        editor_tab.update(|editor_tab| {
+            editor_tab.children[index] = (
+                editor_tab.scope.create_rw_signal(0),
+                editor_tab.scope.create_rw_signal(Rect::ZERO),
+                new_child,
+            );
+        });
+        Some(())
+    }
+
+    /// Open a rendered preview of the active markdown editor in a split to its
+    /// right, or focus the preview when the file already has one.
+    pub fn open_markdown_preview_to_side(&self) -> Option<()> {
+        let editor = self.active_editor.get_untracked()?;
+        let doc = editor.doc();
+        if doc.syntax().with_untracked(|syntax| syntax.language)
+            != LapceLanguage::Markdown
+        {
+            return None;
+        }
+        let path = doc
+            .content
+            .with_untracked(|content| content.path().cloned())?;
+
+        let existing = self.editor_tabs.with_untracked(|editor_tabs| {
+            editor_tabs.iter().find_map(|(editor_tab_id, editor_tab)| {
+                let index = editor_tab.with_untracked(|editor_tab| {
+                    editor_tab.get_markdown_preview(&path)
+                })?;
+                Some((*editor_tab_id, *editor_tab, index))
+            })
+        });
+        if let Some((editor_tab_id, editor_tab, index)) = existing {
+            self.active_editor_tab.set(Some(editor_tab_id));
+            editor_tab.update(|editor_tab| {
+                editor_tab.active = index;
+            });
+            return Some(());
+        }
+
+        let editor_tab_id = editor.editor_tab_id.get_untracked()?;
+        self.split_with_child(
+            SplitDirection::Vertical,
+            editor_tab_id,
+            Some(EditorTabChild::MarkdownPreview(
+                MarkdownPreviewId::next(),
+                path,
+            )),
+        )
+    }
+
     pub fn open_settings(&self) {
         self.get_editor_tab_child(EditorTabChildSource::Settings, false, false);
     }
@@ -2434,11 +2678,12 @@ pub fn new_file(&self) -> EditorTabChild {
     }
 
     pub fn save_as(&self, doc: Rc<Doc>, path: PathBuf, action: impl Fn() + 'static) {
-        let (buffer_id, doc_content, rev, content) = (
+        let (buffer_id, doc_content, rev, content, encoding) = (
             doc.buffer_id,
             doc.content.get_untracked(),
             doc.rev(),
             doc.buffer.with_untracked(|b| b.to_string()),
+            doc.encoding.get_untracked(),
         );
         match doc_content {
             DocContent::Scratch { .. } => {
@@ -2472,6 +2717,7 @@ pub fn save_as(&self, doc: Rc<Doc>, path: PathBuf, action: impl Fn() + 'static)
                     rev,
                     content,
                     true,
+                    encoding,
                     Box::new(move |result| {
                         send(result);
                     }),
@@ -2479,6 +2725,7 @@ pub fn save_as(&self, doc: Rc<Doc>, path: PathBuf, action: impl Fn() + 'static)
             }
             DocContent::Local => {}
             DocContent::File { .. } => {}
+            DocContent::Binary { .. } => {}
             DocContent::History(_) => {}
         }
     }
@@ -2489,11 +2736,12 @@ pub fn save_as2(
         path: PathBuf,
         action: impl Fn() + 'static,
     ) {
-        let (buffer_id, doc_content, rev, content) = (
+        let (buffer_id, doc_content, rev, content, encoding) = (
             doc.buffer_id,
             doc.content.get_untracked(),
             doc.rev(),
             doc.buffer.with_untracked(|b| b.to_string()),
+            doc.encoding.get_untracked(),
         );
         match doc_content {
             DocContent::Scratch { .. } => {
@@ -2527,6 +2775,7 @@ pub fn save_as2(
                     rev,
                     content,
                     true,
+                    encoding,
                     Box::new(move |result| {
                         send(result);
                     }),
@@ -2534,6 +2783,7 @@ pub fn save_as2(
             }
             DocContent::Local => {}
             DocContent::File { .. } => {}
+            DocContent::Binary { .. } => {}
             DocContent::History(_) => {}
         }
     }
@@ -2747,6 +2997,8 @@ fn editor_tab_child_set_parent(
             EditorTabChild::ThemeColorSettings(_) => {}
             EditorTabChild::Keymap(_) => {}
             EditorTabChild::Volt(_, _) => {}
+            EditorTabChild::ImagePreview(_, _) => {}
+            EditorTabChild::MarkdownPreview(_, _) => {}
         }
         Some(())
     }
@@ -2994,6 +3246,12 @@ pub fn get_active_editor(&self) -> Option<EditorData> {
             _ => None,
         }
     }
+
+    /// The bytes of the active editor's file, if it's binary.
+    pub fn active_hex_data(&self) -> Option<HexData> {
+        let editor = self.active_editor.get_untracked()?;
+        editor.doc().binary.get_untracked()
+    }
 }
 
 fn workspace_edits(edit: &WorkspaceEdit) -> Option<HashMap<Url, Vec<TextEdit>>> {
@@ -1,10 +1,12 @@
+use std::ops::Range;
+
 use floem::text::{
     Attrs, AttrsList, FamilyOwned, LineHeightValue, Style, TextLayout, Weight,
 };
 use lapce_core::{language::LapceLanguage, syntax::Syntax};
 use lapce_xi_rope::Rope;
 use lsp_types::MarkedString;
-use pulldown_cmark::{CodeBlockKind, CowStr, Event, Options, Parser, Tag};
+use pulldown_cmark::{CodeBlockKind, Event, Options, Parser, Tag};
 use smallvec::SmallVec;
 
 use crate::config::{LapceConfig, color::LapceColor};
@@ -16,11 +18,45 @@ pub enum MarkdownContent {
     Separator,
 }
 
+/// A piece of rendered markdown along with where it came from in the source
+#[derive(Clone)]
+pub struct MarkdownBlock {
+    /// The byte offset in the source that the block starts at
+    pub offset: usize,
+    pub content: MarkdownContent,
+    /// The links in a text block, as byte ranges of its text and their
+    /// destinations
+    pub links: Vec<(Range<usize>, String)>,
+}
+
 pub fn parse_markdown(
     text: &str,
     line_height: f64,
     config: &LapceConfig,
 ) -> Vec<MarkdownContent> {
+    parse_markdown_inner(text, line_height, config, false)
+        .into_iter()
+        .map(|block| block.content)
+        .collect()
+}
+
+/// Parse markdown into a block for each top level element, such as a
+/// paragraph, heading or list, so that a preview can find the part of the
+/// source that is shown.
+pub fn parse_markdown_blocks(
+    text: &str,
+    line_height: f64,
+    config: &LapceConfig,
+) -> Vec<MarkdownBlock> {
+    parse_markdown_inner(text, line_height, config, true)
+}
+
+fn parse_markdown_inner(
+    text: &str,
+    line_height: f64,
+    config: &LapceConfig,
+    split_blocks: bool,
+) -> Vec<MarkdownBlock> {
     let mut res = Vec::new();
 
     let mut current_text = String::new();
@@ -38,6 +74,9 @@ pub fn parse_markdown(
     let mut pos = 0;
 
     let mut tag_stack: SmallVec<[(usize, Tag); 4]> = SmallVec::new();
+    let mut links = Vec::new();
+    // Where the block that is being built starts in the source
+    let mut block_offset = 0;
 
     let parser = Parser::new_ext(
         text,
@@ -47,11 +86,30 @@ pub fn parse_markdown(
             | Options::ENABLE_TASKLISTS
             | Options::ENABLE_HEADING_ATTRIBUTES,
     );
-    let mut last_text = CowStr::from("");
     // Whether we should add a newline on the next entry
     // This is used so that we don't emit newlines at the very end of the generation
     let mut add_newline = false;
-    for event in parser {
+    for (event, source_range) in parser.into_offset_iter() {
+        if split_blocks && tag_stack.is_empty() {
+            if builder_dirty {
+                res.push(MarkdownBlock {
+                    offset: block_offset,
+                    content: MarkdownContent::Text(text_layout(
+                        &current_text,
+                        attr_list,
+                    )),
+                    links: std::mem::take(&mut links),
+                });
+                attr_list = AttrsList::new(default_attrs.clone());
+                current_text.clear();
+                pos = 0;
+                builder_dirty = false;
+            }
+            // Each block has its own layout, so there's nothing to separate
+            add_newline = false;
+            block_offset = source_range.start;
+        }
+
         // Add the newline since we're going to be outputting more
         if add_newline {
             current_text.push('\n');
@@ -98,7 +156,7 @@ pub fn parse_markdown(
                                 &mut attr_list,
                                 default_attrs.clone().family(&code_font_family),
                                 language,
-                                &last_text,
+                                current_text.get(start_offset..pos).unwrap_or(""),
                                 start_offset,
                                 config,
                             );
@@ -114,20 +172,33 @@ pub fn parse_markdown(
                             // image is rendered?
 
                             if builder_dirty {
-                                let mut text_layout = TextLayout::new();
-                                text_layout.set_text(&current_text, attr_list, None);
-                                res.push(MarkdownContent::Text(text_layout));
+                                res.push(MarkdownBlock {
+                                    offset: block_offset,
+                                    content: MarkdownContent::Text(text_layout(
+                                        &current_text,
+                                        attr_list,
+                                    )),
+                                    links: std::mem::take(&mut links),
+                                });
                                 attr_list = AttrsList::new(default_attrs.clone());
                                 current_text.clear();
                                 pos = 0;
                                 builder_dirty = false;
                             }
 
-                            res.push(MarkdownContent::Image {
-                                url: dest.to_string(),
-                                title: title.to_string(),
+                            res.push(MarkdownBlock {
+                                offset: block_offset,
+                                content: MarkdownContent::Image {
+                                    url: dest.to_string(),
+                                    title: title.to_string(),
+                                },
+                                links: Vec::new(),
                             });
                         }
+                        Tag::Link { dest_url, .. } => {
+                            links.push((start_offset..pos, dest_url.to_string()));
+                            builder_dirty = true;
+                        }
                         _ => {
                             // Presumably?
                             builder_dirty = true;
@@ -145,7 +216,6 @@ pub fn parse_markdown(
                 }
                 current_text.push_str(&text);
                 pos += text.len();
-                last_text = text;
                 builder_dirty = true;
             }
             Event::Code(text) => {
@@ -181,7 +251,15 @@ pub fn parse_markdown(
                 pos += 1;
                 builder_dirty = true;
             }
-            Event::Rule => {}
+            Event::Rule => {
+                if split_blocks {
+                    res.push(MarkdownBlock {
+                        offset: source_range.start,
+                        content: MarkdownContent::Separator,
+                        links: Vec::new(),
+                    });
+                }
+            }
             Event::FootnoteReference(_text) => {}
             Event::TaskListMarker(_text) => {}
             Event::InlineHtml(_) => {} // TODO(panekj): Implement
@@ -191,14 +269,22 @@ pub fn parse_markdown(
     }
 
     if builder_dirty {
-        let mut text_layout = TextLayout::new();
-        text_layout.set_text(&current_text, attr_list, None);
-        res.push(MarkdownContent::Text(text_layout));
+        res.push(MarkdownBlock {
+            offset: block_offset,
+            content: MarkdownContent::Text(text_layout(&current_text, attr_list)),
+            links,
+        });
     }
 
     res
 }
 
+fn text_layout(text: &str, attr_list: AttrsList) -> TextLayout {
+    let mut text_layout = TextLayout::new();
+    text_layout.set_text(text, attr_list, None);
+    text_layout
+}
+
 fn attribute_for_tag<'a>(
     default_attrs: Attrs<'a>,
     tag: &Tag,
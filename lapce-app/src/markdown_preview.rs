@@ -0,0 +1,482 @@
+//! A rendered preview of a markdown file that follows its edits and the
+//! scrolling of the editor it was opened from.
+
+use std::{
+    cell::RefCell,
+    collections::HashMap,
+    ops::Range,
+    path::{Path, PathBuf},
+    rc::Rc,
+    sync::atomic::AtomicU64,
+};
+
+use floem::{
+    View,
+    event::{Event, EventListener},
+    kurbo::Point,
+    reactive::{
+        Memo, RwSignal, Scope, SignalGet, SignalUpdate, SignalWith, create_effect,
+        create_memo, create_rw_signal,
+    },
+    style::CursorStyle,
+    text::TextLayout,
+    views::{
+        Decorators, container, dyn_stack, empty, img, label, rich_text, scroll,
+        stack, svg,
+    },
+};
+use lapce_core::buffer::rope_text::RopeText;
+
+use crate::{
+    command::InternalCommand,
+    config::color::LapceColor,
+    editor::EditorData,
+    image_preview::{ImagePreviewData, image_size, is_svg_path, svg_size},
+    main_split::MainSplitData,
+    markdown::{MarkdownBlock, MarkdownContent, parse_markdown_blocks},
+    window_tab::CommonData,
+};
+
+/// The line height of the rendered text, relative to the font size
+const LINE_HEIGHT: f64 = 1.8;
+/// The space around the rendered markdown
+const PADDING: f64 = 20.0;
+
+/// Where a link in the markdown goes
+#[derive(Debug, PartialEq, Eq)]
+enum LinkTarget {
+    Web(String),
+    File(PathBuf),
+    /// A heading in the same file
+    Anchor,
+}
+
+/// Work out where a link or image source goes. Relative paths are relative to
+/// the markdown file, and absolute ones to the workspace when there is one.
+fn link_target(
+    dest: &str,
+    base_dir: &Path,
+    workspace: Option<&Path>,
+) -> Option<LinkTarget> {
+    let dest = dest.trim();
+    if dest.is_empty() {
+        return None;
+    }
+    if dest.starts_with('#') {
+        return Some(LinkTarget::Anchor);
+    }
+    if dest.contains("://") || dest.starts_with("mailto:") {
+        return Some(LinkTarget::Web(dest.to_string()));
+    }
+
+    let path = dest.split(['#', '?']).next().unwrap_or(dest);
+    let path = percent_decode(path);
+    let path = match path.strip_prefix('/') {
+        Some(relative) => match workspace {
+            Some(workspace) => workspace.join(relative),
+            None => PathBuf::from(&path),
+        },
+        None => base_dir.join(&path),
+    };
+    Some(LinkTarget::File(path))
+}
+
+/// Decode `%20` style escapes, which are common in links to files with spaces
+/// in their names.
+fn percent_decode(text: &str) -> String {
+    let bytes = text.as_bytes();
+    let mut decoded = Vec::with_capacity(bytes.len());
+    let mut i = 0;
+    while i < bytes.len() {
+        let escaped = (bytes[i] == b'%')
+            .then(|| text.get(i + 1..i + 3))
+            .flatten()
+            .and_then(|hex| u8::from_str_radix(hex, 16).ok());
+        if let Some(byte) = escaped {
+            decoded.push(byte);
+            i += 3;
+        } else {
+            decoded.push(bytes[i]);
+            i += 1;
+        }
+    }
+    String::from_utf8_lossy(&decoded).into_owned()
+}
+
+/// How far down the preview to scroll so that it shows the same part of the
+/// file as an editor whose top line is `line`. The position is interpolated
+/// within the block that contains the line.
+fn scroll_offset(
+    block_lines: &[usize],
+    block_heights: &[f64],
+    last_line: usize,
+    line: usize,
+) -> f64 {
+    let mut y = 0.0;
+    for (i, (&start, &height)) in block_lines.iter().zip(block_heights).enumerate() {
+        let end = block_lines.get(i + 1).copied().unwrap_or(last_line + 1);
+        if line < end {
+            if line <= start {
+                return y;
+            }
+            let fraction = (line - start) as f64 / (end - start).max(1) as f64;
+            return y + height * fraction;
+        }
+        y += height;
+    }
+    y
+}
+
+pub fn markdown_preview_view(main_split: MainSplitData, path: PathBuf) -> impl View {
+    let common = main_split.common.clone();
+    let config = common.config;
+    let (doc, _) = main_split.get_doc(path.clone(), None);
+    let base_dir = path.parent().map(Path::to_path_buf).unwrap_or_default();
+    let workspace = common.workspace.path.clone();
+
+    // The blocks with the line they start on, which are rebuilt on each edit
+    let blocks: RwSignal<Vec<(usize, MarkdownBlock)>> = create_rw_signal(Vec::new());
+    let heights: RwSignal<Vec<f64>> = create_rw_signal(Vec::new());
+    {
+        let doc = doc.clone();
+        create_effect(move |_| {
+            let config = config.get();
+            let new_blocks = doc.buffer.with(|buffer| {
+                parse_markdown_blocks(&buffer.to_string(), LINE_HEIGHT, &config)
+                    .into_iter()
+                    .map(|block| (buffer.line_of_offset(block.offset), block))
+                    .collect::<Vec<_>>()
+            });
+            heights.set(vec![0.0; new_blocks.len()]);
+            blocks.set(new_blocks);
+        });
+    }
+
+    // Follow the editor for the file that was focused last
+    let source_editor = create_rw_signal(None);
+    {
+        let path = path.clone();
+        let active_editor = main_split.active_editor;
+        create_effect(move |_| {
+            if let Some(editor) = active_editor.get() {
+                let is_source = editor
+                    .doc()
+                    .content
+                    .with_untracked(|content| content.path() == Some(&path));
+                if is_source {
+                    source_editor.set(Some(editor));
+                }
+            }
+        });
+    }
+    let top_line = create_memo(move |_| {
+        source_editor.with(|editor| {
+            let editor = editor.as_ref()?;
+            editor.screen_lines().with(|lines| {
+                let vline = *lines.lines.first()?;
+                Some(lines.info(vline)?.vline_info.rvline.line)
+            })
+        })
+    });
+    let scroll_to = create_memo(move |_| {
+        let line = top_line.get()?;
+        let block_lines = blocks
+            .with(|blocks| blocks.iter().map(|(line, _)| *line).collect::<Vec<_>>());
+        let last_line = doc.buffer.with(|buffer| buffer.last_line());
+        let y = heights
+            .with(|heights| scroll_offset(&block_lines, heights, last_line, line));
+        Some(Point::new(0.0, y))
+    });
+
+    let cx = Scope::current();
+    let content_width = create_rw_signal(0.0);
+    let images = Rc::new(RefCell::new(HashMap::new()));
+    let link_context = LinkContext {
+        common: common.clone(),
+        main_split: main_split.clone(),
+        source_editor,
+        base_dir,
+        workspace,
+    };
+    let id = AtomicU64::new(0);
+
+    scroll(
+        dyn_stack(
+            move || blocks.get().into_iter().enumerate(),
+            move |_| id.fetch_add(1, std::sync::atomic::Ordering::Relaxed),
+            move |(index, (_, block))| {
+                let view = match block.content {
+                    MarkdownContent::Text(text_layout) => {
+                        text_block(text_layout, block.links, link_context.clone())
+                            .into_any()
+                    }
+                    MarkdownContent::Image { url, title } => image_block(
+                        cx,
+                        url,
+                        title,
+                        &link_context,
+                        images.clone(),
+                        content_width,
+                    )
+                    .into_any(),
+                    MarkdownContent::Separator => empty()
+                        .style(move |s| {
+                            s.width_full().margin_vert(5.0).height(1.0).background(
+                                config.get().color(LapceColor::LAPCE_BORDER),
+                            )
+                        })
+                        .into_any(),
+                };
+                container(view)
+                    .on_resize(move |rect| {
+                        heights.update(|heights| {
+                            if let Some(height) = heights.get_mut(index) {
+                                *height = rect.height();
+                            }
+                        });
+                    })
+                    .style(|s| s.width_full().padding_bottom(8.0))
+            },
+        )
+        .on_resize(move |rect| content_width.set(rect.width() - PADDING * 2.0))
+        .style(|s| s.flex_col().width_full().padding(PADDING as f32)),
+    )
+    .scroll_to(move || scroll_to.get())
+    .style(move |s| {
+        s.size_full()
+            .background(config.get().color(LapceColor::EDITOR_BACKGROUND))
+    })
+    .debug_name("Markdown Preview")
+}
+
+/// What following a link in the preview needs
+#[derive(Clone)]
+struct LinkContext {
+    common: Rc<CommonData>,
+    main_split: MainSplitData,
+    source_editor: RwSignal<Option<EditorData>>,
+    base_dir: PathBuf,
+    workspace: Option<PathBuf>,
+}
+
+impl LinkContext {
+    fn target(&self, dest: &str) -> Option<LinkTarget> {
+        link_target(dest, &self.base_dir, self.workspace.as_deref())
+    }
+
+    fn open(&self, dest: &str) {
+        match self.target(dest) {
+            Some(LinkTarget::Web(uri)) => {
+                self.common
+                    .internal_command
+                    .send(InternalCommand::OpenWebUri { uri });
+            }
+            Some(LinkTarget::File(path)) => {
+                // Open the file next to the markdown rather than over the preview
+                let editor_tab_id = self.source_editor.with_untracked(|editor| {
+                    editor
+                        .as_ref()
+                        .and_then(|editor| editor.editor_tab_id.get_untracked())
+                });
+                if let Some(editor_tab_id) = editor_tab_id {
+                    self.main_split.active_editor_tab.set(Some(editor_tab_id));
+                }
+                self.common
+                    .internal_command
+                    .send(InternalCommand::OpenFile { path });
+            }
+            Some(LinkTarget::Anchor) | None => {}
+        }
+    }
+}
+
+fn text_block(
+    text_layout: TextLayout,
+    links: Vec<(Range<usize>, String)>,
+    link_context: LinkContext,
+) -> impl View {
+    let link_at = {
+        let text_layout = text_layout.clone();
+        move |point: Point| {
+            let index = text_layout.hit_point(point).index;
+            links
+                .iter()
+                .find(|(range, _)| range.contains(&index))
+                .map(|(_, dest)| dest.clone())
+        }
+    };
+    let link_at = Rc::new(link_at);
+    let hovered_link = create_rw_signal(false);
+
+    let move_link_at = link_at.clone();
+    rich_text(move || text_layout.clone())
+        .on_event_cont(EventListener::PointerMove, move |event| {
+            if let Event::PointerMove(pointer_event) = event {
+                let over_link = move_link_at(pointer_event.pos).is_some();
+                if hovered_link.get_untracked() != over_link {
+                    hovered_link.set(over_link);
+                }
+            }
+        })
+        .on_event_cont(EventListener::PointerLeave, move |_| {
+            hovered_link.set(false);
+        })
+        .on_event_cont(EventListener::PointerUp, move |event| {
+            if let Event::PointerUp(pointer_event) = event {
+                if let Some(dest) = link_at(pointer_event.pos) {
+                    link_context.open(&dest);
+                }
+            }
+        })
+        .style(move |s| {
+            s.width_full()
+                .apply_if(hovered_link.get(), |s| s.cursor(CursorStyle::Pointer))
+        })
+}
+
+/// An image in the markdown. Local images are read through the proxy, and are
+/// kept in the preview's scope across edits so they aren't read again on each
+/// one.
+fn image_block(
+    cx: Scope,
+    url: String,
+    title: String,
+    link_context: &LinkContext,
+    images: Rc<RefCell<HashMap<PathBuf, ImagePreviewData>>>,
+    content_width: RwSignal<f64>,
+) -> impl View {
+    let config = link_context.common.config;
+    let placeholder = move |text: String| {
+        label(move || text.clone())
+            .style(move |s| s.color(config.get().color(LapceColor::EDITOR_DIM)))
+            .into_any()
+    };
+    let description = if title.is_empty() { url.clone() } else { title };
+
+    let Some(LinkTarget::File(path)) = link_context.target(&url) else {
+        return placeholder(format!("[{description}]"));
+    };
+    let image = images
+        .borrow_mut()
+        .entry(path.clone())
+        .or_insert_with(|| {
+            let image =
+                ImagePreviewData::new(cx, path.clone(), link_context.common.clone());
+            image.load();
+            image
+        })
+        .clone();
+
+    let bytes = image.bytes;
+    let error = image.error;
+    let is_svg = is_svg_path(&path);
+    let size: Memo<Option<(u32, u32)>> = create_memo(move |_| {
+        bytes.with(|bytes| {
+            let bytes = bytes.as_ref()?;
+            if is_svg {
+                svg_size(&String::from_utf8_lossy(bytes))
+            } else {
+                image_size(bytes)
+            }
+        })
+    });
+    // Shrink images that are wider than the preview
+    let scaled_size = move || {
+        let (width, height) = size.get().unwrap_or((0, 0));
+        let (width, height) = (width as f64, height as f64);
+        let max_width = content_width.get().max(0.0);
+        if width > max_width && width > 0.0 {
+            (max_width, height * max_width / width)
+        } else {
+            (width, height)
+        }
+    };
+    let view = if is_svg {
+        svg(move || {
+            bytes
+                .get()
+                .map(|bytes| String::from_utf8_lossy(&bytes).into_owned())
+                .unwrap_or_default()
+        })
+        .into_any()
+    } else {
+        img(move || {
+            bytes
+                .get()
+                .map(|bytes| (*bytes).clone())
+                .unwrap_or_default()
+        })
+        .into_any()
+    };
+    stack((
+        view.style(move |s| {
+            let (width, height) = scaled_size();
+            s.width(width)
+                .height(height)
+                .apply_if(error.with(|error| error.is_some()), |s| s.hide())
+        }),
+        placeholder(format!("[{description}]")).style(move |s| {
+            s.apply_if(error.with(|error| error.is_none()), |s| s.hide())
+        }),
+    ))
+    .into_any()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_link_target() {
+        let base = Path::new("/project/docs");
+        let workspace = Some(Path::new("/project"));
+        assert_eq!(
+            link_target("https://lapce.dev", base, workspace),
+            Some(LinkTarget::Web("https://lapce.dev".to_string()))
+        );
+        assert_eq!(
+            link_target("mailto:a@b.c", base, workspace),
+            Some(LinkTarget::Web("mailto:a@b.c".to_string()))
+        );
+        assert_eq!(
+            link_target("#usage", base, workspace),
+            Some(LinkTarget::Anchor)
+        );
+        assert_eq!(
+            link_target("../README.md#install", base, workspace),
+            Some(LinkTarget::File(PathBuf::from(
+                "/project/docs/../README.md"
+            )))
+        );
+        assert_eq!(
+            link_target("/src/main.rs", base, workspace),
+            Some(LinkTarget::File(PathBuf::from("/project/src/main.rs")))
+        );
+        assert_eq!(
+            link_target("my%20notes.md", base, None),
+            Some(LinkTarget::File(PathBuf::from("/project/docs/my notes.md")))
+        );
+        assert_eq!(link_target("  ", base, workspace), None);
+    }
+
+    #[test]
+    fn test_percent_decode() {
+        assert_eq!(percent_decode("a%20b"), "a b");
+        assert_eq!(percent_decode("100%"), "100%");
+        assert_eq!(percent_decode("%zz"), "%zz");
+    }
+
+    #[test]
+    fn test_scroll_offset() {
+        // Blocks starting on lines 0, 4 and 10 of a 20 line file
+        let lines = [0, 4, 10];
+        let heights = [40.0, 100.0, 50.0];
+        assert_eq!(scroll_offset(&lines, &heights, 19, 0), 0.0);
+        assert_eq!(scroll_offset(&lines, &heights, 19, 2), 20.0);
+        assert_eq!(scroll_offset(&lines, &heights, 19, 4), 40.0);
+        assert_eq!(scroll_offset(&lines, &heights, 19, 7), 90.0);
+        assert_eq!(scroll_offset(&lines, &heights, 19, 15), 165.0);
+        assert_eq!(scroll_offset(&lines, &heights, 19, 30), 190.0);
+        assert_eq!(scroll_offset(&[], &[], 0, 3), 0.0);
+    }
+}
@@ -0,0 +1,359 @@
+use std::rc::Rc;
+
+use floem::{
+    keyboard::Modifiers,
+    reactive::{RwSignal, Scope, SignalGet, SignalUpdate, SignalWith},
+};
+use indexmap::IndexMap;
+use lapce_core::{command::EditCommand, mode::Mode};
+use lapce_rpc::{core::LogLevel, plugin::VoltID};
+
+use crate::{
+    command::{CommandExecuted, CommandKind},
+    editor::EditorData,
+    keypress::{KeyPressFocus, condition::Condition},
+    main_split::Editors,
+    window_tab::CommonData,
+};
+
+/// Older lines are dropped once a channel has this many.
+const MAX_LINES: usize = 10_000;
+
+/// The levels a channel can be filtered to, from the least verbose.
+pub const OUTPUT_LEVELS: [LogLevel; 5] = [
+    LogLevel::Error,
+    LogLevel::Warn,
+    LogLevel::Info,
+    LogLevel::Debug,
+    LogLevel::Trace,
+];
+
+fn verbosity(level: LogLevel) -> usize {
+    OUTPUT_LEVELS
+        .iter()
+        .position(|l| *l == level)
+        .unwrap_or_default()
+}
+
+pub fn level_name(level: LogLevel) -> &'static str {
+    match level {
+        LogLevel::Error => "Error",
+        LogLevel::Warn => "Warning",
+        LogLevel::Info => "Info",
+        LogLevel::Debug => "Debug",
+        LogLevel::Trace => "Trace",
+    }
+}
+
+/// Where a log line with a proxy `target` should be shown.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub enum OutputSource {
+    Volt(VoltID),
+    LanguageServer(VoltID),
+}
+
+impl OutputSource {
+    /// Parses the targets the proxy logs plugins with, e.g.
+    /// `lapce_proxy::plugin::lsp::{author}::{name}::stderr`.
+    pub fn from_target(target: &str) -> Option<Self> {
+        let mut parts = target.strip_prefix("lapce_proxy::plugin::")?.split("::");
+        let kind = parts.next()?;
+        let volt = VoltID {
+            author: parts.next()?.to_string(),
+            name: parts.next()?.to_string(),
+        };
+        match kind {
+            "wasi" | "psp" => Some(OutputSource::Volt(volt)),
+            "lsp" => Some(OutputSource::LanguageServer(volt)),
+            _ => None,
+        }
+    }
+}
+
+#[derive(Clone, Debug)]
+pub struct OutputLine {
+    pub id: usize,
+    pub level: LogLevel,
+    pub text: String,
+}
+
+#[derive(Clone, Debug)]
+pub struct OutputChannel {
+    pub name: String,
+    pub lines: RwSignal<im::Vector<OutputLine>>,
+    /// The most verbose level that is shown.
+    pub level: RwSignal<LogLevel>,
+    /// Whether the view stays scrolled to the latest line.
+    pub follow: RwSignal<bool>,
+    next_id: RwSignal<usize>,
+}
+
+impl OutputChannel {
+    fn new(cx: Scope, name: String) -> Self {
+        Self {
+            name,
+            lines: cx.create_rw_signal(im::Vector::new()),
+            level: cx.create_rw_signal(LogLevel::Trace),
+            follow: cx.create_rw_signal(true),
+            next_id: cx.create_rw_signal(0),
+        }
+    }
+
+    fn append(&self, level: LogLevel, text: String) {
+        let id = self.next_id.get_untracked();
+        self.next_id.set(id + 1);
+        self.lines.update(|lines| {
+            lines.push_back(OutputLine { id, level, text });
+            while lines.len() > MAX_LINES {
+                lines.pop_front();
+            }
+        });
+    }
+
+    pub fn clear(&self) {
+        self.lines.set(im::Vector::new());
+    }
+
+    /// Moves the filter to the next level, wrapping back to errors only.
+    pub fn cycle_level(&self) {
+        self.level.update(|level| {
+            *level = OUTPUT_LEVELS[(verbosity(*level) + 1) % OUTPUT_LEVELS.len()];
+        });
+    }
+}
+
+/// The named channels of the output panel, one for each volt, language
+/// server, git and tasks.
+#[derive(Clone, Debug)]
+pub struct OutputData {
+    pub channels: RwSignal<IndexMap<String, OutputChannel>>,
+    pub active: RwSignal<Option<String>>,
+    pub search_editor: EditorData,
+    pub common: Rc<CommonData>,
+}
+
+impl KeyPressFocus for OutputData {
+    fn get_mode(&self) -> Mode {
+        Mode::Insert
+    }
+
+    fn check_condition(&self, condition: Condition) -> bool {
+        matches!(condition, Condition::PanelFocus)
+    }
+
+    fn run_command(
+        &self,
+        command: &crate::command::LapceCommand,
+        count: Option<usize>,
+        mods: Modifiers,
+    ) -> CommandExecuted {
+        match &command.kind {
+            CommandKind::Workbench(_) => {}
+            CommandKind::Scroll(_) => {}
+            CommandKind::Focus(_) => {}
+            CommandKind::Edit(_)
+            | CommandKind::Move(_)
+            | CommandKind::MultiSelection(_) => {
+                if let CommandKind::Edit(EditCommand::InsertNewLine) = command.kind {
+                    return CommandExecuted::Yes;
+                }
+                return self.search_editor.run_command(command, count, mods);
+            }
+            CommandKind::MotionMode(_) => {}
+            CommandKind::Plugin(_) => {}
+        }
+        CommandExecuted::No
+    }
+
+    fn receive_char(&self, c: &str) {
+        self.search_editor.receive_char(c);
+    }
+}
+
+impl OutputData {
+    pub fn new(cx: Scope, editors: Editors, common: Rc<CommonData>) -> Self {
+        Self {
+            channels: cx.create_rw_signal(IndexMap::new()),
+            active: cx.create_rw_signal(None),
+            search_editor: editors.make_local(cx, common.clone()),
+            common,
+        }
+    }
+
+    pub fn append(&self, channel: &str, level: LogLevel, text: String) {
+        let existing = self
+            .channels
+            .with_untracked(|channels| channels.get(channel).cloned());
+        let output_channel = match existing {
+            Some(output_channel) => output_channel,
+            None => {
+                let output_channel =
+                    OutputChannel::new(self.common.scope, channel.to_string());
+                self.channels.update(|channels| {
+                    channels.insert(channel.to_string(), output_channel.clone());
+                });
+                output_channel
+            }
+        };
+        output_channel.append(level, text);
+
+        if self.active.with_untracked(|active| active.is_none()) {
+            self.active.set(Some(channel.to_string()));
+        }
+    }
+
+    pub fn active_channel(&self) -> Option<OutputChannel> {
+        let active = self.active.get()?;
+        self.channels
+            .with(|channels| channels.get(&active).cloned())
+    }
+
+    /// The lines of the active channel that pass its level filter and
+    /// contain the search text.
+    pub fn visible_lines(&self) -> im::Vector<OutputLine> {
+        let Some(channel) = self.active_channel() else {
+            return im::Vector::new();
+        };
+        let max = verbosity(channel.level.get());
+        let search = self
+            .search_editor
+            .doc_signal()
+            .get()
+            .buffer
+            .with(|buffer| buffer.to_string().to_lowercase());
+        channel.lines.with(|lines| {
+            lines
+                .iter()
+                .filter(|line| verbosity(line.level) <= max)
+                .filter(|line| {
+                    search.is_empty() || line.text.to_lowercase().contains(&search)
+                })
+                .cloned()
+                .collect()
+        })
+    }
+}
+
+/// Splits what a task writes to its terminal into lines for the output
+/// panel, keeping an unfinished line until the rest of it arrives.
+#[derive(Default)]
+pub struct TaskOutput {
+    pending: Vec<u8>,
+}
+
+impl TaskOutput {
+    /// The lines completed by `content`.
+    pub fn push(&mut self, content: &[u8]) -> Vec<String> {
+        self.pending.extend_from_slice(content);
+        let Some(end) = self.pending.iter().rposition(|b| *b == b'\n') else {
+            return Vec::new();
+        };
+        let rest = self.pending.split_off(end + 1);
+        let done = std::mem::replace(&mut self.pending, rest);
+        String::from_utf8_lossy(&done[..end])
+            .split('\n')
+            .map(task_output_line)
+            .collect()
+    }
+
+    /// The unfinished line, once the task's terminal is closed.
+    pub fn finish(&mut self) -> Option<String> {
+        if self.pending.is_empty() {
+            return None;
+        }
+        let pending = std::mem::take(&mut self.pending);
+        Some(task_output_line(&String::from_utf8_lossy(&pending)))
+    }
+}
+
+/// The text a terminal would end up showing for a line: what follows its
+/// last carriage return, without escape sequences.
+fn task_output_line(line: &str) -> String {
+    let line = line.strip_suffix('\r').unwrap_or(line);
+    let line = line.rsplit('\r').next().unwrap_or(line);
+
+    let mut text = String::with_capacity(line.len());
+    let mut chars = line.chars().peekable();
+    while let Some(c) = chars.next() {
+        if c != '\x1b' {
+            if !c.is_control() || c == '\t' {
+                text.push(c);
+            }
+            continue;
+        }
+        match chars.next() {
+            // CSI, e.g. colors: ends with a byte in `@`..=`~`
+            Some('[') => {
+                for c in chars.by_ref() {
+                    if ('@'..='~').contains(&c) {
+                        break;
+                    }
+                }
+            }
+            // OSC, e.g. titles: ends with BEL or ESC \
+            Some(']') => {
+                while let Some(c) = chars.next() {
+                    if c == '\x07' {
+                        break;
+                    }
+                    if c == '\x1b' && chars.peek() == Some(&'\\') {
+                        chars.next();
+                        break;
+                    }
+                }
+            }
+            _ => {}
+        }
+    }
+    text
+}
+
+#[cfg(test)]
+mod tests {
+    use lapce_rpc::plugin::VoltID;
+
+    use super::{OutputSource, TaskOutput};
+
+    #[test]
+    fn test_task_output() {
+        let mut output = TaskOutput::default();
+        assert!(output.push(b"Compil").is_empty());
+        assert_eq!(
+            output.push(b"ing\r\n\x1b[1;32mok\x1b[0m\r\n10%\r50%"),
+            vec!["Compiling".to_string(), "ok".to_string()]
+        );
+        assert_eq!(
+            output.push(b"\r100%\r\n\x1b]0;title\x07done"),
+            vec!["100%".to_string()]
+        );
+        assert_eq!(output.finish(), Some("done".to_string()));
+        assert_eq!(output.finish(), None);
+    }
+
+    #[test]
+    fn test_output_source_from_target() {
+        let volt = VoltID {
+            author: "lapce".to_string(),
+            name: "lapce-rust".to_string(),
+        };
+        assert_eq!(
+            OutputSource::from_target(
+                "lapce_proxy::plugin::lsp::lapce::lapce-rust::stderr"
+            ),
+            Some(OutputSource::LanguageServer(volt.clone()))
+        );
+        assert_eq!(
+            OutputSource::from_target(
+                "lapce_proxy::plugin::wasi::lapce::lapce-rust"
+            ),
+            Some(OutputSource::Volt(volt.clone()))
+        );
+        assert_eq!(
+            OutputSource::from_target(
+                "lapce_proxy::plugin::psp::lapce::lapce-rust::LogMessage"
+            ),
+            Some(OutputSource::Volt(volt))
+        );
+        assert_eq!(OutputSource::from_target("lapce_app::window_tab"), None);
+    }
+}
@@ -27,7 +27,10 @@
     line_ending::LineEnding, mode::Mode, movement::Movement, selection::Selection,
     syntax::Syntax,
 };
-use lapce_rpc::proxy::ProxyResponse;
+use lapce_rpc::{
+    buffer::{FILE_ENCODINGS, FileEncoding},
+    proxy::ProxyResponse,
+};
 use lapce_xi_rope::Rope;
 use lsp_types::{DocumentSymbol, DocumentSymbolResponse};
 use nucleo::Utf32Str;
@@ -39,8 +42,10 @@
     kind::PaletteKind,
 };
 use crate::{
+    alert::AlertButton,
     command::{
-        CommandExecuted, CommandKind, InternalCommand, LapceCommand, WindowCommand,
+        CommandExecuted, CommandKind, InternalCommand, LapceCommand,
+        LapceWorkbenchCommand, WindowCommand,
     },
     db::LapceDb,
     debug::{RunDebugConfigs, RunDebugMode},
@@ -48,6 +53,7 @@
         EditorData,
         location::{EditorLocation, EditorPosition},
     },
+    hex::{parse_byte_pattern, parse_offset},
     keypress::{KeyPressData, KeyPressFocus, condition::Condition},
     lsp::path_from_url,
     main_split::MainSplitData,
@@ -347,6 +353,12 @@ pub fn placeholder_text(&self) -> &'static str {
             PaletteKind::SshHost => {
                 "Type [user@]host or select a previously connected workspace below"
             }
+            PaletteKind::GoToOffset => {
+                "Type an offset in decimal, or in hex starting with 0x"
+            }
+            PaletteKind::SearchBytes => {
+                "Type hex bytes like 4c 61 70, or \"text\" in quotes"
+            }
             PaletteKind::DiffFiles => {
                 if self.left_diff_path.with(Option::is_some) {
                     "Select right file"
@@ -412,10 +424,23 @@ fn run_inner(&self, kind: PaletteKind) {
             PaletteKind::LineEnding => {
                 self.get_line_endings();
             }
+            PaletteKind::FileEncoding => {
+                self.get_file_encoding_actions();
+            }
+            PaletteKind::ReopenWithEncoding => {
+                self.get_encodings(false);
+            }
+            PaletteKind::SaveWithEncoding => {
+                self.get_encodings(true);
+            }
             PaletteKind::SCMReferences => {
                 self.get_scm_references();
             }
             PaletteKind::TerminalProfile => self.get_terminal_profiles(),
+            // Nothing to pick from, what's typed is used when it's selected
+            PaletteKind::GoToOffset | PaletteKind::SearchBytes => {
+                self.items.set(im::Vector::new());
+            }
         }
     }
 
@@ -576,7 +601,7 @@ fn get_commands(&self) {
             // Add all the rest of the commands, ignoring palette commands (because we're in it)
             // and commands that are sorted earlier due to being executed.
             items.extend(keypress.commands.iter().filter_map(|(_, c)| {
-                if EXCLUDED_ITEMS.contains(&c.kind.str()) {
+                if EXCLUDED_ITEMS.iter().any(|i| *i == c.kind.str()) {
                     return None;
                 }
 
@@ -1047,6 +1072,66 @@ fn get_line_endings(&self) {
         self.items.set(items);
     }
 
+    fn get_file_encoding_actions(&self) {
+        let items = [
+            LapceWorkbenchCommand::ReopenWithEncoding,
+            LapceWorkbenchCommand::SaveWithEncoding,
+        ]
+        .into_iter()
+        .map(|cmd| PaletteItem {
+            filter_text: cmd.get_message().unwrap_or_default().to_string(),
+            content: PaletteItemContent::Command {
+                cmd: LapceCommand {
+                    kind: CommandKind::Workbench(cmd),
+                    data: None,
+                },
+            },
+            score: 0,
+            indices: Vec::new(),
+        })
+        .collect();
+        self.items.set(items);
+    }
+
+    /// The encodings to reopen or save the active file with. Saving offers UTF-8
+    /// with and without a BOM, and writes UTF-16 with one.
+    fn get_encodings(&self, save: bool) {
+        let encodings = FILE_ENCODINGS.iter().flat_map(|(name, description)| {
+            let with_bom = save && *name == "UTF-8";
+            let bom = save && name.starts_with("UTF-16");
+            std::iter::once((FileEncoding::new(*name, bom), *description)).chain(
+                with_bom.then(|| (FileEncoding::new(*name, true), *description)),
+            )
+        });
+        let items: im::Vector<PaletteItem> = encodings
+            .map(|(encoding, description)| PaletteItem {
+                filter_text: format!("{encoding} ({description})"),
+                content: if save {
+                    PaletteItemContent::SaveWithEncoding { encoding }
+                } else {
+                    PaletteItemContent::ReopenWithEncoding { encoding }
+                },
+                score: 0,
+                indices: Vec::new(),
+            })
+            .collect();
+        if let Some(editor) = self.main_split.active_editor.get_untracked() {
+            let current = editor.doc().encoding.get_untracked();
+            if let Some((idx, _)) = items.iter().find_position(|item| {
+                matches!(
+                    &item.content,
+                    PaletteItemContent::ReopenWithEncoding { encoding }
+                        | PaletteItemContent::SaveWithEncoding { encoding }
+                        if encoding.name == current.name
+                            && (!save || encoding.bom == current.bom)
+                )
+            }) {
+                self.preselect_index.set(Some(idx));
+            }
+        }
+        self.items.set(items);
+    }
+
     fn get_scm_references(&self) {
         let branches = self.source_control.branches.get_untracked();
         let tags = self.source_control.tags.get_untracked();
@@ -1313,6 +1398,43 @@ fn select(&self) {
                         buffer.set_line_ending(*kind);
                     });
                 }
+                PaletteItemContent::ReopenWithEncoding { encoding } => {
+                    let Some(editor) = self.main_split.active_editor.get_untracked()
+                    else {
+                        return;
+                    };
+                    let doc = editor.doc();
+                    if doc.is_pristine() {
+                        doc.reopen_with_encoding(encoding.clone());
+                        return;
+                    }
+
+                    let internal_command = self.common.internal_command;
+                    let encoding = encoding.clone();
+                    self.common
+                        .internal_command
+                        .send(InternalCommand::ShowAlert {
+                            title: format!("Reopen the file as {encoding}?"),
+                            msg: "Your unsaved changes will be lost.".to_string(),
+                            buttons: vec![AlertButton {
+                                text: "Reopen".to_string(),
+                                action: Rc::new(move || {
+                                    internal_command
+                                        .send(InternalCommand::HideAlert);
+                                    doc.reopen_with_encoding(encoding.clone());
+                                }),
+                            }],
+                        });
+                }
+                PaletteItemContent::SaveWithEncoding { encoding } => {
+                    let Some(editor) = self.main_split.active_editor.get_untracked()
+                    else {
+                        return;
+                    };
+                    let doc = editor.doc();
+                    doc.encoding.set(encoding.clone());
+                    doc.save(|| {});
+                }
                 PaletteItemContent::SCMReference { name } => {
                     self.common
                         .lapce_command
@@ -1330,6 +1452,21 @@ fn select(&self) {
                         profile: Some(profile.to_owned()),
                     }),
             }
+        } else if self.kind.get_untracked() == PaletteKind::GoToOffset {
+            let input = self.input.with_untracked(|input| input.input.clone());
+            if let (Some(hex), Some(offset)) =
+                (self.main_split.active_hex_data(), parse_offset(&input))
+            {
+                hex.go_to(offset);
+            }
+        } else if self.kind.get_untracked() == PaletteKind::SearchBytes {
+            let input = self.input.with_untracked(|input| input.input.clone());
+            if let (Some(hex), Some(pattern)) = (
+                self.main_split.active_hex_data(),
+                parse_byte_pattern(&input),
+            ) {
+                hex.find(pattern);
+            }
         } else if self.kind.get_untracked() == PaletteKind::SshHost {
             let input = self.input.with_untracked(|input| input.input.clone());
             let ssh = SshHost::from_string(&input);
@@ -1394,6 +1531,8 @@ fn preview(&self) {
                 PaletteItemContent::WslHost { .. } => {}
                 PaletteItemContent::Language { .. } => {}
                 PaletteItemContent::LineEnding { .. } => {}
+                PaletteItemContent::ReopenWithEncoding { .. } => {}
+                PaletteItemContent::SaveWithEncoding { .. } => {}
                 PaletteItemContent::Reference { location, .. } => {
                     self.has_preview.set(true);
                     let (doc, new_doc) =
@@ -1690,6 +1829,7 @@ fn run_command(
                 self.input_editor.run_command(command, count, mods);
             }
             CommandKind::MotionMode(_) => {}
+            CommandKind::Plugin(_) => {}
         }
         CommandExecuted::Yes
     }
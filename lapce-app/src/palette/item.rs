@@ -1,7 +1,7 @@
 use std::path::PathBuf;
 
 use lapce_core::line_ending::LineEnding;
-use lapce_rpc::dap_types::RunDebugConfig;
+use lapce_rpc::{buffer::FileEncoding, dap_types::RunDebugConfig};
 use lsp_types::{Range, SymbolKind};
 
 use crate::{
@@ -77,6 +77,12 @@ pub enum PaletteItemContent {
     LineEnding {
         kind: LineEnding,
     },
+    ReopenWithEncoding {
+        encoding: FileEncoding,
+    },
+    SaveWithEncoding {
+        encoding: FileEncoding,
+    },
     SCMReference {
         name: String,
     },
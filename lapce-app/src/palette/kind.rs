@@ -20,10 +20,15 @@ pub enum PaletteKind {
     IconTheme,
     Language,
     LineEnding,
+    FileEncoding,
+    ReopenWithEncoding,
+    SaveWithEncoding,
     SCMReferences,
     TerminalProfile,
     DiffFiles,
     HelpAndFile,
+    GoToOffset,
+    SearchBytes,
 }
 
 impl PaletteKind {
@@ -46,9 +51,14 @@ pub fn symbol(&self) -> &'static str {
             | PaletteKind::IconTheme
             | PaletteKind::Language
             | PaletteKind::LineEnding
+            | PaletteKind::FileEncoding
+            | PaletteKind::ReopenWithEncoding
+            | PaletteKind::SaveWithEncoding
             | PaletteKind::SCMReferences
             | PaletteKind::HelpAndFile
-            | PaletteKind::DiffFiles => "",
+            | PaletteKind::DiffFiles
+            | PaletteKind::GoToOffset
+            | PaletteKind::SearchBytes => "",
             #[cfg(windows)]
             PaletteKind::WslHost => "",
         }
@@ -98,11 +108,22 @@ pub fn command(self) -> Option<LapceWorkbenchCommand> {
             PaletteKind::LineEnding => {
                 Some(LapceWorkbenchCommand::ChangeFileLineEnding)
             }
+            PaletteKind::FileEncoding => {
+                Some(LapceWorkbenchCommand::ChangeFileEncoding)
+            }
+            PaletteKind::ReopenWithEncoding => {
+                Some(LapceWorkbenchCommand::ReopenWithEncoding)
+            }
+            PaletteKind::SaveWithEncoding => {
+                Some(LapceWorkbenchCommand::SaveWithEncoding)
+            }
             PaletteKind::SCMReferences => {
                 Some(LapceWorkbenchCommand::PaletteSCMReferences)
             }
             PaletteKind::TerminalProfile => None, // InternalCommand::NewTerminal
             PaletteKind::DiffFiles => Some(LapceWorkbenchCommand::DiffFiles),
+            PaletteKind::GoToOffset => Some(LapceWorkbenchCommand::GoToOffset),
+            PaletteKind::SearchBytes => Some(LapceWorkbenchCommand::SearchBytes),
         }
     }
 
@@ -129,8 +150,13 @@ pub fn get_input<'a>(&self, input: &'a str) -> &'a str {
             | PaletteKind::IconTheme
             | PaletteKind::Language
             | PaletteKind::LineEnding
+            | PaletteKind::FileEncoding
+            | PaletteKind::ReopenWithEncoding
+            | PaletteKind::SaveWithEncoding
             | PaletteKind::SCMReferences | PaletteKind::HelpAndFile
-            | PaletteKind::DiffFiles => input,
+            | PaletteKind::DiffFiles
+            | PaletteKind::GoToOffset
+            | PaletteKind::SearchBytes => input,
             PaletteKind::PaletteHelp
             | PaletteKind::Command
             | PaletteKind::Workspace
@@ -13,6 +13,7 @@
 
 use super::position::PanelPosition;
 use crate::{
+    accessibility::KeyboardActivate,
     command::InternalCommand,
     config::{color::LapceColor, icon::LapceIcons},
     editor::location::EditorLocation,
@@ -156,9 +157,9 @@ pub fn show_hierarchy_panel(
                         })
                     )
                     .style(|s| s.padding(4.0).margin_left(6.0).margin_right(2.0))
-                    .on_click_stop({
+                    .on_activate({
                         let window_tab_data = window_tab_data.clone();
-                        move |_x| {
+                        move || {
                             open.update(|x| {
                                 *x = !*x;
                             });
@@ -211,10 +212,10 @@ pub fn show_hierarchy_panel(
                             .cursor(CursorStyle::Pointer)
                         })
                 })
-                .on_click_stop({
+                .on_activate({
                     let window_tab_data = window_tab_data.clone();
                     let data = rw_data;
-                    move |_| {
+                    move || {
                         if !rw_data.get_untracked().init {
                             window_tab_data.common.internal_command.send(
                                 InternalCommand::CallHierarchyIncoming { item_id: rw_data.get_untracked().view_id },
@@ -29,6 +29,7 @@ pub fn default_panel_order() -> PanelOrder {
             PanelKind::Plugin,
             PanelKind::SourceControl,
             PanelKind::Debug,
+            PanelKind::PluginViews,
         ],
     );
     order.insert(
@@ -39,7 +40,8 @@ pub fn default_panel_order() -> PanelOrder {
             PanelKind::Problem,
             PanelKind::CallHierarchy,
             PanelKind::References,
-            PanelKind::Implementation
+            PanelKind::Implementation,
+            PanelKind::Output,
         ],
     );
     order.insert(
@@ -57,6 +59,7 @@ pub enum PanelSection {
     Error,
     Warn,
     Changes,
+    Updates,
     Installed,
     Available,
     Process,
@@ -434,6 +437,44 @@ pub fn move_panel_to_position(&self, kind: PanelKind, position: &PanelPosition)
         db.save_panel_orders(self.panels.get_untracked());
     }
 
+    /// All the panels, position by position in the order of
+    /// [`PanelPosition::ALL`].
+    pub fn all_panels(&self) -> Vec<PanelKind> {
+        self.panels.with_untracked(|panels| {
+            PanelPosition::ALL
+                .iter()
+                .filter_map(|position| panels.get(position))
+                .flat_map(|kinds| kinds.iter().copied())
+                .collect()
+        })
+    }
+
+    /// Grow or shrink the container of the panels at `position` by `delta`,
+    /// keeping to the same limits as resizing it with the mouse.
+    pub fn resize_container(&self, position: &PanelContainerPosition, delta: f64) {
+        let available_size = self.available_size.get_untracked();
+        self.size.update(|size| match position {
+            PanelContainerPosition::Left => {
+                size.left = (size.left + delta)
+                    .max(150.0)
+                    .min(available_size.width - 150.0 - 150.0);
+                size.right =
+                    size.right.min(available_size.width - size.left - 150.0);
+            }
+            PanelContainerPosition::Bottom => {
+                size.bottom = (size.bottom + delta)
+                    .max(100.0)
+                    .min(available_size.height - 100.0);
+            }
+            PanelContainerPosition::Right => {
+                size.right = (size.right + delta)
+                    .max(150.0)
+                    .min(available_size.width - 150.0 - 150.0);
+                size.left = size.left.min(available_size.width - size.right - 150.0);
+            }
+        });
+    }
+
     pub fn section_open(&self, section: PanelSection) -> RwSignal<bool> {
         let open = self
             .sections
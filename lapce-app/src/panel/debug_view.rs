@@ -21,6 +21,7 @@
 
 use super::{data::PanelSection, position::PanelPosition, view::PanelBuilder};
 use crate::{
+    accessibility::KeyboardActivate,
     app::clickable_icon,
     command::InternalCommand,
     config::{LapceConfig, color::LapceColor, icon::LapceIcons},
@@ -297,7 +298,7 @@ fn debug_processes(
                         s.apply_if(!is_hovered.get() && !is_active(), |s| s.hide())
                     }),
                 ))
-                .on_click_stop(move |_| {
+                .on_activate(move || {
                     local_terminal.debug.active_term.set(Some(term_id));
                     local_terminal.focus_terminal(term_id);
                 })
@@ -406,7 +407,7 @@ fn variables_view(window_tab_data: Rc<WindowTabData>) -> impl View {
                         text(format!(" = {}", node.item.value().unwrap_or("")))
                             .style(move |s| s.apply_if(reference > 0, |s| s.hide())),
                     ))
-                    .on_click_stop(move |_| {
+                    .on_activate(move || {
                         if reference > 0 {
                             let dap = local_terminal.get_active_dap(false);
                             if let Some(dap) = dap {
@@ -462,7 +463,7 @@ fn debug_stack_frames(
     let expanded = stack_trace.expanded;
     stack((
         container(label(move || thread_id.to_string()))
-            .on_click_stop(move |_| {
+            .on_activate(move || {
                 expanded.update(|expanded| {
                     *expanded = !*expanded;
                 });
@@ -517,7 +518,7 @@ fn debug_stack_frames(
                             .apply_if(!has_source, |s| s.hide())
                     }),
                 )))
-                .on_click_stop(move |_| {
+                .on_activate(move || {
                     if let Some(path) = full_path.clone() {
                         internal_command.send(InternalCommand::JumpToLocation {
                             location: EditorLocation {
@@ -684,7 +685,7 @@ fn breakpoints_view(window_tab_data: Rc<WindowTabData>) -> impl View {
                             .style(|s| {
                                 s.margin_right(6.0).cursor(CursorStyle::Pointer)
                             })
-                            .on_click_stop(move |_| {
+                            .on_activate(move || {
                                 breakpoints.update(|breakpoints| {
                                     if let Some(breakpoints) =
                                         breakpoints.get_mut(&full_path)
@@ -731,7 +732,7 @@ fn breakpoints_view(window_tab_data: Rc<WindowTabData>) -> impl View {
                             },
                         )
                     })
-                    .on_click_stop(move |_| {
+                    .on_activate(move || {
                         internal_command.send(InternalCommand::JumpToLocation {
                             location: EditorLocation {
                                 path: full_path_for_jump.clone(),
@@ -14,6 +14,7 @@
 
 use super::position::PanelPosition;
 use crate::{
+    accessibility::KeyboardActivate,
     command::InternalCommand,
     config::{color::LapceColor, icon::LapceIcons},
     editor::location::EditorLocation,
@@ -242,8 +243,8 @@ pub fn symbol_panel(
                                  .color(color)
                         })
                     ).style(|s| s.padding(4.0).margin_left(6.0).margin_right(2.0))
-                    .on_click_stop({
-                        move |_x| {
+                    .on_activate({
+                        move || {
                             if has_child {
                                 open.update(|x| {
                                     *x = !*x;
@@ -296,10 +297,10 @@ pub fn symbol_panel(
                             .cursor(CursorStyle::Pointer)
                         })
                 })
-                .on_click_stop({
+                .on_activate({
                     let window_tab_data = window_tab_data.clone();
                     let data = rw_data;
-                    move |_| {
+                    move || {
                         let data = data.get_untracked();
                             window_tab_data
                                 .common
@@ -11,6 +11,7 @@
 
 use super::{kind::PanelKind, position::PanelPosition};
 use crate::{
+    accessibility::KeyboardActivate,
     app::clickable_icon,
     command::InternalCommand,
     config::{LapceConfig, color::LapceColor, icon::LapceIcons},
@@ -192,7 +193,7 @@ fn search_result(
                             ))
                             .style(move |s| s.min_width(0.0).items_center()),
                         ))
-                        .on_click_stop(move |_| {
+                        .on_activate(move || {
                             expanded.update(|expanded| *expanded = !*expanded);
                         })
                         .style(move |s| {
@@ -270,8 +271,8 @@ fn search_result(
                                         },
                                     )
                                 })
-                                .on_click_stop(
-                                    move |_| {
+                                .on_activate(
+                                    move || {
                                         internal_command.send(
                                             InternalCommand::JumpToLocation {
                                                 location: EditorLocation {
@@ -16,6 +16,7 @@
 
 use super::position::PanelPosition;
 use crate::{
+    accessibility::KeyboardActivate,
     command::InternalCommand,
     config::{color::LapceColor, icon::LapceIcons},
     editor::location::EditorLocation,
@@ -63,8 +64,8 @@ pub fn common_reference_panel(
                             }),
                         )
                         .style(|s| s.padding(4.0).margin_left(6.0).margin_right(2.0))
-                        .on_click_stop({
-                            move |_x| {
+                        .on_activate({
+                            move || {
                                 open.update(|x| {
                                     *x = !*x;
                                 });
@@ -136,10 +137,10 @@ pub fn common_reference_panel(
                                 .cursor(CursorStyle::Pointer)
                             })
                     }),))
-                    .on_click_stop({
+                    .on_activate({
                         let window_tab_data = window_tab_data.clone();
                         let position = file_line.position;
-                        move |_| {
+                        move || {
                             window_tab_data.common.internal_command.send(
                                 InternalCommand::JumpToLocation {
                                     location: EditorLocation {
@@ -1,12 +1,22 @@
 use serde::{Deserialize, Serialize};
-use strum_macros::EnumIter;
+use strum_macros::{EnumIter, IntoStaticStr};
 
 use super::{data::PanelOrder, position::PanelPosition};
 use crate::config::icon::LapceIcons;
 
 #[derive(
-    Clone, Copy, PartialEq, Serialize, Deserialize, Hash, Eq, Debug, EnumIter,
+    Clone,
+    Copy,
+    PartialEq,
+    Serialize,
+    Deserialize,
+    Hash,
+    Eq,
+    Debug,
+    EnumIter,
+    IntoStaticStr,
 )]
+#[strum(serialize_all = "snake_case")]
 pub enum PanelKind {
     Terminal,
     FileExplorer,
@@ -19,6 +29,8 @@ pub enum PanelKind {
     DocumentSymbol,
     References,
     Implementation,
+    PluginViews,
+    Output,
 }
 
 impl PanelKind {
@@ -35,6 +47,26 @@ pub fn svg_name(&self) -> &'static str {
             PanelKind::DocumentSymbol => LapceIcons::DOCUMENT_SYMBOL,
             PanelKind::References => LapceIcons::REFERENCES,
             PanelKind::Implementation => LapceIcons::IMPLEMENTATION,
+            PanelKind::PluginViews => LapceIcons::PLUGIN_VIEWS,
+            PanelKind::Output => LapceIcons::OUTPUT,
+        }
+    }
+
+    pub fn title(&self) -> &'static str {
+        match &self {
+            PanelKind::Terminal => "Terminal",
+            PanelKind::FileExplorer => "File Explorer",
+            PanelKind::SourceControl => "Source Control",
+            PanelKind::Plugin => "Plugins",
+            PanelKind::Search => "Search",
+            PanelKind::Problem => "Problems",
+            PanelKind::Debug => "Debug",
+            PanelKind::CallHierarchy => "Call Hierarchy",
+            PanelKind::DocumentSymbol => "Document Symbol",
+            PanelKind::References => "References",
+            PanelKind::Implementation => "Implementation",
+            PanelKind::PluginViews => "Plugin Views",
+            PanelKind::Output => "Output",
         }
     }
 
@@ -61,6 +93,8 @@ pub fn default_position(&self) -> PanelPosition {
             PanelKind::DocumentSymbol => PanelPosition::RightTop,
             PanelKind::References => PanelPosition::BottomLeft,
             PanelKind::Implementation => PanelPosition::BottomLeft,
+            PanelKind::PluginViews => PanelPosition::LeftTop,
+            PanelKind::Output => PanelPosition::BottomLeft,
         }
     }
 }
@@ -5,6 +5,8 @@
 pub mod global_search_view;
 pub mod implementation_view;
 pub mod kind;
+pub mod output_view;
+pub mod plugin_tree_view;
 pub mod plugin_view;
 pub mod position;
 pub mod problem_view;
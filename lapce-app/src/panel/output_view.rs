@@ -0,0 +1,261 @@
+use std::rc::Rc;
+
+use std::sync::Arc;
+
+use floem::{
+    View,
+    event::EventListener,
+    peniko::kurbo::{Point, Size},
+    reactive::{ReadSignal, SignalGet, SignalUpdate, SignalWith, create_rw_signal},
+    style::CursorStyle,
+    views::{Decorators, container, dyn_stack, label, scroll, stack, virtual_stack},
+};
+use lapce_rpc::core::LogLevel;
+
+use super::{kind::PanelKind, position::PanelPosition};
+use crate::{
+    accessibility::KeyboardActivate,
+    config::{LapceConfig, color::LapceColor},
+    output::{OutputData, OutputLine, level_name},
+    text_input::TextInputBuilder,
+    window_tab::{Focus, WindowTabData},
+};
+
+pub fn output_panel(
+    window_tab_data: Rc<WindowTabData>,
+    _position: PanelPosition,
+) -> impl View {
+    let output = window_tab_data.output.clone();
+    let config = output.common.config;
+    let ui_line_height = output.common.ui_line_height;
+    let channels = output.channels;
+    let active = output.active;
+
+    stack((
+        scroll(
+            dyn_stack(
+                move || {
+                    channels.with(|channels| {
+                        channels.keys().cloned().collect::<Vec<_>>()
+                    })
+                },
+                |name| name.clone(),
+                move |name| {
+                    let is_active = {
+                        let name = name.clone();
+                        move || active.with(|active| active.as_ref() == Some(&name))
+                    };
+                    let local_name = name.clone();
+                    label(move || name.clone())
+                        .style(move |s| {
+                            let config = config.get();
+                            s.padding_horiz(10.0)
+                                .height(ui_line_height.get())
+                                .items_center()
+                                .min_width_pct(100.0)
+                                .text_ellipsis()
+                                .apply_if(is_active(), |s| {
+                                    s.background(
+                                        config.color(
+                                            LapceColor::PANEL_CURRENT_BACKGROUND,
+                                        ),
+                                    )
+                                })
+                                .hover(|s| {
+                                    s.cursor(CursorStyle::Pointer).background(
+                                        config.color(
+                                            LapceColor::PANEL_HOVERED_BACKGROUND,
+                                        ),
+                                    )
+                                })
+                        })
+                        .on_activate(move || {
+                            active.set(Some(local_name.clone()));
+                        })
+                },
+            )
+            .style(|s| s.flex_col().width_pct(100.0)),
+        )
+        .style(move |s| {
+            s.width(200.0)
+                .height_pct(100.0)
+                .flex_shrink(0.0)
+                .border_right(1.0)
+                .border_color(config.get().color(LapceColor::LAPCE_BORDER))
+        }),
+        stack((output_toolbar(output.clone()), output_lines(output))).style(|s| {
+            s.flex_col()
+                .flex_grow(1.0)
+                .flex_basis(0.0)
+                .min_width(0.0)
+                .height_pct(100.0)
+        }),
+    ))
+    .style(|s| s.size_full())
+    .debug_name("Output Panel")
+}
+
+fn output_toolbar(output: OutputData) -> impl View {
+    let config = output.common.config;
+    let focus = output.common.focus;
+    let is_focused = move || focus.get() == Focus::Panel(PanelKind::Output);
+    let cursor_x = create_rw_signal(0.0);
+    let level_output = output.clone();
+    let follow_output = output.clone();
+    let clear_output = output.clone();
+
+    stack((
+        container(
+            scroll(
+                TextInputBuilder::new()
+                    .is_focused(is_focused)
+                    .build_editor(output.search_editor.clone())
+                    .placeholder(|| "Filter".to_string())
+                    .on_cursor_pos(move |point| {
+                        cursor_x.set(point.x);
+                    })
+                    .style(|s| {
+                        s.padding_vert(4.0).padding_horiz(10.0).min_width_pct(100.0)
+                    }),
+            )
+            .ensure_visible(move || {
+                Size::new(20.0, 0.0)
+                    .to_rect()
+                    .with_origin(Point::new(cursor_x.get(), 0.0))
+            })
+            .on_event_cont(EventListener::PointerDown, move |_| {
+                focus.set(Focus::Panel(PanelKind::Output));
+            })
+            .scroll_style(|s| s.hide_bars(true))
+            .style(move |s| {
+                let config = config.get();
+                s.flex_grow(1.0)
+                    .flex_basis(0.0)
+                    .min_width(0.0)
+                    .cursor(CursorStyle::Text)
+                    .items_center()
+                    .background(config.color(LapceColor::EDITOR_BACKGROUND))
+                    .border(1.0)
+                    .border_radius(6.0)
+                    .border_color(config.color(LapceColor::LAPCE_BORDER))
+            }),
+        ),
+        toolbar_button(
+            move || {
+                let level = level_output
+                    .active_channel()
+                    .map(|channel| channel.level.get())
+                    .unwrap_or(LogLevel::Trace);
+                format!("Level: {}", level_name(level))
+            },
+            || false,
+            {
+                let output = output.clone();
+                move || {
+                    if let Some(channel) = output.active_channel() {
+                        channel.cycle_level();
+                    }
+                }
+            },
+            config,
+        ),
+        toolbar_button(
+            || "Follow".to_string(),
+            move || {
+                follow_output
+                    .active_channel()
+                    .map(|channel| channel.follow.get())
+                    .unwrap_or(false)
+            },
+            {
+                let output = output.clone();
+                move || {
+                    if let Some(channel) = output.active_channel() {
+                        channel.follow.update(|follow| *follow = !*follow);
+                    }
+                }
+            },
+            config,
+        ),
+        toolbar_button(
+            || "Clear".to_string(),
+            || false,
+            move || {
+                if let Some(channel) = clear_output.active_channel() {
+                    channel.clear();
+                }
+            },
+            config,
+        ),
+    ))
+    .style(|s| s.padding(6.0).width_pct(100.0).items_center().gap(6.0))
+}
+
+fn toolbar_button(
+    text: impl Fn() -> String + 'static,
+    is_active: impl Fn() -> bool + 'static,
+    on_click: impl Fn() + 'static,
+    config: ReadSignal<Arc<LapceConfig>>,
+) -> impl View {
+    label(text).on_activate(on_click).style(move |s| {
+        let config = config.get();
+        s.padding_horiz(8.0)
+            .padding_vert(4.0)
+            .border_radius(6.0)
+            .apply_if(is_active(), |s| {
+                s.background(config.color(LapceColor::PANEL_CURRENT_BACKGROUND))
+            })
+            .hover(|s| {
+                s.cursor(CursorStyle::Pointer)
+                    .background(config.color(LapceColor::PANEL_HOVERED_BACKGROUND))
+            })
+    })
+}
+
+fn output_lines(output: OutputData) -> impl View {
+    let config = output.common.config;
+    let ui_line_height = output.common.ui_line_height;
+    let follow_output = output.clone();
+
+    container(
+        scroll(
+            virtual_stack(
+                move || output.visible_lines(),
+                |line: &OutputLine| line.id,
+                move |line| {
+                    let level = line.level;
+                    label(move || line.text.clone()).style(move |s| {
+                        let config = config.get();
+                        let color = match level {
+                            LogLevel::Error => config.color(LapceColor::LAPCE_ERROR),
+                            LogLevel::Warn => config.color(LapceColor::LAPCE_WARN),
+                            LogLevel::Info => {
+                                config.color(LapceColor::EDITOR_FOREGROUND)
+                            }
+                            LogLevel::Debug | LogLevel::Trace => {
+                                config.color(LapceColor::EDITOR_DIM)
+                            }
+                        };
+                        s.padding_horiz(10.0)
+                            .height(ui_line_height.get())
+                            .items_center()
+                            .color(color)
+                            .font_family(config.editor.font_family.clone())
+                    })
+                },
+            )
+            .item_size_fixed(move || ui_line_height.get())
+            .style(|s| s.flex_col().min_width_full()),
+        )
+        .scroll_to(move || {
+            let channel = follow_output.active_channel()?;
+            if !channel.follow.get() {
+                return None;
+            }
+            let count = follow_output.visible_lines().len();
+            Some(Point::new(0.0, count as f64 * ui_line_height.get()))
+        })
+        .style(|s| s.absolute().size_full()),
+    )
+    .style(|s| s.flex_grow(1.0).flex_basis(0.0).width_pct(100.0))
+}
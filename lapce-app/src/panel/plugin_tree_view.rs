@@ -0,0 +1,419 @@
+use std::{ops::AddAssign, rc::Rc};
+
+use floem::{
+    IntoView, View, ViewId,
+    ext_event::create_ext_action,
+    peniko::Color,
+    reactive::{RwSignal, Scope, SignalGet, SignalUpdate, SignalWith},
+    style::CursorStyle,
+    views::{
+        Decorators, VirtualVector, container, empty, label, scroll, stack, svg,
+        virtual_stack,
+    },
+};
+use lapce_rpc::{
+    RpcError,
+    plugin::{PluginTreeView, TreeNode},
+    proxy::{ProxyResponse, ProxyRpcHandler},
+};
+use serde_json::Value;
+
+use super::position::PanelPosition;
+use crate::{
+    accessibility::KeyboardActivate,
+    config::{color::LapceColor, icon::LapceIcons},
+    window_tab::WindowTabData,
+};
+
+/// A tree a volt registered, shown as a section of the plugin views panel.
+#[derive(Clone, Debug)]
+pub struct PluginTreeViewData {
+    pub view_id: ViewId,
+    pub view: Rc<PluginTreeView>,
+    pub open: RwSignal<bool>,
+    pub loaded: RwSignal<bool>,
+    pub roots: RwSignal<Vec<TreeNodeData>>,
+}
+
+#[derive(Clone, Debug)]
+pub struct TreeNodeData {
+    pub view_id: ViewId,
+    pub node: Rc<TreeNode>,
+    pub open: RwSignal<bool>,
+    pub loaded: RwSignal<bool>,
+    pub children: RwSignal<Vec<TreeNodeData>>,
+}
+
+impl TreeNodeData {
+    fn new(cx: Scope, node: TreeNode) -> Self {
+        Self {
+            view_id: ViewId::new(),
+            node: Rc::new(node),
+            open: cx.create_rw_signal(false),
+            loaded: cx.create_rw_signal(false),
+            children: cx.create_rw_signal(Vec::new()),
+        }
+    }
+
+    fn child_count(&self) -> usize {
+        let mut count = 1;
+        if self.open.get() {
+            for child in self.children.get_untracked() {
+                count += child.child_count();
+            }
+        }
+        count
+    }
+
+    fn find(nodes: &[TreeNodeData], id: &str) -> Option<TreeNodeData> {
+        nodes.iter().find_map(|node| {
+            if node.node.id == id {
+                Some(node.clone())
+            } else {
+                node.children
+                    .with_untracked(|children| Self::find(children, id))
+            }
+        })
+    }
+}
+
+impl PluginTreeViewData {
+    pub fn new(cx: Scope, view: PluginTreeView) -> Self {
+        Self {
+            view_id: ViewId::new(),
+            view: Rc::new(view),
+            open: cx.create_rw_signal(true),
+            loaded: cx.create_rw_signal(false),
+            roots: cx.create_rw_signal(Vec::new()),
+        }
+    }
+
+    fn child_count(&self) -> usize {
+        let mut count = 1;
+        if self.open.get() {
+            for root in self.roots.get_untracked() {
+                count += root.child_count();
+            }
+        }
+        count
+    }
+
+    /// Asks the volt again for the children of `node`, or for the roots if
+    /// it's `None`. Nodes the user never expanded are left to load lazily.
+    pub fn refresh(&self, cx: Scope, proxy: &ProxyRpcHandler, node: Option<&str>) {
+        match node {
+            Some(id) => {
+                let node = self
+                    .roots
+                    .with_untracked(|roots| TreeNodeData::find(roots, id));
+                if let Some(node) = node {
+                    if node.loaded.get_untracked() {
+                        self.load(cx, proxy, Some(id), node.children);
+                    }
+                }
+            }
+            None => {
+                if self.loaded.get_untracked() {
+                    self.load(cx, proxy, None, self.roots);
+                }
+            }
+        }
+    }
+
+    fn load_roots(&self, cx: Scope, proxy: &ProxyRpcHandler) {
+        if !self.loaded.get_untracked() {
+            self.loaded.set(true);
+            self.load(cx, proxy, None, self.roots);
+        }
+    }
+
+    fn load_children(
+        &self,
+        cx: Scope,
+        proxy: &ProxyRpcHandler,
+        node: &TreeNodeData,
+    ) {
+        if !node.loaded.get_untracked() {
+            node.loaded.set(true);
+            self.load(cx, proxy, Some(&node.node.id), node.children);
+        }
+    }
+
+    /// Replaces `target` with the children the volt returns. Nodes that were
+    /// open before keep their state and have their own children reloaded.
+    fn load(
+        &self,
+        cx: Scope,
+        proxy: &ProxyRpcHandler,
+        parent: Option<&str>,
+        target: RwSignal<Vec<TreeNodeData>>,
+    ) {
+        let view = self.clone();
+        let reload_proxy = proxy.clone();
+        let send =
+            create_ext_action(cx, move |result: Result<ProxyResponse, RpcError>| {
+                let children = match result {
+                    Ok(ProxyResponse::GetPluginTreeChildrenResponse {
+                        children,
+                    }) => children,
+                    Ok(_) => return,
+                    Err(err) => {
+                        tracing::error!("{:?}", err);
+                        return;
+                    }
+                };
+                let previous = target.get_untracked();
+                let children = children
+                    .into_iter()
+                    .map(|node| {
+                        let was_open = previous
+                            .iter()
+                            .find(|p| p.node.id == node.id)
+                            .map(|p| p.open.get_untracked())
+                            .unwrap_or(false);
+                        let data = TreeNodeData::new(cx, node);
+                        if was_open && data.node.collapsible {
+                            data.open.set(true);
+                            view.load_children(cx, &reload_proxy, &data);
+                        }
+                        data
+                    })
+                    .collect();
+                target.set(children);
+            });
+        proxy.get_plugin_tree_children(
+            self.view.volt.clone(),
+            self.view.id.clone(),
+            parent.map(|p| p.to_string()),
+            send,
+        );
+    }
+}
+
+#[derive(Clone)]
+enum TreeRow {
+    View(PluginTreeViewData),
+    Node(PluginTreeViewData, TreeNodeData),
+}
+
+impl TreeRow {
+    fn view_id(&self) -> ViewId {
+        match self {
+            TreeRow::View(view) => view.view_id,
+            TreeRow::Node(_, node) => node.view_id,
+        }
+    }
+}
+
+fn get_children(
+    view: &PluginTreeViewData,
+    node: &TreeNodeData,
+    next: &mut usize,
+    min: usize,
+    max: usize,
+    level: usize,
+    rows: &mut Vec<(usize, TreeRow)>,
+) {
+    if *next >= max {
+        return;
+    }
+    if *next >= min {
+        rows.push((level, TreeRow::Node(view.clone(), node.clone())));
+    }
+    next.add_assign(1);
+    if node.open.get() {
+        for child in node.children.get() {
+            get_children(view, &child, next, min, max, level + 1, rows);
+            if *next >= max {
+                break;
+            }
+        }
+    }
+}
+
+struct VirtualList {
+    views: Vec<PluginTreeViewData>,
+}
+
+impl VirtualVector<(usize, TreeRow)> for VirtualList {
+    fn total_len(&self) -> usize {
+        self.views.iter().map(|v| v.child_count()).sum()
+    }
+
+    fn slice(
+        &mut self,
+        range: std::ops::Range<usize>,
+    ) -> impl Iterator<Item = (usize, TreeRow)> {
+        let min = range.start;
+        let max = range.end;
+        let mut next = 0;
+        let mut rows = Vec::new();
+        for view in &self.views {
+            if next >= max {
+                break;
+            }
+            if next >= min {
+                rows.push((0, TreeRow::View(view.clone())));
+            }
+            next += 1;
+            if view.open.get() {
+                for root in view.roots.get() {
+                    get_children(view, &root, &mut next, min, max, 1, &mut rows);
+                    if next >= max {
+                        break;
+                    }
+                }
+            }
+        }
+        rows.into_iter()
+    }
+}
+
+pub fn plugin_tree_view_panel(
+    window_tab_data: Rc<WindowTabData>,
+    _position: PanelPosition,
+) -> impl View {
+    let plugin = window_tab_data.plugin.clone();
+    let config = plugin.common.config;
+    let ui_line_height = plugin.common.ui_line_height;
+    let proxy = plugin.common.proxy.clone();
+    let cx = plugin.common.scope;
+    let tree_views = plugin.tree_views;
+
+    stack((
+        scroll(
+            virtual_stack(
+                move || {
+                    let views = tree_views.get();
+                    for view in &views {
+                        if view.open.get() {
+                            view.load_roots(cx, &proxy);
+                        }
+                    }
+                    VirtualList { views }
+                },
+                move |(_, row)| row.view_id(),
+                move |(level, row)| {
+                    let plugin = plugin.clone();
+                    let proxy = plugin.common.proxy.clone();
+                    let (open, collapsible) = match &row {
+                        TreeRow::View(view) => (view.open, true),
+                        TreeRow::Node(_, node) => (node.open, node.node.collapsible),
+                    };
+                    let (text, description, icon) = match &row {
+                        TreeRow::View(view) => (view.view.title.clone(), None, None),
+                        TreeRow::Node(_, node) => (
+                            node.node.label.clone(),
+                            node.node.description.clone(),
+                            node.node.icon.clone(),
+                        ),
+                    };
+                    let is_view = matches!(row, TreeRow::View(_));
+                    stack((
+                        container(
+                            svg(move || {
+                                let config = config.get();
+                                let svg_str = match open.get() {
+                                    true => LapceIcons::ITEM_OPENED,
+                                    false => LapceIcons::ITEM_CLOSED,
+                                };
+                                config.ui_svg(svg_str)
+                            })
+                            .style(move |s| {
+                                let config = config.get();
+                                let size = config.ui.icon_size() as f32;
+                                let color = if collapsible {
+                                    config.color(LapceColor::LAPCE_ICON_ACTIVE)
+                                } else {
+                                    Color::TRANSPARENT
+                                };
+                                s.size(size, size).color(color)
+                            }),
+                        )
+                        .style(|s| {
+                            s.padding(4.0).margin_left(6.0).margin_right(2.0)
+                        }),
+                        match icon {
+                            Some(icon) => svg(move || {
+                                let config = config.get();
+                                config.ui_svg_by_name(&icon).unwrap_or_else(|| {
+                                    config.ui_svg(LapceIcons::FILE)
+                                })
+                            })
+                            .style(move |s| {
+                                let config = config.get();
+                                let size = config.ui.icon_size() as f32;
+                                s.min_width(size)
+                                    .size(size, size)
+                                    .margin_right(5.0)
+                                    .color(
+                                        config.color(LapceColor::LAPCE_ICON_ACTIVE),
+                                    )
+                            })
+                            .into_any(),
+                            None => empty().into_any(),
+                        },
+                        label(move || text.clone())
+                            .style(move |s| s.apply_if(is_view, |s| s.font_bold())),
+                        match description {
+                            Some(description) => {
+                                label(move || description.replace('\n', "↵"))
+                                    .style(move |s| {
+                                        s.margin_left(6.0).color(
+                                            config
+                                                .get()
+                                                .color(LapceColor::EDITOR_DIM),
+                                        )
+                                    })
+                                    .into_any()
+                            }
+                            None => empty().into_any(),
+                        },
+                    ))
+                    .style(move |s| {
+                        s.padding_right(5.0)
+                            .height(ui_line_height.get())
+                            .padding_left((level * 10) as f32)
+                            .items_center()
+                            .hover(|s| {
+                                s.background(
+                                    config
+                                        .get()
+                                        .color(LapceColor::PANEL_HOVERED_BACKGROUND),
+                                )
+                                .cursor(CursorStyle::Pointer)
+                            })
+                    })
+                    .on_activate(move || match &row {
+                        TreeRow::View(view) => {
+                            view.open.update(|open| *open = !*open);
+                        }
+                        TreeRow::Node(view, node) => {
+                            if node.node.collapsible {
+                                node.open.update(|open| *open = !*open);
+                                view.load_children(cx, &proxy, node);
+                            }
+                            if let Some(command) = &node.node.command {
+                                let data = if node.node.arguments.is_empty() {
+                                    None
+                                } else {
+                                    Some(Value::Array(node.node.arguments.clone()))
+                                };
+                                plugin.run_command_by_name(command, data);
+                            }
+                        }
+                    })
+                },
+            )
+            .item_size_fixed(move || ui_line_height.get())
+            .style(|s| s.flex_col().absolute().min_width_full()),
+        )
+        .style(|s| s.absolute().size_full()),
+        label(|| "No plugin has added a view.".to_string()).style(move |s| {
+            s.padding(10.0)
+                .color(config.get().color(LapceColor::EDITOR_DIM))
+                .apply_if(!tree_views.with(|views| views.is_empty()), |s| s.hide())
+        }),
+    ))
+    .style(|s| s.size_full())
+}
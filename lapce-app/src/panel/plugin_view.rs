@@ -1,13 +1,14 @@
-use std::{ops::Range, rc::Rc};
+use std::{ops::Range, rc::Rc, sync::Arc};
 
 use floem::{
     IntoView, View,
     event::EventListener,
     peniko::kurbo::{Point, Rect, Size},
     reactive::{
-        RwSignal, SignalGet, SignalUpdate, SignalWith, create_memo, create_rw_signal,
+        ReadSignal, RwSignal, SignalGet, SignalUpdate, SignalWith, create_memo,
+        create_rw_signal,
     },
-    style::CursorStyle,
+    style::{CursorStyle, Style},
     views::{
         Decorators, VirtualVector, container, dyn_container, img, label,
         scroll::scroll, stack, svg, virtual_stack,
@@ -23,9 +24,10 @@
     data::PanelSection, kind::PanelKind, position::PanelPosition, view::PanelBuilder,
 };
 use crate::{
+    accessibility::KeyboardActivate,
     app::not_clickable_icon,
     command::InternalCommand,
-    config::{color::LapceColor, icon::LapceIcons},
+    config::{LapceConfig, color::LapceColor, icon::LapceIcons},
     plugin::{AvailableVoltData, InstalledVoltData, PluginData, VoltIcon},
     text_input::TextInputBuilder,
     window_tab::{Focus, WindowTabData},
@@ -73,7 +75,18 @@ pub fn plugin_panel(
     let plugin = window_tab_data.plugin.clone();
     let core_rpc = window_tab_data.proxy.core_rpc.clone();
 
+    let updates = {
+        let plugin = plugin.clone();
+        create_memo(move |_| plugin.updates().len())
+    };
+
     PanelBuilder::new(config, position)
+        .add_style(
+            "Updates",
+            updates_view(plugin.clone()),
+            window_tab_data.panel.section_open(PanelSection::Updates),
+            move |s| s.apply_if(updates.get() == 0, |s| s.hide()),
+        )
         .add(
             "Installed",
             installed_view(plugin.clone()),
@@ -88,6 +101,138 @@ pub fn plugin_panel(
         .debug_name("Plugin Panel")
 }
 
+pub fn primary_button_style(
+    config: ReadSignal<Arc<LapceConfig>>,
+    s: Style,
+) -> Style {
+    let config = config.get();
+    s.color(config.color(LapceColor::LAPCE_BUTTON_PRIMARY_FOREGROUND))
+        .background(config.color(LapceColor::LAPCE_BUTTON_PRIMARY_BACKGROUND))
+        .margin_left(6.0)
+        .padding_horiz(6.0)
+        .border_radius(6.0)
+        .selectable(false)
+        .hover(|s| {
+            s.cursor(CursorStyle::Pointer).background(
+                config
+                    .color(LapceColor::LAPCE_BUTTON_PRIMARY_BACKGROUND)
+                    .multiply_alpha(0.8),
+            )
+        })
+        .active(|s| {
+            s.background(
+                config
+                    .color(LapceColor::LAPCE_BUTTON_PRIMARY_BACKGROUND)
+                    .multiply_alpha(0.6),
+            )
+        })
+        .disabled(|s| s.background(config.color(LapceColor::EDITOR_DIM)))
+}
+
+fn updates_view(plugin: PluginData) -> impl View {
+    let ui_line_height = plugin.common.ui_line_height;
+    let config = plugin.common.config;
+    let internal_command = plugin.common.internal_command;
+
+    let view_fn = move |volt: InstalledVoltData, plugin: PluginData| {
+        let meta = volt.meta.get_untracked();
+        let volt_id = meta.id();
+        let updating = volt.updating;
+        let local_volt = volt.clone();
+        stack((
+            stack((
+                label(move || meta.display_name.clone()).style(|s| {
+                    s.font_bold()
+                        .text_ellipsis()
+                        .min_width(0.0)
+                        .selectable(false)
+                }),
+                label(move || {
+                    format!(
+                        "v{} → v{}",
+                        volt.meta.with(|m| m.version.clone()),
+                        volt.latest.with(|l| l.version.clone())
+                    )
+                })
+                .style(|s| s.text_ellipsis().min_width(0.0).selectable(false)),
+            ))
+            .style(|s| s.flex_col().flex_grow(1.0).flex_basis(0.0).min_width(0.0)),
+            label(move || {
+                if updating.get() {
+                    "Updating".to_string()
+                } else {
+                    "Update".to_string()
+                }
+            })
+            .disabled(move || updating.get())
+            .on_activate(move || {
+                plugin.update_volt(&local_volt);
+            })
+            .style(move |s| primary_button_style(config, s)),
+        ))
+        .on_activate(move || {
+            internal_command.send(InternalCommand::OpenVoltView {
+                volt_id: volt_id.clone(),
+            });
+        })
+        .style(move |s| {
+            s.width_pct(100.0)
+                .items_center()
+                .padding_horiz(10.0)
+                .padding_vert(5.0)
+                .hover(|s| {
+                    s.background(
+                        config.get().color(LapceColor::PANEL_HOVERED_BACKGROUND),
+                    )
+                })
+        })
+    };
+
+    let local_plugin = plugin.clone();
+    let updating_all = {
+        let plugin = plugin.clone();
+        move || plugin.updates().values().all(|volt| volt.updating.get())
+    };
+    stack((
+        stack((
+            label(|| "Check Again".to_string())
+                .on_activate({
+                    let plugin = plugin.clone();
+                    move || plugin.check_updates()
+                })
+                .style(move |s| primary_button_style(config, s)),
+            label(|| "Update All".to_string())
+                .disabled(updating_all)
+                .on_activate({
+                    let plugin = plugin.clone();
+                    move || plugin.update_all()
+                })
+                .style(move |s| primary_button_style(config, s)),
+        ))
+        .style(|s| s.width_pct(100.0).justify_end().padding(10.0)),
+        container(
+            scroll(
+                virtual_stack(
+                    move || IndexMapItems(local_plugin.updates()),
+                    move |(_, id, _)| id.clone(),
+                    move |(_, _, volt)| view_fn(volt, plugin.clone()),
+                )
+                .item_size_fixed(move || ui_line_height.get() * 2.0 + 10.0)
+                .style(|s| s.flex_col().width_pct(100.0)),
+            )
+            .style(|s| s.absolute().size_pct(100.0, 100.0)),
+        )
+        .style(|s| s.width_pct(100.0).flex_grow(1.0).flex_basis(0.0)),
+    ))
+    .style(|s| {
+        s.width_pct(100.0)
+            .line_height(1.6)
+            .flex_grow(1.0)
+            .flex_basis(0.0)
+            .flex_col()
+    })
+}
+
 fn installed_view(plugin: PluginData) -> impl View {
     let ui_line_height = plugin.common.ui_line_height;
     let volts = plugin.installed;
@@ -97,6 +242,11 @@ fn installed_view(plugin: PluginData) -> impl View {
     let internal_command = plugin.common.internal_command;
 
     let view_fn = move |volt: InstalledVoltData, plugin: PluginData| {
+        let has_update = {
+            let plugin = plugin.clone();
+            let volt = volt.clone();
+            move || plugin.has_update(&volt)
+        };
         let meta = volt.meta.get_untracked();
         let volt_id = meta.id();
         let local_volt_id = volt_id.clone();
@@ -142,9 +292,7 @@ fn installed_view(plugin: PluginData) -> impl View {
                                 || workspace_disabled.with(|d| d.contains(&volt_id))
                             {
                                 "Disabled".to_string()
-                            } else if volt.meta.with(|m| {
-                                volt.latest.with(|i| i.version != m.version)
-                            }) {
+                            } else if has_update() {
                                 "Upgrade".to_string()
                             } else {
                                 format!("v{}", volt.meta.with(|m| m.version.clone()))
@@ -174,7 +322,7 @@ fn installed_view(plugin: PluginData) -> impl View {
             ))
             .style(|s| s.flex_col().flex_grow(1.0).flex_basis(0.0).min_width(0.0)),
         ))
-        .on_click_stop(move |_| {
+        .on_activate(move || {
             internal_command.send(InternalCommand::OpenVoltView {
                 volt_id: local_volt_id.clone(),
             });
@@ -235,7 +383,7 @@ fn available_view(plugin: PluginData, core_rpc: CoreRpcHandler) -> impl View {
                 }
             })
             .disabled(move || installed.get() || installing.get())
-            .on_click_stop(move |_| {
+            .on_activate(move || {
                 plugin.install_volt(info.get_untracked());
             })
             .style(move |s| {
@@ -314,7 +462,7 @@ fn available_view(plugin: PluginData, core_rpc: CoreRpcHandler) -> impl View {
             ))
             .style(|s| s.flex_col().flex_grow(1.0).flex_basis(0.0).min_width(0.0)),
         ))
-        .on_click_stop(move |_| {
+        .on_activate(move || {
             internal_command.send(InternalCommand::OpenVoltView {
                 volt_id: volt_id.clone(),
             });
@@ -11,6 +11,16 @@ pub enum PanelPosition {
 }
 
 impl PanelPosition {
+    /// All the positions, clockwise from the top of the left container.
+    pub const ALL: [PanelPosition; 6] = [
+        PanelPosition::LeftTop,
+        PanelPosition::LeftBottom,
+        PanelPosition::BottomLeft,
+        PanelPosition::BottomRight,
+        PanelPosition::RightBottom,
+        PanelPosition::RightTop,
+    ];
+
     pub fn is_bottom(&self) -> bool {
         matches!(self, PanelPosition::BottomLeft | PanelPosition::BottomRight)
     }
@@ -42,6 +52,26 @@ pub fn peer(&self) -> PanelPosition {
             PanelPosition::RightBottom => PanelPosition::RightTop,
         }
     }
+
+    /// The position after this one, going clockwise.
+    pub fn next(&self) -> PanelPosition {
+        let index = Self::ALL.iter().position(|p| p == self).unwrap_or(0);
+        Self::ALL[(index + 1) % Self::ALL.len()]
+    }
+
+    pub fn container(&self) -> PanelContainerPosition {
+        match self {
+            PanelPosition::LeftTop | PanelPosition::LeftBottom => {
+                PanelContainerPosition::Left
+            }
+            PanelPosition::BottomLeft | PanelPosition::BottomRight => {
+                PanelContainerPosition::Bottom
+            }
+            PanelPosition::RightTop | PanelPosition::RightBottom => {
+                PanelContainerPosition::Right
+            }
+        }
+    }
 }
 
 #[derive(Eq, PartialEq, Hash, Clone, Copy, Debug)]
@@ -14,6 +14,7 @@
 
 use super::{data::PanelSection, position::PanelPosition, view::PanelBuilder};
 use crate::{
+    accessibility::KeyboardActivate,
     command::InternalCommand,
     config::{LapceConfig, color::LapceColor, icon::LapceIcons},
     doc::{DiagnosticData, EditorDiagnostic},
@@ -179,7 +180,7 @@ fn file_view(
                 ))
                 .style(move |s| s.width_pct(100.0).min_width(0.0)),
             )
-            .on_click_stop(move |_| {
+            .on_activate(move || {
                 collpased.update(|collpased| *collpased = !*collpased);
             })
             .style(move |s| {
@@ -306,7 +307,7 @@ fn item_view(
                 })
             })
         })
-        .on_click_stop(move |_| {
+        .on_activate(move || {
             internal_command.send(InternalCommand::JumpToLocation {
                 location: location.clone(),
             });
@@ -354,7 +355,7 @@ fn related_view(
                     label(move || message.clone())
                         .style(move |s| s.width_pct(100.0).min_width(0.0)),
                 )
-                .on_click_stop(move |_| {
+                .on_activate(move || {
                     internal_command.send(InternalCommand::JumpToLocation {
                         location: location.clone(),
                     });
@@ -23,6 +23,7 @@
     view::foldable_panel_section,
 };
 use crate::{
+    accessibility::KeyboardActivate,
     command::{CommandKind, InternalCommand, LapceCommand, LapceWorkbenchCommand},
     config::{color::LapceColor, icon::LapceIcons},
     editor::view::editor_view,
@@ -152,7 +153,7 @@ pub fn source_control_panel(
             {
                 let source_control = source_control.clone();
                 label(|| "Commit".to_string())
-                    .on_click_stop(move |_| {
+                    .on_activate(move || {
                         source_control.commit();
                     })
                     .style(move |s| {
@@ -233,7 +234,7 @@ fn file_diffs_view(source_control: SourceControlData) -> impl View {
         stack((
             checkbox(move || checked, config)
                 .style(|s| s.hover(|s| s.cursor(CursorStyle::Pointer)))
-                .on_click_stop(move |_| {
+                .on_activate(move || {
                     file_diffs.update(|diffs| {
                         if let Some((_, checked)) = diffs.get_mut(&full_path) {
                             *checked = !*checked;
@@ -307,7 +308,7 @@ fn file_diffs_view(source_control: SourceControlData) -> impl View {
                     .justify_end()
             }),
         ))
-        .on_click_stop(move |_| {
+        .on_activate(move || {
             internal_command.send(InternalCommand::OpenFileChanges {
                 path: path_for_click.clone(),
             });
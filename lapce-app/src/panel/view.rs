@@ -20,6 +20,8 @@
     debug_view::debug_panel,
     global_search_view::global_search_panel,
     kind::PanelKind,
+    output_view::output_panel,
+    plugin_tree_view::plugin_tree_view_panel,
     plugin_view::plugin_panel,
     position::{PanelContainerPosition, PanelPosition},
     problem_view::problem_panel,
@@ -27,6 +29,7 @@
     terminal_view::terminal_panel,
 };
 use crate::{
+    accessibility::KeyboardActivate,
     app::{clickable_icon, clickable_icon_base},
     config::{LapceConfig, color::LapceColor, icon::LapceIcons},
     file_explorer::view::file_explorer_panel,
@@ -35,6 +38,7 @@
         implementation_view::implementation_panel,
         references_view::references_panel,
     },
+    theme_editor::inspector_overlay,
     window_tab::{DragContent, WindowTabData},
 };
 
@@ -68,7 +72,7 @@ pub fn foldable_panel_section(
                 .cursor(CursorStyle::Pointer)
                 .background(config.get().color(LapceColor::EDITOR_BACKGROUND))
         })
-        .on_click_stop(move |_| {
+        .on_activate(move || {
             open.update(|open| *open = !*open);
         }),
         child.style(move |s| s.apply_if(!open.get(), |s| s.hide())),
@@ -393,6 +397,7 @@ pub fn panel_container_view(
     };
 
     let is_bottom = position.is_bottom();
+    let theme_inspector = window_tab_data.common.theme_inspector;
     stack((
         panel_picker(window_tab_data.clone(), position.first()),
         panel_view(window_tab_data.clone(), position.first()),
@@ -408,6 +413,7 @@ pub fn panel_container_view(
                     .apply_if(!is_dragging_panel, |s| s.pointer_events_none())
             },
         ),
+        inspector_overlay(theme_inspector, |_| LapceColor::PANEL_BACKGROUND),
     ))
     .on_resize(move |rect| {
         let size = rect.size();
@@ -507,6 +513,13 @@ fn panel_view(
                     implementation_panel(window_tab_data.clone(), position)
                         .into_any()
                 }
+                PanelKind::PluginViews => {
+                    plugin_tree_view_panel(window_tab_data.clone(), position)
+                        .into_any()
+                }
+                PanelKind::Output => {
+                    output_panel(window_tab_data.clone(), position).into_any()
+                }
             };
             view.style(|s| s.size_pct(100.0, 100.0))
         },
@@ -551,20 +564,15 @@ fn panel_picker(
         |p| *p,
         move |p| {
             let window_tab_data = window_tab_data.clone();
-            let tooltip = match p {
-                PanelKind::Terminal => "Terminal",
-                PanelKind::FileExplorer => "File Explorer",
-                PanelKind::SourceControl => "Source Control",
-                PanelKind::Plugin => "Plugins",
-                PanelKind::Search => "Search",
-                PanelKind::Problem => "Problems",
-                PanelKind::Debug => "Debug",
-                PanelKind::CallHierarchy => "Call Hierarchy",
-                PanelKind::DocumentSymbol => "Document Symbol",
-                PanelKind::References => "References",
-                PanelKind::Implementation => "Implementation",
-            };
+            let tooltip = p.title();
             let icon = p.svg_name();
+            let badge = {
+                let plugin = window_tab_data.plugin.clone();
+                move || match p {
+                    PanelKind::Plugin => plugin.updates().len(),
+                    _ => 0,
+                }
+            };
             let is_active = {
                 let window_tab_data = window_tab_data.clone();
                 move || {
@@ -634,6 +642,32 @@ fn panel_picker(
                                 .color(LapceColor::LAPCE_TAB_ACTIVE_UNDERLINE),
                         )
                 }),
+                label({
+                    let badge = badge.clone();
+                    move || badge().to_string()
+                })
+                .style(move |s| {
+                    let config = config.get();
+                    s.selectable(false)
+                        .pointer_events_none()
+                        .absolute()
+                        .inset_top(-2.0)
+                        .inset_right(-4.0)
+                        .padding_horiz(3.0)
+                        .min_width(12.0)
+                        .justify_center()
+                        .border_radius(6.0)
+                        .font_size((config.ui.font_size() as f32 * 0.7).max(8.0))
+                        .color(
+                            config
+                                .color(LapceColor::LAPCE_BUTTON_PRIMARY_FOREGROUND),
+                        )
+                        .background(
+                            config
+                                .color(LapceColor::LAPCE_BUTTON_PRIMARY_BACKGROUND),
+                        )
+                        .apply_if(badge() == 0, |s| s.hide())
+                }),
             )))
             .style(|s| s.padding(6.0))
         },
@@ -1,13 +1,15 @@
 use std::{
     collections::HashSet,
+    path::PathBuf,
     rc::Rc,
     sync::{Arc, atomic::AtomicU64},
+    time::Duration,
 };
 
 use anyhow::Result;
 use floem::{
     IntoView, View,
-    action::show_context_menu,
+    action::{exec_after, show_context_menu},
     ext_event::create_ext_action,
     keyboard::Modifiers,
     kurbo::Rect,
@@ -24,28 +26,45 @@
 };
 use indexmap::IndexMap;
 use lapce_core::{command::EditCommand, directory::Directory, mode::Mode};
-use lapce_proxy::plugin::{download_volt, volt_icon, wasi::find_all_volts};
+use lapce_proxy::plugin::{
+    download_volt, install_volt_from_path,
+    registry::{self, Registry, RegistryCursor},
+    volt_icon,
+    wasi::find_all_volts,
+};
 use lapce_rpc::{
     core::{CoreNotification, CoreRpcHandler},
-    plugin::{VoltID, VoltInfo, VoltMetadata},
+    plugin::{
+        PluginCommand, PluginTreeView, StatusBarItem, VoltID, VoltInfo, VoltMetadata,
+    },
+    proxy::ProxyResponse,
 };
 use lsp_types::MessageType;
-use serde::{Deserialize, Serialize};
+use serde_json::Value;
 use sha2::{Digest, Sha256};
 
 use crate::{
-    command::{CommandExecuted, CommandKind},
+    alert::AlertButton,
+    command::{CommandExecuted, CommandKind, InternalCommand},
     config::{LapceConfig, color::LapceColor},
     db::LapceDb,
     editor::EditorData,
     keypress::{KeyPressFocus, condition::Condition},
     main_split::Editors,
     markdown::{MarkdownContent, parse_markdown},
-    panel::plugin_view::VOLT_DEFAULT_PNG,
+    panel::{
+        plugin_tree_view::PluginTreeViewData,
+        plugin_view::{VOLT_DEFAULT_PNG, primary_button_style},
+    },
+    settings_sync::VoltChanges,
     web_link::web_link,
     window_tab::CommonData,
 };
 
+/// How long after startup the first plugin update check runs, which leaves
+/// time for the proxy to report the volts it loaded.
+const FIRST_UPDATE_CHECK_DELAY: Duration = Duration::from_secs(10);
+
 type PluginInfo = Option<(
     Option<VoltMetadata>,
     VoltInfo,
@@ -70,17 +89,12 @@ pub fn from_bytes(buf: &[u8]) -> Result<Self> {
     }
 }
 
-#[derive(Deserialize, Serialize)]
-pub struct VoltsInfo {
-    pub plugins: Vec<VoltInfo>,
-    pub total: usize,
-}
-
 #[derive(Clone)]
 pub struct InstalledVoltData {
     pub meta: RwSignal<VoltMetadata>,
     pub icon: RwSignal<Option<VoltIcon>>,
     pub latest: RwSignal<VoltInfo>,
+    pub updating: RwSignal<bool>,
 }
 
 #[derive(Clone, PartialEq)]
@@ -96,7 +110,8 @@ pub struct AvailableVoltList {
     pub query_id: RwSignal<usize>,
     pub query_editor: EditorData,
     pub volts: RwSignal<IndexMap<VoltID, AvailableVoltData>>,
-    pub total: RwSignal<usize>,
+    /// One cursor per configured registry, in priority order.
+    pub cursors: RwSignal<Vec<RegistryCursor>>,
 }
 
 #[derive(Clone, Debug)]
@@ -106,6 +121,15 @@ pub struct PluginData {
     pub all: RwSignal<im::HashMap<VoltID, AvailableVoltData>>,
     pub disabled: RwSignal<HashSet<VoltID>>,
     pub workspace_disabled: RwSignal<HashSet<VoltID>>,
+    /// Volts kept at their installed version, which update checks skip.
+    pub pinned: RwSignal<HashSet<VoltID>>,
+    /// Status bar items created by running volts.
+    pub status_items: RwSignal<Vec<(VoltID, StatusBarItem)>>,
+    /// Trees registered by running volts, shown in the plugin views panel.
+    pub tree_views: RwSignal<Vec<PluginTreeViewData>>,
+    /// Volts waiting for the user to approve their permissions, all asked
+    /// about in the same alert.
+    pub permission_requests: RwSignal<Vec<VoltMetadata>>,
     pub common: Rc<CommonData>,
 }
 
@@ -145,6 +169,7 @@ fn run_command(
                     .run_command(command, count, mods);
             }
             CommandKind::MotionMode(_) => {}
+            CommandKind::Plugin(_) => {}
         }
         CommandExecuted::No
     }
@@ -167,12 +192,16 @@ pub fn new(
         let available = AvailableVoltList {
             loading: cx.create_rw_signal(false),
             volts: cx.create_rw_signal(IndexMap::new()),
-            total: cx.create_rw_signal(0),
+            cursors: cx.create_rw_signal(Vec::new()),
             query_id: cx.create_rw_signal(0),
             query_editor: editors.make_local(cx, common.clone()),
         };
         let disabled = cx.create_rw_signal(disabled);
         let workspace_disabled = cx.create_rw_signal(workspace_disabled);
+        let db: Arc<LapceDb> = use_context().unwrap();
+        let pinned = cx.create_rw_signal(HashSet::from_iter(
+            db.get_pinned_volts().unwrap_or_default(),
+        ));
 
         let plugin = Self {
             installed,
@@ -180,10 +209,15 @@ pub fn new(
             all: cx.create_rw_signal(im::HashMap::new()),
             disabled,
             workspace_disabled,
+            pinned,
+            status_items: cx.create_rw_signal(Vec::new()),
+            tree_views: cx.create_rw_signal(Vec::new()),
+            permission_requests: cx.create_rw_signal(Vec::new()),
             common,
         };
 
-        plugin.load_available_volts("", 0, core_rpc.clone());
+        plugin.load_available_volts("", core_rpc.clone());
+        plugin.start_update_checks();
 
         {
             let plugin = plugin.clone();
@@ -233,7 +267,8 @@ pub fn new(
                 plugin.available.query_id.update(|id| *id += 1);
                 plugin.available.loading.set(false);
                 plugin.available.volts.update(|v| v.clear());
-                plugin.load_available_volts(&query, 0, core_rpc.clone());
+                plugin.available.cursors.update(|c| c.clear());
+                plugin.load_available_volts(&query, core_rpc.clone());
                 query
             });
         }
@@ -267,6 +302,7 @@ pub fn volt_installed(&self, volt: &VoltMetadata, icon: &Option<Vec<u8>>) {
                                 .and_then(|icon| VoltIcon::from_bytes(icon).ok()),
                         ),
                         latest,
+                        updating: self.common.scope.create_rw_signal(false),
                     };
                     installed.insert(volt_id, data.clone());
 
@@ -276,6 +312,7 @@ pub fn volt_installed(&self, volt: &VoltMetadata, icon: &Option<Vec<u8>>) {
             .unwrap();
 
         if existing {
+            volt_data.updating.set(false);
             volt_data.meta.set(volt.clone());
             volt_data.icon.set(
                 icon.as_ref()
@@ -285,26 +322,341 @@ pub fn volt_installed(&self, volt: &VoltMetadata, icon: &Option<Vec<u8>>) {
 
         let latest = volt_data.latest;
         if !is_latest {
-            let url = format!(
-                "https://plugins.lapce.dev/api/v1/plugins/{}/{}/latest",
-                volt.author, volt.name
-            );
+            let registries = self.registries();
+            let id = volt.id();
             let send = create_ext_action(self.common.scope, move |info| {
                 if let Some(info) = info {
                     latest.set(info);
                 }
             });
             std::thread::spawn(move || {
-                let info: Option<VoltInfo> = lapce_proxy::get_url(url, None)
-                    .ok()
-                    .and_then(|r| r.json().ok());
-                send(info);
+                send(registry::latest_volt(&registries, &id));
             });
         }
     }
 
+    /// The configured plugin registries, in priority order.
+    pub fn registries(&self) -> Vec<Registry> {
+        registry::registries(
+            &self.common.config.get_untracked().core.plugin_registries,
+        )
+    }
+
+    /// Called when installing or updating a volt failed.
+    pub fn volt_installing(&self, volt: &VoltInfo) {
+        let id = volt.id();
+        self.available.volts.with_untracked(|volts| {
+            if let Some(volt) = volts.get(&id) {
+                volt.installing.set(false);
+            }
+        });
+        self.installed.with_untracked(|installed| {
+            if let Some(volt) = installed.get(&id) {
+                volt.updating.set(false);
+            }
+        });
+    }
+
+    pub fn command_registered(&self, command: PluginCommand) {
+        self.common.keypress.update(|keypress| {
+            keypress.add_plugin_command(command);
+        });
+    }
+
+    pub fn status_bar_item(&self, volt: VoltID, item: StatusBarItem) {
+        self.status_items.update(|items| {
+            if let Some((_, existing)) = items
+                .iter_mut()
+                .find(|(v, i)| v == &volt && i.id == item.id)
+            {
+                *existing = item;
+            } else {
+                items.push((volt, item));
+            }
+        });
+    }
+
+    pub fn status_bar_item_disposed(&self, volt: &VoltID, id: &str) {
+        self.status_items.update(|items| {
+            items.retain(|(v, i)| v != volt || i.id != id);
+        });
+    }
+
+    pub fn tree_view_registered(&self, view: PluginTreeView) {
+        let cx = self.common.scope;
+        self.tree_views.update(|views| {
+            views.retain(|v| v.view.volt != view.volt || v.view.id != view.id);
+            views.push(PluginTreeViewData::new(cx, view));
+        });
+    }
+
+    pub fn tree_view_refresh(&self, volt: &VoltID, view: &str, node: Option<&str>) {
+        let view = self.tree_views.with_untracked(|views| {
+            views
+                .iter()
+                .find(|v| &v.view.volt == volt && v.view.id == view)
+                .cloned()
+        });
+        if let Some(view) = view {
+            view.refresh(self.common.scope, &self.common.proxy, node);
+        }
+    }
+
+    /// Removes the commands, status bar items and tree views of a volt that
+    /// stopped running. They're registered again when it starts.
+    fn clear_contributions(&self, volt: &VoltID) {
+        self.common.keypress.update(|keypress| {
+            keypress.remove_plugin_commands(volt);
+        });
+        self.status_items.update(|items| {
+            items.retain(|(v, _)| v != volt);
+        });
+        self.tree_views.update(|views| {
+            views.retain(|v| &v.view.volt != volt);
+        });
+    }
+
+    /// Runs a command by the name it's bound with in keymaps, which can be
+    /// a built in command or one registered by a volt.
+    pub fn run_command_by_name(&self, command: &str, data: Option<Value>) {
+        let cmd = self
+            .common
+            .keypress
+            .with_untracked(|keypress| keypress.commands.get(command).cloned());
+        if let Some(mut cmd) = cmd {
+            cmd.data = data;
+            self.common.lapce_command.send(cmd);
+        }
+    }
+
+    /// Asks the user to approve the permissions a volt needs before the
+    /// proxy starts it, along with the other volts still waiting for theirs,
+    /// as there's only one alert at a time.
+    pub fn volt_permissions_requested(&self, volt: VoltMetadata) {
+        let id = volt.id();
+        self.permission_requests.update(|requests| {
+            requests.retain(|v| v.id() != id);
+            requests.push(volt);
+        });
+        self.show_permission_requests();
+    }
+
+    fn show_permission_requests(&self) {
+        let internal_command = self.common.internal_command;
+        let requests = self.permission_requests.get_untracked();
+        if requests.is_empty() {
+            internal_command.send(InternalCommand::HideAlert);
+            return;
+        }
+
+        let msg = requests
+            .iter()
+            .map(|volt| {
+                let permissions = volt
+                    .requested_permissions()
+                    .descriptions()
+                    .into_iter()
+                    .map(|d| format!("• {d}"))
+                    .collect::<Vec<_>>()
+                    .join("\n");
+                if volt.permissions.is_none() {
+                    format!(
+                        "{} doesn't declare its permissions, so it asks for \
+                         full access:\n{permissions}",
+                        volt.display_name
+                    )
+                } else {
+                    format!("{} asks for:\n{permissions}", volt.display_name)
+                }
+            })
+            .collect::<Vec<_>>()
+            .join("\n\n");
+        let title = match requests.as_slice() {
+            [volt] => format!("Allow {} to run?", volt.display_name),
+            _ => format!("Allow {} plugins to run?", requests.len()),
+        };
+
+        let mut buttons = Vec::new();
+        if requests.len() > 1 {
+            let plugin = self.clone();
+            let volts = requests.clone();
+            buttons.push(AlertButton {
+                text: "Allow All".to_string(),
+                action: Rc::new(move || {
+                    for volt in &volts {
+                        plugin.grant_requested_permissions(volt);
+                    }
+                    plugin.show_permission_requests();
+                }),
+            });
+        }
+        for volt in requests {
+            let plugin = self.clone();
+            buttons.push(AlertButton {
+                text: format!("Allow {}", volt.display_name),
+                action: Rc::new(move || {
+                    plugin.grant_requested_permissions(&volt);
+                    plugin.show_permission_requests();
+                }),
+            });
+        }
+
+        internal_command.send(InternalCommand::ShowAlert {
+            title,
+            msg: format!(
+                "{msg}\n\nThey won't run until you allow them. This can be \
+                 changed later on each plugin's page."
+            ),
+            buttons,
+        });
+    }
+
+    fn grant_requested_permissions(&self, volt: &VoltMetadata) {
+        let id = volt.id();
+        self.permission_requests.update(|requests| {
+            requests.retain(|v| v.id() != id);
+        });
+        self.common.proxy.grant_volt_permissions(volt.clone());
+    }
+
+    /// Whether the registry has a newer version of an installed volt that
+    /// isn't pinned.
+    pub fn has_update(&self, volt: &InstalledVoltData) -> bool {
+        let id = volt.meta.with(|m| m.id());
+        !self.pinned.with(|p| p.contains(&id))
+            && volt
+                .meta
+                .with(|m| volt.latest.with(|l| is_newer(&l.version, &m.version)))
+    }
+
+    /// The installed volts that have an update available.
+    pub fn updates(&self) -> IndexMap<VoltID, InstalledVoltData> {
+        self.installed.with(|installed| {
+            installed
+                .iter()
+                .filter(|(_, volt)| self.has_update(volt))
+                .map(|(id, volt)| (id.clone(), volt.clone()))
+                .collect()
+        })
+    }
+
+    /// Checks for updates soon after startup, then every
+    /// `plugin-update-check-interval` minutes.
+    fn start_update_checks(&self) {
+        let plugin = self.clone();
+        exec_after(FIRST_UPDATE_CHECK_DELAY, move |_| {
+            // The window tab has been closed
+            let Some(config) = plugin.common.config.try_get_untracked() else {
+                return;
+            };
+            if config.core.plugin_update_check_interval > 0 {
+                plugin.check_updates();
+            }
+            plugin.schedule_update_check();
+        });
+    }
+
+    fn schedule_update_check(&self) {
+        // The window tab has been closed
+        let Some(config) = self.common.config.try_get_untracked() else {
+            return;
+        };
+        let interval = config.core.plugin_update_check_interval;
+        if interval == 0 {
+            // Check again later in case the setting gets changed
+            let plugin = self.clone();
+            exec_after(Duration::from_secs(60), move |_| {
+                plugin.schedule_update_check();
+            });
+            return;
+        }
+
+        let plugin = self.clone();
+        exec_after(Duration::from_secs(interval * 60), move |_| {
+            plugin.check_updates();
+            plugin.schedule_update_check();
+        });
+    }
+
+    /// Asks the registries for the latest version of every installed volt
+    /// that isn't pinned.
+    pub fn check_updates(&self) {
+        let ids: Vec<VoltID> = self.installed.with_untracked(|installed| {
+            installed
+                .keys()
+                .filter(|id| !self.pinned.with_untracked(|p| p.contains(id)))
+                .cloned()
+                .collect()
+        });
+        if ids.is_empty() {
+            return;
+        }
+
+        let installed = self.installed;
+        let send = create_ext_action(
+            self.common.scope,
+            move |latest: Vec<(VoltID, VoltInfo)>| {
+                installed.with_untracked(|installed| {
+                    for (id, info) in latest {
+                        if let Some(volt) = installed.get(&id) {
+                            volt.latest.set(info);
+                        }
+                    }
+                });
+            },
+        );
+        let registries = self.registries();
+        std::thread::spawn(move || {
+            let latest = ids
+                .into_iter()
+                .filter_map(|id| {
+                    let info = registry::latest_volt(&registries, &id)?;
+                    Some((id, info))
+                })
+                .collect();
+            send(latest);
+        });
+    }
+
+    pub fn update_volt(&self, volt: &InstalledVoltData) {
+        if volt.updating.get_untracked() {
+            return;
+        }
+        volt.updating.set(true);
+        self.install_volt(volt.latest.get_untracked());
+    }
+
+    pub fn update_all(&self) {
+        for volt in self.updates().values() {
+            self.update_volt(volt);
+        }
+    }
+
+    pub fn pin_volt(&self, id: VoltID) {
+        self.pinned.update(|p| {
+            p.insert(id);
+        });
+        self.save_pinned();
+    }
+
+    pub fn unpin_volt(&self, id: &VoltID) {
+        self.pinned.update(|p| {
+            p.remove(id);
+        });
+        self.save_pinned();
+    }
+
+    fn save_pinned(&self) {
+        let db: Arc<LapceDb> = use_context().unwrap();
+        db.save_pinned_volts(self.pinned.get_untracked().into_iter().collect());
+    }
+
     pub fn volt_removed(&self, volt: &VoltInfo) {
         let id = volt.id();
+        self.clear_contributions(&id);
+        self.permission_requests.update(|requests| {
+            requests.retain(|v| v.id() != id);
+        });
         self.installed.update(|installed| {
             installed.swap_remove(&id);
         });
@@ -334,86 +686,93 @@ pub fn volt_removed(&self, volt: &VoltInfo) {
         }
     }
 
-    fn load_available_volts(
-        &self,
-        query: &str,
-        offset: usize,
-        core_rpc: CoreRpcHandler,
-    ) {
+    fn load_available_volts(&self, query: &str, core_rpc: CoreRpcHandler) {
         if self.available.loading.get_untracked() {
             return;
         }
         self.available.loading.set(true);
 
         let volts = self.available.volts;
-        let volts_total = self.available.total;
+        let cursors = self.available.cursors;
         let cx = self.common.scope;
         let loading = self.available.loading;
         let query_id = self.available.query_id;
         let current_query_id = self.available.query_id.get_untracked();
         let all = self.all;
-        let send =
-            create_ext_action(self.common.scope, move |new: Result<VoltsInfo>| {
+        let send = create_ext_action(
+            self.common.scope,
+            move |(new, new_cursors, errors): (
+                Vec<VoltInfo>,
+                Vec<RegistryCursor>,
+                Vec<anyhow::Error>,
+            )| {
                 loading.set(false);
                 if query_id.get_untracked() != current_query_id {
                     return;
                 }
 
-                match new {
-                    Ok(new) => {
-                        volts.update(|volts| {
-                            volts.extend(new.plugins.into_iter().map(|volt| {
-                                let icon = cx.create_rw_signal(None);
-                                let send = create_ext_action(cx, move |result| {
-                                    if let Ok(i) = result {
-                                        icon.set(Some(i));
-                                    }
-                                });
-                                {
-                                    let volt = volt.clone();
-                                    std::thread::spawn(move || {
-                                        let result = Self::load_icon(&volt);
-                                        send(result);
-                                    });
-                                }
-
-                                let data = AvailableVoltData {
-                                    info: cx.create_rw_signal(volt.clone()),
-                                    icon,
-                                    installing: cx.create_rw_signal(false),
-                                };
-                                all.update(|all| {
-                                    all.insert(volt.id(), data.clone());
-                                });
+                for err in errors {
+                    tracing::error!("{:?}", err);
+                    core_rpc.notification(CoreNotification::ShowMessage {
+                        title: "Request Available Plugins".to_string(),
+                        message: lsp_types::ShowMessageParams {
+                            typ: MessageType::ERROR,
+                            message: err.to_string(),
+                        },
+                    });
+                }
 
-                                (volt.id(), data)
-                            }));
+                volts.update(|volts| {
+                    for volt in new {
+                        // A higher priority registry already provided this volt
+                        if volts.contains_key(&volt.id()) {
+                            continue;
+                        }
+
+                        let icon = cx.create_rw_signal(None);
+                        let send = create_ext_action(cx, move |result| {
+                            if let Ok(i) = result {
+                                icon.set(Some(i));
+                            }
                         });
-                        volts_total.set(new.total);
-                    }
-                    Err(err) => {
-                        tracing::error!("{:?}", err);
-                        core_rpc.notification(CoreNotification::ShowMessage {
-                            title: "Request Available Plugins".to_string(),
-                            message: lsp_types::ShowMessageParams {
-                                typ: MessageType::ERROR,
-                                message: err.to_string(),
-                            },
+                        {
+                            let volt = volt.clone();
+                            std::thread::spawn(move || {
+                                let result = Self::load_icon(&volt);
+                                send(result);
+                            });
+                        }
+
+                        let data = AvailableVoltData {
+                            info: cx.create_rw_signal(volt.clone()),
+                            icon,
+                            installing: cx.create_rw_signal(false),
+                        };
+                        all.update(|all| {
+                            all.insert(volt.id(), data.clone());
                         });
+
+                        volts.insert(volt.id(), data);
                     }
-                }
-            });
+                });
+                cursors.set(new_cursors);
+            },
+        );
 
         let query = query.to_string();
+        let registries = self.registries();
+        let mut cursors = self.available.cursors.get_untracked();
         std::thread::spawn(move || {
-            let volts = Self::query_volts(&query, offset);
-            send(volts);
+            let (volts, errors) =
+                registry::query_registries(&registries, &query, &mut cursors);
+            send((volts, cursors, errors));
         });
     }
 
     fn load_icon(volt: &VoltInfo) -> Result<VoltIcon> {
+        let registry = Registry::of_volt(volt);
         let url = format!(
-            "https://plugins.lapce.dev/api/v1/plugins/{}/{}/{}/icon?id={}",
+            "{registry}/{}/{}/{}/icon?id={}",
             volt.author, volt.name, volt.version, volt.updated_at_ts
         );
 
@@ -430,11 +789,7 @@ fn load_icon(volt: &VoltInfo) -> Result<VoltIcon> {
         let content = match cache_content {
             Some(content) => content,
             None => {
-                let resp = lapce_proxy::get_url(&url, None)?;
-                if !resp.status().is_success() {
-                    return Err(anyhow::anyhow!("can't download icon"));
-                }
-                let buf = resp.bytes()?.to_vec();
+                let buf = registry.icon(volt)?;
 
                 if let Some(path) = cache_file_path.as_ref() {
                     if let Err(err) = std::fs::write(path, &buf) {
@@ -453,31 +808,17 @@ fn download_readme(
         volt: &VoltInfo,
         config: &LapceConfig,
     ) -> Result<Vec<MarkdownContent>> {
-        let url = format!(
-            "https://plugins.lapce.dev/api/v1/plugins/{}/{}/{}/readme",
-            volt.author, volt.name, volt.version
-        );
-        let resp = lapce_proxy::get_url(&url, None)?;
-        if resp.status() != 200 {
-            let text = parse_markdown("Plugin doesn't have a README", 2.0, config);
-            return Ok(text);
-        }
-        let text = resp.text()?;
+        let text = Registry::of_volt(volt)
+            .readme(volt)?
+            .unwrap_or_else(|| "Plugin doesn't have a README".to_string());
         let text = parse_markdown(&text, 2.0, config);
         Ok(text)
     }
 
-    fn query_volts(query: &str, offset: usize) -> Result<VoltsInfo> {
-        let url = format!(
-            "https://plugins.lapce.dev/api/v1/plugins?q={query}&offset={offset}"
-        );
-        let plugins: VoltsInfo = lapce_proxy::get_url(url, None)?.json()?;
-        Ok(plugins)
-    }
-
     fn all_loaded(&self) -> bool {
-        self.available.volts.with_untracked(|v| v.len())
-            >= self.available.total.get_untracked()
+        self.available.cursors.with_untracked(|cursors| {
+            !cursors.is_empty() && cursors.iter().all(|c| c.is_done())
+        })
     }
 
     pub fn load_more_available(&self, core_rpc: CoreRpcHandler) {
@@ -491,8 +832,7 @@ pub fn load_more_available(&self, core_rpc: CoreRpcHandler) {
             .doc()
             .buffer
             .with_untracked(|buffer| buffer.to_string());
-        let offset = self.available.volts.with_untracked(|v| v.len());
-        self.load_available_volts(&query, offset, core_rpc);
+        self.load_available_volts(&query, core_rpc);
     }
 
     pub fn install_volt(&self, info: VoltInfo) {
@@ -505,23 +845,125 @@ pub fn install_volt(&self, info: VoltInfo) {
             self.common.proxy.install_volt(info);
         } else {
             let plugin = self.clone();
-            let send = create_ext_action(self.common.scope, move |result| {
-                if let Ok((meta, icon)) = result {
-                    plugin.volt_installed(&meta, &icon);
-                }
-            });
+            let local_info = info.clone();
+            let send = create_ext_action(
+                self.common.scope,
+                move |result: Result<Vec<(VoltMetadata, Option<Vec<u8>>)>>| {
+                    match result {
+                        Ok(installed) => plugin.volts_installed(installed),
+                        Err(err) => {
+                            tracing::error!("{:?}", err);
+                            plugin.volt_installing(&local_info);
+                            plugin.common.internal_command.send(
+                                InternalCommand::ShowAlert {
+                                    title: format!(
+                                        "Install {}",
+                                        local_info.display_name
+                                    ),
+                                    msg: err.to_string(),
+                                    buttons: Vec::new(),
+                                },
+                            );
+                        }
+                    }
+                },
+            );
             std::thread::spawn(move || {
-                let download = || -> Result<(VoltMetadata, Option<Vec<u8>>)> {
-                    let download_volt_result = download_volt(&info);
-                    let meta = download_volt_result?;
-                    let icon = volt_icon(&meta);
-                    Ok((meta, icon))
-                };
-                send(download());
+                send(download_volt(&info).map(with_icons));
             });
         }
     }
 
+    /// Shows volts that were installed together, the ones the last needs
+    /// first, and starts them unless they're disabled.
+    fn volts_installed(&self, installed: Vec<(VoltMetadata, Option<Vec<u8>>)>) {
+        for (meta, icon) in installed {
+            self.volt_installed(&meta, &icon);
+            if meta.wasm.is_some() && !self.plugin_disabled(&meta.id()) {
+                self.reload_volt(meta);
+            }
+        }
+    }
+
+    /// Install a volt from a local `.volt` archive or an unpacked volt directory.
+    pub fn install_volt_from_path(&self, path: PathBuf, core_rpc: CoreRpcHandler) {
+        let plugin = self.clone();
+        let send = create_ext_action(
+            self.common.scope,
+            move |result: Result<Vec<(VoltMetadata, Option<Vec<u8>>)>>| match result
+            {
+                Ok(installed) => plugin.volts_installed(installed),
+                Err(err) => {
+                    tracing::error!("{:?}", err);
+                    core_rpc.notification(CoreNotification::ShowMessage {
+                        title: "Install Plugin".to_string(),
+                        message: lsp_types::ShowMessageParams {
+                            typ: MessageType::ERROR,
+                            message: err.to_string(),
+                        },
+                    });
+                }
+            },
+        );
+        let registries = self.registries();
+        std::thread::spawn(move || {
+            send(install_volt_from_path(&path, &registries).map(with_icons));
+        });
+    }
+
+    /// The display names of the installed volts that depend on or bundle
+    /// the volt `id`.
+    pub fn dependents(&self, id: &VoltID) -> Vec<String> {
+        self.installed.with_untracked(|installed| {
+            installed
+                .iter()
+                .filter(|(other, _)| *other != id)
+                .filter_map(|(_, volt)| {
+                    volt.meta.with_untracked(|meta| {
+                        meta.requires(id).then(|| meta.display_name.clone())
+                    })
+                })
+                .collect()
+        })
+    }
+
+    /// Runs `action` right away if no installed volt needs the volt, and
+    /// otherwise only once the user confirms it in an alert listing the
+    /// volts that need it.
+    fn confirm_dependents(
+        &self,
+        volt: &VoltInfo,
+        verb: &str,
+        action: impl Fn() + 'static,
+    ) {
+        let dependents = self.dependents(&volt.id());
+        if dependents.is_empty() {
+            action();
+            return;
+        }
+
+        let dependents = dependents
+            .iter()
+            .map(|d| format!("• {d}"))
+            .collect::<Vec<_>>()
+            .join("\n");
+        let internal_command = self.common.internal_command;
+        internal_command.send(InternalCommand::ShowAlert {
+            title: format!("{verb} {}?", volt.display_name),
+            msg: format!(
+                "These plugins need {} and may stop working:\n{dependents}",
+                volt.display_name
+            ),
+            buttons: vec![AlertButton {
+                text: verb.to_string(),
+                action: Rc::new(move || {
+                    internal_command.send(InternalCommand::HideAlert);
+                    action();
+                }),
+            }],
+        });
+    }
+
     pub fn plugin_disabled(&self, id: &VoltID) -> bool {
         self.disabled.with_untracked(|d| d.contains(id))
             || self.workspace_disabled.with_untracked(|d| d.contains(id))
@@ -541,6 +983,7 @@ pub fn enable_volt(&self, volt: VoltInfo) {
 
     pub fn disable_volt(&self, volt: VoltInfo) {
         let id = volt.id();
+        self.clear_contributions(&id);
         self.disabled.update(|d| {
             d.insert(id);
         });
@@ -566,6 +1009,7 @@ pub fn enable_volt_for_ws(&self, volt: VoltInfo) {
 
     pub fn disable_volt_for_ws(&self, volt: VoltInfo) {
         let id = volt.id();
+        self.clear_contributions(&id);
         self.workspace_disabled.update(|d| {
             d.insert(id);
         });
@@ -604,13 +1048,69 @@ pub fn uninstall_volt(&self, volt: VoltMetadata) {
     }
 
     pub fn reload_volt(&self, volt: VoltMetadata) {
+        self.clear_contributions(&volt.id());
         self.common.proxy.reload_volt(volt);
     }
 
+    /// Installs, removes, disables and pins volts to match the lists pulled
+    /// by settings sync.
+    pub fn apply_synced_volts(&self, changes: VoltChanges) {
+        let installed = self.installed.get_untracked();
+        for id in &changes.uninstall {
+            if let Some(volt) = installed.get(id) {
+                self.uninstall_volt(volt.meta.get_untracked());
+            }
+        }
+        for (id, volt) in &installed {
+            let disabled = changes.disabled.contains(id);
+            if disabled != self.disabled.with_untracked(|d| d.contains(id)) {
+                let info = volt.meta.get_untracked().info();
+                if disabled {
+                    self.disable_volt(info);
+                } else {
+                    self.enable_volt(info);
+                }
+            }
+        }
+        // Keep the state of the volts that aren't installed yet
+        self.disabled.set(changes.disabled);
+        let db: Arc<LapceDb> = use_context().unwrap();
+        db.save_disabled_volts(self.disabled.get_untracked().into_iter().collect());
+        self.pinned.set(changes.pinned);
+        self.save_pinned();
+
+        if changes.install.is_empty() {
+            return;
+        }
+        let plugin = self.clone();
+        let send =
+            create_ext_action(self.common.scope, move |volts: Vec<VoltInfo>| {
+                for info in volts {
+                    plugin.install_volt(info);
+                }
+            });
+        let registries = self.registries();
+        std::thread::spawn(move || {
+            let volts = changes
+                .install
+                .iter()
+                .filter_map(|id| {
+                    let info = registry::latest_volt(&registries, id);
+                    if info.is_none() {
+                        tracing::error!("Synced volt {id} isn't in any registry");
+                    }
+                    info
+                })
+                .collect();
+            send(volts);
+        });
+    }
+
     pub fn plugin_controls(&self, meta: VoltMetadata, latest: VoltInfo) -> Menu {
         let volt_id = meta.id();
+        let pinned = self.pinned.with_untracked(|p| p.contains(&volt_id));
         let mut menu = Menu::new("");
-        if meta.version != latest.version {
+        if !pinned && is_newer(&latest.version, &meta.version) {
             menu = menu
                 .entry(MenuItem::new("Upgrade Plugin").action({
                     let plugin = self.clone();
@@ -621,6 +1121,25 @@ pub fn plugin_controls(&self, meta: VoltMetadata, latest: VoltInfo) -> Menu {
                 }))
                 .separator();
         }
+        menu = menu
+            .entry(if pinned {
+                MenuItem::new("Unpin Version").action({
+                    let plugin = self.clone();
+                    let volt_id = volt_id.clone();
+                    move || {
+                        plugin.unpin_volt(&volt_id);
+                    }
+                })
+            } else {
+                MenuItem::new("Pin Version").action({
+                    let plugin = self.clone();
+                    let volt_id = volt_id.clone();
+                    move || {
+                        plugin.pin_volt(volt_id.clone());
+                    }
+                })
+            })
+            .separator();
         menu = menu
             .entry(MenuItem::new("Reload Plugin").action({
                 let plugin = self.clone();
@@ -654,7 +1173,11 @@ pub fn plugin_controls(&self, meta: VoltMetadata, latest: VoltInfo) -> Menu {
                         let plugin = self.clone();
                         let volt = meta.info();
                         move || {
-                            plugin.disable_volt(volt.clone());
+                            let local_plugin = plugin.clone();
+                            let local_volt = volt.clone();
+                            plugin.confirm_dependents(&volt, "Disable", move || {
+                                local_plugin.disable_volt(local_volt.clone());
+                            });
                         }
                     }),
             )
@@ -683,7 +1206,11 @@ pub fn plugin_controls(&self, meta: VoltMetadata, latest: VoltInfo) -> Menu {
                         let plugin = self.clone();
                         let volt = meta.info();
                         move || {
-                            plugin.disable_volt_for_ws(volt.clone());
+                            let local_plugin = plugin.clone();
+                            let local_volt = volt.clone();
+                            plugin.confirm_dependents(&volt, "Disable", move || {
+                                local_plugin.disable_volt_for_ws(local_volt.clone());
+                            });
                         }
                     }),
             )
@@ -691,19 +1218,128 @@ pub fn plugin_controls(&self, meta: VoltMetadata, latest: VoltInfo) -> Menu {
             .entry(MenuItem::new("Uninstall").action({
                 let plugin = self.clone();
                 move || {
-                    plugin.uninstall_volt(meta.clone());
+                    let local_plugin = plugin.clone();
+                    let local_meta = meta.clone();
+                    plugin.confirm_dependents(
+                        &meta.info(),
+                        "Uninstall",
+                        move || {
+                            local_plugin.uninstall_volt(local_meta.clone());
+                        },
+                    );
                 }
             }));
         menu
     }
 }
 
+/// Compares two volt versions, falling back to plain inequality for versions
+/// that aren't valid semver.
+pub fn is_newer(latest: &str, installed: &str) -> bool {
+    match (
+        semver::Version::parse(latest),
+        semver::Version::parse(installed),
+    ) {
+        (Ok(latest), Ok(installed)) => latest > installed,
+        _ => latest != installed,
+    }
+}
+
+/// Pairs installed volts with their icons, read off the UI thread.
+fn with_icons(volts: Vec<VoltMetadata>) -> Vec<(VoltMetadata, Option<Vec<u8>>)> {
+    volts
+        .into_iter()
+        .map(|meta| {
+            let icon = volt_icon(&meta);
+            (meta, icon)
+        })
+        .collect()
+}
+
+/// The permissions an installed wasm volt asks for, and whether the user
+/// granted them.
+fn permissions_view(plugin: PluginData, meta: VoltMetadata) -> impl View {
+    let config = plugin.common.config;
+    let proxy = plugin.common.proxy.clone();
+    let requested = meta.requested_permissions();
+    let descriptions = requested.descriptions();
+
+    // None until the proxy answers
+    let granted = create_rw_signal(None);
+    {
+        let requested = requested.clone();
+        let send = create_ext_action(Scope::current(), move |result| {
+            if let Ok(ProxyResponse::GetVoltPermissionsResponse { granted: grant }) =
+                result
+            {
+                granted
+                    .set(Some(grant.map(|g| g.covers(&requested)).unwrap_or(false)));
+            }
+        });
+        proxy.get_volt_permissions(meta.id(), move |result| {
+            send(result);
+        });
+    }
+
+    stack((
+        text("Permissions").style(|s| s.font_bold()),
+        dyn_stack(
+            move || {
+                if descriptions.is_empty() {
+                    vec!["None".to_string()]
+                } else {
+                    descriptions.clone()
+                }
+            },
+            |d| d.clone(),
+            |d| text(format!("• {d}")),
+        )
+        .style(|s| s.flex_col()),
+        stack((
+            label(move || match granted.get() {
+                Some(true) => "Granted",
+                Some(false) => "Not granted",
+                None => "",
+            })
+            .style(move |s| s.color(config.get().color(LapceColor::EDITOR_DIM))),
+            label(move || {
+                if granted.get() == Some(true) {
+                    "Revoke"
+                } else {
+                    "Grant"
+                }
+            })
+            .style(move |s| primary_button_style(config, s))
+            .disabled(move || granted.get().is_none())
+            .on_click_stop(move |_| {
+                if granted.get_untracked() == Some(true) {
+                    proxy.revoke_volt_permissions(meta.clone());
+                    granted.set(Some(false));
+                } else {
+                    plugin.grant_requested_permissions(&meta);
+                    granted.set(Some(true));
+                }
+            }),
+        ))
+        .style(|s| s.items_center()),
+    ))
+    .style(move |s| {
+        s.flex_col()
+            .line_height(1.6)
+            .padding_bottom(6)
+            .border_bottom(1)
+            .border_color(config.get().color(LapceColor::LAPCE_BORDER))
+            .margin_bottom(6)
+    })
+}
+
 pub fn plugin_info_view(plugin: PluginData, volt: VoltID) -> impl View {
     let config = plugin.common.config;
     let header_rect = create_rw_signal(Rect::ZERO);
     let scroll_width: RwSignal<f64> = create_rw_signal(0.0);
     let internal_command = plugin.common.internal_command;
     let local_plugin = plugin.clone();
+    let permissions_plugin = plugin.clone();
     let plugin_info = create_memo(move |_| {
         plugin
             .installed
@@ -742,7 +1378,7 @@ pub fn plugin_info_view(plugin: PluginData, volt: VoltID) -> impl View {
             move |version_info: Option<(String, Option<String>)>| match version_info
                 .as_ref()
                 .map(|(v, l)| match l {
-                    Some(l) => (true, l == v),
+                    Some(l) => (true, !is_newer(l, v)),
                     None => (false, false),
                 }) {
                 Some((true, true)) => "Installed ▼",
@@ -930,6 +1566,17 @@ pub fn plugin_info_view(plugin: PluginData, volt: VoltID) -> impl View {
                             .width_full()
                             .background(config.get().color(LapceColor::LAPCE_BORDER))
                     }),
+                    match plugin_info
+                        .as_ref()
+                        .and_then(|(meta, _, _, _, _)| meta.clone())
+                        .filter(|meta| meta.wasm.is_some())
+                    {
+                        Some(meta) => {
+                            permissions_view(permissions_plugin.clone(), meta)
+                                .into_any()
+                        }
+                        None => empty().into_any(),
+                    },
                     {
                         let readme = create_rw_signal(None);
                         let info = plugin_info
@@ -57,6 +57,7 @@ fn run_command(
                 self.editor.run_command(command, count, mods);
             }
             CommandKind::MotionMode(_) => {}
+            CommandKind::Plugin(_) => {}
         }
         CommandExecuted::Yes
     }
@@ -2,8 +2,9 @@
 
 use floem::{
     IntoView, View,
-    action::{TimerToken, add_overlay, exec_after, remove_overlay},
+    action::{TimerToken, add_overlay, exec_after, remove_overlay, save_as},
     event::EventListener,
+    file::{FileDialogOptions, FileInfo},
     keyboard::Modifiers,
     peniko::kurbo::{Point, Rect, Size},
     reactive::{
@@ -27,7 +28,7 @@
 use serde_json::Value;
 
 use crate::{
-    command::CommandExecuted,
+    command::{CommandExecuted, InternalCommand},
     config::{
         DropdownInfo, LapceConfig, color::LapceColor, core::CoreConfig,
         editor::EditorConfig, icon::LapceIcons, terminal::TerminalConfig,
@@ -37,6 +38,7 @@
     main_split::Editors,
     plugin::InstalledVoltData,
     text_input::TextInputBuilder,
+    theme_editor::{resolve_chain, save_theme, save_theme_volt},
     window_tab::CommonData,
 };
 
@@ -968,6 +970,25 @@ fn color_section_list(
                                 config.color(LapceColor::EDITOR_FOREGROUND)
                             }))
                     }),
+                    // where a `$variable` value gets its color from
+                    label(move || {
+                        let value =
+                            doc.get_untracked().buffer.with(|b| b.to_string());
+                        if !value.starts_with('$') {
+                            return String::new();
+                        }
+                        let config = config.get();
+                        resolve_chain(
+                            &config.color_theme,
+                            config.default_color_theme(),
+                            &value,
+                        )[1..]
+                            .join(" → ")
+                    })
+                    .style(move |s| {
+                        s.margin_left(10)
+                            .color(config.get().color(LapceColor::EDITOR_DIM))
+                    }),
                     {
                         let kind = kind.clone();
                         let key = key.clone();
@@ -1080,8 +1101,20 @@ pub fn theme_color_settings_view(
     let search_editor = editors.make_local(cx, common.clone());
     let buffer = search_editor.doc_signal().get_untracked().buffer;
 
+    // Show the keys the theme inspector revealed
+    let revealed = common.theme_inspector.revealed;
+    {
+        let search_doc = search_editor.doc_signal();
+        create_effect(move |_| {
+            if let Some(key) = revealed.get() {
+                search_doc.get_untracked().reload(Rope::from(key), true);
+            }
+        });
+    }
+
     scroll(
         stack((
+            theme_editor_toolbar(editors, common.clone()),
             container({
                 TextInputBuilder::new()
                     .build_editor(search_editor)
@@ -1178,6 +1211,102 @@ pub fn theme_color_settings_view(
     .debug_name("Theme Color Settings")
 }
 
+/// Inspecting, saving and exporting the edited theme.
+fn theme_editor_toolbar(editors: Editors, common: Rc<CommonData>) -> impl View {
+    let config = common.config;
+    let inspector = common.theme_inspector;
+    let internal_command = common.internal_command;
+
+    let cx = Scope::current();
+    let name_input = TextInputBuilder::new()
+        .value(format!(
+            "{} Custom",
+            config.get_untracked().color_theme.name
+        ))
+        .build(cx, editors, common.clone());
+    let name_doc = name_input.doc_signal();
+    let name = move || {
+        let name = name_doc
+            .get_untracked()
+            .buffer
+            .with_untracked(|b| b.to_string());
+        let name = name.trim();
+        (!name.is_empty()).then(|| name.to_string())
+    };
+    let show_result = move |title: &str, result: anyhow::Result<()>| {
+        let msg = match result {
+            Ok(()) => return,
+            Err(err) => {
+                tracing::error!("{:?}", err);
+                err.to_string()
+            }
+        };
+        internal_command.send(InternalCommand::ShowAlert {
+            title: title.to_string(),
+            msg,
+            buttons: Vec::new(),
+        });
+    };
+
+    let button = move |text: &'static str, is_active: Box<dyn Fn() -> bool>| {
+        label(move || text.to_string()).style(move |s| {
+            let config = config.get();
+            s.margin_left(10)
+                .padding(6)
+                .cursor(CursorStyle::Pointer)
+                .border(1)
+                .border_radius(6)
+                .border_color(config.color(LapceColor::LAPCE_BORDER))
+                .apply_if(is_active(), |s| {
+                    s.background(config.color(LapceColor::PANEL_CURRENT_BACKGROUND))
+                })
+                .active(|s| s.background(config.color(LapceColor::PANEL_BACKGROUND)))
+        })
+    };
+
+    stack((
+        text("Theme Name").style(|s| s.margin_right(10)),
+        name_input.keyboard_navigable().style(move |s| {
+            s.width(200.0)
+                .border(1)
+                .border_radius(6)
+                .border_color(config.get().color(LapceColor::LAPCE_BORDER))
+        }),
+        button("Save Theme", Box::new(|| false)).on_click_stop(move |_| {
+            let Some(name) = name() else {
+                return;
+            };
+            let theme = config.get_untracked().color_theme.clone();
+            show_result("Save Theme", save_theme(&theme, &name));
+        }),
+        button("Export as Plugin", Box::new(|| false)).on_click_stop(move |_| {
+            let Some(name) = name() else {
+                return;
+            };
+            let theme = config.get_untracked().color_theme.clone();
+            save_as(
+                FileDialogOptions::new()
+                    .title("Choose a folder for the plugin")
+                    .default_name(name.clone()),
+                move |file: Option<FileInfo>| {
+                    if let Some(dir) = file.and_then(|mut file| file.path.pop()) {
+                        show_result(
+                            "Export as Plugin",
+                            save_theme_volt(&theme, &name, &dir),
+                        );
+                    }
+                },
+            );
+        }),
+        button("Inspect", Box::new(move || inspector.active.get())).on_click_stop(
+            move |_| {
+                inspector.active.update(|active| *active = !*active);
+            },
+        ),
+    ))
+    .style(|s| s.items_center().padding_top(20.0).padding_horiz(20.0))
+}
+
 fn dropdown_view(
     item: &SettingsItem,
     current_value: RwSignal<String>,
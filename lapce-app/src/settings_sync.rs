@@ -0,0 +1,977 @@
+//! Settings sync keeps settings.toml, keymaps.toml, the lists of installed,
+//! disabled and pinned volts and the user snippets in a folder or git
+//! repository shared between machines.
+//!
+//! Every file is merged three ways, between the copy on this machine, the
+//! one in the sync location and the one from the last sync, which is kept in
+//! [`Directory::settings_sync_directory`]. Changes made on one side only are
+//! copied to the other, and changes made on both sides are merged when the
+//! file format allows it, or reported as a [`SyncConflict`].
+
+use std::{
+    collections::{BTreeSet, HashSet},
+    fmt, fs,
+    path::{Path, PathBuf},
+    str::FromStr,
+    sync::Mutex,
+};
+
+use anyhow::{Context, Result, anyhow};
+use git2::{
+    Cred, CredentialType, FetchOptions, IndexAddOption, PushOptions,
+    RemoteCallbacks, Repository, ResetType, Signature,
+};
+use itertools::Itertools;
+use lapce_core::directory::Directory;
+use lapce_proxy::plugin::wasi::find_all_volts;
+use lapce_rpc::plugin::VoltID;
+use serde::{Deserialize, Serialize};
+use toml_edit::{ArrayOfTables, Document, Item, Table};
+
+use crate::{config::LapceConfig, db::LapceDb};
+
+const LOCATION_FILE: &str = "location.json";
+const BASE_DIR: &str = "base";
+const REPO_DIR: &str = "repo";
+const CONFLICTS_DIR: &str = "conflicts";
+
+const SETTINGS_FILE: &str = "settings.toml";
+const KEYMAPS_FILE: &str = "keymaps.toml";
+const VOLTS_FILE: &str = "volts.json";
+const SNIPPETS_DIR: &str = "snippets";
+
+const DEFAULT_BRANCH: &str = "main";
+
+/// Only one sync runs at a time, e.g. when syncing by hand while the sync on
+/// startup is still fetching.
+static SYNCING: Mutex<()> = Mutex::new(());
+
+#[derive(Clone, Debug, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(tag = "kind", rename_all = "snake_case")]
+pub enum SyncLocation {
+    /// A folder, which may be kept in sync by other means, like a network
+    /// share or a file sync service.
+    Folder { path: PathBuf },
+    /// A git repository, local or remote, synced on `branch`.
+    Git { url: String, branch: String },
+}
+
+impl SyncLocation {
+    /// Works out the location from a folder, a git repository on disk or a
+    /// git url. A branch other than `main` can be given after a `#`.
+    pub fn parse(s: &str) -> Self {
+        let s = s.trim();
+        let (s, branch) = match s.rsplit_once('#') {
+            Some((s, branch)) if !branch.is_empty() => (s, branch),
+            _ => (s, DEFAULT_BRANCH),
+        };
+        let git = |url: &str| Self::Git {
+            url: url.to_string(),
+            branch: branch.to_string(),
+        };
+
+        if s.contains("://") || s.ends_with(".git") {
+            return git(s);
+        }
+        // scp like syntax, e.g. `git@example.com:settings`
+        if let Some((host, _)) = s.split_once(':') {
+            if host.contains('@') {
+                return git(s);
+            }
+        }
+        let path = Path::new(s);
+        if Repository::open(path).is_ok() {
+            return git(s);
+        }
+        Self::Folder {
+            path: path.to_path_buf(),
+        }
+    }
+}
+
+impl fmt::Display for SyncLocation {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            SyncLocation::Folder { path } => write!(f, "{}", path.display()),
+            SyncLocation::Git { url, branch } => write!(f, "{url} ({branch})"),
+        }
+    }
+}
+
+/// The configured sync location, if settings sync is turned on.
+pub fn location() -> Option<SyncLocation> {
+    read_location(&Directory::settings_sync_directory()?)
+}
+
+/// Sets where the settings are synced to, or turns settings sync off.
+pub fn set_location(location: Option<&SyncLocation>) -> Result<()> {
+    let state = Directory::settings_sync_directory()
+        .ok_or_else(|| anyhow!("can't get the settings sync directory"))?;
+    write_location(&state, location)
+}
+
+fn read_location(state: &Path) -> Option<SyncLocation> {
+    let location = fs::read_to_string(state.join(LOCATION_FILE)).ok()?;
+    serde_json::from_str(&location).ok()
+}
+
+fn write_location(state: &Path, location: Option<&SyncLocation>) -> Result<()> {
+    // The last synced copies and the checkout belong to the old location, so
+    // the first sync with a new one merges without a base.
+    if read_location(state).as_ref() != location {
+        for dir in [BASE_DIR, REPO_DIR, CONFLICTS_DIR] {
+            let dir = state.join(dir);
+            if dir.exists() {
+                fs::remove_dir_all(dir)?;
+            }
+        }
+    }
+    match location {
+        Some(location) => fs::write(
+            state.join(LOCATION_FILE),
+            serde_json::to_string_pretty(location)?,
+        )?,
+        None => {
+            let path = state.join(LOCATION_FILE);
+            if path.exists() {
+                fs::remove_file(path)?;
+            }
+        }
+    }
+    Ok(())
+}
+
+/// Where the synced files are on this machine.
+#[derive(Clone, Debug)]
+pub struct SyncPaths {
+    pub settings: PathBuf,
+    pub keymaps: PathBuf,
+    pub snippets: PathBuf,
+    /// The sync state of this machine, see
+    /// [`Directory::settings_sync_directory`].
+    pub state: PathBuf,
+}
+
+impl SyncPaths {
+    pub fn new() -> Result<Self> {
+        Ok(Self {
+            settings: LapceConfig::settings_file()
+                .ok_or_else(|| anyhow!("can't get the settings file"))?,
+            keymaps: LapceConfig::keymaps_file()
+                .ok_or_else(|| anyhow!("can't get the keymaps file"))?,
+            snippets: Directory::snippets_directory()
+                .ok_or_else(|| anyhow!("can't get the snippets directory"))?,
+            state: Directory::settings_sync_directory()
+                .ok_or_else(|| anyhow!("can't get the settings sync directory"))?,
+        })
+    }
+
+    /// The file on this machine that is synced as `name`. The volt lists
+    /// aren't a file, see [`SyncedVolts`].
+    fn local(&self, name: &str) -> Option<PathBuf> {
+        match name {
+            SETTINGS_FILE => Some(self.settings.clone()),
+            KEYMAPS_FILE => Some(self.keymaps.clone()),
+            _ => name
+                .strip_prefix(SNIPPETS_DIR)
+                .and_then(|name| name.strip_prefix('/'))
+                .map(|name| self.snippets.join(name)),
+        }
+    }
+
+    fn base(&self, name: &str) -> PathBuf {
+        self.state.join(BASE_DIR).join(name)
+    }
+
+    fn conflict(&self, name: &str) -> PathBuf {
+        self.state.join(CONFLICTS_DIR).join(name)
+    }
+}
+
+/// The volts of this machine, synced as `volts.json` with the ids written as
+/// `author.name`.
+#[derive(Clone, Debug, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(default)]
+pub struct SyncedVolts {
+    pub installed: BTreeSet<String>,
+    pub disabled: BTreeSet<String>,
+    pub pinned: BTreeSet<String>,
+}
+
+impl SyncedVolts {
+    /// The volts installed in the plugins directory, and the ones disabled
+    /// and pinned for every workspace.
+    pub fn load(db: &LapceDb) -> Self {
+        let ids = |ids: Vec<VoltID>| ids.iter().map(VoltID::to_string).collect();
+        Self {
+            installed: find_all_volts(&[])
+                .iter()
+                .map(|volt| VoltID::from(volt).to_string())
+                .collect(),
+            disabled: ids(db.get_disabled_volts().unwrap_or_default()),
+            pinned: ids(db.get_pinned_volts().unwrap_or_default()),
+        }
+    }
+
+    fn from_json(s: &str) -> Option<Self> {
+        if s.trim().is_empty() {
+            return Some(Self::default());
+        }
+        serde_json::from_str(s).ok()
+    }
+
+    fn to_json(&self) -> String {
+        let mut s = serde_json::to_string_pretty(self).unwrap_or_default();
+        s.push('\n');
+        s
+    }
+
+    /// What has to change on this machine to match `synced`.
+    fn changes(&self, synced: &SyncedVolts) -> VoltChanges {
+        let ids = |ids: &mut dyn Iterator<Item = &String>| -> Vec<VoltID> {
+            ids.filter_map(|id| VoltID::from_str(id).ok()).collect()
+        };
+        VoltChanges {
+            install: ids(&mut synced.installed.difference(&self.installed)),
+            uninstall: ids(&mut self.installed.difference(&synced.installed)),
+            disabled: ids(&mut synced.disabled.iter()).into_iter().collect(),
+            pinned: ids(&mut synced.pinned.iter()).into_iter().collect(),
+        }
+    }
+}
+
+/// The volt changes pulled from the sync location.
+#[derive(Clone, Debug, Default)]
+pub struct VoltChanges {
+    pub install: Vec<VoltID>,
+    pub uninstall: Vec<VoltID>,
+    pub disabled: HashSet<VoltID>,
+    pub pinned: HashSet<VoltID>,
+}
+
+/// A file changed both on this machine and in the sync location, in a way
+/// that can't be merged.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub struct SyncConflict {
+    /// The path of the file in the sync location, e.g. `settings.toml`.
+    pub name: String,
+    /// The file on this machine.
+    pub local: PathBuf,
+    /// A copy of the file from the sync location, unless it was deleted
+    /// there.
+    pub remote: Option<PathBuf>,
+}
+
+#[derive(Debug, Default)]
+pub struct SyncResult {
+    /// The files changed on this machine.
+    pub pulled: Vec<String>,
+    /// The files changed in the sync location.
+    pub pushed: Vec<String>,
+    pub conflicts: Vec<SyncConflict>,
+    /// Set when the volts of this machine have to change.
+    pub volts: Option<VoltChanges>,
+}
+
+impl SyncResult {
+    pub fn is_empty(&self) -> bool {
+        self.pulled.is_empty() && self.pushed.is_empty() && self.conflicts.is_empty()
+    }
+}
+
+/// Syncs this machine with `location`. This blocks on the file system and
+/// the network, so it should be called from a background thread.
+pub fn sync(location: &SyncLocation, db: &LapceDb) -> Result<SyncResult> {
+    let _syncing = SYNCING
+        .lock()
+        .map_err(|_| anyhow!("settings sync failed"))?;
+    sync_paths(location, &SyncPaths::new()?, &SyncedVolts::load(db))
+}
+
+fn sync_paths(
+    location: &SyncLocation,
+    paths: &SyncPaths,
+    volts: &SyncedVolts,
+) -> Result<SyncResult> {
+    match location {
+        SyncLocation::Folder { path } => {
+            fs::create_dir_all(path)?;
+            let (result, bases) = sync_files(path, paths, volts)?;
+            write_bases(paths, bases)?;
+            Ok(result)
+        }
+        SyncLocation::Git { url, branch } => {
+            let checkout = paths.state.join(REPO_DIR);
+            let repo = open_checkout(&checkout, url, branch)
+                .with_context(|| format!("failed to fetch {url}"))?;
+            let (result, bases) = sync_files(&checkout, paths, volts)?;
+            if !result.pushed.is_empty() {
+                commit_and_push(&repo, branch, &result.pushed)
+                    .with_context(|| format!("failed to push to {url}"))?;
+            }
+            // The last synced copies are only updated once the changes are
+            // pushed, so a failed push is retried by the next sync.
+            write_bases(paths, bases)?;
+            Ok(result)
+        }
+    }
+}
+
+/// Resolves a conflict by keeping the copy of this machine, which is pushed
+/// by the next sync, or by replacing it with the copy from the sync location.
+pub fn resolve_conflict(conflict: &SyncConflict, keep_local: bool) -> Result<()> {
+    resolve_conflict_paths(&SyncPaths::new()?, conflict, keep_local)
+}
+
+fn resolve_conflict_paths(
+    paths: &SyncPaths,
+    conflict: &SyncConflict,
+    keep_local: bool,
+) -> Result<()> {
+    let remote = match &conflict.remote {
+        Some(remote) => Some(fs::read_to_string(remote)?),
+        None => None,
+    };
+    if !keep_local {
+        write_file(&conflict.local, remote.as_deref())?;
+    }
+    write_file(&paths.base(&conflict.name), remote.as_deref())?;
+    write_file(&paths.conflict(&conflict.name), None)
+}
+
+/// Merges every synced file with its copy in `remote`, writing the results
+/// to both sides. Returns the new last synced copies, which the caller
+/// writes with [`write_bases`].
+#[allow(clippy::type_complexity)]
+fn sync_files(
+    remote: &Path,
+    paths: &SyncPaths,
+    volts: &SyncedVolts,
+) -> Result<(SyncResult, Vec<(String, Option<String>)>)> {
+    let mut names = vec![
+        SETTINGS_FILE.to_string(),
+        KEYMAPS_FILE.to_string(),
+        VOLTS_FILE.to_string(),
+    ];
+    names.extend(
+        [
+            paths.snippets.clone(),
+            remote.join(SNIPPETS_DIR),
+            paths.base(SNIPPETS_DIR),
+        ]
+        .iter()
+        .flat_map(|dir| list_files(dir))
+        .sorted()
+        .dedup()
+        .map(|name| format!("{SNIPPETS_DIR}/{name}")),
+    );
+
+    let local_volts = volts.to_json();
+    let mut result = SyncResult::default();
+    let mut bases = Vec::new();
+    for name in names {
+        let base = read_file(&paths.base(&name))?;
+        let local = match paths.local(&name) {
+            Some(path) => read_file(&path)?,
+            None => Some(local_volts.clone()),
+        };
+        let remote_path = remote.join(&name);
+        let remote = read_file(&remote_path)?;
+
+        let synced =
+            match merge(&name, base.as_deref(), local.as_deref(), remote.as_deref())
+            {
+                Some(synced) => synced,
+                None => {
+                    let copy = paths.conflict(&name);
+                    write_file(&copy, remote.as_deref())?;
+                    result.conflicts.push(SyncConflict {
+                        local: paths.local(&name).unwrap_or_default(),
+                        remote: remote.is_some().then_some(copy),
+                        name,
+                    });
+                    continue;
+                }
+            };
+
+        if synced != local {
+            match paths.local(&name) {
+                Some(path) => write_file(&path, synced.as_deref())?,
+                None => {
+                    let synced = synced
+                        .as_deref()
+                        .and_then(SyncedVolts::from_json)
+                        .unwrap_or_default();
+                    result.volts = Some(volts.changes(&synced));
+                }
+            }
+            result.pulled.push(name.clone());
+        }
+        if synced != remote {
+            write_file(&remote_path, synced.as_deref())?;
+            result.pushed.push(name.clone());
+        }
+        // The volt lists only match the synced ones once the volts are
+        // installed, so the next sync pulls them again until they are.
+        let synced = if paths.local(&name).is_none() {
+            local
+        } else {
+            synced
+        };
+        if synced != base {
+            bases.push((name, synced));
+        }
+    }
+    Ok((result, bases))
+}
+
+fn write_bases(
+    paths: &SyncPaths,
+    bases: Vec<(String, Option<String>)>,
+) -> Result<()> {
+    for (name, base) in bases {
+        write_file(&paths.base(&name), base.as_deref())?;
+    }
+    Ok(())
+}
+
+/// The synced content of `name`, which is `None` when the file should be
+/// deleted. Returns `None` when the changes on both sides can't be merged.
+fn merge(
+    name: &str,
+    base: Option<&str>,
+    local: Option<&str>,
+    remote: Option<&str>,
+) -> Option<Option<String>> {
+    let owned = |s: Option<&str>| s.map(|s| s.to_string());
+    if local == remote || base == remote {
+        return Some(owned(local));
+    }
+    if base == local {
+        return Some(owned(remote));
+    }
+
+    let base = base.unwrap_or_default();
+    let merged = match name {
+        // The volt lists are always merged, a missing list is an empty one.
+        VOLTS_FILE => {
+            merge_volts(base, local.unwrap_or_default(), remote.unwrap_or_default())
+        }
+        SETTINGS_FILE => merge_settings(base, local?, remote?),
+        KEYMAPS_FILE => merge_keymaps(base, local?, remote?),
+        _ => None,
+    };
+    merged.map(Some)
+}
+
+/// Merges the settings key by key, keeping the formatting of `remote`.
+fn merge_settings(base: &str, local: &str, remote: &str) -> Option<String> {
+    let base: Document = base.parse().ok()?;
+    let local: Document = local.parse().ok()?;
+    let mut merged: Document = remote.parse().ok()?;
+    merge_tables(&base, &local, &mut merged)?;
+    Some(merged.to_string())
+}
+
+/// Applies the changes from `base` to `local` to `merged`, which starts as
+/// the remote table. Fails when a key was changed differently on both sides.
+fn merge_tables(base: &Table, local: &Table, merged: &mut Table) -> Option<()> {
+    let keys: Vec<String> = base
+        .iter()
+        .chain(local.iter())
+        .map(|(key, _)| key.to_string())
+        .unique()
+        .collect();
+    for key in keys {
+        let base = base.get(&key);
+        let local = local.get(&key);
+        let remote = merged.get(&key);
+        if same_item(local, base) || same_item(local, remote) {
+            continue;
+        }
+
+        match (local, remote) {
+            (Some(Item::Table(local)), Some(Item::Table(_))) => {
+                let empty = Table::new();
+                let base = base.and_then(|base| base.as_table()).unwrap_or(&empty);
+                merge_tables(base, local, merged.get_mut(&key)?.as_table_mut()?)?;
+            }
+            _ if same_item(remote, base) => match local {
+                Some(local) => {
+                    merged.insert(&key, local.clone());
+                }
+                None => {
+                    merged.remove(&key);
+                }
+            },
+            _ => return None,
+        }
+    }
+    Some(())
+}
+
+/// Merges the keymaps as a set, so the ones added and removed on either
+/// side are combined. Keymaps added on this machine go after the remote
+/// ones.
+fn merge_keymaps(base: &str, local: &str, remote: &str) -> Option<String> {
+    let keymaps = |doc: &Document| -> Vec<Table> {
+        doc.get("keymaps")
+            .and_then(|keymaps| keymaps.as_array_of_tables())
+            .map(|keymaps| keymaps.iter().cloned().collect())
+            .unwrap_or_default()
+    };
+    let values = |keymaps: &[Table]| -> Vec<Option<toml::Value>> {
+        keymaps
+            .iter()
+            .map(|keymap| item_value(&Item::Table(keymap.clone())))
+            .collect()
+    };
+
+    let base: Document = base.parse().ok()?;
+    let local: Document = local.parse().ok()?;
+    let mut merged: Document = remote.parse().ok()?;
+    let base = values(&keymaps(&base));
+    let local_keymaps = keymaps(&local);
+    let local = values(&local_keymaps);
+    let remote_keymaps = keymaps(&merged);
+    let remote = values(&remote_keymaps);
+
+    let mut result = ArrayOfTables::new();
+    for (keymap, value) in remote_keymaps.into_iter().zip(&remote) {
+        // Removed on this machine
+        if base.contains(value) && !local.contains(value) {
+            continue;
+        }
+        result.push(keymap);
+    }
+    for (keymap, value) in local_keymaps.into_iter().zip(&local) {
+        // Added on this machine
+        if !base.contains(value) && !remote.contains(value) {
+            result.push(keymap);
+        }
+    }
+    if !result.is_empty() || merged.contains_key("keymaps") {
+        merged.insert("keymaps", Item::ArrayOfTables(result));
+    }
+    Some(merged.to_string())
+}
+
+/// Merges each volt list as a set.
+fn merge_volts(base: &str, local: &str, remote: &str) -> Option<String> {
+    let base = SyncedVolts::from_json(base).unwrap_or_default();
+    let local = SyncedVolts::from_json(local)?;
+    let remote = SyncedVolts::from_json(remote)?;
+    let merge = |base: &BTreeSet<String>,
+                 local: &BTreeSet<String>,
+                 remote: &BTreeSet<String>|
+     -> BTreeSet<String> {
+        remote
+            .iter()
+            .filter(|id| local.contains(*id) || !base.contains(*id))
+            .chain(local.difference(base))
+            .cloned()
+            .collect()
+    };
+    Some(
+        SyncedVolts {
+            installed: merge(&base.installed, &local.installed, &remote.installed),
+            disabled: merge(&base.disabled, &local.disabled, &remote.disabled),
+            pinned: merge(&base.pinned, &local.pinned, &remote.pinned),
+        }
+        .to_json(),
+    )
+}
+
+/// Whether two items have the same value, ignoring their formatting.
+fn same_item(a: Option<&Item>, b: Option<&Item>) -> bool {
+    match (a, b) {
+        (None, None) => true,
+        (Some(a), Some(b)) => item_value(a) == item_value(b),
+        _ => false,
+    }
+}
+
+fn item_value(item: &Item) -> Option<toml::Value> {
+    let mut doc = Document::new();
+    doc.insert("value", item.clone());
+    let value: toml::Value = toml::from_str(&doc.to_string()).ok()?;
+    value.get("value").cloned()
+}
+
+/// Opens the checkout of the sync repository, cloning it when needed, and
+/// resets it to the remote branch. The branch may not exist yet, e.g. in a
+/// new bare repository.
+fn open_checkout(dir: &Path, url: &str, branch: &str) -> Result<Repository> {
+    let repo = match Repository::open(dir) {
+        Ok(repo) => repo,
+        Err(_) => {
+            fs::create_dir_all(dir)?;
+            let repo = Repository::init(dir)?;
+            repo.remote("origin", url)?;
+            repo
+        }
+    };
+    if repo.find_remote("origin")?.url() != Some(url) {
+        repo.remote_set_url("origin", url)?;
+    }
+    repo.set_head(&format!("refs/heads/{branch}"))?;
+
+    {
+        let mut remote = repo.find_remote("origin")?;
+        let mut options = FetchOptions::new();
+        options.remote_callbacks(remote_callbacks());
+        remote.fetch(
+            &[format!("+refs/heads/{branch}:refs/remotes/origin/{branch}")],
+            Some(&mut options),
+            None,
+        )?;
+    }
+
+    if let Ok(reference) =
+        repo.find_reference(&format!("refs/remotes/origin/{branch}"))
+    {
+        let commit = reference.peel_to_commit()?;
+        repo.reset(commit.as_object(), ResetType::Hard, None)?;
+    }
+    Ok(repo)
+}
+
+fn commit_and_push(
+    repo: &Repository,
+    branch: &str,
+    changed: &[String],
+) -> Result<()> {
+    let mut index = repo.index()?;
+    index.add_all(["*"], IndexAddOption::DEFAULT, None)?;
+    index.update_all(["*"], None)?;
+    index.write()?;
+    let tree = repo.find_tree(index.write_tree()?)?;
+
+    let parent = repo.head().ok().and_then(|head| head.peel_to_commit().ok());
+    if parent.as_ref().map(|parent| parent.tree_id()) != Some(tree.id()) {
+        let signature = repo
+            .signature()
+            .or_else(|_| Signature::now("Lapce", "lapce@localhost"))?;
+        let parents: Vec<_> = parent.iter().collect();
+        repo.commit(
+            Some("HEAD"),
+            &signature,
+            &signature,
+            &format!("Sync {}", changed.join(", ")),
+            &tree,
+            &parents,
+        )?;
+    }
+
+    let mut callbacks = remote_callbacks();
+    callbacks.push_update_reference(|reference, status| match status {
+        Some(status) => Err(git2::Error::from_str(&format!(
+            "{reference} was rejected: {status}"
+        ))),
+        None => Ok(()),
+    });
+    let mut options = PushOptions::new();
+    options.remote_callbacks(callbacks);
+    repo.find_remote("origin")?.push(
+        &[format!("refs/heads/{branch}:refs/heads/{branch}")],
+        Some(&mut options),
+    )?;
+    Ok(())
+}
+
+/// Authenticates with the ssh agent or the git credential helpers.
+fn remote_callbacks<'a>() -> RemoteCallbacks<'a> {
+    let mut callbacks = RemoteCallbacks::new();
+    let mut attempts = 0;
+    callbacks.credentials(move |url, username, allowed| {
+        attempts += 1;
+        if attempts > 3 {
+            return Err(git2::Error::from_str("authentication failed"));
+        }
+        if allowed.contains(CredentialType::SSH_KEY) {
+            return Cred::ssh_key_from_agent(username.unwrap_or("git"));
+        }
+        if allowed.contains(CredentialType::USER_PASS_PLAINTEXT) {
+            let config = git2::Config::open_default()?;
+            return Cred::credential_helper(&config, url, username);
+        }
+        Cred::default()
+    });
+    callbacks
+}
+
+fn read_file(path: &Path) -> Result<Option<String>> {
+    if !path.exists() {
+        return Ok(None);
+    }
+    fs::read_to_string(path)
+        .map(Some)
+        .with_context(|| format!("failed to read {}", path.display()))
+}
+
+/// Writes `content` to `path`, or deletes it when `content` is `None`.
+fn write_file(path: &Path, content: Option<&str>) -> Result<()> {
+    match content {
+        Some(content) => {
+            if let Some(parent) = path.parent() {
+                fs::create_dir_all(parent)?;
+            }
+            fs::write(path, content)
+        }
+        None if path.exists() => fs::remove_file(path),
+        None => Ok(()),
+    }
+    .with_context(|| format!("failed to write {}", path.display()))
+}
+
+fn list_files(dir: &Path) -> Vec<String> {
+    let Ok(entries) = fs::read_dir(dir) else {
+        return Vec::new();
+    };
+    entries
+        .flatten()
+        .filter(|entry| entry.path().is_file())
+        .filter_map(|entry| entry.file_name().to_str().map(|s| s.to_string()))
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    struct Machine {
+        _dir: tempfile::TempDir,
+        paths: SyncPaths,
+    }
+
+    impl Machine {
+        fn new() -> Self {
+            let dir = tempfile::tempdir().unwrap();
+            let paths = SyncPaths {
+                settings: dir.path().join("settings.toml"),
+                keymaps: dir.path().join("keymaps.toml"),
+                snippets: dir.path().join("snippets"),
+                state: dir.path().join("settings-sync"),
+            };
+            fs::create_dir_all(&paths.state).unwrap();
+            Self { _dir: dir, paths }
+        }
+
+        fn sync(&self, location: &SyncLocation) -> SyncResult {
+            self.sync_volts(location, &SyncedVolts::default())
+        }
+
+        fn sync_volts(
+            &self,
+            location: &SyncLocation,
+            volts: &SyncedVolts,
+        ) -> SyncResult {
+            sync_paths(location, &self.paths, volts).unwrap()
+        }
+
+        fn settings(&self) -> String {
+            fs::read_to_string(&self.paths.settings).unwrap()
+        }
+    }
+
+    fn volts(installed: &[&str]) -> SyncedVolts {
+        SyncedVolts {
+            installed: installed.iter().map(|id| id.to_string()).collect(),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_merge_settings() {
+        let base = "[core]\nmodal = false\n\n[editor]\nfont-size = 13\n";
+        let local = "[core]\nmodal = true\n\n[editor]\nfont-size = 13\n";
+        let remote = "[core]\nmodal = false\n\n[editor]\nfont-size = 15 # big\n";
+        assert_eq!(
+            merge_settings(base, local, remote).unwrap(),
+            "[core]\nmodal = true\n\n[editor]\nfont-size = 15 # big\n"
+        );
+
+        // A new table on this machine
+        let local = "[core]\nmodal = false\n\n[editor]\nfont-size = 13\n\n[ui]\nscale = 1.5\n";
+        let merged = merge_settings(base, local, remote).unwrap();
+        assert!(merged.contains("[ui]\nscale = 1.5"));
+        assert!(merged.contains("font-size = 15"));
+
+        // The same key changed on both sides
+        let local = "[core]\nmodal = false\n\n[editor]\nfont-size = 14\n";
+        assert_eq!(merge_settings(base, local, remote), None);
+
+        // Removed on this machine
+        let local = "[core]\nmodal = false\n";
+        assert_eq!(
+            merge_settings(
+                base,
+                local,
+                "[core]\nmodal = false\nx = 1\n\n[editor]\nfont-size = 13\n"
+            )
+            .unwrap(),
+            "[core]\nmodal = false\nx = 1\n"
+        );
+    }
+
+    #[test]
+    fn test_merge_keymaps() {
+        let keymap = |key: &str, command: &str| {
+            format!("[[keymaps]]\nkey = \"{key}\"\ncommand = \"{command}\"\n")
+        };
+        let base = keymap("ctrl+a", "a") + "\n" + &keymap("ctrl+b", "b");
+        let local = keymap("ctrl+a", "a") + "\n" + &keymap("ctrl+c", "c");
+        let remote = base.clone() + "\n" + &keymap("ctrl+d", "d");
+        let merged = merge_keymaps(&base, &local, &remote).unwrap();
+        let commands: Vec<String> = merged.parse::<Document>().unwrap()["keymaps"]
+            .as_array_of_tables()
+            .unwrap()
+            .iter()
+            .map(|keymap| keymap["command"].as_str().unwrap().to_string())
+            .collect();
+        assert_eq!(commands, vec!["a", "d", "c"]);
+    }
+
+    #[test]
+    fn test_merge_volts() {
+        let base = volts(&["a.one", "a.two"]).to_json();
+        let local = volts(&["a.one", "a.three"]).to_json();
+        let remote = volts(&["a.one", "a.two", "a.four"]).to_json();
+        assert_eq!(
+            merge_volts(&base, &local, &remote).unwrap(),
+            volts(&["a.one", "a.three", "a.four"]).to_json()
+        );
+    }
+
+    #[test]
+    fn test_parse_location() {
+        assert_eq!(
+            SyncLocation::parse("git@example.com:me/settings#lapce"),
+            SyncLocation::Git {
+                url: "git@example.com:me/settings".to_string(),
+                branch: "lapce".to_string()
+            }
+        );
+        assert_eq!(
+            SyncLocation::parse("https://example.com/settings.git"),
+            SyncLocation::Git {
+                url: "https://example.com/settings.git".to_string(),
+                branch: DEFAULT_BRANCH.to_string()
+            }
+        );
+
+        let dir = tempfile::tempdir().unwrap();
+        assert_eq!(
+            SyncLocation::parse(dir.path().to_str().unwrap()),
+            SyncLocation::Folder {
+                path: dir.path().to_path_buf()
+            }
+        );
+        Repository::init_bare(dir.path()).unwrap();
+        assert!(matches!(
+            SyncLocation::parse(dir.path().to_str().unwrap()),
+            SyncLocation::Git { .. }
+        ));
+    }
+
+    fn test_sync(location: &SyncLocation) {
+        let one = Machine::new();
+        let two = Machine::new();
+        fs::write(&one.paths.settings, "[core]\nmodal = true\n").unwrap();
+        fs::create_dir_all(&one.paths.snippets).unwrap();
+        fs::write(one.paths.snippets.join("rust.json"), "{}").unwrap();
+
+        let result = one.sync_volts(location, &volts(&["a.one"]));
+        assert!(result.pushed.contains(&SETTINGS_FILE.to_string()));
+        assert!(result.pulled.is_empty());
+
+        // The second machine pulls everything
+        let result = two.sync(location);
+        assert_eq!(two.settings(), "[core]\nmodal = true\n");
+        assert!(two.paths.snippets.join("rust.json").exists());
+        let changes = result.volts.unwrap();
+        assert_eq!(changes.install, vec![VoltID::from_str("a.one").unwrap()]);
+        assert!(result.conflicts.is_empty());
+
+        // Changes to different keys are merged
+        fs::write(
+            &one.paths.settings,
+            "[core]\nmodal = true\n\n[ui]\nscale = 2\n",
+        )
+        .unwrap();
+        one.sync_volts(location, &volts(&["a.one"]));
+        fs::write(&two.paths.settings, "[core]\nmodal = false\n").unwrap();
+        let result = two.sync_volts(location, &volts(&["a.one"]));
+        assert!(result.conflicts.is_empty());
+        assert_eq!(two.settings(), "[core]\nmodal = false\n\n[ui]\nscale = 2\n");
+        one.sync_volts(location, &volts(&["a.one"]));
+        assert_eq!(one.settings(), two.settings());
+
+        // The same key changed on both sides
+        let one_settings = "[core]\nmodal = false\n\n[ui]\nscale = 3\n";
+        let two_settings = "[core]\nmodal = false\n\n[ui]\nscale = 4\n";
+        fs::write(&one.paths.settings, one_settings).unwrap();
+        one.sync_volts(location, &volts(&["a.one"]));
+        fs::write(&two.paths.settings, two_settings).unwrap();
+        let result = two.sync_volts(location, &volts(&["a.one"]));
+        assert_eq!(result.conflicts.len(), 1);
+        let conflict = &result.conflicts[0];
+        assert_eq!(conflict.name, SETTINGS_FILE);
+        assert_eq!(
+            fs::read_to_string(conflict.remote.as_ref().unwrap()).unwrap(),
+            one_settings
+        );
+        assert_eq!(two.settings(), two_settings);
+
+        // Keeping this machine's copy pushes it
+        resolve_conflict_paths(&two.paths, conflict, true).unwrap();
+        let result = two.sync_volts(location, &volts(&["a.one"]));
+        assert!(result.conflicts.is_empty());
+        assert_eq!(result.pushed, vec![SETTINGS_FILE.to_string()]);
+        one.sync_volts(location, &volts(&["a.one"]));
+        assert_eq!(one.settings(), two_settings);
+    }
+
+    #[test]
+    fn test_sync_folder() {
+        let remote = tempfile::tempdir().unwrap();
+        test_sync(&SyncLocation::Folder {
+            path: remote.path().join("settings"),
+        });
+    }
+
+    #[test]
+    fn test_sync_bare_repository() {
+        let remote = tempfile::tempdir().unwrap();
+        Repository::init_bare(remote.path()).unwrap();
+        let location = SyncLocation::parse(remote.path().to_str().unwrap());
+        test_sync(&location);
+
+        let repo = Repository::open_bare(remote.path()).unwrap();
+        let commit = repo
+            .find_reference("refs/heads/main")
+            .unwrap()
+            .peel_to_commit()
+            .unwrap();
+        assert!(commit.tree().unwrap().get_name(SETTINGS_FILE).is_some());
+    }
+
+    #[test]
+    fn test_set_location() {
+        let state = tempfile::tempdir().unwrap();
+        let location = SyncLocation::Git {
+            url: "git@example.com:settings".to_string(),
+            branch: DEFAULT_BRANCH.to_string(),
+        };
+        write_location(state.path(), Some(&location)).unwrap();
+        fs::create_dir_all(state.path().join(BASE_DIR)).unwrap();
+        assert_eq!(read_location(state.path()), Some(location.clone()));
+
+        // The state of the old location is dropped
+        write_location(state.path(), Some(&location)).unwrap();
+        assert!(state.path().join(BASE_DIR).exists());
+        write_location(state.path(), None).unwrap();
+        assert!(!state.path().join(BASE_DIR).exists());
+        assert_eq!(read_location(state.path()), None);
+    }
+}
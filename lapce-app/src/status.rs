@@ -4,7 +4,7 @@
 };
 
 use floem::{
-    View,
+    IntoView, View,
     event::EventPropagation,
     reactive::{
         Memo, ReadSignal, RwSignal, SignalGet, SignalUpdate, SignalWith, create_memo,
@@ -13,18 +13,25 @@
     views::{Decorators, dyn_stack, label, stack, svg},
 };
 use indexmap::IndexMap;
-use lapce_core::mode::{Mode, VisualMode};
+use lapce_core::{
+    buffer::rope_text::RopeText,
+    mode::{Mode, VisualMode},
+};
+use lapce_rpc::plugin::{StatusBarAlignment, StatusBarItem, VoltID};
 use lsp_types::{DiagnosticSeverity, ProgressToken};
 
 use crate::{
-    app::clickable_icon,
+    app::{clickable_icon, tooltip_label},
     command::LapceWorkbenchCommand,
     config::{LapceConfig, color::LapceColor, icon::LapceIcons},
     editor::EditorData,
+    hex::HexData,
     listener::Listener,
     palette::kind::PaletteKind,
     panel::{kind::PanelKind, position::PanelContainerPosition},
+    plugin::PluginData,
     source_control::SourceControlData,
+    theme_editor::inspector_overlay,
     window_tab::{WindowTabData, WorkProgress},
 };
 
@@ -40,6 +47,7 @@ pub fn status(
     let editor = window_tab_data.main_split.active_editor;
     let panel = window_tab_data.panel.clone();
     let palette = window_tab_data.palette.clone();
+    let theme_inspector = window_tab_data.common.theme_inspector;
     let diagnostic_count = create_memo(move |_| {
         let mut errors = 0;
         let mut warnings = 0;
@@ -71,8 +79,10 @@ pub fn status(
     };
 
     let progresses = window_tab_data.progresses;
+    let plugin = window_tab_data.plugin.clone();
     let mode = create_memo(move |_| window_tab_data.mode());
     let pointer_down = floem::reactive::create_rw_signal(false);
+    let mode_width = floem::reactive::create_rw_signal(0.0);
 
     stack((
         stack((
@@ -86,6 +96,7 @@ pub fn status(
                 },
                 Mode::Terminal => "Terminal".to_string(),
             })
+            .on_resize(move |rect| mode_width.set(rect.width()))
             .style(move |s| {
                 let config = config.get();
                 let display = if config.core.modal {
@@ -94,27 +105,9 @@ pub fn status(
                     Display::None
                 };
 
-                let (bg, fg) = match mode.get() {
-                    Mode::Normal => (
-                        LapceColor::STATUS_MODAL_NORMAL_BACKGROUND,
-                        LapceColor::STATUS_MODAL_NORMAL_FOREGROUND,
-                    ),
-                    Mode::Insert => (
-                        LapceColor::STATUS_MODAL_INSERT_BACKGROUND,
-                        LapceColor::STATUS_MODAL_INSERT_FOREGROUND,
-                    ),
-                    Mode::Visual(_) => (
-                        LapceColor::STATUS_MODAL_VISUAL_BACKGROUND,
-                        LapceColor::STATUS_MODAL_VISUAL_FOREGROUND,
-                    ),
-                    Mode::Terminal => (
-                        LapceColor::STATUS_MODAL_TERMINAL_BACKGROUND,
-                        LapceColor::STATUS_MODAL_TERMINAL_FOREGROUND,
-                    ),
-                };
-
-                let bg = config.color(bg);
-                let fg = config.color(fg);
+                let mode = mode.get();
+                let bg = config.color(modal_background(mode));
+                let fg = config.color(modal_foreground(mode));
 
                 s.display(display)
                     .padding_horiz(10.0)
@@ -225,6 +218,7 @@ pub fn status(
                         })
                 })
             },
+            plugin_items_view(config, plugin.clone(), StatusBarAlignment::Left),
             progress_view(config, progresses),
         ))
         .style(|s| {
@@ -319,6 +313,35 @@ pub fn status(
                 .color(config.get().color(LapceColor::STATUS_FOREGROUND))
         }),
         stack({
+            let large_file_info = label(move || {
+                let Some(editor) = editor.get() else {
+                    return String::new();
+                };
+                let doc = editor.doc_signal().get();
+                match doc.large_file.get() {
+                    Some(large_file) if !large_file.done => {
+                        let info = large_file.info;
+                        format!(
+                            "Large File ({}% loaded)",
+                            info.loaded * 100 / info.len.max(1)
+                        )
+                    }
+                    Some(_) => "Large File".to_string(),
+                    None => String::new(),
+                }
+            })
+            .style(move |s| {
+                let config = config.get();
+                let is_large = editor.get().is_some_and(|editor| {
+                    editor.doc_signal().get().large_file.with(|l| l.is_some())
+                });
+                s.apply_if(!is_large, |s| s.hide())
+                    .height_full()
+                    .padding_horiz(10.0)
+                    .items_center()
+                    .color(config.color(LapceColor::STATUS_FOREGROUND))
+                    .selectable(false)
+            });
             let palette_clone = palette.clone();
             let cursor_info = status_text(config, editor, move || {
                 if let Some(editor) = editor.get() {
@@ -357,6 +380,34 @@ pub fn status(
                 palette_clone.run(PaletteKind::Line);
             });
             let palette_clone = palette.clone();
+            let hex_offset_info = hex_status_text(config, editor, |hex| {
+                let offset = hex.cursor.get().offset;
+                let mut status = format!("Offset 0x{offset:X} ({offset})");
+                match hex.search_matches.get() {
+                    Some(0) => status.push_str(", no matches"),
+                    Some(1) => status.push_str(", 1 match"),
+                    Some(matches) => {
+                        status.push_str(&format!(", {matches} matches"))
+                    }
+                    None => {}
+                }
+                status
+            })
+            .on_click_stop(move |_| {
+                palette_clone.run(PaletteKind::GoToOffset);
+            });
+            let hex_mode_info = hex_status_text(config, editor, |hex| {
+                if hex.insert_mode.get() { "INS" } else { "OVR" }
+            })
+            .on_click_stop(move |_| {
+                if let Some(hex) = editor
+                    .get_untracked()
+                    .and_then(|editor| editor.doc().binary.get_untracked())
+                {
+                    hex.toggle_insert_mode();
+                }
+            });
+            let palette_clone = palette.clone();
             let line_ending_info = status_text(config, editor, move || {
                 if let Some(editor) = editor.get() {
                     let doc = editor.doc_signal().get();
@@ -369,6 +420,18 @@ pub fn status(
                 palette_clone.run(PaletteKind::LineEnding);
             });
             let palette_clone = palette.clone();
+            let encoding_info = status_text(config, editor, move || {
+                if let Some(editor) = editor.get() {
+                    let doc = editor.doc_signal().get();
+                    doc.encoding.get().to_string()
+                } else {
+                    String::new()
+                }
+            })
+            .on_click_stop(move |_| {
+                palette_clone.run(PaletteKind::FileEncoding);
+            });
+            let palette_clone = palette.clone();
             let language_info = status_text(config, editor, move || {
                 if let Some(editor) = editor.get() {
                     let doc = editor.doc_signal().get();
@@ -380,7 +443,18 @@ pub fn status(
             .on_click_stop(move |_| {
                 palette_clone.run(PaletteKind::Language);
             });
-            (cursor_info, line_ending_info, language_info)
+            let plugin_items =
+                plugin_items_view(config, plugin, StatusBarAlignment::Right);
+            (
+                plugin_items,
+                large_file_info,
+                cursor_info,
+                hex_offset_info,
+                hex_mode_info,
+                encoding_info,
+                line_ending_info,
+                language_info,
+            )
         })
         .style(|s| {
             s.height_pct(100.0)
@@ -388,6 +462,17 @@ pub fn status(
                 .flex_grow(1.0)
                 .justify_end()
         }),
+        // The mode indicator is at the very left, so a click left of its
+        // edge landed on it.
+        inspector_overlay(theme_inspector, move |pos| {
+            if config.get_untracked().core.modal
+                && pos.x < mode_width.get_untracked()
+            {
+                modal_background(mode.get_untracked())
+            } else {
+                LapceColor::STATUS_BACKGROUND
+            }
+        }),
     ))
     .on_resize(move |rect| {
         let height = rect.height();
@@ -408,6 +493,25 @@ pub fn status(
     .debug_name("Status/Bottom Bar")
 }
 
+/// The colors of the mode indicator in `mode`.
+fn modal_background(mode: Mode) -> &'static str {
+    match mode {
+        Mode::Normal => LapceColor::STATUS_MODAL_NORMAL_BACKGROUND,
+        Mode::Insert => LapceColor::STATUS_MODAL_INSERT_BACKGROUND,
+        Mode::Visual(_) => LapceColor::STATUS_MODAL_VISUAL_BACKGROUND,
+        Mode::Terminal => LapceColor::STATUS_MODAL_TERMINAL_BACKGROUND,
+    }
+}
+
+fn modal_foreground(mode: Mode) -> &'static str {
+    match mode {
+        Mode::Normal => LapceColor::STATUS_MODAL_NORMAL_FOREGROUND,
+        Mode::Insert => LapceColor::STATUS_MODAL_INSERT_FOREGROUND,
+        Mode::Visual(_) => LapceColor::STATUS_MODAL_VISUAL_FOREGROUND,
+        Mode::Terminal => LapceColor::STATUS_MODAL_TERMINAL_FOREGROUND,
+    }
+}
+
 fn progress_view(
     config: ReadSignal<Arc<LapceConfig>>,
     progresses: RwSignal<IndexMap<ProgressToken, WorkProgress>>,
@@ -437,6 +541,61 @@ fn progress_view(
     .style(move |s| s.flex_row().height_pct(100.0).min_width(0.0))
 }
 
+fn plugin_items_view(
+    config: ReadSignal<Arc<LapceConfig>>,
+    plugin: PluginData,
+    alignment: StatusBarAlignment,
+) -> impl View {
+    let status_items = plugin.status_items;
+    dyn_stack(
+        move || {
+            let mut items: Vec<(VoltID, StatusBarItem)> = status_items
+                .get()
+                .into_iter()
+                .filter(|(_, item)| item.alignment == alignment)
+                .collect();
+            items.sort_by_key(|(_, item)| std::cmp::Reverse(item.priority));
+            items
+        },
+        |item| item.clone(),
+        move |(_, item)| {
+            let text = item.text.clone();
+            let command = item.command.clone();
+            let clickable = command.is_some();
+            let plugin = plugin.clone();
+            let item_label = label(move || text.clone()).style(move |s| {
+                let config = config.get();
+                s.height_pct(100.0)
+                    .padding_horiz(10.0)
+                    .items_center()
+                    .color(config.color(LapceColor::STATUS_FOREGROUND))
+                    .apply_if(clickable, |s| {
+                        s.hover(|s| {
+                            s.cursor(CursorStyle::Pointer).background(
+                                config.color(LapceColor::PANEL_HOVERED_BACKGROUND),
+                            )
+                        })
+                    })
+                    .selectable(false)
+            });
+            match item.tooltip {
+                Some(tooltip) => {
+                    tooltip_label(config, item_label, move || tooltip.clone())
+                        .into_any()
+                }
+                None => item_label.into_any(),
+            }
+            .on_click_stop(move |_| {
+                if let Some(command) = command.as_ref() {
+                    plugin.run_command_by_name(command, None);
+                }
+            })
+            .style(|s| s.height_pct(100.0))
+        },
+    )
+    .style(|s| s.flex_row().height_pct(100.0).min_width(0.0))
+}
+
 fn status_text<S: std::fmt::Display + 'static>(
     config: ReadSignal<Arc<LapceConfig>>,
     editor: Memo<Option<EditorData>>,
@@ -471,3 +630,32 @@ fn status_text<S: std::fmt::Display + 'static>(
             .selectable(false)
     })
 }
+
+/// A status bar item about the hex editor, shown when the active file is binary.
+fn hex_status_text<S: std::fmt::Display + 'static>(
+    config: ReadSignal<Arc<LapceConfig>>,
+    editor: Memo<Option<EditorData>>,
+    text: impl Fn(&HexData) -> S + 'static,
+) -> impl View {
+    let hex = move || {
+        editor
+            .get()
+            .and_then(|editor| editor.doc_signal().get().binary.get())
+    };
+    label(move || hex().map(|hex| text(&hex).to_string()).unwrap_or_default()).style(
+        move |s| {
+            let config = config.get();
+            s.apply_if(hex().is_none(), |s| s.hide())
+                .height_full()
+                .padding_horiz(10.0)
+                .items_center()
+                .color(config.color(LapceColor::STATUS_FOREGROUND))
+                .hover(|s| {
+                    s.cursor(CursorStyle::Pointer).background(
+                        config.color(LapceColor::PANEL_HOVERED_BACKGROUND),
+                    )
+                })
+                .selectable(false)
+        },
+    )
+}
@@ -417,8 +417,10 @@ fn new_raw_terminal(
 
         {
             let raw = raw.clone();
-            if let Err(err) =
-                common.term_tx.send((term_id, TermEvent::NewTerminal(raw)))
+            let task = run_debug.is_some();
+            if let Err(err) = common
+                .term_tx
+                .send((term_id, TermEvent::NewTerminal { raw, task }))
             {
                 tracing::error!("{:?}", err);
             }
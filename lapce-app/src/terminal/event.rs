@@ -11,15 +11,28 @@
 use parking_lot::RwLock;
 
 use super::raw::RawTerminal;
+use crate::output::TaskOutput;
 
 /// The notifications for terminals to send back to main thread
 pub enum TermNotification {
-    SetTitle { term_id: TermId, title: String },
+    SetTitle {
+        term_id: TermId,
+        title: String,
+    },
     RequestPaint,
+    /// Lines a run or debug task wrote, for the Tasks output channel.
+    TaskOutput {
+        lines: Vec<String>,
+    },
 }
 
 pub enum TermEvent {
-    NewTerminal(Arc<RwLock<RawTerminal>>),
+    NewTerminal {
+        raw: Arc<RwLock<RawTerminal>>,
+        /// Whether it runs a task, whose output is also sent to the output
+        /// panel.
+        task: bool,
+    },
     UpdateContent(Vec<u8>),
     CloseTerminal,
 }
@@ -29,6 +42,7 @@ pub fn terminal_update_process(
     term_notification_tx: Sender<TermNotification>,
 ) {
     let mut terminals = HashMap::new();
+    let mut task_outputs: HashMap<TermId, TaskOutput> = HashMap::new();
     let mut last_redraw = Instant::now();
     let mut last_event = None;
     loop {
@@ -43,12 +57,35 @@ pub fn terminal_update_process(
         match event {
             TermEvent::CloseTerminal => {
                 terminals.remove(&term_id);
+                if let Some(line) = task_outputs
+                    .remove(&term_id)
+                    .and_then(|mut output| output.finish())
+                {
+                    if let Err(err) = term_notification_tx
+                        .send(TermNotification::TaskOutput { lines: vec![line] })
+                    {
+                        tracing::error!("{:?}", err);
+                    }
+                }
             }
-            TermEvent::NewTerminal(raw) => {
+            TermEvent::NewTerminal { raw, task } => {
                 terminals.insert(term_id, raw);
+                if task {
+                    task_outputs.insert(term_id, TaskOutput::default());
+                }
             }
             TermEvent::UpdateContent(content) => {
                 if let Some(raw) = terminals.get(&term_id) {
+                    if let Some(output) = task_outputs.get_mut(&term_id) {
+                        let lines = output.push(&content);
+                        if !lines.is_empty() {
+                            if let Err(err) = term_notification_tx
+                                .send(TermNotification::TaskOutput { lines })
+                            {
+                                tracing::error!("{:?}", err);
+                            }
+                        }
+                    }
                     {
                         raw.write().update_content(content);
                     }
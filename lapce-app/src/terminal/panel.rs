@@ -139,6 +139,7 @@ pub fn key_down<'a>(
         &self,
         event: impl Into<EventRef<'a>> + Copy,
         keypress: &KeyPressData,
+        window: &dyn KeyPressFocus,
     ) -> Option<KeyPressHandle> {
         if self.tab_info.with_untracked(|info| info.tabs.is_empty()) {
             self.new_tab(None);
@@ -147,7 +148,7 @@ pub fn key_down<'a>(
         let tab = self.active_tab(false);
         let terminal = tab.and_then(|tab| tab.active_terminal(false));
         if let Some(terminal) = terminal {
-            let handle = keypress.key_down(event, &terminal);
+            let handle = keypress.window_key_down(event, &terminal, window);
             let mode = terminal.get_mode();
 
             if !handle.handled && mode == Mode::Terminal {
@@ -18,7 +18,7 @@
     pointer::PointerInputEvent,
     prelude::SignalTrack,
     reactive::{ReadSignal, RwSignal, SignalGet, SignalWith, create_effect},
-    text::{Attrs, AttrsList, FamilyOwned, TextLayout, Weight},
+    text::{Attrs, AttrsList, TextLayout, Weight},
     views::editor::{core::register::Clipboard, text::SystemClipboard},
 };
 use lapce_core::mode::Mode;
@@ -31,7 +31,7 @@
 use super::{panel::TerminalPanelData, raw::RawTerminal};
 use crate::{
     command::InternalCommand,
-    config::{LapceConfig, color::LapceColor},
+    config::{LapceConfig, color::LapceColor, font::FontContext},
     debug::RunDebugProcess,
     editor::location::{EditorLocation, EditorPosition},
     listener::Listener,
@@ -53,7 +53,12 @@ struct TerminalLineContent<'a> {
     y: f64,
     bg: Vec<(usize, usize, Color)>,
     underline: Vec<(usize, usize, Color, f64)>,
-    chars: Vec<(char, Attrs<'a>, f64, f64)>,
+    /// Runs of characters drawn together, which is a single character
+    /// unless ligatures are on.
+    chars: Vec<(String, Attrs<'a>, f64, f64)>,
+    /// The column after the last run, and its color and weight, which the
+    /// next character has to match to join it.
+    run_end: Option<(usize, Color, bool)>,
     cursor: Option<(char, f64)>,
 }
 
@@ -150,11 +155,11 @@ pub fn terminal_view(
 impl TerminalView {
     fn char_size(&self) -> Size {
         let config = self.config.get_untracked();
-        let font_family = config.terminal_font_family();
         let font_size = config.terminal_font_size();
-        let family: Vec<FamilyOwned> =
-            FamilyOwned::parse_list(font_family).collect();
-        let attrs = Attrs::new().family(&family).font_size(font_size as f32);
+        let attrs = config
+            .font(FontContext::Terminal)
+            .attrs(Attrs::new())
+            .font_size(font_size as f32);
         let attrs_list = AttrsList::new(attrs);
         let mut text_layout = TextLayout::new();
         text_layout.set_text("W", attrs_list, None);
@@ -334,12 +339,13 @@ fn paint_content(
         let term_bg = config.color(LapceColor::TERMINAL_BACKGROUND);
 
         let font_size = config.terminal_font_size();
-        let font_family = config.terminal_font_family();
-        let family: Vec<FamilyOwned> =
-            FamilyOwned::parse_list(font_family).collect();
-        let attrs = Attrs::new().family(&family).font_size(font_size as f32);
+        let attrs = config
+            .font(FontContext::Terminal)
+            .attrs(Attrs::new())
+            .font_size(font_size as f32);
 
         let char_width = char_size.width;
+        let ligatures = config.terminal.font_ligatures;
 
         let cursor_point = &content.cursor.point;
 
@@ -348,6 +354,7 @@ fn paint_content(
             bg: Vec::new(),
             underline: Vec::new(),
             chars: Vec::new(),
+            run_end: None,
             cursor: None,
         };
         for item in content.display_iter {
@@ -371,6 +378,7 @@ fn paint_content(
                 line_content.bg.clear();
                 line_content.underline.clear();
                 line_content.chars.clear();
+                line_content.run_end = None;
                 line_content.cursor = None;
             }
 
@@ -413,11 +421,30 @@ fn paint_content(
             }
 
             if cell.c != ' ' && cell.c != '\t' {
-                let mut attrs = attrs.clone().color(fg);
-                if bold {
-                    attrs = attrs.weight(Weight::BOLD);
+                // Neighbouring characters of the same style are shaped
+                // together, so they can form ligatures. Wide characters would
+                // move the ones after them off the grid.
+                let single_width = cell.c.width() == Some(1);
+                let joins = ligatures
+                    && single_width
+                    && line_content.run_end == Some((point.column.0, fg, bold));
+                match line_content.chars.last_mut() {
+                    Some((run, ..)) if joins => run.push(cell.c),
+                    _ => {
+                        let mut attrs = attrs.clone().color(fg);
+                        if bold {
+                            attrs = attrs.weight(Weight::BOLD);
+                        }
+                        line_content.chars.push((
+                            cell.c.to_string(),
+                            attrs,
+                            x,
+                            char_y,
+                        ));
+                    }
                 }
-                line_content.chars.push((cell.c, attrs, x, char_y));
+                line_content.run_end =
+                    single_width.then_some((point.column.0 + 1, fg, bold));
             }
         }
         self.paint_line_content(cx, &line_content, line_height, char_width, config);
@@ -473,13 +500,9 @@ fn paint_line_content(
             }
         }
 
-        for (char, attr, x, y) in &line_content.chars {
+        for (text, attr, x, y) in &line_content.chars {
             let mut text_layout = TextLayout::new();
-            text_layout.set_text(
-                &char.to_string(),
-                AttrsList::new(attr.clone()),
-                None,
-            );
+            text_layout.set_text(text, AttrsList::new(attr.clone()), None);
             cx.draw_text(&text_layout, Point::new(*x, *y));
         }
     }
@@ -630,14 +653,14 @@ fn paint(&mut self, cx: &mut floem::context::PaintCx) {
         let config = self.config.get_untracked();
         let mode = self.mode.get_untracked();
         let line_height = config.terminal_line_height() as f64;
-        let font_family = config.terminal_font_family();
         let font_size = config.terminal_font_size();
         let char_size = self.char_size();
         let char_width = char_size.width;
 
-        let family: Vec<FamilyOwned> =
-            FamilyOwned::parse_list(font_family).collect();
-        let attrs = Attrs::new().family(&family).font_size(font_size as f32);
+        let attrs = config
+            .font(FontContext::Terminal)
+            .attrs(Attrs::new())
+            .font_size(font_size as f32);
 
         if let Some(error) = self.launch_error.get() {
             let mut text_layout = TextLayout::new();
@@ -0,0 +1,224 @@
+//! The inspector and export of the theme editor, which is the theme color
+//! settings tab.
+
+use std::{fs, path::Path};
+
+use anyhow::{Result, anyhow};
+use floem::{
+    View,
+    event::{Event, EventListener},
+    kurbo::Point,
+    reactive::{RwSignal, Scope, SignalGet, SignalUpdate},
+    views::{Decorators, empty},
+};
+use lapce_core::{buffer::rope_text::RopeText, directory::Directory};
+
+use crate::{
+    command::LapceWorkbenchCommand,
+    config::color_theme::{ColorThemeConfig, THEME_RECURSION_LIMIT},
+    doc::Doc,
+    listener::Listener,
+};
+
+/// Reveals in the theme editor the key that colors the next thing that is
+/// clicked.
+#[derive(Clone, Copy, Debug)]
+pub struct ThemeInspector {
+    pub active: RwSignal<bool>,
+    /// The key that the last inspected click revealed.
+    pub revealed: RwSignal<Option<String>>,
+    workbench_command: Listener<LapceWorkbenchCommand>,
+}
+
+impl ThemeInspector {
+    pub fn new(
+        cx: Scope,
+        workbench_command: Listener<LapceWorkbenchCommand>,
+    ) -> Self {
+        Self {
+            active: cx.create_rw_signal(false),
+            revealed: cx.create_rw_signal(None),
+            workbench_command,
+        }
+    }
+
+    /// Shows `key` in the theme editor if the inspector is active, which it
+    /// then stops being. Returns whether the click was inspected, in which
+    /// case it shouldn't do anything else.
+    pub fn reveal(&self, key: &str) -> bool {
+        if !self.active.get_untracked() {
+            return false;
+        }
+        self.active.set(false);
+        self.revealed.set(Some(key.to_string()));
+        self.workbench_command
+            .send(LapceWorkbenchCommand::OpenThemeColorSettings);
+        true
+    }
+}
+
+/// Covers its parent while the inspector is active, so that a click there
+/// reveals the key that `key` gives for where it landed, relative to the
+/// parent, instead of reaching the views below.
+pub fn inspector_overlay(
+    inspector: ThemeInspector,
+    key: impl Fn(Point) -> &'static str + 'static,
+) -> impl View {
+    empty()
+        .on_event_stop(EventListener::PointerDown, move |event| {
+            if let Event::PointerDown(pointer_event) = event {
+                inspector.reveal(key(pointer_event.pos));
+            }
+        })
+        .style(move |s| {
+            s.absolute()
+                .inset(0.0)
+                .apply_if(!inspector.active.get(), |s| s.hide())
+        })
+}
+
+/// The syntax key that colors the text at `offset`, if it's highlighted.
+pub fn syntax_key_at(doc: &Doc, offset: usize) -> Option<String> {
+    let (line, col) = doc
+        .buffer
+        .with_untracked(|buffer| buffer.offset_to_line_col(offset));
+    doc.line_style(line)
+        .iter()
+        .find(|style| style.start <= col && col < style.end)
+        .and_then(|style| style.style.fg_color.clone())
+}
+
+/// The values a theme value goes through as its `$variable` references are
+/// followed, ending with the color itself. Variables are looked up in the
+/// theme, then in the default theme.
+pub fn resolve_chain<'a>(
+    theme: &'a ColorThemeConfig,
+    default: &'a ColorThemeConfig,
+    value: &'a str,
+) -> Vec<&'a str> {
+    let mut chain = vec![value];
+    let mut value = value;
+    for _ in 0..THEME_RECURSION_LIMIT {
+        let Some(variable) = value.strip_prefix('$') else {
+            break;
+        };
+        let Some(next) = theme
+            .base
+            .get(variable)
+            .or_else(|| default.base.get(variable))
+            .map(String::as_str)
+        else {
+            break;
+        };
+        chain.push(next);
+        value = next;
+    }
+    chain
+}
+
+/// A color theme file with the colors of `theme`, named `name`.
+pub fn theme_toml(theme: &ColorThemeConfig, name: &str) -> Result<String> {
+    let mut theme = theme.clone();
+    theme.name = name.to_string();
+    let mut table = toml::value::Table::new();
+    table.insert("color-theme".to_string(), toml::Value::try_from(&theme)?);
+    Ok(toml::to_string_pretty(&toml::Value::Table(table))?)
+}
+
+fn file_name(name: &str) -> String {
+    let name: String = name
+        .chars()
+        .map(|c| {
+            if c.is_alphanumeric() {
+                c.to_ascii_lowercase()
+            } else {
+                '-'
+            }
+        })
+        .collect();
+    format!("{}.toml", name.trim_matches('-'))
+}
+
+/// Saves the theme to the themes directory, where it's picked up as an
+/// installed theme.
+pub fn save_theme(theme: &ColorThemeConfig, name: &str) -> Result<()> {
+    let dir = Directory::themes_directory()
+        .ok_or_else(|| anyhow!("can't get themes directory"))?;
+    fs::write(dir.join(file_name(name)), theme_toml(theme, name)?)?;
+    Ok(())
+}
+
+/// Writes the theme as an unpacked volt in `dir`, which can be installed with
+/// `Install Plugin from File` or published to a registry.
+pub fn save_theme_volt(
+    theme: &ColorThemeConfig,
+    name: &str,
+    dir: &Path,
+) -> Result<()> {
+    let theme_file = file_name(name);
+    fs::create_dir_all(dir)?;
+    fs::write(dir.join(&theme_file), theme_toml(theme, name)?)?;
+
+    let mut volt = toml::value::Table::new();
+    volt.insert(
+        "name".to_string(),
+        theme_file.trim_end_matches(".toml").into(),
+    );
+    volt.insert("version".to_string(), "0.1.0".into());
+    volt.insert("display-name".to_string(), name.into());
+    volt.insert("author".to_string(), "local".into());
+    volt.insert(
+        "description".to_string(),
+        format!("The {name} color theme").into(),
+    );
+    volt.insert(
+        "color-themes".to_string(),
+        toml::Value::Array(vec![theme_file.into()]),
+    );
+    fs::write(
+        dir.join("volt.toml"),
+        toml::to_string_pretty(&toml::Value::Table(volt))?,
+    )?;
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use std::collections::BTreeMap;
+
+    use super::{file_name, resolve_chain};
+    use crate::config::color_theme::{ColorThemeConfig, ThemeBaseConfig};
+
+    #[test]
+    fn test_resolve_chain() {
+        let theme = ColorThemeConfig {
+            base: ThemeBaseConfig(BTreeMap::from([
+                ("accent".to_string(), "$blue".to_string()),
+                ("loop".to_string(), "$loop".to_string()),
+            ])),
+            ..Default::default()
+        };
+        let default = ColorThemeConfig {
+            base: ThemeBaseConfig(BTreeMap::from([(
+                "blue".to_string(),
+                "#61afef".to_string(),
+            )])),
+            ..Default::default()
+        };
+        assert_eq!(
+            resolve_chain(&theme, &default, "$accent"),
+            vec!["$accent", "$blue", "#61afef"]
+        );
+        assert_eq!(resolve_chain(&theme, &default, "#000000"), vec!["#000000"]);
+        assert_eq!(
+            resolve_chain(&theme, &default, "$missing"),
+            vec!["$missing"]
+        );
+        assert_eq!(resolve_chain(&theme, &default, "$loop").len(), 7);
+    }
+
+    #[test]
+    fn test_file_name() {
+        assert_eq!(file_name("My Theme (Dark)"), "my-theme--dark.toml");
+    }
+}
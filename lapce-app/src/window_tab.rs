@@ -15,7 +15,7 @@
     ViewId,
     action::{TimerToken, open_file, remove_overlay},
     ext_event::{create_ext_action, create_signal_from_channel},
-    file::FileDialogOptions,
+    file::{FileDialogOptions, FileSpec},
     keyboard::Modifiers,
     kurbo::Size,
     peniko::kurbo::{Point, Rect, Vec2},
@@ -36,19 +36,23 @@
 };
 use lapce_rpc::{
     RpcError,
-    core::CoreNotification,
+    core::{CoreNotification, LogLevel},
     dap_types::{ConfigSource, RunDebugConfig},
     file::{Naming, PathObject},
-    plugin::PluginId,
+    plugin::{
+        DEBUGGERS_SECTION, LANGUAGE_SERVERS_SECTION, PluginCommand, PluginId,
+        PluginNotificationParams,
+    },
     proxy::{ProxyResponse, ProxyRpcHandler, ProxyStatus},
     source_control::FileDiff,
     terminal::TermId,
 };
 use lsp_types::{
-    CodeActionOrCommand, CodeLens, Diagnostic, ProgressParams, ProgressToken,
-    ShowMessageParams,
+    CodeActionOrCommand, CodeLens, Diagnostic, MessageType, ProgressParams,
+    ProgressToken, Range, ShowMessageParams,
 };
 use serde_json::Value;
+use strum::IntoEnumIterator;
 use tracing::{Level, debug, error, event};
 
 use crate::{
@@ -60,7 +64,7 @@
         LapceWorkbenchCommand, WindowCommand,
     },
     completion::{CompletionData, CompletionStatus},
-    config::LapceConfig,
+    config::{LapceConfig, vscode_theme::import_vscode_theme_file},
     db::LapceDb,
     debug::{DapData, LapceBreakpoint, RunDebugMode, RunDebugProcess},
     doc::DocContent,
@@ -72,10 +76,15 @@
     hover::HoverData,
     id::WindowTabId,
     inline_completion::InlineCompletionData,
-    keypress::{EventRef, KeyPressData, KeyPressFocus, condition::Condition},
+    keypress::{
+        EventRef, KeyPressData, KeyPressFocus,
+        condition::{Condition, ContextKey},
+        vscode::import_vscode_keybindings_file,
+    },
     listener::Listener,
     lsp::path_from_url,
     main_split::{MainSplitData, SplitData, SplitDirection, SplitMoveDirection},
+    output::{OutputData, OutputSource},
     palette::{DEFAULT_RUN_TOML, PaletteData, PaletteStatus, kind::PaletteKind},
     panel::{
         call_hierarchy_view::{CallHierarchyData, CallHierarchyItemData},
@@ -86,16 +95,21 @@
     plugin::PluginData,
     proxy::{ProxyData, new_proxy},
     rename::RenameData,
+    settings_sync::{self, SyncLocation, SyncResult},
     source_control::SourceControlData,
     terminal::{
         event::{TermEvent, TermNotification, terminal_update_process},
         panel::TerminalPanelData,
     },
+    theme_editor::{ThemeInspector, save_theme},
     tracing::*,
     window::WindowCommonData,
     workspace::{LapceWorkspace, LapceWorkspaceType, WorkspaceInfo},
 };
 
+/// How much the panel resize commands grow or shrink a panel by.
+const PANEL_RESIZE_STEP: f64 = 20.0;
+
 #[derive(Debug, Clone, PartialEq, Eq)]
 pub enum Focus {
     Workbench,
@@ -154,6 +168,7 @@ pub struct CommonData {
     pub breakpoints: RwSignal<BTreeMap<PathBuf, BTreeMap<usize, LapceBreakpoint>>>,
     // the current focused view which will receive keyboard events
     pub keyboard_focus: RwSignal<Option<ViewId>>,
+    pub theme_inspector: ThemeInspector,
     pub window_common: Rc<WindowCommonData>,
 }
 
@@ -176,6 +191,7 @@ pub struct WindowTabData {
     pub panel: PanelData,
     pub terminal: TerminalPanelData,
     pub plugin: PluginData,
+    pub output: OutputData,
     pub code_action: RwSignal<CodeActionData>,
     pub code_lens: RwSignal<Option<ViewId>>,
     pub source_control: SourceControlData,
@@ -221,6 +237,33 @@ fn check_condition(&self, condition: Condition) -> bool {
         }
     }
 
+    fn context_values(&self, key: ContextKey) -> Vec<String> {
+        match key {
+            ContextKey::PanelVisible => PanelKind::iter()
+                .filter(|kind| self.panel.is_panel_visible(kind))
+                .map(|kind| <&str>::from(kind).to_string())
+                .collect(),
+            ContextKey::DebugState => {
+                let (running, stopped) =
+                    self.terminal.debug.daps.with_untracked(|daps| {
+                        (
+                            !daps.is_empty(),
+                            daps.values().any(|dap| dap.stopped.get_untracked()),
+                        )
+                    });
+                let state = if stopped {
+                    "stopped"
+                } else if running {
+                    "running"
+                } else {
+                    "inactive"
+                };
+                vec![state.to_string()]
+            }
+            _ => Vec::new(),
+        }
+    }
+
     fn run_command(
         &self,
         command: &LapceCommand,
@@ -231,6 +274,9 @@ fn run_command(
             CommandKind::Workbench(cmd) => {
                 self.run_workbench_command(cmd.clone(), None);
             }
+            CommandKind::Plugin(cmd) => {
+                self.run_plugin_command(cmd, None);
+            }
             CommandKind::Focus(cmd) => {
                 if self.common.focus.get_untracked() == Focus::Workbench {
                     match cmd {
@@ -388,6 +434,7 @@ pub fn new(
             window_origin: cx.create_rw_signal(Point::ZERO),
             breakpoints: cx.create_rw_signal(BTreeMap::new()),
             keyboard_focus: cx.create_rw_signal(None),
+            theme_inspector: ThemeInspector::new(cx, workbench_command),
             window_common: window_common.clone(),
         });
 
@@ -521,9 +568,12 @@ pub fn new(
             proxy.core_rpc.clone(),
         );
 
+        let output = OutputData::new(cx, main_split.editors, common.clone());
+
         {
             let notification = create_signal_from_channel(term_notification_rx);
             let terminal = terminal.clone();
+            let output = output.clone();
             cx.create_effect(move |_| {
                 notification.with(|notification| {
                     if let Some(notification) = notification.as_ref() {
@@ -534,6 +584,15 @@ pub fn new(
                             TermNotification::RequestPaint => {
                                 view_id.get_untracked().request_paint();
                             }
+                            TermNotification::TaskOutput { lines } => {
+                                for line in lines {
+                                    output.append(
+                                        "Tasks",
+                                        LogLevel::Info,
+                                        line.clone(),
+                                    );
+                                }
+                            }
                         }
                     }
                 });
@@ -556,6 +615,7 @@ pub fn new(
             code_lens: cx.create_rw_signal(None),
             source_control,
             plugin,
+            output,
             rename,
             global_search,
             call_hierarchy_data: CallHierarchyData {
@@ -592,6 +652,40 @@ pub fn new(
             });
         }
 
+        {
+            // Plugins can ask for the focused editor and its selections
+            let active_editor = window_tab_data.main_split.active_editor;
+            let proxy = window_tab_data.common.proxy.clone();
+            cx.create_effect(move |last: Option<(Option<PathBuf>, Vec<Range>)>| {
+                let state = active_editor
+                    .get()
+                    .map(|editor| {
+                        let doc = editor.doc();
+                        let path = doc.content.with(|c| c.path().cloned());
+                        let selections = editor.cursor().with(|cursor| {
+                            doc.buffer.with_untracked(|buffer| {
+                                cursor
+                                    .edit_selection(buffer)
+                                    .regions()
+                                    .iter()
+                                    .map(|region| Range {
+                                        start: buffer
+                                            .offset_to_position(region.min()),
+                                        end: buffer.offset_to_position(region.max()),
+                                    })
+                                    .collect()
+                            })
+                        });
+                        (path, selections)
+                    })
+                    .unwrap_or_default();
+                if last.as_ref() != Some(&state) {
+                    proxy.active_editor_changed(state.0.clone(), state.1.clone());
+                }
+                state
+            });
+        }
+
         {
             let window_tab_data = window_tab_data.clone();
             window_tab_data.common.lapce_command.listen(move |cmd| {
@@ -648,8 +742,13 @@ pub fn reload_config(&self) {
             keypress.update_keymaps(&config);
         });
 
+        let old_plugins = self.common.config.get_untracked().plugins.clone();
         let mut change_plugins = Vec::new();
-        for (key, configs) in self.common.config.get_untracked().plugins.iter() {
+        for (key, configs) in old_plugins.iter() {
+            // these declare servers for the proxy rather than configure a volt
+            if key == LANGUAGE_SERVERS_SECTION || key == DEBUGGERS_SECTION {
+                continue;
+            }
             if config
                 .plugins
                 .get(key)
@@ -660,7 +759,7 @@ pub fn reload_config(&self) {
             }
         }
         self.set_config.set(Arc::new(config.clone()));
-        if !change_plugins.is_empty() {
+        if old_plugins != config.plugins {
             self.common
                 .proxy
                 .update_plugin_configs(config.plugins.clone());
@@ -710,9 +809,27 @@ pub fn run_lapce_command(&self, cmd: LapceCommand) {
             }
             CommandKind::MotionMode(_) => {}
             CommandKind::MultiSelection(_) => {}
+            CommandKind::Plugin(command) => {
+                self.run_plugin_command(&command, cmd.data);
+            }
         }
     }
 
+    /// Runs a command registered by a plugin. An array in `data` is passed
+    /// on as the command's arguments.
+    pub fn run_plugin_command(&self, cmd: &PluginCommand, data: Option<Value>) {
+        let arguments = match data {
+            Some(Value::Array(arguments)) => arguments,
+            Some(value) => vec![value],
+            None => Vec::new(),
+        };
+        self.common.proxy.execute_plugin_command(
+            cmd.volt.clone(),
+            cmd.command.clone(),
+            arguments,
+        );
+    }
+
     pub fn run_workbench_command(
         &self,
         cmd: LapceWorkbenchCommand,
@@ -879,6 +996,98 @@ pub fn run_workbench_command(
                     );
                 }
             }
+            ImportVsCodeKeybindings => {
+                let internal_command = self.common.internal_command;
+                let options = FileDialogOptions::new()
+                    .title("Choose a VS Code keybindings.json")
+                    .allowed_types(vec![FileSpec {
+                        name: "JSON",
+                        extensions: &["json"],
+                    }]);
+                open_file(options, move |file| {
+                    let Some(path) = file.and_then(|mut file| file.path.pop())
+                    else {
+                        return;
+                    };
+                    // the config watcher reloads the keymaps once they're saved
+                    let imported = import_vscode_keybindings_file(&path).and_then(
+                        |imported| {
+                            KeyPressData::append_to_file(&imported.keymaps)?;
+                            Ok(imported)
+                        },
+                    );
+                    match imported {
+                        Ok(imported) => {
+                            if !imported.unconverted.is_empty() {
+                                internal_command.send(InternalCommand::ShowAlert {
+                                    title: format!(
+                                        "Imported {} keybindings, {} could not be converted",
+                                        imported.keymaps.len(),
+                                        imported.unconverted.len()
+                                    ),
+                                    msg: imported.unconverted_summary(20),
+                                    buttons: Vec::new(),
+                                });
+                            }
+                        }
+                        Err(err) => {
+                            tracing::error!("{:?}", err);
+                            internal_command.send(InternalCommand::ShowAlert {
+                                title: "Failed to import the keybindings"
+                                    .to_string(),
+                                msg: err.to_string(),
+                                buttons: Vec::new(),
+                            });
+                        }
+                    }
+                });
+            }
+            SetUpSettingsSync => {
+                let lapce_command = self.common.lapce_command;
+                let internal_command = self.common.internal_command;
+                let set_up = move |location: SyncLocation| {
+                    match settings_sync::set_location(Some(&location)) {
+                        Ok(()) => lapce_command.send(LapceCommand {
+                            kind: CommandKind::Workbench(
+                                LapceWorkbenchCommand::SyncSettings,
+                            ),
+                            data: None,
+                        }),
+                        Err(err) => {
+                            tracing::error!("{:?}", err);
+                            internal_command.send(InternalCommand::ShowAlert {
+                                title: "Failed to set up settings sync".to_string(),
+                                msg: err.to_string(),
+                                buttons: Vec::new(),
+                            });
+                        }
+                    }
+                };
+                // A git url, which can't be picked from the file dialog, can
+                // be given as the argument
+                if let Some(location) = data.as_ref().and_then(|data| data.as_str())
+                {
+                    set_up(SyncLocation::parse(location));
+                } else {
+                    let options = FileDialogOptions::new()
+                        .title("Choose a folder or git repository to sync to")
+                        .select_directories();
+                    open_file(options, move |file| {
+                        if let Some(path) = file.and_then(|mut file| file.path.pop())
+                        {
+                            set_up(SyncLocation::parse(&path.to_string_lossy()));
+                        }
+                    });
+                }
+            }
+            SyncSettings => {
+                self.sync_settings(false);
+            }
+            TurnOffSettingsSync => {
+                if let Err(err) = settings_sync::set_location(None) {
+                    tracing::error!("{:?}", err);
+                }
+            }
             OpenLogFile => {
                 if let Some(dir) = Directory::logs_directory() {
                     self.open_paths(&[PathObject::from_path(
@@ -922,9 +1131,85 @@ pub fn run_workbench_command(
             }
 
             InstallTheme => {}
+            InstallVoltFromPath => {
+                if self.workspace.kind.is_remote() {
+                    self.show_message(
+                        "Install Plugin from File",
+                        &ShowMessageParams {
+                            typ: MessageType::ERROR,
+                            message: "Plugins can only be installed from a file \
+                                      in a local workspace"
+                                .to_string(),
+                        },
+                    );
+                } else {
+                    let plugin = self.plugin.clone();
+                    let core_rpc = self.proxy.core_rpc.clone();
+                    let options = FileDialogOptions::new()
+                        .title("Choose a .volt archive or a volt.toml");
+                    open_file(options, move |file| {
+                        if let Some(mut file) = file {
+                            if let Some(path) = file.path.pop() {
+                                plugin.install_volt_from_path(path, core_rpc);
+                            } else {
+                                tracing::error!("No path");
+                            }
+                        }
+                    });
+                }
+            }
             ExportCurrentThemeSettings => {
                 self.main_split.export_theme();
             }
+            ImportVsCodeTheme => {
+                let internal_command = self.common.internal_command;
+                let options = FileDialogOptions::new()
+                    .title("Choose a VS Code color theme")
+                    .allowed_types(vec![FileSpec {
+                        name: "JSON",
+                        extensions: &["json"],
+                    }]);
+                open_file(options, move |file| {
+                    let Some(path) = file.and_then(|mut file| file.path.pop())
+                    else {
+                        return;
+                    };
+                    let imported = import_vscode_theme_file(&path).and_then(
+                        |imported| {
+                            save_theme(&imported.theme, &imported.theme.name)?;
+                            Ok(imported)
+                        },
+                    );
+                    match imported {
+                        Ok(imported) => {
+                            internal_command.send(InternalCommand::SetColorTheme {
+                                name: imported.theme.name.clone(),
+                                save: true,
+                            });
+                            if !imported.unmapped.is_empty() {
+                                internal_command.send(InternalCommand::ShowAlert {
+                                    title: format!(
+                                        "Imported {} with {} entries that could not be mapped",
+                                        imported.theme.name,
+                                        imported.unmapped.len()
+                                    ),
+                                    msg: imported.unmapped_summary(20),
+                                    buttons: Vec::new(),
+                                });
+                            }
+                        }
+                        Err(err) => {
+                            tracing::error!("{:?}", err);
+                            internal_command.send(InternalCommand::ShowAlert {
+                                title: "Failed to import the color theme"
+                                    .to_string(),
+                                msg: err.to_string(),
+                                buttons: Vec::new(),
+                            });
+                        }
+                    }
+                });
+            }
             ToggleInlayHints => {}
 
             // ==== Window ====
@@ -1106,7 +1391,12 @@ pub fn run_workbench_command(
             PaletteHelp => self.palette.run(PaletteKind::PaletteHelp),
             PaletteHelpAndFile => self.palette.run(PaletteKind::HelpAndFile),
             PaletteLine => {
-                self.palette.run(PaletteKind::Line);
+                // Binary files have offsets rather than lines to go to
+                if self.main_split.active_hex_data().is_some() {
+                    self.palette.run(PaletteKind::GoToOffset);
+                } else {
+                    self.palette.run(PaletteKind::Line);
+                }
             }
             Palette => {
                 self.palette.run(PaletteKind::File);
@@ -1139,7 +1429,37 @@ pub fn run_workbench_command(
             ChangeFileLineEnding => {
                 self.palette.run(PaletteKind::LineEnding);
             }
+            ChangeFileEncoding => {
+                self.palette.run(PaletteKind::FileEncoding);
+            }
+            ReopenWithEncoding => {
+                self.palette.run(PaletteKind::ReopenWithEncoding);
+            }
+            SaveWithEncoding => {
+                self.palette.run(PaletteKind::SaveWithEncoding);
+            }
             DiffFiles => self.palette.run(PaletteKind::DiffFiles),
+            GoToOffset => {
+                if self.main_split.active_hex_data().is_some() {
+                    self.palette.run(PaletteKind::GoToOffset);
+                }
+            }
+            SearchBytes => {
+                if self.main_split.active_hex_data().is_some() {
+                    self.palette.run(PaletteKind::SearchBytes);
+                }
+            }
+            ToggleHexInsertMode => {
+                if let Some(hex) = self.main_split.active_hex_data() {
+                    hex.toggle_insert_mode();
+                }
+            }
+            ToggleSvgSource => {
+                self.main_split.toggle_svg_source();
+            }
+            MarkdownPreviewToSide => {
+                self.main_split.open_markdown_preview_to_side();
+            }
 
             // ==== Running / Debugging ====
             RunAndDebugRestart => {
@@ -1249,6 +1569,27 @@ pub fn run_workbench_command(
             TogglePanelBottomVisual => {
                 self.toggle_container_visual(&PanelContainerPosition::Bottom);
             }
+            FocusNextPanel => {
+                self.focus_panel_by(1);
+            }
+            FocusPreviousPanel => {
+                self.focus_panel_by(-1);
+            }
+            IncreasePanelSize => {
+                self.resize_focused_panel(PANEL_RESIZE_STEP);
+            }
+            DecreasePanelSize => {
+                self.resize_focused_panel(-PANEL_RESIZE_STEP);
+            }
+            MovePanelToNextPosition => {
+                if let Some(kind) = self.focused_panel() {
+                    if let Some((_, position)) = self.panel.panel_position(&kind) {
+                        let position = position.next();
+                        self.panel.move_panel_to_position(kind, &position);
+                        self.show_panel(kind);
+                    }
+                }
+            }
             ToggleTerminalFocus => {
                 self.toggle_panel_focus(PanelKind::Terminal);
             }
@@ -1924,10 +2265,14 @@ pub fn run_internal_command(&self, cmd: InternalCommand) {
             }
             InternalCommand::SetColorTheme { name, save } => {
                 if save {
+                    // Replace the theme of the current appearance when light
+                    // and dark themes are set
+                    let (key, _) =
+                        self.common.config.get_untracked().active_color_theme();
                     // The config file is watched
                     LapceConfig::update_file(
                         "core",
-                        "color-theme",
+                        key,
                         toml_edit::Value::from(name),
                     );
                 } else {
@@ -2171,6 +2516,29 @@ fn handle_core_notification(&self, rpc: &CoreNotification) {
             }
             CoreNotification::TerminalProcessStopped { term_id, exit_code } => {
                 debug!("TerminalProcessStopped {:?}, {:?}", term_id, exit_code);
+                let run_debug = self
+                    .terminal
+                    .get_terminal(term_id)
+                    .and_then(|terminal| terminal.run_debug.get_untracked());
+                if let Some(run_debug) = run_debug {
+                    let name = if run_debug.is_prelaunch
+                        && run_debug.config.prelaunch.is_some()
+                    {
+                        format!("Prelaunch of {}", run_debug.config.name)
+                    } else {
+                        run_debug.config.name.clone()
+                    };
+                    let (level, text) = match exit_code {
+                        Some(0) | None => {
+                            (LogLevel::Info, format!("{name} finished"))
+                        }
+                        Some(code) => (
+                            LogLevel::Error,
+                            format!("{name} exited with code {code}"),
+                        ),
+                    };
+                    self.output.append("Tasks", level, text);
+                }
                 if let Err(err) = self
                     .common
                     .term_tx
@@ -2262,6 +2630,42 @@ fn handle_core_notification(&self, rpc: &CoreNotification) {
             CoreNotification::VoltInstalled { volt, icon } => {
                 self.plugin.volt_installed(volt, icon);
             }
+            CoreNotification::VoltInstalling { volt, error } => {
+                self.plugin.volt_installing(volt);
+                if !error.is_empty() {
+                    self.show_message(
+                        &format!("Install {}", volt.display_name),
+                        &ShowMessageParams {
+                            typ: MessageType::ERROR,
+                            message: error.clone(),
+                        },
+                    );
+                }
+            }
+            CoreNotification::PluginCommandRegistered { command } => {
+                self.plugin.command_registered(command.clone());
+            }
+            CoreNotification::PluginStatusBarItem { volt, item } => {
+                self.plugin.status_bar_item(volt.clone(), item.clone());
+            }
+            CoreNotification::PluginStatusBarItemDisposed { volt, id } => {
+                self.plugin.status_bar_item_disposed(volt, id);
+            }
+            CoreNotification::ApplyWorkspaceEdit { edit } => {
+                self.main_split.apply_workspace_edit(edit);
+            }
+            CoreNotification::PluginTreeViewRegistered { view } => {
+                self.plugin.tree_view_registered(view.clone());
+            }
+            CoreNotification::PluginTreeViewRefresh { volt, view, node } => {
+                self.plugin.tree_view_refresh(volt, view, node.as_deref());
+            }
+            CoreNotification::PluginNotification { title, params, .. } => {
+                self.show_plugin_notification(title, params);
+            }
+            CoreNotification::VoltPermissionsRequested { volt } => {
+                self.plugin.volt_permissions_requested(volt.clone());
+            }
             CoreNotification::VoltRemoved { volt, .. } => {
                 self.plugin.volt_removed(volt);
             }
@@ -2276,10 +2680,10 @@ fn handle_core_notification(&self, rpc: &CoreNotification) {
                 message,
                 target,
             } => {
-                use lapce_rpc::core::LogLevel;
                 use tracing_log::log::{Level, log};
 
                 let target = target.clone().unwrap_or(String::from("unknown"));
+                self.log_to_output(*level, &target, message);
 
                 match level {
                     LogLevel::Trace => {
@@ -2299,9 +2703,23 @@ fn handle_core_notification(&self, rpc: &CoreNotification) {
                     }
                 }
             }
+            CoreNotification::Output {
+                channel,
+                level,
+                text,
+            } => {
+                self.output.append(channel, *level, text.clone());
+            }
             CoreNotification::LogMessage { message, target } => {
-                use lsp_types::MessageType;
                 use tracing_log::log::{Level, log};
+
+                let level = match message.typ {
+                    MessageType::ERROR => LogLevel::Error,
+                    MessageType::WARNING => LogLevel::Warn,
+                    MessageType::INFO => LogLevel::Info,
+                    _ => LogLevel::Debug,
+                };
+                self.log_to_output(level, target, &message.message);
                 match message.typ {
                     MessageType::ERROR => {
                         log!(target: target, Level::Error, "{}", message.message)
@@ -2328,6 +2746,32 @@ fn handle_core_notification(&self, rpc: &CoreNotification) {
         }
     }
 
+    /// Shows a log line from the proxy in the output channel of the volt or
+    /// language server it came from, going by its target.
+    fn log_to_output(&self, level: LogLevel, target: &str, message: &str) {
+        let Some(source) = OutputSource::from_target(target) else {
+            return;
+        };
+        let (OutputSource::Volt(volt) | OutputSource::LanguageServer(volt)) =
+            &source;
+        let display_name = self
+            .plugin
+            .installed
+            .with_untracked(|installed| {
+                installed
+                    .get(volt)
+                    .map(|v| v.meta.with_untracked(|m| m.display_name.clone()))
+            })
+            .unwrap_or_else(|| volt.name.clone());
+        let channel = match source {
+            OutputSource::Volt(_) => display_name,
+            OutputSource::LanguageServer(_) => {
+                format!("{display_name} Language Server")
+            }
+        };
+        self.output.append(&channel, level, message.to_string());
+    }
+
     pub fn key_down<'a>(&self, event: impl Into<EventRef<'a>> + Copy) -> bool {
         if self.alert_data.active.get_untracked() {
             return false;
@@ -2335,25 +2779,34 @@ pub fn key_down<'a>(&self, event: impl Into<EventRef<'a>> + Copy) -> bool {
         let focus = self.common.focus.get_untracked();
         let keypress = self.common.keypress.get_untracked();
         let handle = match focus {
-            Focus::Workbench => self.main_split.key_down(event, &keypress),
-            Focus::Palette => Some(keypress.key_down(event, &self.palette)),
+            Focus::Workbench => self.main_split.key_down(event, &keypress, self),
+            Focus::Palette => {
+                Some(keypress.window_key_down(event, &self.palette, self))
+            }
             Focus::CodeAction => {
                 let code_action = self.code_action.get_untracked();
-                Some(keypress.key_down(event, &code_action))
+                Some(keypress.window_key_down(event, &code_action, self))
+            }
+            Focus::Rename => {
+                Some(keypress.window_key_down(event, &self.rename, self))
+            }
+            Focus::AboutPopup => {
+                Some(keypress.window_key_down(event, &self.about_data, self))
             }
-            Focus::Rename => Some(keypress.key_down(event, &self.rename)),
-            Focus::AboutPopup => Some(keypress.key_down(event, &self.about_data)),
             Focus::Panel(PanelKind::Terminal) => {
-                self.terminal.key_down(event, &keypress)
+                self.terminal.key_down(event, &keypress, self)
             }
             Focus::Panel(PanelKind::Search) => {
-                Some(keypress.key_down(event, &self.global_search))
+                Some(keypress.window_key_down(event, &self.global_search, self))
             }
             Focus::Panel(PanelKind::Plugin) => {
-                Some(keypress.key_down(event, &self.plugin))
+                Some(keypress.window_key_down(event, &self.plugin, self))
             }
             Focus::Panel(PanelKind::SourceControl) => {
-                Some(keypress.key_down(event, &self.source_control))
+                Some(keypress.window_key_down(event, &self.source_control, self))
+            }
+            Focus::Panel(PanelKind::Output) => {
+                Some(keypress.window_key_down(event, &self.output, self))
             }
             _ => None,
         };
@@ -2371,7 +2824,7 @@ pub fn key_down<'a>(&self, event: impl Into<EventRef<'a>> + Copy) -> bool {
                     .handled
             }
         } else {
-            keypress.key_down(event, self).handled
+            keypress.window_key_down(event, self, self).handled
         }
     }
 
@@ -2636,14 +3089,16 @@ fn toggle_panel_focus(&self, kind: PanelKind) {
             | PanelKind::CallHierarchy
             | PanelKind::DocumentSymbol
             | PanelKind::References
-            | PanelKind::Implementation => {
+            | PanelKind::Implementation
+            | PanelKind::PluginViews => {
                 // Some panels don't accept focus (yet). Fall back to visibility check
                 // in those cases.
                 self.panel.is_panel_visible(&kind)
             }
-            PanelKind::Terminal | PanelKind::SourceControl | PanelKind::Search => {
-                self.is_panel_focused(kind)
-            }
+            PanelKind::Terminal
+            | PanelKind::SourceControl
+            | PanelKind::Search
+            | PanelKind::Output => self.is_panel_focused(kind),
         };
         if should_hide {
             self.hide_panel(kind);
@@ -2696,6 +3151,41 @@ fn is_panel_focused(&self, kind: PanelKind) -> bool {
             && self.panel.is_panel_visible(&kind)
     }
 
+    /// The panel with the focus, if any.
+    fn focused_panel(&self) -> Option<PanelKind> {
+        match self.common.focus.get_untracked() {
+            Focus::Panel(kind) => Some(kind),
+            _ => None,
+        }
+    }
+
+    /// Show and focus the panel `step` panels away from the focused one, or
+    /// the first or last panel if none has the focus.
+    fn focus_panel_by(&self, step: isize) {
+        let panels = self.panel.all_panels();
+        if panels.is_empty() {
+            return;
+        }
+        let len = panels.len() as isize;
+        let index = match self
+            .focused_panel()
+            .and_then(|kind| panels.iter().position(|p| p == &kind))
+        {
+            Some(index) => (index as isize + step).rem_euclid(len),
+            None if step > 0 => 0,
+            None => len - 1,
+        };
+        self.show_panel(panels[index as usize]);
+    }
+
+    fn resize_focused_panel(&self, delta: f64) {
+        if let Some(kind) = self.focused_panel() {
+            if let Some((_, position)) = self.panel.panel_position(&kind) {
+                self.panel.resize_container(&position.container(), delta);
+            }
+        }
+    }
+
     fn hide_panel(&self, kind: PanelKind) {
         self.panel.hide_panel(&kind);
         self.common.focus.set(Focus::Workbench);
@@ -2738,6 +3228,16 @@ fn run_and_debug(
         config: &RunDebugConfig,
     ) {
         debug!("{:?}", config);
+        let mut command = config.program.clone();
+        for arg in config.args.iter().flatten() {
+            command.push(' ');
+            command.push_str(arg);
+        }
+        self.output.append(
+            "Tasks",
+            LogLevel::Info,
+            format!("{mode} {}: {command}", config.name),
+        );
         match mode {
             RunDebugMode::Run => {
                 self.run_in_terminal(cx, mode, config, false);
@@ -2856,6 +3356,41 @@ pub fn show_alert(&self, title: String, msg: String, buttons: Vec<AlertButton>)
         self.alert_data.active.set(true);
     }
 
+    /// Syncs the settings in the background. A `quiet` sync only reports
+    /// changes, conflicts and errors.
+    pub fn sync_settings(&self, quiet: bool) {
+        let Some(location) = settings_sync::location() else {
+            if !quiet {
+                self.common.lapce_command.send(LapceCommand {
+                    kind: CommandKind::Workbench(
+                        LapceWorkbenchCommand::SetUpSettingsSync,
+                    ),
+                    data: None,
+                });
+            }
+            return;
+        };
+
+        let db: Arc<LapceDb> = use_context().unwrap();
+        let plugin = self.plugin.clone();
+        let messages = self.messages;
+        let send = create_ext_action(self.scope, move |result| {
+            settings_synced(&plugin, messages, result, quiet);
+        });
+        std::thread::Builder::new()
+            .name("SettingsSync".to_owned())
+            .spawn(move || {
+                send(settings_sync::sync(&location, &db));
+            })
+            .unwrap();
+    }
+
+    /// Shows the outcome of a settings sync started elsewhere, like the one
+    /// on startup.
+    pub fn settings_synced(&self, result: anyhow::Result<SyncResult>, quiet: bool) {
+        settings_synced(&self.plugin, self.messages, result, quiet);
+    }
+
     fn update_progress(&self, progress: &ProgressParams) {
         let token = progress.token.clone();
         match &progress.value {
@@ -2888,6 +3423,43 @@ fn update_progress(&self, progress: &ProgressParams) {
         }
     }
 
+    /// Notifications without actions are shown like other messages, the
+    /// ones with actions ask the user to pick one.
+    fn show_plugin_notification(
+        &self,
+        title: &str,
+        params: &PluginNotificationParams,
+    ) {
+        if params.actions.is_empty() {
+            self.show_message(
+                title,
+                &ShowMessageParams {
+                    typ: MessageType::INFO,
+                    message: params.message.clone(),
+                },
+            );
+            return;
+        }
+
+        let internal_command = self.common.internal_command;
+        let buttons = params
+            .actions
+            .iter()
+            .map(|action| {
+                let plugin = self.plugin.clone();
+                let command = action.command.clone();
+                AlertButton {
+                    text: action.title.clone(),
+                    action: Rc::new(move || {
+                        internal_command.send(InternalCommand::HideAlert);
+                        plugin.run_command_by_name(&command, None);
+                    }),
+                }
+            })
+            .collect();
+        self.show_alert(title.to_string(), params.message.clone(), buttons);
+    }
+
     fn show_message(&self, title: &str, message: &ShowMessageParams) {
         self.messages.update(|messages| {
             messages.push((title.to_string(), message.clone()));
@@ -2983,6 +3555,104 @@ pub fn call_hierarchy_incoming(&self, item_id: ViewId) {
 }
 
 /// Open path with the default application without blocking.
+/// Applies the pulled volt lists, and asks how to resolve the first conflict.
+/// Resolving it syncs again, which brings up the next one.
+fn settings_synced(
+    plugin: &PluginData,
+    messages: RwSignal<Vec<(String, ShowMessageParams)>>,
+    result: anyhow::Result<SyncResult>,
+    quiet: bool,
+) {
+    let show_message = |typ: MessageType, message: String| {
+        messages.update(|messages| {
+            messages.push((
+                "Settings Sync".to_string(),
+                ShowMessageParams { typ, message },
+            ));
+        });
+    };
+    let result = match result {
+        Ok(result) => result,
+        Err(err) => {
+            tracing::error!("{:?}", err);
+            show_message(MessageType::ERROR, format!("{err:#}"));
+            return;
+        }
+    };
+
+    if let Some(volts) = result.volts {
+        plugin.apply_synced_volts(volts);
+    }
+    if !result.pulled.is_empty() {
+        show_message(
+            MessageType::INFO,
+            format!("Updated {}", result.pulled.join(", ")),
+        );
+    } else if result.is_empty() && !quiet {
+        show_message(MessageType::INFO, "Settings are up to date".to_string());
+    }
+
+    let Some(conflict) = result.conflicts.first().cloned() else {
+        return;
+    };
+    let internal_command = plugin.common.internal_command;
+    let lapce_command = plugin.common.lapce_command;
+    let resolve = move |keep_local: bool| {
+        let conflict = conflict.clone();
+        Rc::new(move || {
+            internal_command.send(InternalCommand::HideAlert);
+            if let Err(err) = settings_sync::resolve_conflict(&conflict, keep_local)
+            {
+                tracing::error!("{:?}", err);
+                return;
+            }
+            lapce_command.send(LapceCommand {
+                kind: CommandKind::Workbench(LapceWorkbenchCommand::SyncSettings),
+                data: None,
+            });
+        }) as Rc<dyn Fn()>
+    };
+    let mut buttons = vec![
+        AlertButton {
+            text: "Keep Local".to_string(),
+            action: resolve(true),
+        },
+        AlertButton {
+            text: "Use Remote".to_string(),
+            action: resolve(false),
+        },
+    ];
+    if let Some(remote) = conflict.remote.clone().filter(|_| conflict.local.exists())
+    {
+        let local = conflict.local.clone();
+        buttons.push(AlertButton {
+            text: "Compare".to_string(),
+            action: Rc::new(move || {
+                internal_command.send(InternalCommand::HideAlert);
+                internal_command.send(InternalCommand::OpenDiffFiles {
+                    left_path: remote.clone(),
+                    right_path: local.clone(),
+                });
+            }),
+        });
+    }
+    internal_command.send(InternalCommand::ShowAlert {
+        title: format!(
+            "{} was changed both here and in the sync location",
+            conflict.name
+        ),
+        msg: format!(
+            "Keep the copy on this machine, or replace it with the one from the sync location.{}",
+            if result.conflicts.len() > 1 {
+                format!(" {} more files conflict.", result.conflicts.len() - 1)
+            } else {
+                String::new()
+            }
+        ),
+        buttons,
+    });
+}
+
 fn open_uri(path: &Path) {
     match open::that(path) {
         Ok(_) => {
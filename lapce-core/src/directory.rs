@@ -175,6 +175,41 @@ pub fn queries_directory() -> Option<PathBuf> {
         }
     }
 
+    /// Get the path to the user snippets folder, with one `.json` file of
+    /// snippets per language
+    pub fn snippets_directory() -> Option<PathBuf> {
+        if let Some(dir) = Self::config_directory() {
+            let dir = dir.join("snippets");
+            if !dir.exists() {
+                if let Err(err) = std::fs::create_dir(&dir) {
+                    tracing::error!("{:?}", err);
+                }
+            }
+
+            Some(dir)
+        } else {
+            None
+        }
+    }
+
+    /// Get the path to the settings sync state, which is kept per machine:
+    /// the sync location, the last synced copy of each file and the git
+    /// checkout when syncing to a repository
+    pub fn settings_sync_directory() -> Option<PathBuf> {
+        if let Some(dir) = Self::data_local_directory() {
+            let dir = dir.join("settings-sync");
+            if !dir.exists() {
+                if let Err(err) = std::fs::create_dir(&dir) {
+                    tracing::error!("{:?}", err);
+                }
+            }
+
+            Some(dir)
+        } else {
+            None
+        }
+    }
+
     pub fn grammars_directory() -> Option<PathBuf> {
         if let Some(dir) = Self::data_local_directory() {
             let dir = dir.join("grammars");
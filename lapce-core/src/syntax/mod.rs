@@ -1203,6 +1203,33 @@ pub fn find_enclosing_parentheses(
         }
     }
 
+    /// Find the syntax nodes around `offset` that span more than one line,
+    /// innermost first, returning their start and end offsets. The root node
+    /// is not a scope.
+    pub fn find_enclosing_scopes(&self, offset: usize) -> Vec<(usize, usize)> {
+        let mut scopes = Vec::new();
+        if offset > self.text.len() {
+            return scopes;
+        }
+
+        let Some(tree) = self.layers.as_ref().and_then(|layers| layers.try_tree())
+        else {
+            return scopes;
+        };
+        let mut node = tree.root_node().descendant_for_byte_range(offset, offset);
+        while let Some(current) = node {
+            let parent = current.parent();
+            if parent.is_some()
+                && current.is_named()
+                && current.start_position().row < current.end_position().row
+            {
+                scopes.push((current.start_byte(), current.end_byte()));
+            }
+            node = parent;
+        }
+        scopes
+    }
+
     pub fn find_enclosing_pair(&self, offset: usize) -> Option<(usize, usize)> {
         if self.language == LapceLanguage::Markdown {
             // TODO: fix the issue that sometimes node.prev_sibling can stuck for markdown
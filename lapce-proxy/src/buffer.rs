@@ -3,15 +3,22 @@
     ffi::OsString,
     fs,
     fs::File,
-    io::{Read, Write},
+    io::{self, Read, Seek, SeekFrom, Write},
     path::{Path, PathBuf},
     time::SystemTime,
 };
 
 use anyhow::{Result, anyhow};
+use encoding_rs::{
+    BIG5, EUC_JP, EUC_KR, Encoding, GBK, SHIFT_JIS, UTF_8, UTF_16BE, UTF_16LE,
+    WINDOWS_1252,
+};
 use floem_editor_core::buffer::rope_text::CharIndicesJoin;
 use lapce_core::encoding::offset_utf8_to_utf16;
-use lapce_rpc::buffer::BufferId;
+use lapce_rpc::buffer::{
+    BufferId, FileEncoding, LARGE_FILE_PAGE_BYTES, LARGE_FILE_PAGE_LINES,
+    LargeFileInfo,
+};
 use lapce_xi_rope::{RopeDelta, interval::IntervalBounds, rope::Rope};
 use lsp_types::*;
 
@@ -24,15 +31,53 @@ pub struct Buffer {
     pub path: PathBuf,
     pub rev: u64,
     pub mod_time: Option<SystemTime>,
+    pub encoding: FileEncoding,
+    /// In large-file mode, the part of the file the editor hasn't loaded. The
+    /// rope only has the part it has, which its edits are made to.
+    pub unloaded: Option<Unloaded>,
+    /// Whether the file isn't text. The editor works with its bytes instead.
+    pub binary: bool,
+    /// Whether the file has bytes that aren't valid in its encoding, which makes
+    /// the buffer read only.
+    pub lossy: bool,
+}
+
+/// The part of a file in large-file mode that the editor hasn't loaded, which
+/// is read from disk a page at a time.
+#[derive(Clone, Debug)]
+pub struct Unloaded {
+    /// The file it's in. That's the buffer's own file, unless the buffer was
+    /// saved under a new name and hasn't been saved again since.
+    pub path: PathBuf,
+    /// Where it starts in the file
+    pub offset: u64,
+    /// The length of the file
+    pub file_len: u64,
+    /// The encoding of the file, which the part is kept in when saving
+    pub encoding: &'static Encoding,
+    /// The page last sent to the editor and how many bytes of the file it
+    /// takes, until the editor has loaded it
+    page: Option<(String, u64)>,
 }
 
 impl Buffer {
     pub fn new(id: BufferId, path: PathBuf) -> Buffer {
-        let (s, read_only) = match load_file(&path) {
-            Ok(s) => (s, false),
+        let mut binary = false;
+        let mut lossy = false;
+        let ((s, encoding), read_only) = match load_file(&path) {
+            // Saving text that was decoded lossily would write the replacement
+            // characters over what the file had
+            Ok(decoded) => {
+                lossy = decoded.lossy;
+                ((decoded.text, decoded.encoding), lossy)
+            }
+            Err(err) if err.is::<BinaryFileError>() => {
+                binary = true;
+                ((String::new(), FileEncoding::default()), true)
+            }
             Err(err) => {
                 use std::io::ErrorKind;
-                match err.downcast_ref::<std::io::Error>() {
+                let (s, read_only) = match err.downcast_ref::<std::io::Error>() {
                     Some(err) => match err.kind() {
                         ErrorKind::PermissionDenied => {
                             ("Permission Denied".to_string(), true)
@@ -44,7 +89,8 @@ pub fn new(id: BufferId, path: PathBuf) -> Buffer {
                         _ => (format!("Not supported: {err}"), true),
                     },
                     None => (format!("Not supported: {err}"), true),
-                }
+                };
+                ((s, FileEncoding::default()), read_only)
             }
         };
         let rope = Rope::from(s);
@@ -59,7 +105,119 @@ pub fn new(id: BufferId, path: PathBuf) -> Buffer {
             language_id,
             rev,
             mod_time,
+            encoding,
+            unloaded: None,
+            binary,
+            lossy,
+        }
+    }
+
+    /// Open a file in large-file mode, reading only enough of it to detect its
+    /// encoding and get the first page for the editor.
+    pub fn new_large(id: BufferId, path: PathBuf) -> Buffer {
+        let detected = File::open(&path)
+            .and_then(|mut file| {
+                let file_len = file.metadata()?.len();
+                let mut prefix = Vec::new();
+                (&mut file)
+                    .take(DETECT_ENCODING_LEN)
+                    .read_to_end(&mut prefix)?;
+                Ok((prefix, file_len))
+            })
+            .map_err(anyhow::Error::from)
+            .and_then(|(prefix, file_len)| {
+                let whole = prefix.len() as u64 == file_len;
+                Ok((detect_encoding(&prefix, whole)?, file_len))
+            });
+        let ((encoding, bom_len), file_len) = match detected {
+            Ok(detected) => detected,
+            // Binary files and ones that can't be read are opened as usual
+            Err(_) => return Buffer::new(id, path),
+        };
+
+        let mut buffer = Buffer {
+            id,
+            rope: Rope::default(),
+            read_only: false,
+            language_id: language_id_from_path(&path).unwrap_or(""),
+            rev: 0,
+            mod_time: get_mod_time(&path),
+            encoding: FileEncoding::new(encoding.name(), bom_len > 0),
+            unloaded: Some(Unloaded {
+                path: path.clone(),
+                offset: bom_len as u64,
+                file_len,
+                encoding,
+                page: None,
+            }),
+            binary: false,
+            lossy: false,
+            path,
+        };
+        if let Ok((page, _)) = buffer.next_page() {
+            buffer.page_loaded(page.len(), 1);
         }
+        buffer.rev = u64::from(!buffer.rope.is_empty());
+        buffer
+    }
+
+    pub fn is_large(&self) -> bool {
+        self.unloaded.is_some()
+    }
+
+    /// The size of a large file and how much of it the editor has loaded.
+    pub fn large_file_info(&self) -> Option<LargeFileInfo> {
+        self.unloaded.as_ref().map(|unloaded| LargeFileInfo {
+            len: unloaded.file_len,
+            loaded: unloaded.offset,
+        })
+    }
+
+    /// The page of a large file that follows what the editor has loaded, up to
+    /// [`LARGE_FILE_PAGE_LINES`] lines, or [`LARGE_FILE_PAGE_BYTES`] bytes for
+    /// files with very long lines, along with where it ends in the file.
+    pub fn next_page(&mut self) -> Result<(String, u64)> {
+        let unloaded = self
+            .unloaded
+            .as_mut()
+            .ok_or_else(|| anyhow!("the buffer isn't in large-file mode"))?;
+        if unloaded.page.is_none() {
+            let (text, len, lossy) =
+                read_page(&unloaded.path, unloaded.offset, unloaded.encoding)?;
+            // Saving text that was decoded lossily would write the replacement
+            // characters over what the file had
+            if lossy {
+                self.read_only = true;
+                self.lossy = true;
+            }
+            unloaded.page = Some((text, len));
+        }
+        let (text, len) = unloaded.page.clone().unwrap_or_default();
+        Ok((text, unloaded.offset + len))
+    }
+
+    /// Record that the editor appended the page of a large buffer it got from
+    /// [`Buffer::next_page`], `len` bytes long, as revision `rev`.
+    pub fn page_loaded(&mut self, len: usize, rev: u64) {
+        if self.rev + 1 != rev {
+            return;
+        }
+        let Some(unloaded) = self.unloaded.as_mut() else {
+            return;
+        };
+        if unloaded
+            .page
+            .as_ref()
+            .is_none_or(|(text, _)| text.len() != len)
+        {
+            return;
+        }
+        let Some((text, file_len)) = unloaded.page.take() else {
+            return;
+        };
+        self.rev += 1;
+        self.rope.edit(self.rope.len().., text.as_str());
+        unloaded.offset += file_len;
     }
 
     pub fn save(&mut self, rev: u64, create_parents: bool) -> Result<()> {
@@ -85,6 +243,27 @@ pub fn save(&mut self, rev: u64, create_parents: bool) -> Result<()> {
         };
         let new_file = !path.exists();
 
+        // The part of a large file the editor hasn't loaded is copied over
+        // unchanged, so it has to stay in the encoding it's in
+        let tail = match &self.unloaded {
+            Some(unloaded) if unloaded.offset < unloaded.file_len => {
+                if encoding_for(&self.encoding)? != unloaded.encoding {
+                    return Err(anyhow!(
+                        "a large file can only be saved with another encoding \
+                         once all of it is loaded"
+                    ));
+                }
+                if new_file && unloaded.path == self.path {
+                    return Err(anyhow!(
+                        "the file was removed, taking the part of it that \
+                         isn't loaded"
+                    ));
+                }
+                Some(unloaded)
+            }
+            _ => None,
+        };
+
         let bak_file_path = &path.with_extension(bak_extension);
         if !new_file {
             fs::copy(&path, bak_file_path)?;
@@ -96,13 +275,54 @@ pub fn save(&mut self, rev: u64, create_parents: bool) -> Result<()> {
             }
         }
 
+        // Encode before touching the file, so text the encoding can't represent
+        // doesn't leave it truncated
+        let encoded = if self.encoding.is_utf8() && !self.encoding.bom {
+            None
+        } else {
+            Some(encode_text(&self.rope.to_string(), &self.encoding)?)
+        };
+
         let mut f = fs::OpenOptions::new()
             .create(true)
             .write(true)
             .truncate(true)
             .open(&path)?;
-        for chunk in self.rope.iter_chunks(..self.rope.len()) {
-            f.write_all(chunk.as_bytes())?;
+        let written = match encoded {
+            Some(bytes) => {
+                f.write_all(&bytes)?;
+                bytes.len()
+            }
+            None => {
+                for chunk in self.rope.iter_chunks(..self.rope.len()) {
+                    f.write_all(chunk.as_bytes())?;
+                }
+                self.rope.len()
+            }
+        } as u64;
+        if let Some(tail) = tail {
+            // The file itself was just overwritten, the backup still has it
+            let tail_path = if tail.path == self.path {
+                bak_file_path
+            } else {
+                &tail.path
+            };
+            let mut tail_file = File::open(tail_path)?;
+            tail_file.seek(SeekFrom::Start(tail.offset))?;
+            let tail_len = io::copy(&mut tail_file, &mut f)?;
+            let page = tail.page.clone();
+            self.unloaded = Some(Unloaded {
+                path: self.path.clone(),
+                offset: written,
+                file_len: written + tail_len,
+                encoding: tail.encoding,
+                page,
+            });
+        } else if let Some(unloaded) = self.unloaded.as_mut() {
+            unloaded.path = self.path.clone();
+            unloaded.offset = written;
+            unloaded.file_len = written;
+            unloaded.encoding = encoding_for(&self.encoding)?;
         }
 
         self.mod_time = get_mod_time(&path);
@@ -122,6 +342,12 @@ pub fn update(
             return None;
         }
         self.rev += 1;
+        // Large files aren't synced to language servers, so there's no change
+        // to report
+        if self.is_large() {
+            self.rope = delta.apply(&self.rope);
+            return None;
+        }
         let content_change = get_document_content_changes(delta, self);
         self.rope = delta.apply(&self.rope);
         Some(
@@ -192,22 +418,343 @@ pub fn is_empty(&self) -> bool {
     }
 }
 
-pub fn load_file(path: &Path) -> Result<String> {
-    read_path_to_string(path)
+/// The error for files that aren't text in any encoding.
+#[derive(Debug)]
+pub struct BinaryFileError;
+
+impl std::fmt::Display for BinaryFileError {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "binary file")
+    }
 }
 
-pub fn read_path_to_string<P: AsRef<Path>>(path: P) -> Result<String> {
-    let path = path.as_ref();
+impl std::error::Error for BinaryFileError {}
 
+/// How much of a file is read to tell whether it's binary, and to detect the
+/// encoding of a file in large-file mode.
+const DETECT_ENCODING_LEN: u64 = 64 * 1024;
+
+/// Read the page of a large file at `offset`: up to [`LARGE_FILE_PAGE_LINES`]
+/// lines, or [`LARGE_FILE_PAGE_BYTES`] bytes for files with very long lines.
+/// Returns its text, how many bytes of the file it takes and whether some of
+/// them weren't valid in the encoding.
+fn read_page(
+    path: &Path,
+    offset: u64,
+    encoding: &'static Encoding,
+) -> Result<(String, u64, bool)> {
     let mut file = File::open(path)?;
-    // Read the file in as bytes
-    let mut buffer = Vec::new();
-    file.read_to_end(&mut buffer)?;
+    file.seek(SeekFrom::Start(offset))?;
+    let mut bytes = Vec::new();
+    file.take(LARGE_FILE_PAGE_BYTES as u64)
+        .read_to_end(&mut bytes)?;
+    let to_end = bytes.len() < LARGE_FILE_PAGE_BYTES;
+    let end = page_end(&bytes, encoding, to_end);
+    let (text, lossy) = encoding.decode_without_bom_handling(&bytes[..end]);
+    Ok((text.into_owned(), end as u64, lossy))
+}
+
+/// Where a page read into `bytes` ends: after its [`LARGE_FILE_PAGE_LINES`]th
+/// line, or else at the end of `bytes` if they run to the end of the file, or
+/// else at the last character boundary in them.
+fn page_end(bytes: &[u8], encoding: &'static Encoding, to_end: bool) -> usize {
+    // In UTF-16 a line break is a whole code unit, in the other encodings a
+    // newline byte is never part of another character
+    let (unit, newline): (usize, &[u8]) = if encoding == UTF_16LE {
+        (2, b"\n\0")
+    } else if encoding == UTF_16BE {
+        (2, b"\0\n")
+    } else {
+        (1, b"\n")
+    };
+    if let Some((i, _)) = bytes
+        .chunks_exact(unit)
+        .enumerate()
+        .filter(|(_, c)| *c == newline)
+        .nth(LARGE_FILE_PAGE_LINES - 1)
+    {
+        return (i + 1) * unit;
+    }
+    if to_end {
+        return bytes.len();
+    }
+
+    if encoding == UTF_8 {
+        // Leave out the last character, which may be cut off
+        bytes
+            .iter()
+            .rposition(|b| b & 0xC0 != 0x80)
+            .unwrap_or(bytes.len())
+    } else if unit == 2 {
+        let end = bytes.len() & !1;
+        let last = if encoding == UTF_16LE {
+            u16::from_le_bytes([bytes[end - 2], bytes[end - 1]])
+        } else {
+            u16::from_be_bytes([bytes[end - 2], bytes[end - 1]])
+        };
+        // A high surrogate needs the low one that follows it
+        if (0xD800..0xDC00).contains(&last) {
+            end - 2
+        } else {
+            end
+        }
+    } else {
+        // Bytes below 0x40 are never part of a multibyte character in the
+        // legacy encodings
+        bytes
+            .iter()
+            .rposition(|b| *b < 0x40)
+            .map_or(bytes.len(), |i| i + 1)
+    }
+}
+
+/// Text decoded from the bytes of a file.
+#[derive(Debug, PartialEq, Eq)]
+pub struct DecodedText {
+    pub text: String,
+    pub encoding: FileEncoding,
+    /// Whether some bytes weren't valid in the encoding and were replaced with
+    /// U+FFFD, so the text doesn't save back to the same bytes.
+    pub lossy: bool,
+}
+
+/// Read a file, detecting its encoding. Binary files are told apart by their
+/// start, without reading the rest of them.
+pub fn load_file(path: &Path) -> Result<DecodedText> {
+    let mut file = File::open(path)?;
+    let mut bytes = Vec::new();
+    (&mut file)
+        .take(DETECT_ENCODING_LEN)
+        .read_to_end(&mut bytes)?;
+    detect_encoding(&bytes, (bytes.len() as u64) < DETECT_ENCODING_LEN)?;
+    file.read_to_end(&mut bytes)?;
+    decode_bytes(&bytes)
+}
+
+/// Read a file with a known encoding.
+pub fn load_file_with_encoding(
+    path: &Path,
+    encoding: &FileEncoding,
+) -> Result<DecodedText> {
+    decode_bytes_with_encoding(&fs::read(path)?, encoding)
+}
+
+/// Decode the contents of a file, detecting the encoding with
+/// [`detect_encoding`].
+pub fn decode_bytes(bytes: &[u8]) -> Result<DecodedText> {
+    let (encoding, bom_len) = detect_encoding(bytes, true)?;
+    let (text, lossy) = encoding.decode_without_bom_handling(&bytes[bom_len..]);
+    Ok(DecodedText {
+        text: text.into_owned(),
+        encoding: FileEncoding::new(encoding.name(), bom_len > 0),
+        lossy,
+    })
+}
+
+/// Detect the encoding of a file from its first bytes, `prefix`, which are all
+/// of it if `whole`: from a byte order mark, whether it is valid UTF-8, or the
+/// layout of UTF-16 text without one, and otherwise guessing it from the legacy
+/// encodings in [`LEGACY_ENCODINGS`]. Returns the length of the byte order mark
+/// along with the encoding.
+pub fn detect_encoding(
+    prefix: &[u8],
+    whole: bool,
+) -> Result<(&'static Encoding, usize)> {
+    if let Some(found) = Encoding::for_bom(prefix) {
+        return Ok(found);
+    }
+
+    let utf8 = match std::str::from_utf8(prefix) {
+        Ok(_) => true,
+        // Only a character cut off by the end of the prefix
+        Err(err) => !whole && err.error_len().is_none(),
+    };
+    // ASCII text in UTF-16 is valid UTF-8 too, but has NUL bytes that UTF-8
+    // text doesn't
+    if utf8 && !prefix.contains(&0) {
+        return Ok((UTF_8, 0));
+    }
+    if let Some(encoding) = detect_utf16_without_bom(prefix) {
+        return Ok((encoding, 0));
+    }
+    if utf8 {
+        return Ok((UTF_8, 0));
+    }
+
+    // Nothing but UTF-16 has NUL bytes in text, so this is a binary file
+    if prefix.contains(&0) {
+        return Err(BinaryFileError.into());
+    }
+
+    Ok((guess_legacy_encoding(prefix, whole), 0))
+}
+
+/// Decode the contents of a file with `encoding`, dropping its byte order mark.
+/// The returned encoding tells whether there was one.
+pub fn decode_bytes_with_encoding(
+    bytes: &[u8],
+    encoding: &FileEncoding,
+) -> Result<DecodedText> {
+    let encoding = encoding_for(encoding)?;
+    let bom = Encoding::for_bom(bytes).is_some_and(|(bom, _)| bom == encoding);
+    let (text, lossy) = encoding.decode_with_bom_removal(bytes);
+    Ok(DecodedText {
+        text: text.into_owned(),
+        encoding: FileEncoding::new(encoding.name(), bom),
+        lossy,
+    })
+}
 
-    // Parse the file contents as utf8
-    let contents = String::from_utf8(buffer)?;
+/// Encode `text` to be saved with `encoding`, failing if it has characters the
+/// encoding can't represent.
+pub fn encode_text(text: &str, file_encoding: &FileEncoding) -> Result<Vec<u8>> {
+    let encoding = encoding_for(file_encoding)?;
+    let mut bytes = Vec::with_capacity(text.len() + 3);
+    if encoding == UTF_8 {
+        if file_encoding.bom {
+            bytes.extend_from_slice(b"\xEF\xBB\xBF");
+        }
+        bytes.extend_from_slice(text.as_bytes());
+    } else if encoding == UTF_16LE || encoding == UTF_16BE {
+        // encoding_rs only decodes UTF-16
+        let le = encoding == UTF_16LE;
+        let unit_bytes = |unit: u16| {
+            if le {
+                unit.to_le_bytes()
+            } else {
+                unit.to_be_bytes()
+            }
+        };
+        if file_encoding.bom {
+            bytes.extend_from_slice(&unit_bytes(0xFEFF));
+        }
+        for unit in text.encode_utf16() {
+            bytes.extend_from_slice(&unit_bytes(unit));
+        }
+    } else {
+        let (encoded, _, had_errors) = encoding.encode(text);
+        if had_errors {
+            return Err(anyhow!(
+                "the text has characters that can't be saved as {}",
+                encoding.name()
+            ));
+        }
+        bytes.extend_from_slice(&encoded);
+    }
+    Ok(bytes)
+}
+
+fn encoding_for(encoding: &FileEncoding) -> Result<&'static Encoding> {
+    Encoding::for_label(encoding.name.as_bytes())
+        .ok_or_else(|| anyhow!("unknown encoding {}", encoding.name))
+}
 
-    Ok(contents.to_string())
+/// UTF-16 text mostly in ASCII, as source code is, has a NUL byte in every other
+/// position, which tells apart the byte order as well.
+fn detect_utf16_without_bom(bytes: &[u8]) -> Option<&'static Encoding> {
+    let sample = &bytes[..bytes.len().min(4096) & !1];
+    if sample.is_empty() {
+        return None;
+    }
+    let units = sample.len() / 2;
+    let (mut even_nuls, mut odd_nuls) = (0, 0);
+    for pair in sample.chunks_exact(2) {
+        even_nuls += usize::from(pair[0] == 0);
+        odd_nuls += usize::from(pair[1] == 0);
+    }
+    if odd_nuls * 10 >= units * 7 && even_nuls * 10 <= units {
+        Some(UTF_16LE)
+    } else if even_nuls * 10 >= units * 7 && odd_nuls * 10 <= units {
+        Some(UTF_16BE)
+    } else {
+        None
+    }
+}
+
+/// The multibyte encodings a file that isn't UTF-8 is tried in, each with a
+/// check that the decoded text looks like the script written with it. The
+/// first one that decodes without errors and passes its check is taken.
+const LEGACY_ENCODINGS: [(&Encoding, fn(&str) -> bool); 5] = [
+    (EUC_KR, looks_korean),
+    (SHIFT_JIS, looks_japanese),
+    (EUC_JP, looks_japanese),
+    (GBK, looks_chinese),
+    (BIG5, looks_chinese),
+];
+
+/// Guess the encoding of text that isn't UTF-8 from [`LEGACY_ENCODINGS`], or
+/// else take windows-1252, which decodes anything. `bytes` are the whole file
+/// if `whole`.
+fn guess_legacy_encoding(bytes: &[u8], whole: bool) -> &'static Encoding {
+    let sample = &bytes[..bytes.len().min(64 * 1024)];
+    let whole = whole && sample.len() == bytes.len();
+    for (encoding, looks_right) in LEGACY_ENCODINGS {
+        let (decoded, had_errors) = encoding.decode_without_bom_handling(sample);
+        // A character cut off by the end of the sample is only an error if the
+        // sample is the whole file
+        let text: &str = if whole {
+            &decoded
+        } else {
+            decoded.trim_end_matches('\u{FFFD}')
+        };
+        if (had_errors && text.contains('\u{FFFD}')) || !looks_right(text) {
+            continue;
+        }
+        return encoding;
+    }
+    WINDOWS_1252
+}
+
+/// How many of the non-ASCII characters in `text` match `f`, out of how many.
+fn non_ascii_share(text: &str, f: impl Fn(char) -> bool) -> (usize, usize) {
+    text.chars()
+        .filter(|c| !c.is_ascii())
+        .fold((0, 0), |(matched, all), c| {
+            (matched + usize::from(f(c)), all + 1)
+        })
+}
+
+/// Whether nine in ten of the non-ASCII characters of `text` match `f`.
+fn mostly(text: &str, f: impl Fn(char) -> bool) -> bool {
+    let (matched, all) = non_ascii_share(text, f);
+    all > 0 && matched * 10 >= all * 9
+}
+
+fn is_cjk_punctuation(c: char) -> bool {
+    // Fullwidth forms, but not the halfwidth katakana
+    matches!(
+        c,
+        '\u{3000}'..='\u{303F}' | '\u{FF00}'..='\u{FF60}' | '\u{FFE0}'..='\u{FFEF}'
+    )
+}
+
+fn is_ideograph(c: char) -> bool {
+    matches!(c, '\u{4E00}'..='\u{9FFF}')
+}
+
+fn is_kana(c: char) -> bool {
+    matches!(c, '\u{3040}'..='\u{30FF}')
+}
+
+/// Korean is written in hangul, where text in the other encodings decoded as
+/// EUC-KR turns into a mix of hangul and ideographs.
+fn looks_korean(text: &str) -> bool {
+    mostly(text, |c| {
+        matches!(c, '\u{AC00}'..='\u{D7AF}') || is_cjk_punctuation(c)
+    })
+}
+
+/// Japanese has kana between its ideographs, which Chinese doesn't.
+fn looks_japanese(text: &str) -> bool {
+    let (kana, all) = non_ascii_share(text, is_kana);
+    kana * 10 >= all
+        && mostly(text, |c| {
+            is_kana(c) || is_ideograph(c) || is_cjk_punctuation(c)
+        })
+}
+
+fn looks_chinese(text: &str) -> bool {
+    mostly(text, |c| is_ideograph(c) || is_cjk_punctuation(c))
 }
 
 pub fn language_id_from_path(path: &Path) -> Option<&'static str> {
@@ -348,3 +895,185 @@ pub fn get_mod_time<P: AsRef<Path>>(path: P) -> Option<SystemTime> {
         .and_then(|meta| meta.modified())
         .ok()
 }
+
+#[cfg(test)]
+mod tests {
+    use std::fs;
+
+    use encoding_rs::{UTF_8, UTF_16LE};
+    use lapce_rpc::buffer::{
+        BufferId, FileEncoding, LARGE_FILE_PAGE_BYTES, LARGE_FILE_PAGE_LINES,
+    };
+    use lapce_xi_rope::{Delta, Interval, Rope};
+
+    use super::{
+        BinaryFileError, Buffer, DecodedText, decode_bytes,
+        decode_bytes_with_encoding, encode_text, load_file, page_end,
+    };
+
+    fn decoded(text: &str, encoding: FileEncoding, lossy: bool) -> DecodedText {
+        DecodedText {
+            text: text.to_string(),
+            encoding,
+            lossy,
+        }
+    }
+
+    #[test]
+    fn test_decode_bytes() {
+        assert_eq!(
+            decode_bytes("héllo".as_bytes()).unwrap(),
+            decoded("héllo", FileEncoding::default(), false)
+        );
+        assert_eq!(
+            decode_bytes(b"\xEF\xBB\xBFhi").unwrap(),
+            decoded("hi", FileEncoding::new("UTF-8", true), false)
+        );
+        assert_eq!(
+            decode_bytes(b"\xFF\xFEh\0i\0").unwrap(),
+            decoded("hi", FileEncoding::new("UTF-16LE", true), false)
+        );
+        assert_eq!(
+            decode_bytes(b"\0f\0n\0 \0m\0a\0i\0n").unwrap(),
+            decoded("fn main", FileEncoding::new("UTF-16BE", false), false)
+        );
+        assert_eq!(
+            decode_bytes(b"caf\xE9 cr\xE8me br\xFBl\xE9e, d\xE9j\xE0 vu").unwrap(),
+            decoded(
+                "café crème brûlée, déjà vu",
+                FileEncoding::new("windows-1252", false),
+                false
+            )
+        );
+        assert_eq!(
+            decode_bytes(b"\x82\xB1\x82\xF1\x82\xC9\x82\xBF\x82\xCD").unwrap(),
+            decoded("こんにちは", FileEncoding::new("Shift_JIS", false), false)
+        );
+        assert_eq!(
+            decode_bytes(b"\xC7\xD1\xB1\xB9\xBE\xEE").unwrap(),
+            decoded("한국어", FileEncoding::new("EUC-KR", false), false)
+        );
+        assert_eq!(
+            decode_bytes(b"\xD6\xD0\xCE\xC4").unwrap(),
+            decoded("中文", FileEncoding::new("GBK", false), false)
+        );
+
+        // Bytes that aren't valid after a byte order mark are replaced
+        assert_eq!(
+            decode_bytes(b"\xEF\xBB\xBFh\xFFi").unwrap(),
+            decoded("h\u{FFFD}i", FileEncoding::new("UTF-8", true), true)
+        );
+
+        assert!(
+            decode_bytes(b"\x89PNG\r\n\x1a\n\0\0\0\rIHDR\xff")
+                .unwrap_err()
+                .is::<BinaryFileError>()
+        );
+    }
+
+    #[test]
+    fn test_encode_text() {
+        let sjis = FileEncoding::new("Shift_JIS", false);
+        let bytes = encode_text("日本語", &sjis).unwrap();
+        assert_eq!(bytes, b"\x93\xFA\x96\x7B\x8C\xEA");
+        assert_eq!(
+            decode_bytes_with_encoding(&bytes, &sjis).unwrap(),
+            decoded("日本語", sjis.clone(), false)
+        );
+        assert!(
+            decode_bytes_with_encoding(b"\x93\xFA\x96", &sjis)
+                .unwrap()
+                .lossy
+        );
+
+        let utf16 = FileEncoding::new("UTF-16LE", true);
+        let bytes = encode_text("hi", &utf16).unwrap();
+        assert_eq!(bytes, b"\xFF\xFEh\0i\0");
+        assert_eq!(
+            decode_bytes_with_encoding(&bytes, &utf16).unwrap(),
+            decoded("hi", utf16, false)
+        );
+
+        assert_eq!(
+            encode_text("hi", &FileEncoding::new("UTF-8", true)).unwrap(),
+            b"\xEF\xBB\xBFhi"
+        );
+        assert!(
+            encode_text("日本語", &FileEncoding::new("windows-1252", false))
+                .is_err()
+        );
+    }
+
+    #[test]
+    fn test_load_file() {
+        let dir = tempfile::tempdir().unwrap();
+        let text = "line\n".repeat(20_000);
+        let path = dir.path().join("text");
+        fs::write(&path, &text).unwrap();
+        assert_eq!(load_file(&path).unwrap().text, text);
+
+        let path = dir.path().join("binary");
+        fs::write(
+            &path,
+            [b"\x89PNG\r\n\x1a\n\0\0\0\rIHDR".as_slice(), text.as_bytes()].concat(),
+        )
+        .unwrap();
+        assert!(load_file(&path).unwrap_err().is::<BinaryFileError>());
+    }
+
+    #[test]
+    fn test_large_file_pages() {
+        let text = (0..LARGE_FILE_PAGE_LINES * 2 + 5)
+            .map(|i| format!("line {i}\n"))
+            .collect::<String>();
+        let dir = tempfile::tempdir().unwrap();
+        let path = dir.path().join("large.log");
+        fs::write(&path, &text).unwrap();
+
+        let mut buffer = Buffer::new_large(BufferId(0), path.clone());
+        let page = buffer.rope.to_string();
+        assert_eq!(page.lines().count(), LARGE_FILE_PAGE_LINES);
+        assert!(page.starts_with("line 0\n"));
+        assert_eq!(buffer.rev, 1);
+
+        // Edits are made to the loaded part, and the rest stays on disk
+        let delta =
+            Delta::simple_edit(Interval::new(0, 4), Rope::from("row"), page.len());
+        buffer.update(&delta, 2);
+        assert!(buffer.rope.to_string().starts_with("row 0\n"));
+
+        let (next, loaded) = buffer.next_page().unwrap();
+        assert!(next.starts_with(&format!("line {LARGE_FILE_PAGE_LINES}\n")));
+        assert_eq!(loaded, (page.len() + next.len()) as u64);
+        buffer.page_loaded(next.len(), 3);
+        assert_eq!(buffer.rev, 3);
+
+        buffer.save(3, false).unwrap();
+        let saved = fs::read_to_string(&path).unwrap();
+        assert_eq!(saved, format!("row{}", &text[4..]));
+        let info = buffer.large_file_info().unwrap();
+        assert_eq!(info.loaded, (page.len() + next.len() - 1) as u64);
+        assert_eq!(info.len, saved.len() as u64);
+
+        let (last, loaded) = buffer.next_page().unwrap();
+        assert_eq!(last.lines().count(), 5);
+        assert_eq!(loaded, info.len);
+        buffer.page_loaded(last.len(), 4);
+        assert_eq!(buffer.rope.to_string(), saved);
+    }
+
+    #[test]
+    fn test_page_end() {
+        let long_line = "é".repeat(LARGE_FILE_PAGE_BYTES / 2);
+        let bytes = &long_line.as_bytes()[1..];
+        assert_eq!(page_end(bytes, UTF_8, false), bytes.len() - 2);
+        assert_eq!(page_end(bytes, UTF_8, true), bytes.len());
+
+        let lines = "a\n".repeat(LARGE_FILE_PAGE_LINES + 1);
+        let utf16 = lines
+            .encode_utf16()
+            .flat_map(u16::to_le_bytes)
+            .collect::<Vec<_>>();
+        assert_eq!(page_end(&utf16, UTF_16LE, true), LARGE_FILE_PAGE_LINES * 4);
+    }
+}
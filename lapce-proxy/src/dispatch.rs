@@ -1,13 +1,14 @@
 use std::{
     collections::{HashMap, HashSet},
-    fs, io,
+    fs,
+    io::{self, Read, Seek, SeekFrom, Write},
     path::{Path, PathBuf},
     sync::{
         Arc,
         atomic::{AtomicU64, Ordering},
     },
     thread,
-    time::Duration,
+    time::{Duration, Instant},
 };
 
 use alacritty_terminal::{event::WindowSize, event_loop::Msg};
@@ -17,14 +18,14 @@
     DiffOptions, ErrorCode::NotFound, Oid, Repository, build::CheckoutBuilder,
 };
 use grep_matcher::Matcher;
-use grep_regex::RegexMatcherBuilder;
-use grep_searcher::{SearcherBuilder, sinks::UTF8};
+use grep_regex::{RegexMatcher, RegexMatcherBuilder};
+use grep_searcher::{Searcher, SearcherBuilder, Sink, SinkMatch, sinks::UTF8};
 use indexmap::IndexMap;
 use lapce_rpc::{
     RequestId, RpcError,
-    buffer::BufferId,
-    core::{CoreNotification, CoreRpcHandler, FileChanged},
-    file::FileNodeItem,
+    buffer::{BufferId, FileEncoding},
+    core::{CoreNotification, CoreRpcHandler, FileChanged, LogLevel},
+    file::{FileNodeItem, FilePiece},
     file_line::FileLine,
     proxy::{
         ProxyHandler, ProxyNotification, ProxyRequest, ProxyResponse,
@@ -43,14 +44,23 @@
 use parking_lot::Mutex;
 
 use crate::{
-    buffer::{Buffer, get_mod_time, load_file},
-    plugin::{PluginCatalogRpcHandler, catalog::PluginCatalog},
+    buffer::{
+        Buffer, decode_bytes, decode_bytes_with_encoding, get_mod_time,
+        load_file_with_encoding,
+    },
+    plugin::{
+        PluginCatalogRpcHandler,
+        catalog::PluginCatalog,
+        permissions::{grant_permissions, granted_permissions, revoke_permissions},
+        wasi::{is_dev_volt_file, reload_dev_volt},
+    },
     terminal::{Terminal, TerminalSender},
     watcher::{FileWatcher, Notify, WatchToken},
 };
 
 const OPEN_FILE_EVENT_TOKEN: WatchToken = WatchToken(1);
 const WORKSPACE_EVENT_TOKEN: WatchToken = WatchToken(2);
+const DEV_PLUGIN_EVENT_TOKEN: WatchToken = WatchToken(3);
 
 pub struct Dispatcher {
     workspace: Option<PathBuf>,
@@ -58,6 +68,8 @@ pub struct Dispatcher {
     core_rpc: CoreRpcHandler,
     catalog_rpc: PluginCatalogRpcHandler,
     buffers: HashMap<PathBuf, Buffer>,
+    /// The path and selections of the focused editor, for plugins.
+    active_editor: (Option<PathBuf>, Vec<Range>),
     terminals: HashMap<TermId, TerminalSender>,
     file_watcher: FileWatcher,
     window_id: usize,
@@ -79,15 +91,26 @@ fn handle_notification(&mut self, rpc: ProxyNotification) {
                 self.window_id = window_id;
                 self.tab_id = tab_id;
                 self.workspace = workspace;
+                // Volts loaded from `--plugin-path` are in development mode,
+                // and get reloaded when they're rebuilt.
+                let dev_plugin_paths: Vec<PathBuf> = extra_plugin_paths
+                    .iter()
+                    .filter_map(|path| path.canonicalize().ok())
+                    .collect();
                 self.file_watcher.notify(FileWatchNotifier::new(
                     self.workspace.clone(),
                     self.core_rpc.clone(),
                     self.proxy_rpc.clone(),
+                    self.catalog_rpc.clone(),
+                    dev_plugin_paths.clone(),
                 ));
                 if let Some(workspace) = self.workspace.as_ref() {
                     self.file_watcher
                         .watch(workspace, true, WORKSPACE_EVENT_TOKEN);
                 }
+                for path in &dev_plugin_paths {
+                    self.file_watcher.watch(path, true, DEV_PLUGIN_EVENT_TOKEN);
+                }
 
                 let plugin_rpc = self.catalog_rpc.clone();
                 let workspace = self.workspace.clone();
@@ -116,17 +139,34 @@ fn handle_notification(&mut self, rpc: ProxyNotification) {
                 self.core_rpc
                     .notification(CoreNotification::OpenPaths { paths });
             }
+            ActiveEditorChanged { path, selections } => {
+                self.active_editor = (path, selections);
+            }
             OpenFileChanged { path } => {
                 if path.exists() {
-                    if let Some(buffer) = self.buffers.get(&path) {
+                    if let Some(buffer) = self.buffers.get_mut(&path) {
                         if get_mod_time(&buffer.path) == buffer.mod_time {
                             return;
                         }
-                        match load_file(&buffer.path) {
-                            Ok(content) => {
+                        // Reloading would send the whole file to the editor,
+                        // which is what large-file mode avoids, and binary
+                        // files are read by the editor in ranges instead
+                        if buffer.is_large() || buffer.binary {
+                            return;
+                        }
+                        match load_file_with_encoding(&buffer.path, &buffer.encoding)
+                        {
+                            Ok(decoded) => {
+                                // Keep text that doesn't decode cleanly from
+                                // being saved over the file
+                                if decoded.lossy {
+                                    buffer.read_only = true;
+                                    buffer.lossy = true;
+                                    warn_lossy(&self.core_rpc, buffer);
+                                }
                                 self.core_rpc.open_file_changed(
                                     path,
-                                    FileChanged::Change(content),
+                                    FileChanged::Change(decoded.text),
                                 );
                             }
                             Err(err) => {
@@ -167,6 +207,10 @@ fn handle_notification(&mut self, rpc: ProxyNotification) {
             }
             Update { path, delta, rev } => {
                 let buffer = self.buffers.get_mut(&path).unwrap();
+                if buffer.is_large() {
+                    buffer.update(&delta, rev);
+                    return;
+                }
                 let old_text = buffer.rope.clone();
                 buffer.update(&delta, rev);
                 self.catalog_rpc.did_change_text_document(
@@ -177,6 +221,11 @@ fn handle_notification(&mut self, rpc: ProxyNotification) {
                     buffer.rope.clone(),
                 );
             }
+            BufferPageLoaded { path, len, rev } => {
+                if let Some(buffer) = self.buffers.get_mut(&path) {
+                    buffer.page_loaded(len, rev);
+                }
+            }
             UpdatePluginConfigs { configs } => {
                 if let Err(err) = self.catalog_rpc.update_plugin_configs(configs) {
                     tracing::error!("{:?}", err);
@@ -335,9 +384,39 @@ fn handle_notification(&mut self, rpc: ProxyNotification) {
                     tracing::error!("{:?}", err);
                 }
             }
+            GrantVoltPermissions { volt } => {
+                if let Err(err) =
+                    grant_permissions(&volt.id(), volt.requested_permissions())
+                {
+                    tracing::error!("{:?}", err);
+                }
+                if let Err(err) = self.catalog_rpc.reload_volt(volt) {
+                    tracing::error!("{:?}", err);
+                }
+            }
+            RevokeVoltPermissions { volt } => {
+                if let Err(err) = revoke_permissions(&volt.id()) {
+                    tracing::error!("{:?}", err);
+                }
+                self.catalog_rpc.stop_volt(volt.info());
+            }
+            ExecutePluginCommand {
+                volt,
+                command,
+                arguments,
+            } => {
+                if let Err(err) = self
+                    .catalog_rpc
+                    .execute_plugin_command(volt, command, arguments)
+                {
+                    tracing::error!("{:?}", err);
+                }
+            }
             GitCommit { message, diffs } => {
                 if let Some(workspace) = self.workspace.as_ref() {
-                    match git_commit(workspace, &message, diffs) {
+                    let result = git_commit(workspace, &message, diffs);
+                    self.git_output("commit", &result);
+                    match result {
                         Ok(()) => (),
                         Err(e) => {
                             self.core_rpc.show_message(
@@ -353,37 +432,29 @@ fn handle_notification(&mut self, rpc: ProxyNotification) {
             }
             GitCheckout { reference } => {
                 if let Some(workspace) = self.workspace.as_ref() {
-                    match git_checkout(workspace, &reference) {
-                        Ok(()) => (),
-                        Err(e) => eprintln!("{e:?}"),
-                    }
+                    let result = git_checkout(workspace, &reference);
+                    self.git_output("checkout", &result);
                 }
             }
             GitDiscardFilesChanges { files } => {
                 if let Some(workspace) = self.workspace.as_ref() {
-                    match git_discard_files_changes(
+                    let result = git_discard_files_changes(
                         workspace,
                         files.iter().map(AsRef::as_ref),
-                    ) {
-                        Ok(()) => (),
-                        Err(e) => eprintln!("{e:?}"),
-                    }
+                    );
+                    self.git_output("discard", &result);
                 }
             }
             GitDiscardWorkspaceChanges {} => {
                 if let Some(workspace) = self.workspace.as_ref() {
-                    match git_discard_workspace_changes(workspace) {
-                        Ok(()) => (),
-                        Err(e) => eprintln!("{e:?}"),
-                    }
+                    let result = git_discard_workspace_changes(workspace);
+                    self.git_output("discard all", &result);
                 }
             }
             GitInit {} => {
                 if let Some(workspace) = self.workspace.as_ref() {
-                    match git_init(workspace) {
-                        Ok(()) => (),
-                        Err(e) => eprintln!("{e:?}"),
-                    }
+                    let result = git_init(workspace);
+                    self.git_output("init", &result);
                 }
             }
             LspCancel { id } => {
@@ -404,26 +475,204 @@ fn handle_notification(&mut self, rpc: ProxyNotification) {
     fn handle_request(&mut self, id: RequestId, rpc: ProxyRequest) {
         use ProxyRequest::*;
         match rpc {
-            NewBuffer { buffer_id, path } => {
-                let buffer = Buffer::new(buffer_id, path.clone());
-                let content = buffer.rope.to_string();
+            NewBuffer {
+                buffer_id,
+                path,
+                large_file_threshold,
+            } => {
+                // Large files are sent in pages and aren't opened in language
+                // servers, so they're only read a page at a time
+                let large = large_file_threshold.is_some_and(|threshold| {
+                    fs::metadata(&path)
+                        .is_ok_and(|metadata| metadata.len() > threshold as u64)
+                });
+                let buffer = if large {
+                    Buffer::new_large(buffer_id, path.clone())
+                } else {
+                    Buffer::new(buffer_id, path.clone())
+                };
+                if buffer.lossy {
+                    warn_lossy(&self.core_rpc, &buffer);
+                }
                 let read_only = buffer.read_only;
-                self.catalog_rpc.did_open_document(
-                    &path,
-                    buffer.language_id.to_string(),
-                    buffer.rev as i32,
-                    content.clone(),
-                );
+                let encoding = buffer.encoding.clone();
+                let binary = buffer.binary;
+                let (content, large_file) = if binary {
+                    (String::new(), None)
+                } else if buffer.is_large() {
+                    (buffer.rope.to_string(), buffer.large_file_info())
+                } else {
+                    let content = buffer.rope.to_string();
+                    self.catalog_rpc.did_open_document(
+                        &path,
+                        buffer.language_id.to_string(),
+                        buffer.rev as i32,
+                        content.clone(),
+                    );
+                    (content, None)
+                };
                 self.file_watcher.watch(&path, false, OPEN_FILE_EVENT_TOKEN);
                 self.buffers.insert(path, buffer);
                 self.respond_rpc(
                     id,
-                    Ok(ProxyResponse::NewBufferResponse { content, read_only }),
+                    Ok(ProxyResponse::NewBufferResponse {
+                        content,
+                        read_only,
+                        encoding,
+                        large_file,
+                        binary,
+                    }),
                 );
             }
+            ReadFileRange { path, offset, len } => {
+                let result = read_file_range(&path, offset, len)
+                    .map(|(data, file_len)| ProxyResponse::ReadFileRangeResponse {
+                        data,
+                        file_len,
+                    })
+                    .map_err(|e| RpcError {
+                        code: 0,
+                        message: e.to_string(),
+                    });
+                self.respond_rpc(id, result);
+            }
+            WriteFile { path, pieces } => {
+                let result = write_file_pieces(&path, &pieces)
+                    .map(|_| {
+                        if let Some(buffer) = self.buffers.get_mut(&path) {
+                            buffer.mod_time = get_mod_time(&path);
+                        }
+                        ProxyResponse::Success {}
+                    })
+                    .map_err(|e| RpcError {
+                        code: 0,
+                        message: e.to_string(),
+                    });
+                self.respond_rpc(id, result);
+            }
+            FindBytes {
+                path,
+                pieces,
+                pattern,
+            } => {
+                let proxy_rpc = self.proxy_rpc.clone();
+                thread::spawn(move || {
+                    let result = find_bytes(&path, &pieces, pattern)
+                        .map(|(matches, count)| ProxyResponse::FindBytesResponse {
+                            matches,
+                            count,
+                        })
+                        .map_err(|e| RpcError {
+                            code: 0,
+                            message: e.to_string(),
+                        });
+                    proxy_rpc.handle_response(id, result);
+                });
+            }
+            BufferPage { path } => {
+                let result = match self.buffers.get_mut(&path) {
+                    Some(buffer) => {
+                        let was_lossy = buffer.lossy;
+                        let result = buffer.next_page();
+                        if buffer.lossy && !was_lossy {
+                            warn_lossy(&self.core_rpc, buffer);
+                        }
+                        let file_len = buffer.large_file_info().map(|i| i.len);
+                        result
+                            .map(|(content, loaded)| {
+                                ProxyResponse::BufferPageResponse {
+                                    content,
+                                    loaded,
+                                    done: file_len.is_none_or(|len| loaded >= len),
+                                }
+                            })
+                            .map_err(|e| RpcError {
+                                code: 0,
+                                message: e.to_string(),
+                            })
+                    }
+                    None => Err(RpcError {
+                        code: 0,
+                        message: "buffer not found".to_string(),
+                    }),
+                };
+                self.respond_rpc(id, result);
+            }
+            FindInBuffer {
+                path,
+                pattern,
+                case_sensitive,
+                whole_word,
+                is_regex,
+            } => {
+                let Some(buffer) = self.buffers.get(&path) else {
+                    self.respond_rpc(
+                        id,
+                        Err(RpcError {
+                            code: 0,
+                            message: "buffer not found".to_string(),
+                        }),
+                    );
+                    return;
+                };
+                // Only the loaded part of a large file is in the rope
+                let text = buffer.rope.clone();
+                let proxy_rpc = self.proxy_rpc.clone();
+
+                // Perform the search on another thread to avoid blocking the proxy thread
+                thread::spawn(move || {
+                    proxy_rpc.handle_response(
+                        id,
+                        search_in_rope(
+                            &text,
+                            &pattern,
+                            case_sensitive,
+                            whole_word,
+                            is_regex,
+                        ),
+                    );
+                });
+            }
+            ReopenBuffer { path, encoding } => {
+                if self.buffers.get(&path).is_some_and(|b| b.is_large()) {
+                    self.respond_rpc(
+                        id,
+                        Err(RpcError {
+                            code: 0,
+                            message: "files in large-file mode can't be reopened \
+                                      with another encoding"
+                                .to_string(),
+                        }),
+                    );
+                    return;
+                }
+                // The new content reaches the buffer as an edit from the editor
+                let result = load_file_with_encoding(&path, &encoding)
+                    .map(|decoded| {
+                        if let Some(buffer) = self.buffers.get_mut(&path) {
+                            buffer.encoding = decoded.encoding.clone();
+                            buffer.read_only = decoded.lossy;
+                            buffer.lossy = decoded.lossy;
+                            if buffer.lossy {
+                                warn_lossy(&self.core_rpc, buffer);
+                            }
+                        }
+                        ProxyResponse::ReopenBufferResponse {
+                            content: decoded.text,
+                            encoding: decoded.encoding,
+                            read_only: decoded.lossy,
+                        }
+                    })
+                    .map_err(|e| RpcError {
+                        code: 0,
+                        message: e.to_string(),
+                    });
+                self.respond_rpc(id, result);
+            }
             BufferHead { path } => {
                 let result = if let Some(workspace) = self.workspace.as_ref() {
-                    let result = file_get_head(workspace, &path);
+                    let encoding = self.buffers.get(&path).map(|b| &b.encoding);
+                    let result = file_get_head(workspace, &path, encoding);
                     if let Ok((_blob_id, content)) = result {
                         Ok(ProxyResponse::BufferHeadResponse {
                             version: "head".to_string(),
@@ -531,6 +780,14 @@ fn handle_request(&mut self, id: RequestId, rpc: ProxyRequest) {
                     },
                 );
             }
+            GetVoltPermissions { volt } => {
+                self.respond_rpc(
+                    id,
+                    Ok(ProxyResponse::GetVoltPermissionsResponse {
+                        granted: granted_permissions(&volt),
+                    }),
+                );
+            }
             GitGetRemoteFileUrl { file } => {
                 if let Some(workspace) = self.workspace.as_ref() {
                     match git_get_remote_file_url(workspace, &file) {
@@ -611,6 +868,20 @@ fn handle_request(&mut self, id: RequestId, rpc: ProxyRequest) {
                     },
                 );
             }
+            GetPluginTreeChildren { volt, view, parent } => {
+                let proxy_rpc = self.proxy_rpc.clone();
+                self.catalog_rpc.get_plugin_tree_children(
+                    volt,
+                    view,
+                    parent,
+                    move |result| {
+                        let result = result.map(|children| {
+                            ProxyResponse::GetPluginTreeChildrenResponse { children }
+                        });
+                        proxy_rpc.handle_response(id, result);
+                    },
+                );
+            }
             GetInlayHints { path } => {
                 let proxy_rpc = self.proxy_rpc.clone();
                 let buffer = self.buffers.get(&path).unwrap();
@@ -820,6 +1091,13 @@ fn handle_request(&mut self, id: RequestId, rpc: ProxyRequest) {
                 let resp = ProxyResponse::GetOpenFilesContentResponse { items };
                 self.proxy_rpc.handle_response(id, Ok(resp));
             }
+            GetActiveEditor {} => {
+                let (path, selections) = self.active_editor.clone();
+                self.respond_rpc(
+                    id,
+                    Ok(ProxyResponse::GetActiveEditorResponse { path, selections }),
+                );
+            }
             ReadDir { path } => {
                 let proxy_rpc = self.proxy_rpc.clone();
                 thread::spawn(move || {
@@ -856,13 +1134,17 @@ fn handle_request(&mut self, id: RequestId, rpc: ProxyRequest) {
                 rev,
                 path,
                 create_parents,
+                encoding,
             } => {
                 let buffer = self.buffers.get_mut(&path).unwrap();
+                buffer.encoding = encoding;
                 let result = buffer
                     .save(rev, create_parents)
                     .map(|_r| {
-                        self.catalog_rpc
-                            .did_save_text_document(&path, buffer.rope.clone());
+                        if !buffer.is_large() {
+                            self.catalog_rpc
+                                .did_save_text_document(&path, buffer.rope.clone());
+                        }
                         ProxyResponse::SaveResponse {}
                     })
                     .map_err(|e| RpcError {
@@ -877,10 +1159,21 @@ fn handle_request(&mut self, id: RequestId, rpc: ProxyRequest) {
                 rev,
                 content,
                 create_parents,
+                encoding,
             } => {
                 let mut buffer = Buffer::new(buffer_id, path.clone());
                 buffer.rope = Rope::from(content);
+                // The editor only has the loaded part of a large file, the rest
+                // is copied from the file it was opened from
+                if let Some(old) = self
+                    .buffers
+                    .values()
+                    .find(|b| b.id == buffer_id && b.is_large())
+                {
+                    buffer.unloaded.clone_from(&old.unloaded);
+                }
                 buffer.rev = rev;
+                buffer.encoding = encoding;
                 let result = buffer
                     .save(rev, create_parents)
                     .map(|_| ProxyResponse::Success {})
@@ -1221,6 +1514,7 @@ pub fn new(core_rpc: CoreRpcHandler, proxy_rpc: ProxyRpcHandler) -> Self {
             core_rpc,
             catalog_rpc: plugin_rpc,
             buffers: HashMap::new(),
+            active_editor: (None, Vec::new()),
             terminals: HashMap::new(),
             file_watcher,
             window_id: 1,
@@ -1237,6 +1531,15 @@ fn get_buffer_or_insert(&mut self, path: PathBuf) -> &mut Buffer {
             .entry(path.clone())
             .or_insert(Buffer::new(BufferId::next(), path))
     }
+
+    /// Reports a git operation to the Git output channel.
+    fn git_output(&self, command: &str, result: &Result<()>) {
+        let (level, text) = match result {
+            Ok(()) => (LogLevel::Info, format!("git {command}")),
+            Err(err) => (LogLevel::Error, format!("git {command} failed: {err:#}")),
+        };
+        self.core_rpc.output("Git".to_string(), level, text);
+    }
 }
 
 struct FileWatchNotifier {
@@ -1245,6 +1548,20 @@ struct FileWatchNotifier {
     workspace: Option<PathBuf>,
     workspace_fs_change_handler: Arc<Mutex<Option<Sender<bool>>>>,
     last_diff: Arc<Mutex<DiffInfo>>,
+    catalog_rpc: PluginCatalogRpcHandler,
+    dev_plugin_paths: Vec<PathBuf>,
+    /// The development volts waiting to be reloaded, while changes to them
+    /// are debounced.
+    dev_plugin_changes: Arc<Mutex<Option<DevPluginChanges>>>,
+}
+
+/// How long a development volt's files have to stop changing before it's
+/// reloaded.
+const DEV_PLUGIN_DEBOUNCE: Duration = Duration::from_millis(500);
+
+struct DevPluginChanges {
+    dirs: HashSet<PathBuf>,
+    last_change: Instant,
 }
 
 impl Notify for FileWatchNotifier {
@@ -1258,6 +1575,8 @@ fn new(
         workspace: Option<PathBuf>,
         core_rpc: CoreRpcHandler,
         proxy_rpc: ProxyRpcHandler,
+        catalog_rpc: PluginCatalogRpcHandler,
+        dev_plugin_paths: Vec<PathBuf>,
     ) -> Self {
         let notifier = Self {
             workspace,
@@ -1265,6 +1584,9 @@ fn new(
             proxy_rpc,
             workspace_fs_change_handler: Arc::new(Mutex::new(None)),
             last_diff: Arc::new(Mutex::new(DiffInfo::default())),
+            catalog_rpc,
+            dev_plugin_paths,
+            dev_plugin_changes: Arc::new(Mutex::new(None)),
         };
 
         if let Some(workspace) = notifier.workspace.clone() {
@@ -1286,6 +1608,7 @@ fn handle_fs_events(&self, events: Vec<(WatchToken, notify::Event)>) {
             match token {
                 OPEN_FILE_EVENT_TOKEN => self.handle_open_file_fs_event(event),
                 WORKSPACE_EVENT_TOKEN => self.handle_workspace_fs_event(event),
+                DEV_PLUGIN_EVENT_TOKEN => self.handle_dev_plugin_fs_event(event),
                 _ => {}
             }
         }
@@ -1369,6 +1692,67 @@ fn handle_workspace_fs_event(&self, event: notify::Event) {
         });
         *handler = Some(sender);
     }
+
+    fn handle_dev_plugin_fs_event(&self, event: notify::Event) {
+        if !(event.kind.is_create() || event.kind.is_modify()) {
+            return;
+        }
+
+        // Only a new manifest or the wasm it declares needs the volt to be
+        // reloaded, the rest of a plugin's directory is usually its sources
+        // and build artifacts.
+        let dirs: HashSet<PathBuf> = event
+            .paths
+            .iter()
+            .filter(|path| {
+                path.file_name().is_some_and(|name| name == "volt.toml")
+                    || path.extension().is_some_and(|ext| ext == "wasm")
+            })
+            .filter_map(|path| {
+                self.dev_plugin_paths
+                    .iter()
+                    .find(|dir| path.starts_with(dir))
+                    .filter(|dir| is_dev_volt_file(dir, path))
+                    .cloned()
+            })
+            .collect();
+        if dirs.is_empty() {
+            return;
+        }
+
+        let mut changes = self.dev_plugin_changes.lock();
+        if let Some(changes) = changes.as_mut() {
+            changes.dirs.extend(dirs);
+            changes.last_change = Instant::now();
+            return;
+        }
+        *changes = Some(DevPluginChanges {
+            dirs,
+            last_change: Instant::now(),
+        });
+
+        let local_changes = self.dev_plugin_changes.clone();
+        let catalog_rpc = self.catalog_rpc.clone();
+        thread::spawn(move || {
+            // A build usually writes the wasm in several steps, so wait until
+            // it has stopped changing.
+            let dirs = loop {
+                thread::sleep(DEV_PLUGIN_DEBOUNCE);
+                let mut changes = local_changes.lock();
+                if changes.as_ref().is_some_and(|changes| {
+                    changes.last_change.elapsed() < DEV_PLUGIN_DEBOUNCE
+                }) {
+                    continue;
+                }
+                break changes.take().map(|changes| changes.dirs);
+            };
+            for dir in dirs.unwrap_or_default() {
+                if let Err(err) = reload_dev_volt(&catalog_rpc, &dir) {
+                    tracing::error!("{:?}", err);
+                }
+            }
+        });
+    }
 }
 
 #[derive(Clone, Debug)]
@@ -1616,16 +2000,42 @@ fn git_diff_new(workspace_path: &Path) -> Option<DiffInfo> {
     })
 }
 
-fn file_get_head(workspace_path: &Path, path: &Path) -> Result<(String, String)> {
+/// Tell the user why a file that doesn't decode cleanly is read only.
+fn warn_lossy(core_rpc: &CoreRpcHandler, buffer: &Buffer) {
+    core_rpc.show_message(
+        "File is read only".to_owned(),
+        ShowMessageParams {
+            typ: MessageType::WARNING,
+            message: format!(
+                "{} has bytes that aren't valid {}, so it's read only to \
+                 keep saving from replacing them. Reopen it with \
+                 the right encoding to edit it.",
+                buffer.path.display(),
+                buffer.encoding.name
+            ),
+        },
+    );
+}
+
+/// The blob id and the text of a file at HEAD, decoded like the open file if
+/// its encoding is known.
+fn file_get_head(
+    workspace_path: &Path,
+    path: &Path,
+    encoding: Option<&FileEncoding>,
+) -> Result<(String, String)> {
     let repo = Repository::discover(workspace_path)?;
     let head = repo.head()?;
     let tree = head.peel_to_tree()?;
     let tree_entry = tree.get_path(path.strip_prefix(workspace_path)?)?;
     let blob = repo.find_blob(tree_entry.id())?;
     let id = blob.id().to_string();
-    let content = std::str::from_utf8(blob.content())
-        .with_context(|| "content bytes to string")?
-        .to_string();
+    let content = match encoding {
+        Some(encoding) => decode_bytes_with_encoding(blob.content(), encoding),
+        None => decode_bytes(blob.content()),
+    }
+    .map(|decoded| decoded.text)
+    .with_context(|| "content bytes to string")?;
     Ok((id, content))
 }
 
@@ -1674,16 +2084,153 @@ fn git_get_remote_file_url(workspace_path: &Path, file: &Path) -> Result<String>
     Ok(url)
 }
 
-fn search_in_path(
-    id: u64,
-    current_id: &AtomicU64,
-    paths: impl Iterator<Item = PathBuf>,
+/// The most bytes [`ProxyRequest::ReadFileRange`] reads at once.
+const MAX_FILE_RANGE_LEN: u64 = 16 * 1024 * 1024;
+
+/// Read up to `len` bytes from `offset`, returning them with the length of the
+/// whole file.
+fn read_file_range(path: &Path, offset: u64, len: u64) -> Result<(Vec<u8>, u64)> {
+    let mut file = fs::File::open(path)?;
+    let file_len = file.metadata()?.len();
+    file.seek(SeekFrom::Start(offset))?;
+    let mut data = Vec::new();
+    file.take(len.min(MAX_FILE_RANGE_LEN))
+        .read_to_end(&mut data)?;
+    Ok((data, file_len))
+}
+
+/// Copy the bytes of a file edited as bytes, made of `pieces` of `file` and
+/// bytes put between them, to `out`.
+fn copy_pieces(
+    file: &mut fs::File,
+    pieces: &[FilePiece],
+    out: &mut impl Write,
+) -> io::Result<u64> {
+    let mut copied = 0;
+    for piece in pieces {
+        copied += match piece {
+            FilePiece::File { offset, len } => {
+                file.seek(SeekFrom::Start(*offset))?;
+                io::copy(&mut (&mut *file).take(*len), out)?
+            }
+            FilePiece::Bytes(bytes) => {
+                out.write_all(bytes)?;
+                bytes.len() as u64
+            }
+        };
+    }
+    Ok(copied)
+}
+
+/// Write a file edited as bytes, made of `pieces`. The bytes put in place of
+/// others are written over them, and from the first piece of the file that
+/// moved on, the rest of it is written again.
+fn write_file_pieces(path: &Path, pieces: &[FilePiece]) -> Result<()> {
+    let mut file = fs::OpenOptions::new().read(true).write(true).open(path)?;
+
+    let mut pos = 0;
+    let mut moved = None;
+    for (i, piece) in pieces.iter().enumerate() {
+        if matches!(piece, FilePiece::File { offset, .. } if *offset != pos) {
+            moved = Some((i, pos));
+            break;
+        }
+        pos += piece.len();
+    }
+
+    // The moved part is read before anything is written, as it may be written
+    // over
+    let rest = match moved {
+        Some((i, _)) => {
+            let mut rest = tempfile::tempfile()?;
+            copy_pieces(&mut file, &pieces[i..], &mut rest)?;
+            rest.seek(SeekFrom::Start(0))?;
+            Some(rest)
+        }
+        None => None,
+    };
+
+    let mut pos = 0;
+    for piece in &pieces[..moved.map_or(pieces.len(), |(i, _)| i)] {
+        if let FilePiece::Bytes(bytes) = piece {
+            file.seek(SeekFrom::Start(pos))?;
+            file.write_all(bytes)?;
+        }
+        pos += piece.len();
+    }
+    if let Some(mut rest) = rest {
+        file.seek(SeekFrom::Start(pos))?;
+        pos += io::copy(&mut rest, &mut file)?;
+    }
+    file.set_len(pos)?;
+    Ok(())
+}
+
+/// The most match offsets [`ProxyRequest::FindBytes`] sends back.
+const MAX_BYTE_MATCHES: usize = 100_000;
+
+/// Find the offsets of `pattern` in a file edited as bytes, made of `pieces`,
+/// returning the first [`MAX_BYTE_MATCHES`] of them and how many there are.
+fn find_bytes(
+    path: &Path,
+    pieces: &[FilePiece],
+    pattern: Vec<u8>,
+) -> Result<(Vec<u64>, u64)> {
+    let mut file = fs::File::open(path)?;
+    let mut search = ByteSearch {
+        pattern,
+        tail: Vec::new(),
+        pos: 0,
+        matches: Vec::new(),
+        count: 0,
+    };
+    copy_pieces(&mut file, pieces, &mut search)?;
+    Ok((search.matches, search.count))
+}
+
+/// Looks for a pattern in the bytes written to it, keeping the end of what was
+/// written last for the matches that continue into what's written next.
+struct ByteSearch {
+    pattern: Vec<u8>,
+    tail: Vec<u8>,
+    /// How many bytes were written so far
+    pos: u64,
+    matches: Vec<u64>,
+    count: u64,
+}
+
+impl Write for ByteSearch {
+    fn write(&mut self, buf: &[u8]) -> io::Result<usize> {
+        if self.pattern.is_empty() {
+            return Ok(buf.len());
+        }
+        let start = self.pos - self.tail.len() as u64;
+        self.tail.extend_from_slice(buf);
+        for (i, window) in self.tail.windows(self.pattern.len()).enumerate() {
+            if window == self.pattern {
+                self.count += 1;
+                if self.matches.len() < MAX_BYTE_MATCHES {
+                    self.matches.push(start + i as u64);
+                }
+            }
+        }
+        let keep = self.tail.len().min(self.pattern.len() - 1);
+        self.tail.drain(..self.tail.len() - keep);
+        self.pos += buf.len() as u64;
+        Ok(buf.len())
+    }
+
+    fn flush(&mut self) -> io::Result<()> {
+        Ok(())
+    }
+}
+
+fn build_matcher(
     pattern: &str,
     case_sensitive: bool,
     whole_word: bool,
     is_regex: bool,
-) -> Result<ProxyResponse, RpcError> {
-    let mut matches = IndexMap::new();
+) -> Result<RegexMatcher, RpcError> {
     let mut matcher = RegexMatcherBuilder::new();
     let matcher = matcher.case_insensitive(!case_sensitive).word(whole_word);
     let matcher = if is_regex {
@@ -1691,10 +2238,105 @@ fn search_in_path(
     } else {
         matcher.build_literals(&[&regex::escape(pattern)])
     };
-    let matcher = matcher.map_err(|_| RpcError {
+    matcher.map_err(|_| RpcError {
         code: 0,
         message: "can't build matcher".to_string(),
-    })?;
+    })
+}
+
+/// Find the byte ranges of all the matches in `text`, which can be too big to
+/// copy into a string.
+fn search_in_rope(
+    text: &Rope,
+    pattern: &str,
+    case_sensitive: bool,
+    whole_word: bool,
+    is_regex: bool,
+) -> Result<ProxyResponse, RpcError> {
+    let matcher = build_matcher(pattern, case_sensitive, whole_word, is_regex)?;
+    let mut sink = OffsetSink {
+        matcher: &matcher,
+        matches: Vec::new(),
+    };
+    SearcherBuilder::new()
+        .line_number(false)
+        .build()
+        .search_reader(&matcher, ChunksReader::new(text.iter_chunks(..)), &mut sink)
+        .map_err(|e| RpcError {
+            code: 0,
+            message: e.to_string(),
+        })?;
+    Ok(ProxyResponse::FindInBufferResponse {
+        matches: sink.matches,
+    })
+}
+
+/// Collects the byte ranges of every match on the matching lines.
+struct OffsetSink<'a> {
+    matcher: &'a RegexMatcher,
+    matches: Vec<(usize, usize)>,
+}
+
+impl Sink for OffsetSink<'_> {
+    type Error = io::Error;
+
+    fn matched(
+        &mut self,
+        _searcher: &Searcher,
+        mat: &SinkMatch<'_>,
+    ) -> Result<bool, Self::Error> {
+        let offset = mat.absolute_byte_offset() as usize;
+        self.matcher
+            .find_iter(mat.bytes(), |m| {
+                self.matches.push((offset + m.start(), offset + m.end()));
+                true
+            })
+            .map_err(io::Error::other)?;
+        Ok(true)
+    }
+}
+
+/// Reads the chunks of a rope in turn.
+struct ChunksReader<'a, I: Iterator<Item = &'a str>> {
+    chunks: I,
+    current: &'a [u8],
+}
+
+impl<'a, I: Iterator<Item = &'a str>> ChunksReader<'a, I> {
+    fn new(chunks: I) -> Self {
+        Self {
+            chunks,
+            current: &[],
+        }
+    }
+}
+
+impl<'a, I: Iterator<Item = &'a str>> Read for ChunksReader<'a, I> {
+    fn read(&mut self, buf: &mut [u8]) -> io::Result<usize> {
+        while self.current.is_empty() {
+            match self.chunks.next() {
+                Some(chunk) => self.current = chunk.as_bytes(),
+                None => return Ok(0),
+            }
+        }
+        let len = self.current.len().min(buf.len());
+        buf[..len].copy_from_slice(&self.current[..len]);
+        self.current = &self.current[len..];
+        Ok(len)
+    }
+}
+
+fn search_in_path(
+    id: u64,
+    current_id: &AtomicU64,
+    paths: impl Iterator<Item = PathBuf>,
+    pattern: &str,
+    case_sensitive: bool,
+    whole_word: bool,
+    is_regex: bool,
+) -> Result<ProxyResponse, RpcError> {
+    let mut matches = IndexMap::new();
+    let matcher = build_matcher(pattern, case_sensitive, whole_word, is_regex)?;
     let mut searcher = SearcherBuilder::new().build();
 
     for path in paths {
@@ -1,6 +1,6 @@
 use std::{
     borrow::Cow,
-    collections::HashMap,
+    collections::{HashMap, HashSet},
     path::PathBuf,
     sync::{
         Arc,
@@ -12,7 +12,7 @@
 use lapce_rpc::{
     RpcError,
     dap_types::{self, DapId, DapServer, SetBreakpointsResponse},
-    plugin::{PluginId, VoltID, VoltInfo, VoltMetadata},
+    plugin::{LanguageServerConfig, PluginId, VoltID, VoltInfo, VoltMetadata},
     proxy::ProxyResponse,
     style::LineStyle,
 };
@@ -29,7 +29,11 @@
 use super::{
     PluginCatalogNotification, PluginCatalogRpcHandler,
     dap::{DapClient, DapRpcHandler, DebuggerData},
-    psp::{ClonableCallback, PluginServerRpc, PluginServerRpcHandler, RpcCallback},
+    native,
+    psp::{
+        ClonableCallback, ExecuteCommand, ExecuteCommandParams, PluginServerRpc,
+        PluginServerRpcHandler, RpcCallback,
+    },
     wasi::{load_all_volts, start_volt},
 };
 use crate::plugin::{
@@ -44,6 +48,12 @@ pub struct PluginCatalog {
     debuggers: HashMap<String, DebuggerData>,
     plugin_configurations: HashMap<String, HashMap<String, serde_json::Value>>,
     unactivated_volts: HashMap<VoltID, VoltMetadata>,
+    /// Language servers declared in settings, with the plugin they run as
+    /// once a document they handle has been opened.
+    language_servers: HashMap<String, (LanguageServerConfig, Option<PluginId>)>,
+    /// The types in `debuggers` that were declared in settings rather than
+    /// registered by a volt.
+    declared_debuggers: HashSet<String>,
     open_files: HashMap<PathBuf, String>,
 }
 
@@ -55,7 +65,7 @@ pub fn new(
         plugin_configurations: HashMap<String, HashMap<String, serde_json::Value>>,
         plugin_rpc: PluginCatalogRpcHandler,
     ) -> Self {
-        let plugin = Self {
+        let mut plugin = Self {
             workspace,
             plugin_rpc: plugin_rpc.clone(),
             plugin_configurations,
@@ -63,8 +73,11 @@ pub fn new(
             daps: HashMap::new(),
             debuggers: HashMap::new(),
             unactivated_volts: HashMap::new(),
+            language_servers: HashMap::new(),
+            declared_debuggers: HashSet::new(),
             open_files: HashMap::new(),
         };
+        plugin.update_declared_servers();
 
         thread::spawn(move || {
             load_all_volts(plugin_rpc, &extra_plugin_paths, disabled_volts);
@@ -176,6 +189,40 @@ pub fn handle_server_notification(
         }
     }
 
+    /// The plugin started for the volt itself, as opposed to the ones it
+    /// spawned, like language servers.
+    fn volt_plugin(&self, volt: &VoltID) -> Option<&PluginServerRpcHandler> {
+        self.plugins
+            .values()
+            .find(|p| &p.volt_id == volt && p.spawned_by.is_none())
+    }
+
+    pub fn handle_volt_request(
+        &mut self,
+        volt: VoltID,
+        method: Cow<'static, str>,
+        params: Value,
+        f: Box<dyn RpcCallback<Value, RpcError>>,
+    ) {
+        let Some(plugin) = self.volt_plugin(&volt) else {
+            f.call(Err(RpcError {
+                code: 0,
+                message: format!("plugin {volt} is not running"),
+            }));
+            return;
+        };
+        plugin.server_request_async(
+            method,
+            params,
+            None,
+            None,
+            false,
+            move |result| {
+                f.call(result);
+            },
+        );
+    }
+
     pub fn shutdown_volt(
         &mut self,
         volt: VoltInfo,
@@ -220,6 +267,81 @@ fn start_unactivated_volts(&mut self, to_be_activated: Vec<VoltID>) {
         }
     }
 
+    /// Picks up the language servers and debug adapters declared in
+    /// settings, restarting the servers whose declaration changed.
+    fn update_declared_servers(&mut self) {
+        let servers = native::language_servers(&self.plugin_configurations);
+        let names: Vec<String> = self.language_servers.keys().cloned().collect();
+        for name in names {
+            let changed = self.language_servers.get(&name).map(|(c, _)| c)
+                != servers.get(&name);
+            if !changed {
+                continue;
+            }
+            if let Some((_, Some(plugin_id))) = self.language_servers.remove(&name) {
+                if let Some(plugin) = self.plugins.remove(&plugin_id) {
+                    plugin.shutdown();
+                }
+            }
+        }
+        for (name, config) in servers {
+            self.language_servers.entry(name).or_insert((config, None));
+        }
+
+        let debuggers = native::debuggers(&self.plugin_configurations);
+        for debugger_type in std::mem::take(&mut self.declared_debuggers) {
+            if !debuggers.contains_key(&debugger_type) {
+                self.debuggers.remove(&debugger_type);
+            }
+        }
+        for (debugger_type, config) in debuggers {
+            self.declared_debuggers.insert(debugger_type.clone());
+            self.debuggers.insert(
+                debugger_type.clone(),
+                DebuggerData {
+                    debugger_type,
+                    program: config.program,
+                    args: config.args,
+                },
+            );
+        }
+
+        self.start_declared_servers();
+    }
+
+    fn start_declared_servers(&mut self) {
+        for (name, (config, plugin_id)) in self.language_servers.iter_mut() {
+            if plugin_id.is_some() {
+                continue;
+            }
+            let handled = self.open_files.iter().any(|(path, language_id)| {
+                native::handles(config, language_id, path)
+            });
+            if !handled {
+                continue;
+            }
+            match native::start_language_server(
+                self.plugin_rpc.clone(),
+                self.workspace.clone(),
+                name,
+                config,
+            ) {
+                Ok(id) => {
+                    *plugin_id = Some(id);
+                }
+                Err(err) => {
+                    self.plugin_rpc.core_rpc.log(
+                        lapce_rpc::core::LogLevel::Error,
+                        format!("can't start {}: {err:#}", config.command),
+                        Some(format!(
+                            "lapce_proxy::plugin::lsp::settings::{name}::start"
+                        )),
+                    );
+                }
+            }
+        }
+    }
+
     fn check_unactivated_volts(&mut self) {
         let to_be_activated: Vec<VoltID> = self
             .unactivated_volts
@@ -291,6 +413,7 @@ pub fn handle_did_open_text_document(&mut self, document: TextDocumentItem) {
                 tracing::error!("{:?}", err);
             }
         }
+        self.start_declared_servers();
 
         let to_be_activated: Vec<VoltID> = self
             .unactivated_volts
@@ -487,6 +610,7 @@ pub fn handle_notification(&mut self, notification: PluginCatalogNotification) {
             UpdatePluginConfigs(configs) => {
                 tracing::debug!("UpdatePluginConfigs {:?}", configs);
                 self.plugin_configurations = configs;
+                self.update_declared_servers();
             }
             PluginServerLoaded(plugin) => {
                 // TODO: check if the server has did open registered
@@ -737,6 +861,7 @@ pub fn handle_notification(&mut self, notification: PluginCatalogNotification) {
                 program,
                 args,
             } => {
+                self.declared_debuggers.remove(&debugger_type);
                 self.debuggers.insert(
                     debugger_type.clone(),
                     DebuggerData {
@@ -746,6 +871,44 @@ pub fn handle_notification(&mut self, notification: PluginCatalogNotification) {
                     },
                 );
             }
+            ExecutePluginCommand {
+                volt,
+                command,
+                arguments,
+            } => {
+                let Some(plugin) = self.volt_plugin(&volt) else {
+                    self.plugin_rpc.core_rpc.show_message(
+                        command,
+                        ShowMessageParams {
+                            typ: MessageType::ERROR,
+                            message: format!("Plugin {volt} is not running"),
+                        },
+                    );
+                    return;
+                };
+                let core_rpc = self.plugin_rpc.core_rpc.clone();
+                plugin.server_request_async(
+                    ExecuteCommand::METHOD,
+                    ExecuteCommandParams {
+                        command: command.clone(),
+                        arguments,
+                    },
+                    None,
+                    None,
+                    false,
+                    move |result| {
+                        if let Err(err) = result {
+                            core_rpc.show_message(
+                                command,
+                                ShowMessageParams {
+                                    typ: MessageType::ERROR,
+                                    message: err.message,
+                                },
+                            );
+                        }
+                    },
+                );
+            }
             Shutdown => {
                 for (_, plugin) in self.plugins.iter() {
                     plugin.shutdown();
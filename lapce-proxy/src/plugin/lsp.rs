@@ -1,6 +1,7 @@
 #[cfg(target_os = "windows")]
 use std::os::windows::process::CommandExt;
 use std::{
+    collections::HashMap,
     io::{BufRead, BufReader, BufWriter, Write},
     path::{Path, PathBuf},
     process::{self, Child, Command, Stdio},
@@ -13,7 +14,7 @@
 use lapce_core::meta;
 use lapce_rpc::{
     RpcError,
-    plugin::{PluginId, VoltID},
+    plugin::{PluginId, VoltID, VoltPermissions},
     style::LineStyle,
 };
 use lapce_xi_rope::Rope;
@@ -182,6 +183,7 @@ fn new(
         pwd: Option<PathBuf>,
         server_uri: Url,
         args: Vec<String>,
+        env: HashMap<String, String>,
         options: Option<Value>,
     ) -> Result<Self> {
         let server = match server_uri.scheme() {
@@ -201,7 +203,7 @@ fn new(
             _ => return Err(anyhow!("uri not supported")),
         };
 
-        let mut process = Self::process(workspace.as_ref(), &server, &args)?;
+        let mut process = Self::process(workspace.as_ref(), &server, &args, &env)?;
         let stdin = process.stdin.take().unwrap();
         let stdout = process.stdout.take().unwrap();
         let stderr = process.stderr.take().unwrap();
@@ -301,16 +303,20 @@ fn new(
             }
         });
 
-        let host = PluginHostHandler::new(
+        let mut host = PluginHostHandler::new(
             workspace.clone(),
             pwd,
             volt_id,
             volt_display_name,
             document_selector,
+            // Language servers are native processes, the permissions of
+            // volts only restrict their wasm
+            VoltPermissions::unrestricted(),
             plugin_rpc.core_rpc.clone(),
             server_rpc.clone(),
             plugin_rpc.clone(),
         );
+        host.is_language_server = true;
 
         Ok(Self {
             plugin_rpc,
@@ -334,6 +340,7 @@ pub fn start(
         pwd: Option<PathBuf>,
         server_uri: Url,
         args: Vec<String>,
+        env: HashMap<String, String>,
         options: Option<Value>,
     ) -> Result<PluginId> {
         let mut lsp = Self::new(
@@ -347,6 +354,7 @@ pub fn start(
             pwd,
             server_uri,
             args,
+            env,
             options,
         )?;
         let plugin_id = lsp.server_rpc.plugin_id;
@@ -441,6 +449,7 @@ fn process(
         workspace: Option<&PathBuf>,
         server: &str,
         args: &[String],
+        env: &HashMap<String, String>,
     ) -> Result<Child> {
         let mut process = Command::new(server);
         if let Some(workspace) = workspace {
@@ -448,6 +457,7 @@ fn process(
         }
 
         process.args(args);
+        process.envs(env);
 
         #[cfg(target_os = "windows")]
         let process = process.creation_flags(0x08000000);
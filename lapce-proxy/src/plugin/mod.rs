@@ -1,16 +1,20 @@
 pub mod catalog;
 pub mod dap;
 pub mod lsp;
+pub mod native;
+pub mod permissions;
 pub mod psp;
+pub mod registry;
 pub mod wasi;
 
 use std::{
     borrow::Cow,
-    collections::HashMap,
+    collections::{HashMap, HashSet},
     fs,
+    io::{Read, Seek, SeekFrom},
     path::{Path, PathBuf},
     sync::{
-        Arc,
+        Arc, LazyLock,
         atomic::{AtomicBool, AtomicU64, AtomicUsize, Ordering},
     },
     time::Duration,
@@ -25,7 +29,7 @@
     RequestId, RpcError,
     core::CoreRpcHandler,
     dap_types::{self, DapId, RunDebugConfig, SourceBreakpoint, ThreadId},
-    plugin::{PluginId, VoltInfo, VoltMetadata},
+    plugin::{PluginId, TreeNode, VoltID, VoltInfo, VoltMetadata},
     proxy::ProxyRpcHandler,
     style::LineStyle,
     terminal::TermId,
@@ -80,8 +84,13 @@
 use self::{
     catalog::PluginCatalog,
     dap::DapRpcHandler,
-    psp::{ClonableCallback, PluginServerRpcHandler, RpcCallback},
-    wasi::{load_volt, start_volt},
+    permissions::approved_permissions,
+    psp::{
+        ClonableCallback, GetTreeChildren, GetTreeChildrenParams,
+        PluginServerRpcHandler, RpcCallback,
+    },
+    registry::{Registry, VoltArchive, latest_volt},
+    wasi::{find_all_volts, load_volt, start_volt},
 };
 use crate::buffer::language_id_from_path;
 
@@ -113,6 +122,14 @@ pub enum PluginCatalogRpc {
         text: Rope,
         f: Box<dyn RpcCallback<Vec<LineStyle>, RpcError>>,
     },
+    /// A request to the main plugin of a volt, rather than to whichever
+    /// plugin handles a language.
+    VoltRequest {
+        volt: VoltID,
+        method: Cow<'static, str>,
+        params: Value,
+        f: Box<dyn RpcCallback<Value, RpcError>>,
+    },
     DapVariable {
         dap_id: DapId,
         reference: usize,
@@ -212,6 +229,11 @@ pub enum PluginCatalogNotification {
         program: String,
         args: Option<Vec<String>>,
     },
+    ExecutePluginCommand {
+        volt: VoltID,
+        command: String,
+        arguments: Vec<Value>,
+    },
     Shutdown,
 }
 
@@ -333,6 +355,14 @@ pub fn mainloop(&self, plugin: &mut PluginCatalog) {
                         new_text,
                     );
                 }
+                PluginCatalogRpc::VoltRequest {
+                    volt,
+                    method,
+                    params,
+                    f,
+                } => {
+                    plugin.handle_volt_request(volt, method, params, f);
+                }
                 PluginCatalogRpc::DapVariable {
                     dap_id,
                     reference,
@@ -1372,6 +1402,19 @@ pub fn enable_volt(&self, volt: VoltInfo) -> Result<()> {
         self.catalog_notification(PluginCatalogNotification::EnableVolt(volt))
     }
 
+    pub fn execute_plugin_command(
+        &self,
+        volt: VoltID,
+        command: String,
+        arguments: Vec<Value>,
+    ) -> Result<()> {
+        self.catalog_notification(PluginCatalogNotification::ExecutePluginCommand {
+            volt,
+            command,
+            arguments,
+        })
+    }
+
     pub fn dap_disconnected(&self, dap_id: DapId) -> Result<()> {
         self.catalog_notification(PluginCatalogNotification::DapDisconnected(dap_id))
     }
@@ -1473,6 +1516,58 @@ pub fn dap_set_breakpoints(
         })
     }
 
+    fn volt_request<P: Serialize>(
+        &self,
+        volt: VoltID,
+        method: &'static str,
+        params: P,
+        f: impl FnOnce(Result<Value, RpcError>) + Send + 'static,
+    ) {
+        let params = match serde_json::to_value(params) {
+            Ok(params) => params,
+            Err(err) => {
+                f(Err(RpcError {
+                    code: 0,
+                    message: err.to_string(),
+                }));
+                return;
+            }
+        };
+        if let Err(err) = self.plugin_tx.send(PluginCatalogRpc::VoltRequest {
+            volt,
+            method: Cow::Borrowed(method),
+            params,
+            f: Box::new(f),
+        }) {
+            tracing::error!("{:?}", err);
+        }
+    }
+
+    pub fn get_plugin_tree_children(
+        &self,
+        volt: VoltID,
+        view: String,
+        parent: Option<String>,
+        f: impl FnOnce(Result<Vec<TreeNode>, RpcError>) + Send + 'static,
+    ) {
+        self.volt_request(
+            volt,
+            GetTreeChildren::METHOD,
+            GetTreeChildrenParams { view, parent },
+            move |result| {
+                let result = result.and_then(|value| {
+                    serde_json::from_value::<Option<Vec<TreeNode>>>(value)
+                        .map(|children| children.unwrap_or_default())
+                        .map_err(|err| RpcError {
+                            code: 0,
+                            message: err.to_string(),
+                        })
+                });
+                f(result);
+            },
+        );
+    }
+
     pub fn dap_variable(
         &self,
         dap_id: DapId,
@@ -1552,52 +1647,307 @@ pub fn volt_icon(volt: &VoltMetadata) -> Option<Vec<u8>> {
     std::fs::read(icon).ok()
 }
 
-pub fn download_volt(volt: &VoltInfo) -> Result<VoltMetadata> {
-    let url = format!(
-        "https://plugins.lapce.dev/api/v1/plugins/{}/{}/{}/download",
-        volt.author, volt.name, volt.version
-    );
+/// Serializes the installs of each volt, so that two of them don't move its
+/// directory around at once.
+static INSTALL_LOCKS: LazyLock<Mutex<HashMap<VoltID, Arc<Mutex<()>>>>> =
+    LazyLock::new(Default::default);
+
+fn install_lock(id: &VoltID) -> Arc<Mutex<()>> {
+    INSTALL_LOCKS.lock().entry(id.clone()).or_default().clone()
+}
+
+/// Downloads a volt and moves it into the plugins directory, along with the
+/// volts it needs. A previously installed version is only replaced once the
+/// new one has been unpacked, its volt.toml could be read and the volts it
+/// needs are installed.
+///
+/// Returns the installed volts in the order they can be started in: the ones
+/// it needs first and the volt itself last.
+pub fn download_volt(volt: &VoltInfo) -> Result<Vec<VoltMetadata>> {
+    download_volt_once(volt, &mut HashSet::new())
+}
+
+fn download_volt_once(
+    volt: &VoltInfo,
+    seen: &mut HashSet<VoltID>,
+) -> Result<Vec<VoltMetadata>> {
+    let lock = install_lock(&volt.id());
+    let _guard = lock.lock();
+    let update = VoltUpdate::download(volt)?;
+    let registries = registry::dependency_registries(volt);
+    let installed = load_volt(&update.plugin_dir).and_then(|meta| {
+        let mut installed = download_dependencies(&meta, &registries, seen)?;
+        installed.push(meta);
+        Ok(installed)
+    });
+    match installed {
+        Ok(installed) => {
+            update.commit();
+            Ok(installed)
+        }
+        Err(err) => {
+            update.rollback();
+            Err(err)
+        }
+    }
+}
+
+/// Downloads the volts `meta` needs that are missing, and the ones those
+/// need, in the order they can be started in. Volts in `seen` are skipped,
+/// so that one needed twice or in a cycle is only downloaded once.
+fn download_dependencies(
+    meta: &VoltMetadata,
+    registries: &[Registry],
+    seen: &mut HashSet<VoltID>,
+) -> Result<Vec<VoltMetadata>> {
+    seen.insert(meta.id());
+    let mut installed = Vec::new();
+    for dependency in missing_volts(meta, registries)? {
+        if seen.insert(dependency.id()) {
+            installed.extend(download_volt_once(&dependency, seen)?);
+        }
+    }
+    Ok(installed)
+}
+
+/// The volts that have to be installed along with `meta` for its
+/// dependencies and extension pack: those that aren't installed in a version
+/// meeting their requirement, at the latest version `registries` have.
+pub fn missing_volts(
+    meta: &VoltMetadata,
+    registries: &[Registry],
+) -> Result<Vec<VoltInfo>> {
+    let required = meta.required_volts();
+    if required.is_empty() {
+        return Ok(Vec::new());
+    }
+    let installed: HashMap<VoltID, String> = find_all_volts(&[])
+        .into_iter()
+        .map(|volt| (volt.id(), volt.version))
+        .collect();
+
+    let mut missing = Vec::new();
+    for (id, req) in required {
+        let volt_id: VoltID = id.parse()?;
+        let req = semver::VersionReq::parse(&req).map_err(|err| {
+            anyhow!("invalid version requirement {req} for {id}: {err}")
+        })?;
+        if installed
+            .get(&volt_id)
+            .is_some_and(|version| version_matches(&req, version))
+        {
+            continue;
+        }
+        let info = latest_volt(registries, &volt_id).ok_or_else(|| {
+            anyhow!("{} needs {id}, which isn't in any registry", meta.id())
+        })?;
+        if !version_matches(&req, &info.version) {
+            return Err(anyhow!(
+                "{} needs {id} {req}, but the latest version is {}",
+                meta.id(),
+                info.version
+            ));
+        }
+        missing.push(info);
+    }
+    Ok(missing)
+}
 
-    let resp = crate::get_url(url, None)?;
-    if !resp.status().is_success() {
-        return Err(anyhow!("can't download plugin"));
+/// Whether a volt version meets a requirement. Versions like `0.1` that
+/// leave out components are read as `0.1.0`.
+fn version_matches(req: &semver::VersionReq, version: &str) -> bool {
+    if *req == semver::VersionReq::STAR {
+        return true;
+    }
+    let mut padded = version.to_string();
+    for _ in version.split('.').count()..3 {
+        padded.push_str(".0");
     }
+    semver::Version::parse(version)
+        .or_else(|_| semver::Version::parse(&padded))
+        .is_ok_and(|version| req.matches(&version))
+}
+
+/// A volt that has been moved into place, with the version it replaced kept
+/// aside until the new one is known to work.
+struct VoltUpdate {
+    plugin_dir: PathBuf,
+    backup_dir: Option<PathBuf>,
+}
 
-    // this is the s3 url
-    let url = resp.text()?;
+impl VoltUpdate {
+    fn download(volt: &VoltInfo) -> Result<Self> {
+        let plugins_dir = Directory::plugins_directory()
+            .ok_or_else(|| anyhow!("can't get plugin directory"))?;
+        let id = volt.id().to_string();
+
+        let archive = Registry::of_volt(volt).download(volt)?;
+        // Removed when dropped, unless it's been moved into place.
+        let staging_dir = tempfile::Builder::new()
+            .prefix(&format!(".staging-{id}-"))
+            .tempdir_in(&plugins_dir)?;
+        unpack_volt(archive, staging_dir.path())?;
+
+        let plugin_dir = plugins_dir.join(&id);
+        let backup_dir = if plugin_dir.exists() {
+            let backup_dir = plugins_dir.join(format!(".backup-{id}"));
+            if backup_dir.exists() {
+                fs::remove_dir_all(&backup_dir)?;
+            }
+            fs::rename(&plugin_dir, &backup_dir)?;
+            Some(backup_dir)
+        } else {
+            None
+        };
+        if let Err(err) = fs::rename(staging_dir.path(), &plugin_dir) {
+            if let Some(backup_dir) = backup_dir.as_ref() {
+                fs::rename(backup_dir, &plugin_dir)?;
+            }
+            return Err(err.into());
+        }
+
+        Ok(Self {
+            plugin_dir,
+            backup_dir,
+        })
+    }
 
-    let mut resp = crate::get_url(url, None)?;
-    if !resp.status().is_success() {
-        return Err(anyhow!("can't download plugin"));
+    /// Keeps the new version and drops the previous one.
+    fn commit(self) {
+        if let Some(backup_dir) = self.backup_dir {
+            if let Err(err) = fs::remove_dir_all(backup_dir) {
+                tracing::error!("{:?}", err);
+            }
+        }
     }
 
-    let is_zstd = resp
-        .headers()
-        .get("content-type")
-        .and_then(|v| v.to_str().ok())
-        == Some("application/zstd");
+    /// Removes the new version and restores the previous one, if there was
+    /// one. Returns the metadata of the restored version.
+    fn rollback(self) -> Option<VoltMetadata> {
+        if let Err(err) = fs::remove_dir_all(&self.plugin_dir) {
+            tracing::error!("{:?}", err);
+        }
+        let backup_dir = self.backup_dir?;
+        if let Err(err) = fs::rename(&backup_dir, &self.plugin_dir) {
+            tracing::error!("{:?}", err);
+            return None;
+        }
+        load_volt(&self.plugin_dir)
+            .map_err(|err| tracing::error!("{:?}", err))
+            .ok()
+    }
+}
 
-    let id = volt.id();
-    let plugin_dir = Directory::plugins_directory()
-        .ok_or_else(|| anyhow!("can't get plugin directory"))?
-        .join(id.to_string());
+/// Installs a volt from a local `.volt` archive (a gzip or zstd compressed
+/// tar) or from a directory containing a `volt.toml`, without going through a
+/// registry. The volts it needs are downloaded from `registries` before it's
+/// moved into place, and returned before it like [`download_volt`] does.
+pub fn install_volt_from_path(
+    path: &Path,
+    registries: &[Registry],
+) -> Result<Vec<VoltMetadata>> {
+    let plugins_dir = Directory::plugins_directory()
+        .ok_or_else(|| anyhow!("can't get plugin directory"))?;
+
+    // Picking the volt.toml of an unpacked volt installs its directory
+    let path = match path.parent() {
+        Some(parent) if path.file_name() == Some("volt.toml".as_ref()) => parent,
+        _ => path,
+    };
+
+    if path.is_dir() {
+        let meta = load_volt(path)?;
+        let plugin_dir = plugins_dir.join(meta.id().to_string());
+        // Removing the installed copy would delete a source inside it, and
+        // copying a source that holds it would copy into itself.
+        let source = path.canonicalize()?;
+        let target = plugins_dir.canonicalize()?.join(meta.id().to_string());
+        if source.starts_with(&target) || target.starts_with(&source) {
+            return Err(anyhow!(
+                "can't install {} from {}, which overlaps where it's installed",
+                meta.id(),
+                path.display()
+            ));
+        }
+        let mut installed =
+            download_dependencies(&meta, registries, &mut HashSet::new())?;
+        let lock = install_lock(&meta.id());
+        let _guard = lock.lock();
+        if let Err(err) = fs::remove_dir_all(&plugin_dir) {
+            tracing::error!("{:?}", err);
+        }
+        copy_dir(path, &plugin_dir)?;
+        installed.push(load_volt(&plugin_dir)?);
+        return Ok(installed);
+    }
+
+    // Unpack into a staging directory first, as the id of the volt is only
+    // known once its volt.toml can be read. It's removed when dropped,
+    // unless it's been moved into place.
+    let staging_dir = tempfile::Builder::new()
+        .prefix(".staging-")
+        .tempdir_in(&plugins_dir)?;
+    let mut file = fs::File::open(path)?;
+    let mut magic = [0u8; 4];
+    let is_zstd =
+        file.read_exact(&mut magic).is_ok() && magic == [0x28, 0xb5, 0x2f, 0xfd];
+    file.seek(SeekFrom::Start(0))?;
+    unpack_volt(
+        VoltArchive {
+            reader: Box::new(file),
+            is_zstd,
+        },
+        staging_dir.path(),
+    )?;
+
+    let meta = load_volt(staging_dir.path())?;
+    let mut installed =
+        download_dependencies(&meta, registries, &mut HashSet::new())?;
+    let lock = install_lock(&meta.id());
+    let _guard = lock.lock();
+    let plugin_dir = plugins_dir.join(meta.id().to_string());
     if let Err(err) = fs::remove_dir_all(&plugin_dir) {
         tracing::error!("{:?}", err);
     }
-    fs::create_dir_all(&plugin_dir)?;
+    fs::rename(staging_dir.path(), &plugin_dir)?;
+    installed.push(load_volt(&plugin_dir)?);
+    Ok(installed)
+}
+
+fn unpack_volt(archive: VoltArchive, plugin_dir: &Path) -> Result<()> {
+    if let Err(err) = fs::remove_dir_all(plugin_dir) {
+        tracing::error!("{:?}", err);
+    }
+    fs::create_dir_all(plugin_dir)?;
 
+    let VoltArchive {
+        mut reader,
+        is_zstd,
+    } = archive;
     if is_zstd {
-        let tar = zstd::Decoder::new(&mut resp).unwrap();
+        let tar = zstd::Decoder::new(&mut reader)?;
         let mut archive = Archive::new(tar);
-        archive.unpack(&plugin_dir)?;
+        archive.unpack(plugin_dir)?;
     } else {
-        let tar = GzDecoder::new(&mut resp);
+        let tar = GzDecoder::new(&mut reader);
         let mut archive = Archive::new(tar);
-        archive.unpack(&plugin_dir)?;
+        archive.unpack(plugin_dir)?;
     }
+    Ok(())
+}
 
-    let meta = load_volt(&plugin_dir)?;
-    Ok(meta)
+fn copy_dir(from: &Path, to: &Path) -> Result<()> {
+    fs::create_dir_all(to)?;
+    for entry in fs::read_dir(from)? {
+        let entry = entry?;
+        let target = to.join(entry.file_name());
+        if entry.file_type()?.is_dir() {
+            copy_dir(&entry.path(), &target)?;
+        } else {
+            fs::copy(entry.path(), target)?;
+        }
+    }
+    Ok(())
 }
 
 pub fn install_volt(
@@ -1606,21 +1956,83 @@ pub fn install_volt(
     configurations: Option<HashMap<String, serde_json::Value>>,
     volt: VoltInfo,
 ) -> Result<()> {
-    let download_volt_result = download_volt(&volt);
-    if download_volt_result.is_err() {
-        catalog_rpc
-            .core_rpc
-            .volt_installing(volt, "Could not download Plugin".to_string());
-    }
-    let meta = download_volt_result?;
-    let local_catalog_rpc = catalog_rpc.clone();
-    let local_meta = meta.clone();
-
-    if let Err(err) =
-        start_volt(workspace, configurations, local_catalog_rpc, local_meta)
-    {
-        tracing::error!("{:?}", err);
-    }
+    let lock = install_lock(&volt.id());
+    let _guard = lock.lock();
+    let update = match VoltUpdate::download(&volt) {
+        Ok(update) => update,
+        Err(err) => {
+            catalog_rpc
+                .core_rpc
+                .volt_installing(volt, "Could not download Plugin".to_string());
+            return Err(err);
+        }
+    };
+
+    let registries = registry::dependency_registries(&volt);
+    let started = load_volt(&update.plugin_dir).and_then(|meta| {
+        // The volts it needs are installed before it's started, and one that
+        // can't be installed fails the install.
+        let dependencies =
+            download_dependencies(&meta, &registries, &mut HashSet::new())?;
+        for dependency in dependencies {
+            let icon = volt_icon(&dependency);
+            catalog_rpc
+                .core_rpc
+                .volt_installed(dependency.clone(), icon);
+            if dependency.wasm.is_some() {
+                catalog_rpc.reload_volt(dependency)?;
+            }
+        }
+        if meta.wasm.is_none() {
+            return Ok(meta);
+        }
+        if approved_permissions(&meta).is_none() {
+            // Keep the new version, it's started once the user approves the
+            // permissions it asks for.
+            catalog_rpc
+                .core_rpc
+                .volt_permissions_requested(meta.clone());
+            return Ok(meta);
+        }
+        start_volt(
+            workspace.clone(),
+            configurations.clone(),
+            catalog_rpc.clone(),
+            meta.clone(),
+        )?;
+        Ok(meta)
+    });
+    let meta = match started {
+        Ok(meta) => {
+            update.commit();
+            meta
+        }
+        Err(err) => {
+            tracing::error!("{:?}", err);
+            // Go back to the version that was installed before, so a broken
+            // update doesn't leave the user without the plugin.
+            let restored = update.rollback();
+            let message = match restored.as_ref() {
+                Some(meta) => format!(
+                    "Could not start version {}, rolled back to {}",
+                    volt.version, meta.version
+                ),
+                None => format!("Could not start Plugin: {err}"),
+            };
+            catalog_rpc.core_rpc.volt_installing(volt, message);
+            let Some(meta) = restored else {
+                return Err(err);
+            };
+            start_volt(
+                workspace,
+                configurations,
+                catalog_rpc.clone(),
+                meta.clone(),
+            )?;
+            meta
+        }
+    };
+
     let icon = volt_icon(&meta);
     catalog_rpc.core_rpc.volt_installed(meta, icon);
     Ok(())
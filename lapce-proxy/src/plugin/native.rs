@@ -0,0 +1,162 @@
+//! Language servers and debug adapters declared in settings.toml, which are
+//! started directly rather than by a volt.
+
+use std::{
+    collections::HashMap,
+    path::{Path, PathBuf},
+};
+
+use anyhow::{Result, anyhow};
+use lapce_rpc::plugin::{
+    DEBUGGERS_SECTION, DebuggerConfig, LANGUAGE_SERVERS_SECTION,
+    LanguageServerConfig, PluginId, VoltID,
+};
+use lsp_types::{DocumentFilter, Url};
+use serde::de::DeserializeOwned;
+use serde_json::Value;
+
+use super::{PluginCatalogRpcHandler, lsp::LspClient};
+
+/// The author of the `VoltID` a declared language server runs as.
+const SETTINGS_AUTHOR: &str = "settings";
+
+fn parse_section<T: DeserializeOwned>(
+    configurations: &HashMap<String, HashMap<String, Value>>,
+    section: &str,
+) -> HashMap<String, T> {
+    configurations
+        .get(section)
+        .into_iter()
+        .flatten()
+        .filter_map(
+            |(name, value)| match serde_json::from_value(value.clone()) {
+                Ok(config) => Some((name.clone(), config)),
+                Err(err) => {
+                    tracing::error!("invalid {section}.{name} in settings: {err}");
+                    None
+                }
+            },
+        )
+        .collect()
+}
+
+pub fn language_servers(
+    configurations: &HashMap<String, HashMap<String, Value>>,
+) -> HashMap<String, LanguageServerConfig> {
+    parse_section(configurations, LANGUAGE_SERVERS_SECTION)
+}
+
+pub fn debuggers(
+    configurations: &HashMap<String, HashMap<String, Value>>,
+) -> HashMap<String, DebuggerConfig> {
+    parse_section(configurations, DEBUGGERS_SECTION)
+}
+
+/// Whether the server should be started for a document with this language
+/// id and path.
+pub fn handles(
+    config: &LanguageServerConfig,
+    language_id: &str,
+    path: &Path,
+) -> bool {
+    config.languages.iter().any(|l| l == language_id)
+        || config.file_patterns.iter().any(|pattern| {
+            globset::Glob::new(pattern)
+                .map(|glob| glob.compile_matcher().is_match(path))
+                .unwrap_or(false)
+        })
+}
+
+pub fn start_language_server(
+    plugin_rpc: PluginCatalogRpcHandler,
+    workspace: Option<PathBuf>,
+    name: &str,
+    config: &LanguageServerConfig,
+) -> Result<PluginId> {
+    let command = Path::new(&config.command);
+    let server_uri = if command.is_absolute() {
+        Url::from_file_path(command)
+            .map_err(|_| anyhow!("can't convert {} to uri", config.command))?
+    } else {
+        // a program to look up in PATH
+        Url::parse(&format!("urn:{}", config.command))?
+    };
+    let document_selector = config
+        .languages
+        .iter()
+        .map(|language| DocumentFilter {
+            language: Some(language.clone()),
+            pattern: None,
+            scheme: None,
+        })
+        .chain(config.file_patterns.iter().map(|pattern| DocumentFilter {
+            language: None,
+            pattern: Some(pattern.clone()),
+            scheme: None,
+        }))
+        .collect();
+    LspClient::start(
+        plugin_rpc,
+        document_selector,
+        workspace,
+        VoltID {
+            author: SETTINGS_AUTHOR.to_string(),
+            name: name.to_string(),
+        },
+        name.to_string(),
+        None,
+        None,
+        None,
+        server_uri,
+        config.args.clone(),
+        config.env.clone(),
+        config.initialization_options.clone(),
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use std::{collections::HashMap, path::Path};
+
+    use serde_json::json;
+
+    use super::{debuggers, handles, language_servers};
+
+    #[test]
+    fn test_parse_declared_servers() {
+        let configurations = HashMap::from([
+            (
+                "language-servers".to_string(),
+                HashMap::from([
+                    (
+                        "clangd".to_string(),
+                        json!({
+                            "command": "clangd",
+                            "args": ["--background-index"],
+                            "languages": ["c", "cpp"],
+                        }),
+                    ),
+                    ("broken".to_string(), json!({ "command": 1 })),
+                ]),
+            ),
+            (
+                "debuggers".to_string(),
+                HashMap::from([(
+                    "lldb".to_string(),
+                    json!({ "program": "lldb-dap" }),
+                )]),
+            ),
+        ]);
+
+        let servers = language_servers(&configurations);
+        assert_eq!(servers.len(), 1);
+        let clangd = &servers["clangd"];
+        assert_eq!(clangd.args, vec!["--background-index".to_string()]);
+        assert!(handles(clangd, "cpp", Path::new("/src/main.cpp")));
+        assert!(!handles(clangd, "rust", Path::new("/src/main.rs")));
+
+        let debuggers = debuggers(&configurations);
+        assert_eq!(debuggers["lldb"].program, "lldb-dap");
+        assert_eq!(debuggers["lldb"].args, None);
+    }
+}
@@ -0,0 +1,79 @@
+//! The permissions users have granted to volts.
+//!
+//! Grants are kept next to the installed volts, so they live on the same
+//! machine as the proxy that enforces them, and survive volt updates.
+
+use std::{collections::HashMap, fs, path::PathBuf};
+
+use anyhow::{Result, anyhow};
+use lapce_core::directory::Directory;
+use lapce_rpc::plugin::{VoltID, VoltMetadata, VoltPermissions};
+
+const GRANTED_PERMISSIONS: &str = ".permissions.json";
+
+fn granted_permissions_file() -> Result<PathBuf> {
+    Ok(Directory::plugins_directory()
+        .ok_or_else(|| anyhow!("can't get plugin directory"))?
+        .join(GRANTED_PERMISSIONS))
+}
+
+fn load_granted() -> HashMap<String, VoltPermissions> {
+    granted_permissions_file()
+        .and_then(|path| Ok(fs::read_to_string(path)?))
+        .and_then(|s| Ok(serde_json::from_str(&s)?))
+        .unwrap_or_default()
+}
+
+fn save_granted(granted: &HashMap<String, VoltPermissions>) -> Result<()> {
+    let path = granted_permissions_file()?;
+    fs::write(path, serde_json::to_string_pretty(granted)?)?;
+    Ok(())
+}
+
+pub fn granted_permissions(id: &VoltID) -> Option<VoltPermissions> {
+    load_granted().remove(&id.to_string())
+}
+
+pub fn grant_permissions(id: &VoltID, permissions: VoltPermissions) -> Result<()> {
+    let mut granted = load_granted();
+    granted.insert(id.to_string(), permissions);
+    save_granted(&granted)
+}
+
+/// Grants the volts that were installed before permissions existed what they
+/// ask for, so upgrading doesn't stop every one of them until it's approved.
+/// This only happens once, when nothing has been granted yet; volts installed
+/// after that have to be approved.
+pub fn grant_installed_volts(volts: &[VoltMetadata]) -> Result<()> {
+    if granted_permissions_file()?.exists() {
+        return Ok(());
+    }
+    let granted = volts
+        .iter()
+        .filter(|meta| meta.wasm.is_some())
+        .map(|meta| (meta.id().to_string(), meta.requested_permissions()))
+        .collect();
+    save_granted(&granted)
+}
+
+pub fn revoke_permissions(id: &VoltID) -> Result<()> {
+    let mut granted = load_granted();
+    if granted.remove(&id.to_string()).is_some() {
+        save_granted(&granted)?;
+    }
+    Ok(())
+}
+
+/// The permissions a volt can be started with, or `None` if it asks for
+/// something the user hasn't granted yet.
+///
+/// Volts only get what they asked for, even if more was granted to an
+/// earlier version.
+pub fn approved_permissions(meta: &VoltMetadata) -> Option<VoltPermissions> {
+    let requested = meta.requested_permissions();
+    if requested.is_empty() {
+        return Some(requested);
+    }
+    let granted = granted_permissions(&meta.id())?;
+    granted.covers(&requested).then_some(requested)
+}
@@ -18,35 +18,41 @@
 use lapce_rpc::{
     RpcError,
     core::{CoreRpcHandler, ServerStatusParams},
-    plugin::{PluginId, VoltID},
+    plugin::{
+        PluginCommand, PluginId, PluginNotificationParams, PluginTreeView,
+        StatusBarItem, TreeNode, VoltID, VoltPermissions,
+    },
+    proxy::ProxyResponse,
     style::{LineStyle, Style},
 };
 use lapce_xi_rope::{Rope, RopeDelta};
 use lsp_types::{
-    CancelParams, CodeActionProviderCapability, DidChangeTextDocumentParams,
-    DidSaveTextDocumentParams, DocumentSelector, FoldingRangeProviderCapability,
+    ApplyWorkspaceEditParams, ApplyWorkspaceEditResponse, CancelParams,
+    CodeActionProviderCapability, DidChangeTextDocumentParams,
+    DidOpenTextDocumentParams, DidSaveTextDocumentParams, DocumentChangeOperation,
+    DocumentChanges, DocumentSelector, FoldingRangeProviderCapability,
     HoverProviderCapability, ImplementationProviderCapability, InitializeResult,
     LogMessageParams, MessageType, OneOf, ProgressParams, PublishDiagnosticsParams,
-    Range, Registration, RegistrationParams, SemanticTokens, SemanticTokensLegend,
-    SemanticTokensServerCapabilities, ServerCapabilities, ShowMessageParams,
-    TextDocumentContentChangeEvent, TextDocumentIdentifier,
-    TextDocumentSaveRegistrationOptions, TextDocumentSyncCapability,
-    TextDocumentSyncKind, TextDocumentSyncSaveOptions,
-    VersionedTextDocumentIdentifier,
+    Range, Registration, RegistrationParams, ResourceOp, SemanticTokens,
+    SemanticTokensLegend, SemanticTokensServerCapabilities, ServerCapabilities,
+    ShowMessageParams, TextDocumentContentChangeEvent, TextDocumentIdentifier,
+    TextDocumentItem, TextDocumentSaveRegistrationOptions,
+    TextDocumentSyncCapability, TextDocumentSyncKind, TextDocumentSyncSaveOptions,
+    Url, VersionedTextDocumentIdentifier, WorkspaceEdit,
     notification::{
         Cancel, DidChangeTextDocument, DidOpenTextDocument, DidSaveTextDocument,
         Initialized, LogMessage, Notification, Progress, PublishDiagnostics,
         ShowMessage,
     },
     request::{
-        CallHierarchyIncomingCalls, CallHierarchyPrepare, CodeActionRequest,
-        CodeActionResolveRequest, CodeLensRequest, CodeLensResolve, Completion,
-        DocumentSymbolRequest, FoldingRangeRequest, Formatting, GotoDefinition,
-        GotoImplementation, GotoTypeDefinition, HoverRequest, Initialize,
-        InlayHintRequest, InlineCompletionRequest, PrepareRenameRequest, References,
-        RegisterCapability, Rename, ResolveCompletionItem, SelectionRangeRequest,
-        SemanticTokensFullRequest, SignatureHelpRequest, WorkDoneProgressCreate,
-        WorkspaceSymbolRequest,
+        ApplyWorkspaceEdit, CallHierarchyIncomingCalls, CallHierarchyPrepare,
+        CodeActionRequest, CodeActionResolveRequest, CodeLensRequest,
+        CodeLensResolve, Completion, DocumentSymbolRequest, FoldingRangeRequest,
+        Formatting, GotoDefinition, GotoImplementation, GotoTypeDefinition,
+        HoverRequest, Initialize, InlayHintRequest, InlineCompletionRequest,
+        PrepareRenameRequest, References, RegisterCapability, Rename,
+        ResolveCompletionItem, SelectionRangeRequest, SemanticTokensFullRequest,
+        SignatureHelpRequest, WorkDoneProgressCreate, WorkspaceSymbolRequest,
     },
 };
 use parking_lot::Mutex;
@@ -57,7 +63,7 @@
     SendLspRequestResult, StartLspServer, StartLspServerParams,
     StartLspServerResult,
 };
-use serde::Serialize;
+use serde::{Deserialize, Serialize};
 use serde_json::Value;
 
 use super::{
@@ -65,6 +71,205 @@
     lsp::{DocumentFilter, LspClient},
 };
 
+/// Registers a command that can be run from the command palette, keybindings
+/// and status bar items. The host runs it with [`ExecuteCommand`].
+pub enum RegisterCommand {}
+
+impl Request for RegisterCommand {
+    type Params = RegisterCommandParams;
+    type Result = ();
+    const METHOD: &'static str = "host/registerCommand";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct RegisterCommandParams {
+    pub command: String,
+    pub title: String,
+}
+
+/// Sent from the host to the plugin to run one of its registered commands.
+pub enum ExecuteCommand {}
+
+impl Request for ExecuteCommand {
+    type Params = ExecuteCommandParams;
+    type Result = Option<Value>;
+    const METHOD: &'static str = "plugin/executeCommand";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct ExecuteCommandParams {
+    pub command: String,
+    #[serde(default)]
+    pub arguments: Vec<Value>,
+}
+
+pub enum CreateStatusBarItem {}
+
+impl Notification for CreateStatusBarItem {
+    type Params = StatusBarItem;
+    const METHOD: &'static str = "host/createStatusBarItem";
+}
+
+pub enum UpdateStatusBarItem {}
+
+impl Notification for UpdateStatusBarItem {
+    type Params = StatusBarItem;
+    const METHOD: &'static str = "host/updateStatusBarItem";
+}
+
+pub enum DisposeStatusBarItem {}
+
+impl Notification for DisposeStatusBarItem {
+    type Params = DisposeStatusBarItemParams;
+    const METHOD: &'static str = "host/disposeStatusBarItem";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct DisposeStatusBarItemParams {
+    pub id: String,
+}
+
+/// Like `window/showMessage`, but with actions that run commands.
+pub enum ShowNotification {}
+
+impl Notification for ShowNotification {
+    type Params = PluginNotificationParams;
+    const METHOD: &'static str = "host/showNotification";
+}
+
+/// Adds a tree to the plugin views panel. Its nodes are asked for with
+/// [`GetTreeChildren`].
+pub enum RegisterTreeView {}
+
+impl Notification for RegisterTreeView {
+    type Params = RegisterTreeViewParams;
+    const METHOD: &'static str = "host/registerTreeView";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct RegisterTreeViewParams {
+    pub id: String,
+    pub title: String,
+}
+
+pub enum RefreshTreeView {}
+
+impl Notification for RefreshTreeView {
+    type Params = RefreshTreeViewParams;
+    const METHOD: &'static str = "host/refreshTreeView";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct RefreshTreeViewParams {
+    pub view: String,
+    /// The node whose children changed, or the whole tree if it's omitted.
+    #[serde(default)]
+    pub node: Option<String>,
+}
+
+/// Sent from the host to the plugin when a tree node is expanded, or with no
+/// parent for the roots of the tree.
+pub enum GetTreeChildren {}
+
+impl Request for GetTreeChildren {
+    type Params = GetTreeChildrenParams;
+    type Result = Option<Vec<TreeNode>>;
+    const METHOD: &'static str = "plugin/getTreeChildren";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct GetTreeChildrenParams {
+    pub view: String,
+    pub parent: Option<String>,
+}
+
+/// Reads a file in the workspace. Needs the `workspace-read` permission.
+pub enum ReadFile {}
+
+impl Request for ReadFile {
+    type Params = ReadFileParams;
+    type Result = ReadFileResult;
+    const METHOD: &'static str = "host/readFile";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct ReadFileParams {
+    pub uri: Url,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct ReadFileResult {
+    pub text: String,
+}
+
+/// Writes a file in the workspace. Needs the `workspace-write` permission.
+pub enum WriteFile {}
+
+impl Request for WriteFile {
+    type Params = WriteFileParams;
+    type Result = ();
+    const METHOD: &'static str = "host/writeFile";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct WriteFileParams {
+    pub uri: Url,
+    pub text: String,
+}
+
+/// The documents open in editors, with their unsaved contents.
+pub enum GetOpenDocuments {}
+
+impl Request for GetOpenDocuments {
+    type Params = ();
+    type Result = Vec<TextDocumentItem>;
+    const METHOD: &'static str = "host/getOpenDocuments";
+}
+
+/// The document of the focused editor and its selections.
+pub enum GetActiveEditor {}
+
+impl Request for GetActiveEditor {
+    type Params = ();
+    type Result = Option<ActiveEditor>;
+    const METHOD: &'static str = "host/getActiveEditor";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct ActiveEditor {
+    pub uri: Url,
+    pub selections: Vec<Range>,
+}
+
+/// Asks for `textDocument/didOpen` and `textDocument/didChange` of the
+/// matching documents, for plugins that don't start a language server.
+pub enum SubscribeTextDocuments {}
+
+impl Request for SubscribeTextDocuments {
+    type Params = SubscribeTextDocumentsParams;
+    type Result = ();
+    const METHOD: &'static str = "host/subscribeTextDocuments";
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct SubscribeTextDocumentsParams {
+    /// Every document if it's omitted.
+    #[serde(default)]
+    pub document_selector: Option<DocumentSelector>,
+    pub sync_kind: TextDocumentSyncKind,
+}
+
 pub enum ResponseHandler<Resp, Error> {
     Chan(Sender<Result<Resp, Error>>),
     Callback(Box<dyn RpcCallback<Resp, Error>>),
@@ -615,9 +820,29 @@ struct SaveRegistration {
     filters: Vec<DocumentFilter>,
 }
 
+/// Set by [`SubscribeTextDocuments`].
+struct DocumentSubscription {
+    kind: TextDocumentSyncKind,
+    filters: Vec<DocumentFilter>,
+}
+
+impl DocumentSubscription {
+    fn matches(&self, language_id: &str, path: Option<&Path>) -> bool {
+        self.filters.is_empty()
+            || self.filters.iter().any(|filter| {
+                (filter.language_id.is_none()
+                    || filter.language_id.as_deref() == Some(language_id))
+                    && (path.is_none()
+                        || filter.pattern.is_none()
+                        || filter.pattern.as_ref().unwrap().is_match(path.unwrap()))
+            })
+    }
+}
+
 #[derive(Default)]
 struct ServerRegistrations {
     save: Option<SaveRegistration>,
+    documents: Option<DocumentSubscription>,
 }
 
 pub struct PluginHostHandler {
@@ -626,12 +851,17 @@ pub struct PluginHostHandler {
     pwd: Option<PathBuf>,
     pub(crate) workspace: Option<PathBuf>,
     document_selector: Vec<DocumentFilter>,
+    /// What the user allowed this plugin to do on the host.
+    permissions: VoltPermissions,
     core_rpc: CoreRpcHandler,
     catalog_rpc: PluginCatalogRpcHandler,
     pub server_rpc: PluginServerRpcHandler,
     pub server_capabilities: ServerCapabilities,
     server_registrations: ServerRegistrations,
 
+    /// Whether this handles a language server rather than a wasm volt.
+    pub(crate) is_language_server: bool,
+
     /// Language servers that this plugin has spawned.  
     /// Note that these plugin ids could be 'dead' if the LSP died/exited.  
     spawned_lsp: HashMap<PluginId, SpawnedLspInfo>,
@@ -645,6 +875,7 @@ pub fn new(
         volt_id: VoltID,
         volt_display_name: String,
         document_selector: DocumentSelector,
+        permissions: VoltPermissions,
         core_rpc: CoreRpcHandler,
         server_rpc: PluginServerRpcHandler,
         catalog_rpc: PluginCatalogRpcHandler,
@@ -659,11 +890,13 @@ pub fn new(
             volt_id,
             volt_display_name,
             document_selector,
+            permissions,
             core_rpc,
             catalog_rpc,
             server_rpc,
             server_capabilities: ServerCapabilities::default(),
             server_registrations: ServerRegistrations::default(),
+            is_language_server: false,
             spawned_lsp: HashMap::new(),
         }
     }
@@ -689,7 +922,10 @@ pub fn document_supported(
                         return true;
                     }
                 }
-                false
+                self.server_registrations
+                    .documents
+                    .as_ref()
+                    .is_some_and(|d| d.matches(language_id, path))
             }
             None => true,
         }
@@ -709,6 +945,9 @@ pub fn method_registered(&mut self, method: &str) -> bool {
                 .and_then(|c| c.resolve_provider)
                 .unwrap_or(false),
             DidOpenTextDocument::METHOD => {
+                if self.server_registrations.documents.is_some() {
+                    return true;
+                }
                 match &self.server_capabilities.text_document_sync {
                     Some(TextDocumentSyncCapability::Kind(kind)) => {
                         kind != &TextDocumentSyncKind::NONE
@@ -725,6 +964,9 @@ pub fn method_registered(&mut self, method: &str) -> bool {
                 }
             }
             DidChangeTextDocument::METHOD => {
+                if self.server_registrations.documents.is_some() {
+                    return true;
+                }
                 match &self.server_capabilities.text_document_sync {
                     Some(TextDocumentSyncCapability::Kind(kind)) => {
                         kind != &TextDocumentSyncKind::NONE
@@ -939,6 +1181,92 @@ fn register_capability(&mut self, registration: Registration) -> Result<()> {
         Ok(())
     }
 
+    /// The path of a workspace file a plugin asked for, if its permissions
+    /// allow it.
+    fn workspace_file(&self, uri: &Url, write: bool) -> Result<PathBuf> {
+        let allowed = if write {
+            self.permissions.workspace_write
+        } else {
+            self.permissions.workspace_read
+        };
+        if !allowed {
+            return Err(anyhow!(
+                "{} is not allowed to {} workspace files",
+                self.volt_display_name,
+                if write { "write" } else { "read" }
+            ));
+        }
+        let workspace = self
+            .workspace
+            .as_ref()
+            .ok_or_else(|| anyhow!("no workspace is open"))?
+            .canonicalize()?;
+        let path = uri
+            .to_file_path()
+            .map_err(|_| anyhow!("{uri} is not a file"))?;
+        // Resolve `..` and symlinks in the folder before checking it's in
+        // the workspace, so a file that doesn't exist yet is covered too.
+        let name = path
+            .file_name()
+            .ok_or_else(|| anyhow!("{uri} is not a file"))?;
+        let parent = path
+            .parent()
+            .ok_or_else(|| anyhow!("{uri} is not a file"))?
+            .canonicalize()?;
+        let mut resolved = parent.join(name);
+        if resolved
+            .symlink_metadata()
+            .is_ok_and(|metadata| metadata.file_type().is_symlink())
+        {
+            // Writing through a link, even a dangling one, could land
+            // anywhere, so only reads follow it.
+            if write {
+                return Err(anyhow!("{uri} is a symlink"));
+            }
+            resolved = resolved.canonicalize()?;
+        }
+        if !resolved.starts_with(&workspace) {
+            return Err(anyhow!("{uri} is not in the workspace"));
+        }
+        Ok(resolved)
+    }
+
+    /// The file a plugin asked to run, if its permissions allow running it.
+    fn allowed_program(&self, program: &str) -> Result<PathBuf> {
+        self.permissions
+            .allowed_program(program, self.pwd.as_deref(), self.workspace.as_deref())
+            .ok_or_else(|| {
+                anyhow!("{} is not allowed to run {program}", self.volt_display_name)
+            })
+    }
+
+    /// The `file:` uri of the language server a plugin asked to start, if
+    /// its permissions allow running it.
+    fn allowed_server(&self, server_uri: &Url) -> Result<Url> {
+        let program = match server_uri.scheme() {
+            "file" => server_uri
+                .to_file_path()
+                .ok()
+                .and_then(|path| path.to_str().map(str::to_string)),
+            "urn" => Some(server_uri.path().to_string()),
+            _ => None,
+        }
+        .ok_or_else(|| anyhow!("{server_uri} is not a program"))?;
+        let path = self.allowed_program(&program)?;
+        Url::from_file_path(&path)
+            .map_err(|_| anyhow!("{} is not a program", path.display()))
+    }
+
+    fn check_workspace_read(&self) -> Result<()> {
+        if !self.permissions.workspace_read {
+            return Err(anyhow!(
+                "{} is not allowed to read workspace files",
+                self.volt_display_name
+            ));
+        }
+        Ok(())
+    }
+
     pub fn handle_request(
         &mut self,
         _id: Id,
@@ -970,7 +1298,8 @@ pub fn process_request(
             ExecuteProcess::METHOD => {
                 let params: ExecuteProcessParams =
                     serde_json::from_value(serde_json::to_value(params)?)?;
-                let output = std::process::Command::new(params.program)
+                let program = self.allowed_program(&params.program)?;
+                let output = std::process::Command::new(program)
                     .args(params.args)
                     .output()?;
 
@@ -983,9 +1312,10 @@ pub fn process_request(
             RegisterDebuggerType::METHOD => {
                 let params: RegisterDebuggerTypeParams =
                     serde_json::from_value(serde_json::to_value(params)?)?;
+                let program = self.allowed_program(&params.program)?;
                 self.catalog_rpc.register_debugger_type(
                     params.debugger_type,
-                    params.program,
+                    program.to_string_lossy().into_owned(),
                     params.args,
                 );
                 resp.send_null();
@@ -993,6 +1323,7 @@ pub fn process_request(
             StartLspServer::METHOD => {
                 let params: StartLspServerParams =
                     serde_json::from_value(serde_json::to_value(params)?)?;
+                let server_uri = self.allowed_server(&params.server_uri)?;
                 let workspace = self.workspace.clone();
                 let pwd = self.pwd.clone();
                 let catalog_rpc = self.catalog_rpc.clone();
@@ -1013,8 +1344,9 @@ pub fn process_request(
                         Some(spawned_by),
                         Some(plugin_id),
                         pwd,
-                        params.server_uri,
+                        server_uri,
                         params.server_args,
+                        HashMap::new(),
                         params.options,
                     ) {
                         tracing::error!("{:?}", err);
@@ -1081,6 +1413,116 @@ pub fn process_request(
                     },
                 )
             }
+            ReadFile::METHOD => {
+                let params: ReadFileParams =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                let path = self.workspace_file(&params.uri, false)?;
+                let text = std::fs::read_to_string(path)?;
+                resp.send(ReadFileResult { text });
+            }
+            WriteFile::METHOD => {
+                let params: WriteFileParams =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                let path = self.workspace_file(&params.uri, true)?;
+                std::fs::write(path, params.text)?;
+                resp.send_null();
+            }
+            GetOpenDocuments::METHOD => {
+                self.check_workspace_read()?;
+                match self.catalog_rpc.proxy_rpc.get_open_files_content() {
+                    Ok(ProxyResponse::GetOpenFilesContentResponse { items }) => {
+                        resp.send(items);
+                    }
+                    Ok(_) => return Err(anyhow!("unexpected response")),
+                    Err(err) => return Err(anyhow!(err.message)),
+                }
+            }
+            GetActiveEditor::METHOD => {
+                self.check_workspace_read()?;
+                match self.catalog_rpc.proxy_rpc.get_active_editor() {
+                    Ok(ProxyResponse::GetActiveEditorResponse {
+                        path,
+                        selections,
+                    }) => {
+                        let editor = path
+                            .and_then(|path| Url::from_file_path(path).ok())
+                            .map(|uri| ActiveEditor { uri, selections });
+                        resp.send(editor);
+                    }
+                    Ok(_) => return Err(anyhow!("unexpected response")),
+                    Err(err) => return Err(anyhow!(err.message)),
+                }
+            }
+            SubscribeTextDocuments::METHOD => {
+                self.check_workspace_read()?;
+                let params: SubscribeTextDocumentsParams =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                let subscription = DocumentSubscription {
+                    kind: params.sync_kind,
+                    filters: params
+                        .document_selector
+                        .iter()
+                        .flatten()
+                        .map(DocumentFilter::from_lsp_filter_loose)
+                        .collect(),
+                };
+                resp.send_null();
+
+                // Documents opened before the subscription
+                if let Ok(ProxyResponse::GetOpenFilesContentResponse { items }) =
+                    self.catalog_rpc.proxy_rpc.get_open_files_content()
+                {
+                    for item in items {
+                        let path = item.uri.to_file_path().ok();
+                        if !subscription.matches(&item.language_id, path.as_deref())
+                        {
+                            continue;
+                        }
+                        let language_id = Some(item.language_id.clone());
+                        self.server_rpc.server_notification(
+                            DidOpenTextDocument::METHOD,
+                            DidOpenTextDocumentParams {
+                                text_document: item,
+                            },
+                            language_id,
+                            path,
+                            false,
+                        );
+                    }
+                }
+                self.server_registrations.documents = Some(subscription);
+            }
+            ApplyWorkspaceEdit::METHOD => {
+                let params: ApplyWorkspaceEditParams =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                for uri in workspace_edit_uris(&params.edit) {
+                    self.workspace_file(uri, true)?;
+                }
+                self.core_rpc.apply_workspace_edit(params.edit);
+                resp.send(ApplyWorkspaceEditResponse {
+                    applied: true,
+                    failure_reason: None,
+                    failed_change: None,
+                });
+            }
+            RegisterCommand::METHOD => {
+                let params: RegisterCommandParams =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                let command = PluginCommand {
+                    volt: self.volt_id.clone(),
+                    command: params.command,
+                    title: params.title,
+                };
+                if !command.is_namespaced() {
+                    return Err(anyhow!(
+                        "command {} must start with {}.",
+                        command.command,
+                        self.volt_id
+                    ));
+                }
+                self.core_rpc.plugin_command_registered(command);
+                resp.send_null();
+            }
             _ => return Err(anyhow!("request not supported")),
         }
 
@@ -1107,6 +1549,7 @@ pub fn handle_notification(
 
                 let params: StartLspServerParams =
                     serde_json::from_value(serde_json::to_value(params)?)?;
+                let server_uri = self.allowed_server(&params.server_uri)?;
                 let workspace = self.workspace.clone();
                 let pwd = self.pwd.clone();
                 let catalog_rpc = self.catalog_rpc.clone();
@@ -1122,8 +1565,9 @@ pub fn handle_notification(
                         None,
                         None,
                         pwd,
-                        params.server_uri,
+                        server_uri,
                         params.server_args,
+                        HashMap::new(),
                         params.options,
                     ) {
                         tracing::error!("{:?}", err);
@@ -1149,14 +1593,63 @@ pub fn handle_notification(
             LogMessage::METHOD => {
                 let message: LogMessageParams =
                     serde_json::from_value(serde_json::to_value(params)?)?;
+                // language servers get their own output channel, apart from
+                // the volt's
+                let kind = if self.is_language_server {
+                    "lsp"
+                } else {
+                    "psp"
+                };
                 self.catalog_rpc.core_rpc.log_message(
                     message,
                     format!(
-                        "lapce_proxy::plugin::psp::{}::{}::LogMessage",
+                        "lapce_proxy::plugin::{kind}::{}::{}::LogMessage",
                         self.volt_id.author, self.volt_id.name
                     ),
                 );
             }
+            CreateStatusBarItem::METHOD | UpdateStatusBarItem::METHOD => {
+                let item: StatusBarItem =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                self.core_rpc
+                    .plugin_status_bar_item(self.volt_id.clone(), item);
+            }
+            DisposeStatusBarItem::METHOD => {
+                let params: DisposeStatusBarItemParams =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                self.core_rpc.plugin_status_bar_item_disposed(
+                    self.volt_id.clone(),
+                    params.id,
+                );
+            }
+            RegisterTreeView::METHOD => {
+                let params: RegisterTreeViewParams =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                self.core_rpc.plugin_tree_view_registered(PluginTreeView {
+                    volt: self.volt_id.clone(),
+                    id: params.id,
+                    title: params.title,
+                });
+            }
+            RefreshTreeView::METHOD => {
+                let params: RefreshTreeViewParams =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                self.core_rpc.plugin_tree_view_refresh(
+                    self.volt_id.clone(),
+                    params.view,
+                    params.node,
+                );
+            }
+            ShowNotification::METHOD => {
+                let params: PluginNotificationParams =
+                    serde_json::from_value(serde_json::to_value(params)?)?;
+                let title = format!("Plugin: {}", self.volt_display_name);
+                self.core_rpc.plugin_notification(
+                    self.volt_id.clone(),
+                    title,
+                    params,
+                );
+            }
             Cancel::METHOD => {
                 let params: CancelParams =
                     serde_json::from_value(serde_json::to_value(params)?)?;
@@ -1242,6 +1735,17 @@ pub fn handle_did_change_text_document(
             }
             None => TextDocumentSyncKind::NONE,
         };
+        let path = document.uri.to_file_path().ok();
+        let kind = if kind == TextDocumentSyncKind::NONE {
+            self.server_registrations
+                .documents
+                .as_ref()
+                .filter(|d| d.matches(&lanaguage_id, path.as_deref()))
+                .map(|d| d.kind)
+                .unwrap_or(TextDocumentSyncKind::NONE)
+        } else {
+            kind
+        };
 
         let mut existing = change.lock();
         let change = match kind {
@@ -1276,8 +1780,6 @@ pub fn handle_did_change_text_document(
             _ => return,
         };
 
-        let path = document.uri.to_file_path().ok();
-
         let params = DidChangeTextDocumentParams {
             text_document: document,
             content_changes: vec![change],
@@ -1335,6 +1837,41 @@ struct SpawnedLspInfo {
     resp: Option<ResponseSender>,
 }
 
+/// Every file a workspace edit changes, creates, renames or deletes.
+fn workspace_edit_uris(edit: &WorkspaceEdit) -> Vec<&Url> {
+    let mut uris: Vec<&Url> = edit
+        .changes
+        .iter()
+        .flat_map(|changes| changes.keys())
+        .collect();
+    match &edit.document_changes {
+        Some(DocumentChanges::Edits(edits)) => {
+            uris.extend(edits.iter().map(|edit| &edit.text_document.uri));
+        }
+        Some(DocumentChanges::Operations(operations)) => {
+            for operation in operations {
+                match operation {
+                    DocumentChangeOperation::Edit(edit) => {
+                        uris.push(&edit.text_document.uri);
+                    }
+                    DocumentChangeOperation::Op(ResourceOp::Create(create)) => {
+                        uris.push(&create.uri);
+                    }
+                    DocumentChangeOperation::Op(ResourceOp::Rename(rename)) => {
+                        uris.push(&rename.old_uri);
+                        uris.push(&rename.new_uri);
+                    }
+                    DocumentChangeOperation::Op(ResourceOp::Delete(delete)) => {
+                        uris.push(&delete.uri);
+                    }
+                }
+            }
+        }
+        None => {}
+    }
+    uris
+}
+
 fn get_document_content_change(
     text: &Rope,
     delta: &RopeDelta,
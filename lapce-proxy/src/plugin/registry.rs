@@ -0,0 +1,472 @@
+//! Access to volt registries.
+//!
+//! A registry is either a server implementing the plugin API served by
+//! `https://plugins.lapce.dev`, or a static index (`index.json`) that lists
+//! the available volts next to their archives. The static form can be served
+//! by any file server or read straight from a local directory, which is what
+//! makes offline and self-hosted setups possible. See
+//! `docs/plugin-registry.md` for the exact layout of both forms.
+
+use std::{
+    fs,
+    io::{Cursor, Read},
+    path::{Path, PathBuf},
+};
+
+use anyhow::{Result, anyhow};
+use lapce_rpc::plugin::{VoltID, VoltInfo};
+use serde::{Deserialize, Serialize};
+use url::Url;
+
+pub const DEFAULT_REGISTRY: &str = "https://plugins.lapce.dev";
+
+const STATIC_INDEX: &str = "index.json";
+
+#[derive(Deserialize, Serialize)]
+pub struct VoltsInfo {
+    pub plugins: Vec<VoltInfo>,
+    pub total: usize,
+}
+
+/// The downloaded archive of a volt, either gzip or zstd compressed tar.
+pub struct VoltArchive {
+    pub reader: Box<dyn Read>,
+    pub is_zstd: bool,
+}
+
+/// How far the search results of a registry have been paged through.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq)]
+pub struct RegistryCursor {
+    pub offset: usize,
+    /// `None` until the registry has answered at least once.
+    pub total: Option<usize>,
+}
+
+impl RegistryCursor {
+    pub fn is_done(&self) -> bool {
+        self.total
+            .map(|total| self.offset >= total)
+            .unwrap_or(false)
+    }
+}
+
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub enum Registry {
+    /// A server implementing the `/api/v1/plugins` API.
+    Api(String),
+    /// A static `index.json` served over http(s).
+    StaticRemote(String),
+    /// A static `index.json` in a local directory.
+    StaticLocal(PathBuf),
+}
+
+impl Registry {
+    /// Parses a registry location as written in the `core.plugin-registries`
+    /// setting. `file://` urls and plain paths are static local registries,
+    /// http(s) urls ending with `index.json` are static remote registries and
+    /// every other url is expected to implement the registry api.
+    pub fn new(location: &str) -> Self {
+        let location = location.trim();
+        match Url::parse(location) {
+            Ok(url) if url.scheme() == "file" => {
+                let path = url
+                    .to_file_path()
+                    .unwrap_or_else(|_| PathBuf::from(url.path()));
+                Self::local(path)
+            }
+            Ok(url) if url.scheme() == "http" || url.scheme() == "https" => {
+                let location = location.trim_end_matches('/');
+                if let Some(base) = location.strip_suffix(STATIC_INDEX) {
+                    Self::StaticRemote(base.trim_end_matches('/').to_string())
+                } else {
+                    Self::Api(location.to_string())
+                }
+            }
+            _ => Self::local(PathBuf::from(location)),
+        }
+    }
+
+    fn local(path: PathBuf) -> Self {
+        if path.file_name().and_then(|f| f.to_str()) == Some(STATIC_INDEX) {
+            Self::StaticLocal(path.parent().map(Path::to_path_buf).unwrap_or(path))
+        } else {
+            Self::StaticLocal(path)
+        }
+    }
+
+    /// The location that identifies this registry, stored in
+    /// [`VoltInfo::registry`] so a volt is later downloaded from where it was
+    /// found.
+    pub fn location(&self) -> String {
+        match self {
+            Registry::Api(url) => url.clone(),
+            Registry::StaticRemote(url) => format!("{url}/{STATIC_INDEX}"),
+            Registry::StaticLocal(path) => path.to_string_lossy().to_string(),
+        }
+    }
+
+    /// The registry a volt should be fetched from.
+    pub fn of_volt(volt: &VoltInfo) -> Self {
+        Self::new(volt.registry.as_deref().unwrap_or(DEFAULT_REGISTRY))
+    }
+
+    pub fn query(&self, query: &str, offset: usize) -> Result<VoltsInfo> {
+        let mut info = match self {
+            Registry::Api(url) => {
+                let mut url = Url::parse(&format!("{url}/api/v1/plugins"))?;
+                url.query_pairs_mut()
+                    .append_pair("q", query)
+                    .append_pair("offset", &offset.to_string());
+                let resp = crate::get_url(url, None)?;
+                if !resp.status().is_success() {
+                    return Err(anyhow!("can't query plugins from {}", self));
+                }
+                resp.json::<VoltsInfo>()?
+            }
+            Registry::StaticRemote(_) | Registry::StaticLocal(_) => {
+                let query = query.to_lowercase();
+                let plugins: Vec<VoltInfo> = self
+                    .index()?
+                    .into_iter()
+                    .filter(|volt| {
+                        query.is_empty()
+                            || [
+                                &volt.name,
+                                &volt.display_name,
+                                &volt.description,
+                                &volt.author,
+                            ]
+                            .iter()
+                            .any(|s| s.to_lowercase().contains(&query))
+                    })
+                    .collect();
+                let total = plugins.len();
+                VoltsInfo {
+                    plugins: plugins.into_iter().skip(offset).collect(),
+                    total,
+                }
+            }
+        };
+        let location = self.location();
+        for volt in info.plugins.iter_mut() {
+            volt.registry = Some(location.clone());
+        }
+        Ok(info)
+    }
+
+    pub fn latest(&self, author: &str, name: &str) -> Result<VoltInfo> {
+        let mut info = match self {
+            Registry::Api(url) => {
+                let resp = crate::get_url(
+                    format!("{url}/api/v1/plugins/{author}/{name}/latest"),
+                    None,
+                )?;
+                if !resp.status().is_success() {
+                    return Err(anyhow!("{author}.{name} not found in {}", self));
+                }
+                resp.json::<VoltInfo>()?
+            }
+            Registry::StaticRemote(_) | Registry::StaticLocal(_) => self
+                .index()?
+                .into_iter()
+                .find(|volt| volt.author == author && volt.name == name)
+                .ok_or_else(|| anyhow!("{author}.{name} not found in {}", self))?,
+        };
+        info.registry = Some(self.location());
+        Ok(info)
+    }
+
+    pub fn icon(&self, volt: &VoltInfo) -> Result<Vec<u8>> {
+        match self {
+            Registry::Api(url) => {
+                let resp = crate::get_url(
+                    format!(
+                        "{url}/api/v1/plugins/{}/{}/{}/icon?id={}",
+                        volt.author, volt.name, volt.version, volt.updated_at_ts
+                    ),
+                    None,
+                )?;
+                if !resp.status().is_success() {
+                    return Err(anyhow!("can't download icon"));
+                }
+                Ok(resp.bytes()?.to_vec())
+            }
+            Registry::StaticRemote(_) | Registry::StaticLocal(_) => self
+                .read_static(&Self::volt_file(volt, "icon")?)?
+                .ok_or_else(|| anyhow!("volt doesn't have an icon")),
+        }
+    }
+
+    /// Returns `None` if the volt doesn't have a README.
+    pub fn readme(&self, volt: &VoltInfo) -> Result<Option<String>> {
+        match self {
+            Registry::Api(url) => {
+                let resp = crate::get_url(
+                    format!(
+                        "{url}/api/v1/plugins/{}/{}/{}/readme",
+                        volt.author, volt.name, volt.version
+                    ),
+                    None,
+                )?;
+                if resp.status() != 200 {
+                    return Ok(None);
+                }
+                Ok(Some(resp.text()?))
+            }
+            Registry::StaticRemote(_) | Registry::StaticLocal(_) => Ok(self
+                .read_static(&Self::volt_file(volt, "README.md")?)?
+                .map(|buf| String::from_utf8_lossy(&buf).to_string())),
+        }
+    }
+
+    pub fn download(&self, volt: &VoltInfo) -> Result<VoltArchive> {
+        match self {
+            Registry::Api(url) => {
+                let resp = crate::get_url(
+                    format!(
+                        "{url}/api/v1/plugins/{}/{}/{}/download",
+                        volt.author, volt.name, volt.version
+                    ),
+                    None,
+                )?;
+                if !resp.status().is_success() {
+                    return Err(anyhow!("can't download plugin"));
+                }
+
+                // this is the s3 url
+                let url = resp.text()?;
+
+                let resp = crate::get_url(url, None)?;
+                if !resp.status().is_success() {
+                    return Err(anyhow!("can't download plugin"));
+                }
+
+                let is_zstd = resp
+                    .headers()
+                    .get("content-type")
+                    .and_then(|v| v.to_str().ok())
+                    == Some("application/zstd");
+                Ok(VoltArchive {
+                    reader: Box::new(resp),
+                    is_zstd,
+                })
+            }
+            Registry::StaticRemote(_) | Registry::StaticLocal(_) => {
+                for (file, is_zstd) in
+                    [("volt.tar.zst", true), ("volt.tar.gz", false)]
+                {
+                    if let Some(buf) =
+                        self.read_static(&Self::volt_file(volt, file)?)?
+                    {
+                        return Ok(VoltArchive {
+                            reader: Box::new(Cursor::new(buf)),
+                            is_zstd,
+                        });
+                    }
+                }
+                Err(anyhow!("can't find archive of {} in {}", volt.id(), self))
+            }
+        }
+    }
+
+    fn index(&self) -> Result<Vec<VoltInfo>> {
+        let buf = self
+            .read_static(STATIC_INDEX)?
+            .ok_or_else(|| anyhow!("{} doesn't have an {STATIC_INDEX}", self))?;
+        let index: VoltsInfo = serde_json::from_slice(&buf)?;
+        Ok(index.plugins)
+    }
+
+    /// The path of a file of a volt, relative to the root of a static
+    /// registry. The author, name and version come from the registry's
+    /// `index.json`, so any that would lead out of the volt's directory are
+    /// refused.
+    fn volt_file(volt: &VoltInfo, file: &str) -> Result<String> {
+        for component in [&volt.author, &volt.name, &volt.version] {
+            if component.is_empty()
+                || component.contains(['/', '\\', ':'])
+                || component.contains("..")
+            {
+                return Err(anyhow!(
+                    "{} has an invalid path component {component:?}",
+                    volt.id()
+                ));
+            }
+        }
+        Ok(format!(
+            "{}/{}/{}/{file}",
+            volt.author, volt.name, volt.version
+        ))
+    }
+
+    /// Reads a file relative to the root of a static registry, returning
+    /// `None` if it doesn't exist.
+    fn read_static(&self, file: &str) -> Result<Option<Vec<u8>>> {
+        match self {
+            Registry::StaticRemote(url) => {
+                let resp = crate::get_url(format!("{url}/{file}"), None)?;
+                if resp.status() == 404 {
+                    return Ok(None);
+                }
+                if !resp.status().is_success() {
+                    return Err(anyhow!("can't fetch {file} from {}", self));
+                }
+                Ok(Some(resp.bytes()?.to_vec()))
+            }
+            Registry::StaticLocal(path) => {
+                let path = path.join(file);
+                if !path.exists() {
+                    return Ok(None);
+                }
+                Ok(Some(fs::read(path)?))
+            }
+            Registry::Api(_) => Err(anyhow!("{} is not a static registry", self)),
+        }
+    }
+}
+
+impl std::fmt::Display for Registry {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "{}", self.location())
+    }
+}
+
+/// Parses the configured registry locations, in priority order. Falls back to
+/// the public registry if none are configured.
+pub fn registries(locations: &[String]) -> Vec<Registry> {
+    let registries: Vec<Registry> = locations
+        .iter()
+        .filter(|l| !l.trim().is_empty())
+        .map(|l| Registry::new(l))
+        .collect();
+    if registries.is_empty() {
+        vec![Registry::new(DEFAULT_REGISTRY)]
+    } else {
+        registries
+    }
+}
+
+/// The registries the dependencies of a volt are looked up in: the one the
+/// volt was installed from, then the public registry.
+pub fn dependency_registries(volt: &VoltInfo) -> Vec<Registry> {
+    let mut registries =
+        vec![Registry::of_volt(volt), Registry::new(DEFAULT_REGISTRY)];
+    registries.dedup();
+    registries
+}
+
+/// Queries the next page of every registry that still has unseen results.
+///
+/// `cursors` has one entry per registry and is updated in place. Volts are
+/// returned in registry priority order, and a volt that a higher priority
+/// registry also provides is dropped. Registries that fail are skipped and
+/// their errors returned alongside the results, so that one unreachable
+/// registry doesn't hide the others.
+pub fn query_registries(
+    registries: &[Registry],
+    query: &str,
+    cursors: &mut Vec<RegistryCursor>,
+) -> (Vec<VoltInfo>, Vec<anyhow::Error>) {
+    cursors.resize(registries.len(), RegistryCursor::default());
+
+    let mut seen = std::collections::HashSet::new();
+    let mut plugins = Vec::new();
+    let mut errors = Vec::new();
+    for (registry, cursor) in registries.iter().zip(cursors.iter_mut()) {
+        if cursor.is_done() {
+            continue;
+        }
+        match registry.query(query, cursor.offset) {
+            Ok(info) => {
+                cursor.offset += info.plugins.len();
+                // A registry that returns an empty page has nothing more to
+                // give, even if its total says otherwise.
+                cursor.total = Some(if info.plugins.is_empty() {
+                    cursor.offset
+                } else {
+                    info.total
+                });
+                for volt in info.plugins {
+                    if seen.insert(volt.id()) {
+                        plugins.push(volt);
+                    }
+                }
+            }
+            Err(err) => {
+                cursor.total = Some(cursor.offset);
+                errors.push(err);
+            }
+        }
+    }
+    (plugins, errors)
+}
+
+/// Looks up the latest version of a volt in the registries, in priority order.
+pub fn latest_volt(registries: &[Registry], id: &VoltID) -> Option<VoltInfo> {
+    registries.iter().find_map(|registry| {
+        registry
+            .latest(&id.author, &id.name)
+            .map_err(|err| tracing::debug!("{:?}", err))
+            .ok()
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use std::path::PathBuf;
+
+    use super::*;
+
+    #[test]
+    fn test_registry_location() {
+        assert_eq!(
+            Registry::new("https://plugins.lapce.dev/"),
+            Registry::Api("https://plugins.lapce.dev".to_string())
+        );
+        assert_eq!(
+            Registry::new("https://example.com/volts/index.json"),
+            Registry::StaticRemote("https://example.com/volts".to_string())
+        );
+        assert_eq!(
+            Registry::new("/mnt/volts"),
+            Registry::StaticLocal(PathBuf::from("/mnt/volts"))
+        );
+        assert_eq!(
+            Registry::new("/mnt/volts/index.json"),
+            Registry::StaticLocal(PathBuf::from("/mnt/volts"))
+        );
+
+        // The location round trips, so volts are downloaded from the same place
+        let registry = Registry::new("https://example.com/volts/index.json");
+        assert_eq!(Registry::new(&registry.location()), registry);
+    }
+
+    #[test]
+    fn test_volt_file() {
+        let volt = |author: &str, name: &str, version: &str| VoltInfo {
+            name: name.to_string(),
+            version: version.to_string(),
+            display_name: name.to_string(),
+            author: author.to_string(),
+            description: String::new(),
+            repository: None,
+            wasm: true,
+            updated_at_ts: 0,
+            registry: None,
+        };
+        assert_eq!(
+            Registry::volt_file(&volt("lapce", "rust", "0.3.1"), "icon").unwrap(),
+            "lapce/rust/0.3.1/icon"
+        );
+        for (author, name, version) in [
+            ("..", "rust", "0.3.1"),
+            ("lapce", "../../etc", "0.3.1"),
+            ("lapce", "rust", "..\\..\\secret"),
+            ("lapce", "", "0.3.1"),
+        ] {
+            assert!(
+                Registry::volt_file(&volt(author, name, version), "icon").is_err()
+            );
+        }
+    }
+}
@@ -2,6 +2,7 @@
 mod tests;
 
 use std::{
+    any::Any,
     collections::{HashMap, VecDeque},
     fs,
     io::{Read, Seek, Write},
@@ -16,7 +17,8 @@
 use lapce_core::directory::Directory;
 use lapce_rpc::{
     RpcError,
-    plugin::{PluginId, VoltID, VoltInfo, VoltMetadata},
+    core::LogLevel,
+    plugin::{PluginId, VoltID, VoltInfo, VoltMetadata, VoltPermissions},
     style::LineStyle,
 };
 use lapce_xi_rope::{Rope, RopeDelta};
@@ -29,11 +31,17 @@
 use parking_lot::Mutex;
 use psp_types::{Notification, Request};
 use serde_json::Value;
+use wasi_common::{
+    Error as WasiError, ErrorExt, SystemTimeSpec, WasiDir,
+    dir::{OpenResult, ReaddirCursor, ReaddirEntity},
+    file::{FdFlags, Filestat, OFlags},
+};
 use wasi_experimental_http_wasmtime::{HttpCtx, HttpState};
 use wasmtime_wasi::WasiCtxBuilder;
 
 use super::{
     PluginCatalogRpcHandler, client_capabilities,
+    permissions::{approved_permissions, grant_installed_volts},
     psp::{
         PluginHandlerNotification, PluginHostHandler, PluginServerHandler,
         PluginServerRpc, ResponseSender, RpcCallback, handle_plugin_server_message,
@@ -79,6 +87,117 @@ fn seek(&mut self, _pos: std::io::SeekFrom) -> std::io::Result<u64> {
     }
 }
 
+/// A preopened directory the volt can read but not change, for a workspace
+/// it has only been granted reading.
+struct ReadOnlyDir(Box<dyn WasiDir>);
+
+#[wiggle::async_trait]
+impl WasiDir for ReadOnlyDir {
+    fn as_any(&self) -> &dyn Any {
+        self
+    }
+
+    async fn open_file(
+        &self,
+        symlink_follow: bool,
+        path: &str,
+        oflags: OFlags,
+        read: bool,
+        write: bool,
+        fdflags: FdFlags,
+    ) -> Result<OpenResult, WasiError> {
+        if write
+            || oflags
+                .intersects(OFlags::CREATE | OFlags::TRUNCATE | OFlags::EXCLUSIVE)
+        {
+            return Err(WasiError::perm());
+        }
+        let result = self
+            .0
+            .open_file(symlink_follow, path, oflags, read, write, fdflags)
+            .await?;
+        Ok(match result {
+            // Directories opened through it can't be changed either
+            OpenResult::Dir(dir) => OpenResult::Dir(Box::new(ReadOnlyDir(dir))),
+            OpenResult::File(file) => OpenResult::File(file),
+        })
+    }
+
+    async fn create_dir(&self, _path: &str) -> Result<(), WasiError> {
+        Err(WasiError::perm())
+    }
+
+    async fn readdir(
+        &self,
+        cursor: ReaddirCursor,
+    ) -> Result<
+        Box<dyn Iterator<Item = Result<ReaddirEntity, WasiError>> + Send>,
+        WasiError,
+    > {
+        self.0.readdir(cursor).await
+    }
+
+    async fn symlink(
+        &self,
+        _old_path: &str,
+        _new_path: &str,
+    ) -> Result<(), WasiError> {
+        Err(WasiError::perm())
+    }
+
+    async fn remove_dir(&self, _path: &str) -> Result<(), WasiError> {
+        Err(WasiError::perm())
+    }
+
+    async fn unlink_file(&self, _path: &str) -> Result<(), WasiError> {
+        Err(WasiError::perm())
+    }
+
+    async fn read_link(&self, path: &str) -> Result<PathBuf, WasiError> {
+        self.0.read_link(path).await
+    }
+
+    async fn get_filestat(&self) -> Result<Filestat, WasiError> {
+        self.0.get_filestat().await
+    }
+
+    async fn get_path_filestat(
+        &self,
+        path: &str,
+        follow_symlinks: bool,
+    ) -> Result<Filestat, WasiError> {
+        self.0.get_path_filestat(path, follow_symlinks).await
+    }
+
+    async fn rename(
+        &self,
+        _path: &str,
+        _dest_dir: &dyn WasiDir,
+        _dest_path: &str,
+    ) -> Result<(), WasiError> {
+        Err(WasiError::perm())
+    }
+
+    async fn hard_link(
+        &self,
+        _path: &str,
+        _target_dir: &dyn WasiDir,
+        _target_path: &str,
+    ) -> Result<(), WasiError> {
+        Err(WasiError::perm())
+    }
+
+    async fn set_times(
+        &self,
+        _path: &str,
+        _atime: Option<SystemTimeSpec>,
+        _mtime: Option<SystemTimeSpec>,
+        _follow_symlinks: bool,
+    ) -> Result<(), WasiError> {
+        Err(WasiError::perm())
+    }
+}
+
 pub struct Plugin {
     #[allow(dead_code)]
     id: PluginId,
@@ -250,6 +369,9 @@ pub fn load_all_volts(
     disabled_volts: Vec<VoltID>,
 ) {
     let all_volts = find_all_volts(extra_plugin_paths);
+    if let Err(err) = grant_installed_volts(&all_volts) {
+        tracing::error!("{:?}", err);
+    }
     let volts = all_volts
         .into_iter()
         .filter_map(|meta| {
@@ -361,7 +483,11 @@ pub fn find_all_volts(extra_plugin_paths: &[PathBuf]) -> Vec<VoltMetadata> {
 ///         icon_themes: None,
 ///         dir: parent_path.canonicalize().ok(),
 ///         activation: None,
-///         config: None
+///         config: None,
+///         permissions: None,
+///         keymaps: None,
+///         dependencies: None,
+///         extension_pack: None
 ///     }
 /// );
 /// let _ = std::fs::remove_file(parent_path.join("volt.toml"));
@@ -401,6 +527,59 @@ pub fn load_volt(path: &Path) -> Result<VoltMetadata> {
     Ok(meta)
 }
 
+/// Whether the volt was loaded with `--plugin-path` rather than installed,
+/// in which case it runs in development mode.
+pub fn is_dev_volt(meta: &VoltMetadata) -> bool {
+    let Some(dir) = meta.dir.as_ref() else {
+        return false;
+    };
+    match Directory::plugins_directory().and_then(|d| d.canonicalize().ok()) {
+        Some(plugins_dir) => !dir.starts_with(plugins_dir),
+        None => true,
+    }
+}
+
+/// Whether a change to `file` should reload the development volt at `path`,
+/// because it's the volt.toml or the wasm that it declares. Other wasm files,
+/// like a build's intermediates, are left alone.
+pub fn is_dev_volt_file(path: &Path, file: &Path) -> bool {
+    let manifest = path.join("volt.toml");
+    if file == manifest {
+        return true;
+    }
+    let Ok(contents) = fs::read_to_string(&manifest) else {
+        return false;
+    };
+    let Ok(meta) = toml::from_str::<VoltMetadata>(&contents) else {
+        return false;
+    };
+    let Some(wasm) = meta.wasm.map(|wasm| path.join(wasm)) else {
+        return false;
+    };
+    file == wasm
+        || file
+            .canonicalize()
+            .is_ok_and(|file| wasm.canonicalize().is_ok_and(|wasm| file == wasm))
+}
+
+/// Loads the development volt at `path` again and restarts it, after its
+/// wasm or volt.toml has changed.
+pub fn reload_dev_volt(
+    plugin_rpc: &PluginCatalogRpcHandler,
+    path: &Path,
+) -> Result<()> {
+    let meta = load_volt(path)?;
+    plugin_rpc.core_rpc.output(
+        meta.display_name.clone(),
+        LogLevel::Info,
+        format!("Reloading {} from {}", meta.name, path.display()),
+    );
+    let icon = volt_icon(&meta);
+    plugin_rpc.core_rpc.volt_installed(meta.clone(), icon);
+    plugin_rpc.reload_volt(meta)?;
+    Ok(())
+}
+
 pub fn enable_volt(
     plugin_rpc: PluginCatalogRpcHandler,
     volt: VoltInfo,
@@ -419,6 +598,14 @@ pub fn start_volt(
     plugin_rpc: PluginCatalogRpcHandler,
     meta: VoltMetadata,
 ) -> Result<()> {
+    let Some(permissions) = approved_permissions(&meta) else {
+        plugin_rpc.core_rpc.volt_permissions_requested(meta.clone());
+        return Err(anyhow!(
+            "permissions of {} haven't been approved yet",
+            meta.id()
+        ));
+    };
+
     let engine = wasmtime::Engine::default();
     let module = wasmtime::Module::from_file(
         &engine,
@@ -428,8 +615,17 @@ pub fn start_volt(
     )?;
     let mut linker = wasmtime::Linker::new(&engine);
     wasmtime_wasi::add_to_linker(&mut linker, |s| s)?;
-    HttpState::new()?.add_to_linker(&mut linker, |_| HttpCtx {
-        allowed_hosts: Some(vec!["insecure:allow-all".to_string()]),
+    let allowed_hosts = if permissions
+        .network
+        .iter()
+        .any(|host| host == VoltPermissions::ALL)
+    {
+        vec!["insecure:allow-all".to_string()]
+    } else {
+        permissions.network.clone()
+    };
+    HttpState::new()?.add_to_linker(&mut linker, move |_| HttpCtx {
+        allowed_hosts: Some(allowed_hosts.clone()),
         max_concurrent_requests: Some(100),
     })?;
 
@@ -464,8 +660,22 @@ pub fn start_volt(
     let stdin = Arc::new(RwLock::new(WasiPipe::new()));
     let stdout = Arc::new(RwLock::new(WasiPipe::new()));
     let stderr = Arc::new(RwLock::new(WasiPipe::new()));
-    let wasi = WasiCtxBuilder::new()
-        .inherit_env()?
+    let mut wasi = WasiCtxBuilder::new();
+    for (key, value) in std::env::vars() {
+        if permissions.allows_env(&key) {
+            wasi = wasi.env(&key, &value)?;
+        }
+    }
+    let workspace_dir = match workspace.as_ref() {
+        Some(workspace) if permissions.workspace_read => {
+            Some(wasmtime_wasi::Dir::open_ambient_dir(
+                workspace,
+                wasmtime_wasi::ambient_authority(),
+            )?)
+        }
+        _ => None,
+    };
+    let wasi = wasi
         .env("VOLT_OS", std::env::consts::OS)?
         .env("VOLT_ARCH", std::env::consts::ARCH)?
         .env("VOLT_LIBC", volt_libc)?
@@ -492,20 +702,50 @@ pub fn start_volt(
             "/",
         )?
         .build();
+    if let Some(workspace_dir) = workspace_dir {
+        let dir = Box::new(wasmtime_wasi::dir::Dir::from_cap_std(workspace_dir));
+        let dir: Box<dyn WasiDir> = if permissions.workspace_write {
+            dir
+        } else {
+            Box::new(ReadOnlyDir(dir))
+        };
+        wasi.push_preopened_dir(dir, "/workspace")?;
+    }
     let mut store = wasmtime::Store::new(&engine, wasi);
 
     let (io_tx, io_rx) = crossbeam_channel::unbounded();
     let rpc = PluginServerRpcHandler::new(meta.id(), None, None, io_tx);
 
+    // Volts in development mode also get their rpc traffic in their output
+    // channel, so that a plugin author can see what's sent both ways.
+    let channel = meta.display_name.clone();
+    let trace_rpc = is_dev_volt(&meta).then(|| plugin_rpc.core_rpc.clone());
+
     let local_rpc = rpc.clone();
     let local_stdin = stdin.clone();
     let volt_name = format!("volt {}", meta.name);
+    let local_trace_rpc = trace_rpc.clone();
+    let local_channel = channel.clone();
     linker.func_wrap("lapce", "host_handle_rpc", move || {
         if let Ok(msg) = wasi_read_string(&stdout) {
+            if let Some(core_rpc) = local_trace_rpc.as_ref() {
+                core_rpc.output(
+                    local_channel.clone(),
+                    LogLevel::Debug,
+                    format!("[volt -> host] {}", msg.trim_end()),
+                );
+            }
             if let Some(resp) =
                 handle_plugin_server_message(&local_rpc, &msg, &volt_name)
             {
                 if let Ok(msg) = serde_json::to_string(&resp) {
+                    if let Some(core_rpc) = local_trace_rpc.as_ref() {
+                        core_rpc.output(
+                            local_channel.clone(),
+                            LogLevel::Debug,
+                            format!("[host -> volt] {msg}"),
+                        );
+                    }
                     if let Err(err) = writeln!(local_stdin.write().unwrap(), "{msg}")
                     {
                         tracing::error!("{:?}", err);
@@ -515,23 +755,32 @@ pub fn start_volt(
         }
     })?;
     let plugin_meta = meta.clone();
+    let core_rpc = plugin_rpc.core_rpc.clone();
+    let local_channel = channel.clone();
     linker.func_wrap("lapce", "host_handle_stderr", move || {
         if let Ok(msg) = wasi_read_string(&stderr) {
             tracing_log::log::log!(target: &format!("lapce_proxy::plugin::wasi::{}::{}", plugin_meta.author, plugin_meta.name), tracing_log::log::Level::Debug, "{msg}");
+            for line in msg.lines() {
+                core_rpc.output(
+                    local_channel.clone(),
+                    LogLevel::Info,
+                    line.to_string(),
+                );
+            }
         }
     })?;
     linker.module(&mut store, "", &module)?;
+    // Instantiate before spawning the plugin thread, so that a volt which
+    // can't start is reported to the caller rather than panicking the thread.
+    let instance = linker.instantiate(&mut store, &module)?;
+    let handle_rpc = instance
+        .get_func(&mut store, "handle_rpc")
+        .ok_or_else(|| anyhow!("can't convet to function"))?
+        .typed::<(), ()>(&mut store)?;
     let local_rpc = rpc.clone();
     thread::spawn(move || {
         let mut exist_id = None;
         {
-            let instance = linker.instantiate(&mut store, &module).unwrap();
-            let handle_rpc = instance
-                .get_func(&mut store, "handle_rpc")
-                .ok_or_else(|| anyhow!("can't convet to function"))
-                .unwrap()
-                .typed::<(), ()>(&mut store)
-                .unwrap();
             for msg in io_rx {
                 if msg
                     .get_method()
@@ -542,6 +791,13 @@ pub fn start_volt(
                     break;
                 }
                 if let Ok(msg) = serde_json::to_string(&msg) {
+                    if let Some(core_rpc) = trace_rpc.as_ref() {
+                        core_rpc.output(
+                            channel.clone(),
+                            LogLevel::Debug,
+                            format!("[host -> volt] {msg}"),
+                        );
+                    }
                     if let Err(err) = writeln!(stdin.write().unwrap(), "{msg}") {
                         tracing::error!("{:?}", err);
                     }
@@ -585,6 +841,7 @@ pub fn start_volt(
                         }),
                 )
                 .collect(),
+            permissions,
             plugin_rpc.core_rpc.clone(),
             rpc.clone(),
             plugin_rpc.clone(),
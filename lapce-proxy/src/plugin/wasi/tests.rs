@@ -145,7 +145,11 @@ fn test_load_volt() {
             icon_themes: Some(icon_themes_pathes),
             dir: parent_path.canonicalize().ok(),
             activation: None,
-            config: None
+            config: None,
+            permissions: None,
+            keymaps: None,
+            dependencies: None,
+            extension_pack: None
         }
     );
 
@@ -205,7 +209,11 @@ fn test_load_volt() {
             icon_themes: Some(icon_themes_pathes),
             dir: parent_path.canonicalize().ok(),
             activation: None,
-            config: None
+            config: None,
+            permissions: None,
+            keymaps: None,
+            dependencies: None,
+            extension_pack: None
         }
     );
 
@@ -231,7 +239,11 @@ fn test_load_volt() {
             icon_themes: Some(Vec::new()),
             dir: parent_path.canonicalize().ok(),
             activation: None,
-            config: None
+            config: None,
+            permissions: None,
+            keymaps: None,
+            dependencies: None,
+            extension_pack: None
         }
     );
 }
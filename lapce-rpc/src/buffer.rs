@@ -1,3 +1,5 @@
+use std::fmt;
+
 use serde::{Deserialize, Serialize};
 
 use crate::counter::Counter;
@@ -12,9 +14,94 @@ pub fn next() -> Self {
     }
 }
 
+/// How many lines of a file in large-file mode are sent to the editor at a time.
+pub const LARGE_FILE_PAGE_LINES: usize = 10_000;
+
+/// The most bytes a page of a file in large-file mode may hold, for files with
+/// very long lines.
+pub const LARGE_FILE_PAGE_BYTES: usize = 4 * 1024 * 1024;
+
+/// The size of a file opened in large-file mode, where the editor only holds
+/// the pages of it that have been loaded so far.
+#[derive(Clone, Copy, Debug, PartialEq, Eq, Serialize, Deserialize)]
+pub struct LargeFileInfo {
+    /// The length of the whole file in bytes
+    pub len: u64,
+    /// How many bytes of the file the pages loaded so far take
+    pub loaded: u64,
+}
+
+/// The encodings files can be reopened and saved with, by their WHATWG names,
+/// with the script or region they are used for.
+pub const FILE_ENCODINGS: &[(&str, &str)] = &[
+    ("UTF-8", "Unicode"),
+    ("UTF-16LE", "Unicode"),
+    ("UTF-16BE", "Unicode"),
+    ("windows-1252", "Western"),
+    ("ISO-8859-15", "Western"),
+    ("windows-1250", "Central European"),
+    ("ISO-8859-2", "Central European"),
+    ("windows-1251", "Cyrillic"),
+    ("KOI8-R", "Cyrillic"),
+    ("KOI8-U", "Cyrillic"),
+    ("windows-1253", "Greek"),
+    ("windows-1254", "Turkish"),
+    ("windows-1255", "Hebrew"),
+    ("windows-1256", "Arabic"),
+    ("windows-1257", "Baltic"),
+    ("windows-1258", "Vietnamese"),
+    ("windows-874", "Thai"),
+    ("Shift_JIS", "Japanese"),
+    ("EUC-JP", "Japanese"),
+    ("ISO-2022-JP", "Japanese"),
+    ("GBK", "Simplified Chinese"),
+    ("gb18030", "Simplified Chinese"),
+    ("Big5", "Traditional Chinese"),
+    ("EUC-KR", "Korean"),
+];
+
+/// The character encoding of a file, by its WHATWG name, and whether the file
+/// starts with a byte order mark.
+#[derive(Clone, Debug, PartialEq, Eq, Hash, Serialize, Deserialize)]
+pub struct FileEncoding {
+    pub name: String,
+    pub bom: bool,
+}
+
+impl FileEncoding {
+    pub fn new(name: impl Into<String>, bom: bool) -> Self {
+        Self {
+            name: name.into(),
+            bom,
+        }
+    }
+
+    pub fn is_utf8(&self) -> bool {
+        self.name == "UTF-8"
+    }
+}
+
+impl Default for FileEncoding {
+    fn default() -> Self {
+        Self::new("UTF-8", false)
+    }
+}
+
+impl fmt::Display for FileEncoding {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        // UTF-16 files always have a BOM, so it's only worth telling for UTF-8
+        if self.is_utf8() && self.bom {
+            write!(f, "UTF-8 with BOM")
+        } else {
+            write!(f, "{}", self.name)
+        }
+    }
+}
+
 #[derive(Debug, Clone, Serialize, Deserialize)]
 pub struct NewBufferResponse {
     pub content: String,
+    pub encoding: FileEncoding,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -10,7 +10,7 @@
 use crossbeam_channel::{Receiver, Sender};
 use lsp_types::{
     CancelParams, CompletionResponse, LogMessageParams, ProgressParams,
-    PublishDiagnosticsParams, ShowMessageParams, SignatureHelp,
+    PublishDiagnosticsParams, ShowMessageParams, SignatureHelp, WorkspaceEdit,
 };
 use parking_lot::Mutex;
 use serde::{Deserialize, Serialize};
@@ -21,7 +21,10 @@
         self, DapId, RunDebugConfig, Scope, StackFrame, Stopped, ThreadId, Variable,
     },
     file::PathObject,
-    plugin::{PluginId, VoltInfo, VoltMetadata},
+    plugin::{
+        PluginCommand, PluginId, PluginNotificationParams, PluginTreeView,
+        StatusBarItem, VoltID, VoltInfo, VoltMetadata,
+    },
     proxy::ProxyStatus,
     source_control::DiffInfo,
     terminal::TermId,
@@ -51,6 +54,10 @@ pub enum CoreNotification {
         path: PathBuf,
         content: FileChanged,
     },
+    /// An edit a plugin asked to apply to the open documents.
+    ApplyWorkspaceEdit {
+        edit: WorkspaceEdit,
+    },
     CompletionResponse {
         request_id: usize,
         input: String,
@@ -101,10 +108,42 @@ pub enum CoreNotification {
         volt: VoltMetadata,
         error: String,
     },
+    /// The volt asks for permissions the user hasn't granted, and won't be
+    /// started until they are.
+    VoltPermissionsRequested {
+        volt: VoltMetadata,
+    },
     VoltRemoved {
         volt: VoltInfo,
         only_installing: bool,
     },
+    PluginCommandRegistered {
+        command: PluginCommand,
+    },
+    /// A status bar item was created or updated.
+    PluginStatusBarItem {
+        volt: VoltID,
+        item: StatusBarItem,
+    },
+    PluginStatusBarItemDisposed {
+        volt: VoltID,
+        id: String,
+    },
+    PluginNotification {
+        volt: VoltID,
+        title: String,
+        params: PluginNotificationParams,
+    },
+    PluginTreeViewRegistered {
+        view: PluginTreeView,
+    },
+    /// The children of `node`, or the whole tree if it's `None`, should be
+    /// asked for again.
+    PluginTreeViewRefresh {
+        volt: VoltID,
+        view: String,
+        node: Option<String>,
+    },
     DiffInfo {
         diff: DiffInfo,
     },
@@ -132,6 +171,12 @@ pub enum CoreNotification {
         message: String,
         target: Option<String>,
     },
+    /// A line for the named channel of the output panel.
+    Output {
+        channel: String,
+        level: LogLevel,
+        text: String,
+    },
     DapStopped {
         dap_id: DapId,
         stopped: Stopped,
@@ -262,6 +307,10 @@ pub fn open_file_changed(&self, path: PathBuf, content: FileChanged) {
         self.notification(CoreNotification::OpenFileChanged { path, content });
     }
 
+    pub fn apply_workspace_edit(&self, edit: WorkspaceEdit) {
+        self.notification(CoreNotification::ApplyWorkspaceEdit { edit });
+    }
+
     pub fn completion_response(
         &self,
         request_id: usize,
@@ -298,6 +347,55 @@ pub fn volt_installing(&self, volt: VoltInfo, error: String) {
         self.notification(CoreNotification::VoltInstalling { volt, error });
     }
 
+    pub fn volt_permissions_requested(&self, volt: VoltMetadata) {
+        self.notification(CoreNotification::VoltPermissionsRequested { volt });
+    }
+
+    pub fn plugin_command_registered(&self, command: PluginCommand) {
+        self.notification(CoreNotification::PluginCommandRegistered { command });
+    }
+
+    pub fn plugin_status_bar_item(&self, volt: VoltID, item: StatusBarItem) {
+        self.notification(CoreNotification::PluginStatusBarItem { volt, item });
+    }
+
+    pub fn plugin_status_bar_item_disposed(&self, volt: VoltID, id: String) {
+        self.notification(CoreNotification::PluginStatusBarItemDisposed {
+            volt,
+            id,
+        });
+    }
+
+    pub fn plugin_notification(
+        &self,
+        volt: VoltID,
+        title: String,
+        params: PluginNotificationParams,
+    ) {
+        self.notification(CoreNotification::PluginNotification {
+            volt,
+            title,
+            params,
+        });
+    }
+
+    pub fn plugin_tree_view_registered(&self, view: PluginTreeView) {
+        self.notification(CoreNotification::PluginTreeViewRegistered { view });
+    }
+
+    pub fn plugin_tree_view_refresh(
+        &self,
+        volt: VoltID,
+        view: String,
+        node: Option<String>,
+    ) {
+        self.notification(CoreNotification::PluginTreeViewRefresh {
+            volt,
+            view,
+            node,
+        });
+    }
+
     pub fn volt_removing(&self, volt: VoltMetadata, error: String) {
         self.notification(CoreNotification::VoltRemoving { volt, error });
     }
@@ -321,6 +419,14 @@ pub fn log(&self, level: LogLevel, message: String, target: Option<String>) {
         });
     }
 
+    pub fn output(&self, channel: String, level: LogLevel, text: String) {
+        self.notification(CoreNotification::Output {
+            channel,
+            level,
+            text,
+        });
+    }
+
     pub fn publish_diagnostics(&self, diagnostics: PublishDiagnosticsParams) {
         self.notification(CoreNotification::PublishDiagnostics { diagnostics });
     }
@@ -410,7 +516,7 @@ fn default() -> Self {
     }
 }
 
-#[derive(Debug, Clone, Serialize, Deserialize)]
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
 pub enum LogLevel {
     Info = 0,
     Warn = 1,
@@ -6,6 +6,27 @@
 
 use serde::{Deserialize, Serialize};
 
+/// A piece of a file edited as bytes: a range of the file as it is on disk, or
+/// bytes that were put in its place.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub enum FilePiece {
+    File { offset: u64, len: u64 },
+    Bytes(Vec<u8>),
+}
+
+impl FilePiece {
+    pub fn len(&self) -> u64 {
+        match self {
+            FilePiece::File { len, .. } => *len,
+            FilePiece::Bytes(bytes) => bytes.len() as u64,
+        }
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+}
+
 /// UTF8 line and column-offset
 #[derive(
     Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize,
@@ -1,11 +1,24 @@
 use core::fmt;
-use std::{collections::HashMap, path::PathBuf};
+use std::{
+    collections::{BTreeMap, HashMap},
+    ffi::OsStr,
+    path::{Path, PathBuf},
+    str::FromStr,
+};
 
+use anyhow::anyhow;
 use serde::{Deserialize, Serialize};
 use serde_json::Value;
 
 use crate::counter::Counter;
 
+/// The settings table declaring language servers that are started without
+/// a volt.
+pub const LANGUAGE_SERVERS_SECTION: &str = "language-servers";
+/// The settings table declaring debug adapters that are started without a
+/// volt.
+pub const DEBUGGERS_SECTION: &str = "debuggers";
+
 #[derive(Eq, PartialEq, Hash, Clone, Copy, Debug, Serialize, Deserialize)]
 pub struct PluginId(pub u64);
 
@@ -34,6 +47,9 @@ pub struct VoltInfo {
     pub repository: Option<String>,
     pub wasm: bool,
     pub updated_at_ts: i64,
+    /// The registry this volt was found in. `None` means the default registry.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub registry: Option<String>,
 }
 
 impl VoltInfo {
@@ -49,6 +65,220 @@ pub struct VoltActivation {
     pub workspace_contains: Option<Vec<String>>,
 }
 
+/// What a volt's wasm is allowed to do on the host, declared in the
+/// `[permissions]` table of its volt.toml.
+///
+/// Lists accept `"*"` to allow everything of that kind.
+#[derive(Deserialize, Clone, Debug, Default, Serialize, PartialEq, Eq)]
+#[serde(rename_all = "kebab-case")]
+pub struct VoltPermissions {
+    /// Urls the volt may send http requests to, e.g.
+    /// `https://api.github.com`, which also allows the paths under them.
+    #[serde(default)]
+    pub network: Vec<String>,
+    /// Programs the volt may run, as a language server, debug adapter or
+    /// with `ExecuteProcess`. Names are looked up on `PATH`, and paths are
+    /// relative to the volt's directory.
+    #[serde(default)]
+    pub process: Vec<String>,
+    /// Whether the workspace folder is made available to the volt, mounted
+    /// at `/workspace`, and it can read workspace files and open documents
+    /// through the host.
+    #[serde(default)]
+    pub workspace_read: bool,
+    /// Whether the volt can write workspace files and apply workspace edits
+    /// through the host, and `/workspace` is mounted writable.
+    #[serde(default)]
+    pub workspace_write: bool,
+    /// Environment variables of the host the volt can see.
+    #[serde(default)]
+    pub env: Vec<String>,
+}
+
+impl VoltPermissions {
+    pub const ALL: &'static str = "*";
+
+    pub fn unrestricted() -> Self {
+        Self {
+            network: vec![Self::ALL.to_string()],
+            process: vec![Self::ALL.to_string()],
+            workspace_read: true,
+            workspace_write: true,
+            env: vec![Self::ALL.to_string()],
+        }
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self == &Self::default()
+    }
+
+    /// Whether `url` has the scheme, host and port of a granted url, and a
+    /// path within the granted path.
+    pub fn allows_url(&self, url: &str) -> bool {
+        if self.network.iter().any(|grant| grant == Self::ALL) {
+            return true;
+        }
+        let Ok(url) = url::Url::parse(url) else {
+            return false;
+        };
+        self.network.iter().any(|grant| {
+            let Ok(grant) = url::Url::parse(grant) else {
+                return false;
+            };
+            grant.scheme() == url.scheme()
+                && grant.host_str() == url.host_str()
+                && grant.port_or_known_default() == url.port_or_known_default()
+                && path_segments_start_with(url.path(), grant.path())
+        })
+    }
+
+    /// The file `program` runs, if the volt may run it. `volt_dir` is where
+    /// the volt is installed, which relative paths are resolved against.
+    ///
+    /// A granted name only allows the program `PATH` finds for it, and not
+    /// one inside the volt or workspace that the volt could have written.
+    pub fn allowed_program(
+        &self,
+        program: &str,
+        volt_dir: Option<&Path>,
+        workspace: Option<&Path>,
+    ) -> Option<PathBuf> {
+        self.allowed_program_in(
+            program,
+            volt_dir,
+            workspace,
+            std::env::var_os("PATH").as_deref(),
+        )
+    }
+
+    fn allowed_program_in(
+        &self,
+        program: &str,
+        volt_dir: Option<&Path>,
+        workspace: Option<&Path>,
+        path_var: Option<&OsStr>,
+    ) -> Option<PathBuf> {
+        let resolve = |program: &str| {
+            if is_program_name(program) {
+                find_in_path(program, path_var)
+            } else {
+                volt_dir
+                    .map(|dir| dir.join(program))
+                    .unwrap_or_else(|| PathBuf::from(program))
+                    .canonicalize()
+                    .ok()
+            }
+        };
+        if self.process.iter().any(|grant| grant == Self::ALL) {
+            return Some(resolve(program).unwrap_or_else(|| program.into()));
+        }
+
+        let resolved = resolve(program)?;
+        let untrusted_dirs: Vec<PathBuf> = [volt_dir, workspace]
+            .into_iter()
+            .flatten()
+            .filter_map(|dir| dir.canonicalize().ok())
+            .collect();
+        let allowed = self.process.iter().any(|grant| {
+            if is_program_name(grant)
+                && untrusted_dirs.iter().any(|dir| resolved.starts_with(dir))
+            {
+                return false;
+            }
+            resolve(grant).as_ref() == Some(&resolved)
+        });
+        allowed.then_some(resolved)
+    }
+
+    pub fn allows_env(&self, key: &str) -> bool {
+        self.env.iter().any(|k| k == Self::ALL || k == key)
+    }
+
+    /// Whether everything `other` asks for is allowed by these permissions.
+    pub fn covers(&self, other: &VoltPermissions) -> bool {
+        other
+            .network
+            .iter()
+            .all(|host| self.network.iter().any(|h| h == Self::ALL || h == host))
+            && other
+                .process
+                .iter()
+                .all(|p| self.process.iter().any(|q| q == Self::ALL || q == p))
+            && (!other.workspace_read || self.workspace_read)
+            && (!other.workspace_write || self.workspace_write)
+            && other
+                .env
+                .iter()
+                .all(|k| self.env.iter().any(|e| e == Self::ALL || e == k))
+    }
+
+    /// Human readable lines describing the permissions, for asking the user.
+    pub fn descriptions(&self) -> Vec<String> {
+        fn list(items: &[String]) -> String {
+            if items.iter().any(|i| i == VoltPermissions::ALL) {
+                "any".to_string()
+            } else {
+                items.join(", ")
+            }
+        }
+
+        let mut lines = Vec::new();
+        if !self.network.is_empty() {
+            lines.push(format!("Network access: {}", list(&self.network)));
+        }
+        if !self.process.is_empty() {
+            lines.push(format!("Run programs: {}", list(&self.process)));
+        }
+        if self.workspace_read {
+            lines.push("Read files in the workspace".to_string());
+        }
+        if self.workspace_write {
+            lines.push("Change files in the workspace".to_string());
+        }
+        if !self.env.is_empty() {
+            lines.push(format!("Environment variables: {}", list(&self.env)));
+        }
+        lines
+    }
+}
+
+/// Whether a path's segments start with all of the segments of `prefix`, so
+/// that `/repos` is within `/repos/` and `/` but not `/repo`.
+fn path_segments_start_with(path: &str, prefix: &str) -> bool {
+    let mut segments = path.split('/').filter(|s| !s.is_empty());
+    prefix
+        .split('/')
+        .filter(|s| !s.is_empty())
+        .all(|prefix| segments.next() == Some(prefix))
+}
+
+/// Whether a program is given by name, to be looked up on `PATH`, rather
+/// than by path.
+fn is_program_name(program: &str) -> bool {
+    !program.contains(['/', '\\'])
+}
+
+/// Finds a program on `PATH` the way a shell would, trying the executable
+/// extensions of `PATHEXT` on Windows.
+fn find_in_path(name: &str, path_var: Option<&OsStr>) -> Option<PathBuf> {
+    let extensions: Vec<String> = if cfg!(windows) {
+        std::env::var("PATHEXT")
+            .unwrap_or_else(|_| ".COM;.EXE;.BAT;.CMD".to_string())
+            .split(';')
+            .map(|ext| format!("{name}{ext}"))
+            .collect()
+    } else {
+        Vec::new()
+    };
+    std::env::split_paths(path_var?).find_map(|dir| {
+        std::iter::once(name)
+            .chain(extensions.iter().map(String::as_str))
+            .map(|file| dir.join(file))
+            .find(|file| file.is_file())
+            .and_then(|file| file.canonicalize().ok())
+    })
+}
+
 #[derive(Deserialize, Clone, Debug, Serialize, PartialEq, Eq)]
 pub struct VoltConfig {
     pub default: Value,
@@ -71,6 +301,21 @@ pub struct VoltMetadata {
     pub dir: Option<PathBuf>,
     pub activation: Option<VoltActivation>,
     pub config: Option<HashMap<String, VoltConfig>>,
+    /// The permissions the volt asks for. Volts that don't declare any
+    /// predate permissions and are treated as asking for all of them.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub permissions: Option<VoltPermissions>,
+    /// Keybindings for the commands the volt registers, merged before the
+    /// user's own keymaps.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub keymaps: Option<Vec<VoltKeymap>>,
+    /// The volts this volt needs, by `author.name`, with a semver version
+    /// requirement for each.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub dependencies: Option<BTreeMap<String, String>>,
+    /// The volts, by `author.name`, that are installed along with this one.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub extension_pack: Option<Vec<String>>,
 }
 
 impl VoltMetadata {
@@ -78,6 +323,39 @@ pub fn id(&self) -> VoltID {
         VoltID::from(self)
     }
 
+    /// The permissions the wasm of this volt needs to be granted before it
+    /// can start.
+    pub fn requested_permissions(&self) -> VoltPermissions {
+        self.permissions
+            .clone()
+            .unwrap_or_else(VoltPermissions::unrestricted)
+    }
+
+    /// The volts that have to be installed for this one, by `author.name`,
+    /// with their version requirement. Volts of the extension pack can be of
+    /// any version.
+    pub fn required_volts(&self) -> Vec<(String, String)> {
+        self.dependencies
+            .iter()
+            .flatten()
+            .map(|(id, req)| (id.clone(), req.clone()))
+            .chain(
+                self.extension_pack
+                    .iter()
+                    .flatten()
+                    .map(|id| (id.clone(), "*".to_string())),
+            )
+            .collect()
+    }
+
+    /// Whether this volt depends on or bundles the volt `id`.
+    pub fn requires(&self, id: &VoltID) -> bool {
+        let id = id.to_string();
+        self.required_volts()
+            .iter()
+            .any(|(required, _)| *required == id)
+    }
+
     pub fn info(&self) -> VoltInfo {
         VoltInfo {
             name: self.name.clone(),
@@ -88,22 +366,178 @@ pub fn info(&self) -> VoltInfo {
             repository: self.repository.clone(),
             wasm: self.wasm.is_some(),
             updated_at_ts: 0,
+            registry: None,
         }
     }
 }
 
+/// A language server declared in a `[language-servers.<name>]` table of
+/// settings.toml.
+#[derive(Deserialize, Clone, Debug, Serialize, PartialEq, Default)]
+#[serde(rename_all = "kebab-case", default)]
+pub struct LanguageServerConfig {
+    pub command: String,
+    pub args: Vec<String>,
+    pub env: HashMap<String, String>,
+    /// The language ids of the documents the server handles.
+    pub languages: Vec<String>,
+    /// Globs of the paths the server handles, besides its languages.
+    pub file_patterns: Vec<String>,
+    pub initialization_options: Option<Value>,
+}
+
+/// A debug adapter declared in a `[debuggers.<type>]` table of
+/// settings.toml, for run configs of that type.
+#[derive(Deserialize, Clone, Debug, Serialize, PartialEq, Eq, Default)]
+#[serde(rename_all = "kebab-case", default)]
+pub struct DebuggerConfig {
+    pub program: String,
+    pub args: Option<Vec<String>>,
+}
+
+/// A keybinding declared in the `[[keymaps]]` tables of volt.toml, in the
+/// same format as the user's keymaps.toml.
+#[derive(Deserialize, Clone, Debug, Serialize, PartialEq, Eq)]
+pub struct VoltKeymap {
+    pub key: String,
+    pub command: String,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub when: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub mode: Option<String>,
+}
+
+/// A command a volt registered, which can be run from the command palette,
+/// keybindings and status bar items.
+#[derive(Clone, Debug, Hash, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PluginCommand {
+    pub volt: VoltID,
+    pub command: String,
+    pub title: String,
+}
+
+impl PluginCommand {
+    /// Whether the command is named within its volt's id, as
+    /// `author.name.command`. Only these are registered, so that a volt
+    /// can't take the place of a built in command or another volt's.
+    pub fn is_namespaced(&self) -> bool {
+        self.volt.owns_command(&self.command)
+    }
+}
+
+#[derive(
+    Clone, Copy, Debug, Default, Hash, PartialEq, Eq, Serialize, Deserialize,
+)]
+#[serde(rename_all = "camelCase")]
+pub enum StatusBarAlignment {
+    #[default]
+    Left,
+    Right,
+}
+
+/// An item a volt shows in the status bar.
+#[derive(Clone, Debug, Hash, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct StatusBarItem {
+    /// Unique within the volt.
+    pub id: String,
+    pub text: String,
+    #[serde(default)]
+    pub tooltip: Option<String>,
+    /// The command run when the item is clicked.
+    #[serde(default)]
+    pub command: Option<String>,
+    #[serde(default)]
+    pub alignment: StatusBarAlignment,
+    /// Items with a higher priority are shown further left.
+    #[serde(default)]
+    pub priority: i32,
+}
+
+#[derive(Clone, Debug, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct NotificationAction {
+    pub title: String,
+    pub command: String,
+}
+
+/// A message from a volt, with buttons that run commands.
+#[derive(Clone, Debug, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct PluginNotificationParams {
+    pub message: String,
+    #[serde(default)]
+    pub actions: Vec<NotificationAction>,
+}
+
+/// A tree a volt shows in the plugin views panel. Its nodes are asked from
+/// the volt when they're expanded.
+#[derive(Clone, Debug, Hash, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PluginTreeView {
+    pub volt: VoltID,
+    pub id: String,
+    pub title: String,
+}
+
+#[derive(Clone, Debug, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "camelCase")]
+pub struct TreeNode {
+    /// Unique within the tree view.
+    pub id: String,
+    pub label: String,
+    #[serde(default)]
+    pub description: Option<String>,
+    /// The name of an icon in the icon theme, like `file` or `debug`.
+    #[serde(default)]
+    pub icon: Option<String>,
+    /// Whether the node has children, which are asked for when it's
+    /// expanded.
+    #[serde(default)]
+    pub collapsible: bool,
+    /// The command run when the node is clicked.
+    #[serde(default)]
+    pub command: Option<String>,
+    #[serde(default)]
+    pub arguments: Vec<Value>,
+}
+
 #[derive(Clone, Debug, Hash, PartialEq, Eq, Serialize, Deserialize)]
 pub struct VoltID {
     pub author: String,
     pub name: String,
 }
 
+impl VoltID {
+    /// Whether `command` is named within this id, as `author.name.command`.
+    pub fn owns_command(&self, command: &str) -> bool {
+        command
+            .strip_prefix(&format!("{self}."))
+            .is_some_and(|name| !name.is_empty())
+    }
+}
+
 impl fmt::Display for VoltID {
     fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
         write!(f, "{}.{}", self.author, self.name)
     }
 }
 
+impl FromStr for VoltID {
+    type Err = anyhow::Error;
+
+    /// Parses an id written as `author.name`.
+    fn from_str(s: &str) -> Result<Self, Self::Err> {
+        let (author, name) = s
+            .split_once('.')
+            .filter(|(author, name)| !author.is_empty() && !name.is_empty())
+            .ok_or_else(|| anyhow!("invalid volt id {s}, expected author.name"))?;
+        Ok(Self {
+            author: author.to_string(),
+            name: name.to_string(),
+        })
+    }
+}
+
 impl From<VoltMetadata> for VoltID {
     fn from(volt: VoltMetadata) -> Self {
         Self {
@@ -142,7 +576,9 @@ fn from(volt: &VoltInfo) -> Self {
 
 #[cfg(test)]
 mod tests {
-    use super::{VoltID, VoltInfo, VoltMetadata};
+    use std::path::Path;
+
+    use super::{PluginCommand, VoltID, VoltInfo, VoltMetadata, VoltPermissions};
 
     #[test]
     fn test_volt_metadata_id() {
@@ -160,6 +596,10 @@ fn test_volt_metadata_id() {
             dir: std::env::current_dir().unwrap().canonicalize().ok(),
             activation: None,
             config: None,
+            permissions: None,
+            keymaps: None,
+            dependencies: None,
+            extension_pack: None,
         };
         let volt_id = VoltID {
             author: "Author".to_string(),
@@ -198,6 +638,10 @@ fn test_volt_metadata_info() {
             dir: std::env::current_dir().unwrap().canonicalize().ok(),
             activation: None,
             config: None,
+            permissions: None,
+            keymaps: None,
+            dependencies: None,
+            extension_pack: None,
         };
         let volt_info = VoltInfo {
             name: "plugin".to_string(),
@@ -208,6 +652,7 @@ fn test_volt_metadata_info() {
             repository: None,
             wasm: false,
             updated_at_ts: 0,
+            registry: None,
         };
         assert_eq!(volt_metadata.info(), volt_info);
     }
@@ -223,6 +668,7 @@ fn test_volt_info_id() {
             repository: None,
             wasm: false,
             updated_at_ts: 0,
+            registry: None,
         };
         let volt_id = VoltID {
             author: "Author".to_string(),
@@ -234,4 +680,140 @@ fn test_volt_info_id() {
         assert_eq!(<&VoltInfo as Into<VoltID>>::into(&volt_info), volt_id);
         assert_eq!(<VoltInfo as Into<VoltID>>::into(volt_info), volt_id);
     }
+
+    #[test]
+    fn test_volt_permissions() {
+        let granted = VoltPermissions {
+            network: vec!["https://api.github.com".to_string()],
+            process: vec!["rust-analyzer".to_string()],
+            workspace_read: false,
+            workspace_write: false,
+            env: vec!["PATH".to_string()],
+        };
+        assert!(granted.allows_url("https://api.github.com/repos"));
+        assert!(granted.allows_url("https://api.github.com:443/"));
+        assert!(!granted.allows_url("https://example.com"));
+        assert!(!granted.allows_url("https://api.github.com.evil.com"));
+        assert!(!granted.allows_url("http://api.github.com"));
+        assert!(!granted.allows_url("https://api.github.com:8443"));
+        assert!(granted.allows_env("PATH"));
+        assert!(!granted.allows_env("HOME"));
+
+        assert!(granted.covers(&VoltPermissions::default()));
+        assert!(granted.covers(&granted));
+        assert!(!granted.covers(&VoltPermissions {
+            workspace_read: true,
+            ..granted.clone()
+        }));
+        assert!(!granted.covers(&VoltPermissions {
+            workspace_write: true,
+            ..granted.clone()
+        }));
+        assert!(VoltPermissions::unrestricted().covers(&granted));
+        assert!(!granted.covers(&VoltPermissions::unrestricted()));
+    }
+
+    #[test]
+    fn test_plugin_command_namespace() {
+        let volt = VoltID {
+            author: "author".to_string(),
+            name: "volt".to_string(),
+        };
+        let command = |command: &str| PluginCommand {
+            volt: volt.clone(),
+            command: command.to_string(),
+            title: String::new(),
+        };
+        assert!(command("author.volt.refresh").is_namespaced());
+        assert!(!command("save").is_namespaced());
+        assert!(!command("author.volt.").is_namespaced());
+        assert!(!command("author.voltx.refresh").is_namespaced());
+    }
+
+    #[test]
+    fn test_volt_permissions_url_path() {
+        let granted = VoltPermissions {
+            network: vec!["https://example.com/api/".to_string()],
+            ..Default::default()
+        };
+        assert!(granted.allows_url("https://example.com/api"));
+        assert!(granted.allows_url("https://example.com/api/v1?q=1"));
+        assert!(!granted.allows_url("https://example.com/apis"));
+        assert!(!granted.allows_url("https://example.com/"));
+        assert!(!granted.allows_url("not a url"));
+    }
+
+    #[test]
+    fn test_volt_permissions_program() {
+        let root = std::env::temp_dir()
+            .join(format!("lapce-volt-permissions-{}", std::process::id()));
+        let bin = root.join("bin");
+        let volt = root.join("volt");
+        std::fs::create_dir_all(&bin).unwrap();
+        std::fs::create_dir_all(volt.join("server")).unwrap();
+        for file in [bin.join("git"), volt.join("git"), volt.join("server/ls")] {
+            std::fs::write(file, "").unwrap();
+        }
+        let bin_git = bin.join("git").canonicalize().unwrap();
+        let volt_git = volt.join("git").canonicalize().unwrap();
+        let volt_ls = volt.join("server/ls").canonicalize().unwrap();
+        let allowed = |granted: &VoltPermissions, program: &str, path: &Path| {
+            granted.allowed_program_in(
+                program,
+                Some(&volt),
+                None,
+                Some(path.as_os_str()),
+            )
+        };
+
+        let granted = VoltPermissions {
+            process: vec!["git".to_string(), "server/ls".to_string()],
+            ..Default::default()
+        };
+        // Names only match what PATH finds
+        assert_eq!(allowed(&granted, "git", &bin), Some(bin_git.clone()));
+        assert_eq!(
+            allowed(&granted, bin_git.to_str().unwrap(), &bin),
+            Some(bin_git.clone())
+        );
+        assert_eq!(allowed(&granted, volt_git.to_str().unwrap(), &bin), None);
+        // even when PATH leads into the volt
+        assert_eq!(allowed(&granted, "git", &volt), None);
+        // Paths are relative to the volt
+        assert_eq!(allowed(&granted, "server/ls", &bin), Some(volt_ls.clone()));
+        assert_eq!(
+            allowed(&granted, volt_ls.to_str().unwrap(), &bin),
+            Some(volt_ls)
+        );
+        assert_eq!(allowed(&granted, "sh", &bin), None);
+
+        let unrestricted = VoltPermissions::unrestricted();
+        assert_eq!(allowed(&unrestricted, "git", &volt), Some(volt_git));
+
+        std::fs::remove_dir_all(root).unwrap();
+    }
+    #[test]
+    fn test_volt_required_volts() {
+        let volt_metadata: VoltMetadata =
+            serde_json::from_value(serde_json::json!({
+                "name": "framework",
+                "version": "0.1.0",
+                "display-name": "Framework",
+                "author": "Author",
+                "description": "Framework support",
+                "dependencies": { "lapce.lapce-rust": "^0.3" },
+                "extension-pack": ["author.snippets"],
+            }))
+            .unwrap();
+        assert_eq!(
+            volt_metadata.required_volts(),
+            vec![
+                ("lapce.lapce-rust".to_string(), "^0.3".to_string()),
+                ("author.snippets".to_string(), "*".to_string()),
+            ]
+        );
+        assert!(volt_metadata.requires(&"lapce.lapce-rust".parse().unwrap()));
+        assert!(!volt_metadata.requires(&"lapce.lapce-go".parse().unwrap()));
+        assert!("lapce".parse::<VoltID>().is_err());
+    }
 }
@@ -14,7 +14,7 @@
     CallHierarchyIncomingCall, CallHierarchyItem, CodeAction, CodeActionResponse,
     CodeLens, CompletionItem, Diagnostic, DocumentSymbolResponse, FoldingRange,
     GotoDefinitionResponse, Hover, InlayHint, InlineCompletionResponse,
-    InlineCompletionTriggerKind, Location, Position, PrepareRenameResponse,
+    InlineCompletionTriggerKind, Location, Position, PrepareRenameResponse, Range,
     SelectionRange, SymbolInformation, TextDocumentItem, TextEdit, WorkspaceEdit,
     request::{GotoImplementationResponse, GotoTypeDefinitionResponse},
 };
@@ -24,11 +24,11 @@
 use super::plugin::VoltID;
 use crate::{
     RequestId, RpcError, RpcMessage,
-    buffer::BufferId,
+    buffer::{BufferId, FileEncoding, LargeFileInfo},
     dap_types::{self, DapId, RunDebugConfig, SourceBreakpoint, ThreadId},
-    file::{FileNodeItem, PathObject},
+    file::{FileNodeItem, FilePiece, PathObject},
     file_line::FileLine,
-    plugin::{PluginId, VoltInfo, VoltMetadata},
+    plugin::{PluginId, TreeNode, VoltInfo, VoltMetadata, VoltPermissions},
     source_control::FileDiff,
     style::SemanticStyles,
     terminal::{TermId, TerminalProfile},
@@ -63,10 +63,49 @@ pub enum ProxyRequest {
     NewBuffer {
         buffer_id: BufferId,
         path: PathBuf,
+        /// Files bigger than this many bytes are opened in large-file mode
+        large_file_threshold: Option<usize>,
+    },
+    /// Get the page of a large file that follows what the editor has loaded
+    BufferPage {
+        path: PathBuf,
+    },
+    /// Read up to `len` bytes of a file from `offset`, for binary files
+    ReadFileRange {
+        path: PathBuf,
+        offset: u64,
+        len: u64,
+    },
+    /// Write a file edited as bytes, made of `pieces` from the file as it is
+    /// and the bytes put between them. Only the bytes that changed are
+    /// written, and the ones after them that moved.
+    WriteFile {
+        path: PathBuf,
+        pieces: Vec<FilePiece>,
+    },
+    /// Search a file edited as bytes, made of `pieces` as for
+    /// [`ProxyRequest::WriteFile`], for `pattern`
+    FindBytes {
+        path: PathBuf,
+        pieces: Vec<FilePiece>,
+        pattern: Vec<u8>,
+    },
+    /// Search the loaded part of a large file
+    FindInBuffer {
+        path: PathBuf,
+        pattern: String,
+        case_sensitive: bool,
+        whole_word: bool,
+        is_regex: bool,
     },
     BufferHead {
         path: PathBuf,
     },
+    /// Read an open file again, decoding it with `encoding`.
+    ReopenBuffer {
+        path: PathBuf,
+        encoding: FileEncoding,
+    },
     GlobalSearch {
         pattern: String,
         case_sensitive: bool,
@@ -118,6 +157,11 @@ pub enum ProxyRequest {
         path: PathBuf,
         call_hierarchy_item: CallHierarchyItem,
     },
+    GetPluginTreeChildren {
+        volt: VoltID,
+        view: String,
+        parent: Option<String>,
+    },
     GetTypeDefinition {
         request_id: usize,
         path: PathBuf,
@@ -169,6 +213,11 @@ pub enum ProxyRequest {
         path: PathBuf,
     },
     GetOpenFilesContent {},
+    GetActiveEditor {},
+    /// The permissions the user granted to a volt, if any.
+    GetVoltPermissions {
+        volt: VoltID,
+    },
     GetFiles {
         path: String,
     },
@@ -180,6 +229,7 @@ pub enum ProxyRequest {
         path: PathBuf,
         /// Whether to create the parent directories if they do not exist.
         create_parents: bool,
+        encoding: FileEncoding,
     },
     SaveBufferAs {
         buffer_id: BufferId,
@@ -188,6 +238,7 @@ pub enum ProxyRequest {
         content: String,
         /// Whether to create the parent directories if they do not exist.
         create_parents: bool,
+        encoding: FileEncoding,
     },
     CreateFile {
         path: PathBuf,
@@ -238,6 +289,11 @@ pub enum ProxyNotification {
     OpenFileChanged {
         path: PathBuf,
     },
+    /// The focused editor changed, or its selections did.
+    ActiveEditorChanged {
+        path: Option<PathBuf>,
+        selections: Vec<Range>,
+    },
     OpenPaths {
         paths: Vec<PathObject>,
     },
@@ -258,6 +314,13 @@ pub enum ProxyNotification {
         delta: RopeDelta,
         rev: u64,
     },
+    /// The editor appended the page of a large file it got from
+    /// [`ProxyRequest::BufferPage`], `len` bytes long
+    BufferPageLoaded {
+        path: PathBuf,
+        len: usize,
+        rev: u64,
+    },
     UpdatePluginConfigs {
         configs: HashMap<String, HashMap<String, serde_json::Value>>,
     },
@@ -280,6 +343,19 @@ pub enum ProxyNotification {
     EnableVolt {
         volt: VoltInfo,
     },
+    /// Grant a volt the permissions it asks for, and start it.
+    GrantVoltPermissions {
+        volt: VoltMetadata,
+    },
+    RevokeVoltPermissions {
+        volt: VoltMetadata,
+    },
+    /// Run a command registered by a volt.
+    ExecutePluginCommand {
+        volt: VoltID,
+        command: String,
+        arguments: Vec<serde_json::Value>,
+    },
     GitCommit {
         message: String,
         diffs: Vec<FileDiff>,
@@ -363,6 +439,42 @@ pub enum ProxyResponse {
     NewBufferResponse {
         content: String,
         read_only: bool,
+        encoding: FileEncoding,
+        /// Set when the file was opened in large-file mode, in which case
+        /// `content` is only its first page
+        large_file: Option<LargeFileInfo>,
+        /// Whether the file isn't text, so it should be opened as bytes with
+        /// [`ProxyRequest::ReadFileRange`]
+        binary: bool,
+    },
+    ReadFileRangeResponse {
+        data: Vec<u8>,
+        /// The length of the whole file
+        file_len: u64,
+    },
+    BufferPageResponse {
+        content: String,
+        /// How many bytes of the file are loaded once this page is
+        loaded: u64,
+        /// Whether this page reaches the end of the file
+        done: bool,
+    },
+    FindInBufferResponse {
+        /// The byte ranges of the matches
+        matches: Vec<(usize, usize)>,
+    },
+    FindBytesResponse {
+        /// The offsets of the first matches, up to a limit
+        matches: Vec<u64>,
+        /// The number of all the matches
+        count: u64,
+    },
+    ReopenBufferResponse {
+        content: String,
+        encoding: FileEncoding,
+        /// Whether the file has bytes that aren't valid in the encoding, which
+        /// keeps it from being saved
+        read_only: bool,
     },
     BufferHeadResponse {
         version: String,
@@ -391,6 +503,9 @@ pub enum ProxyResponse {
     CallHierarchyIncomingResponse {
         items: Option<Vec<CallHierarchyIncomingCall>>,
     },
+    GetPluginTreeChildrenResponse {
+        children: Vec<TreeNode>,
+    },
     GetTypeDefinition {
         request_id: usize,
         definition: GotoTypeDefinitionResponse,
@@ -451,6 +566,13 @@ pub enum ProxyResponse {
     GetOpenFilesContentResponse {
         items: Vec<TextDocumentItem>,
     },
+    GetActiveEditorResponse {
+        path: Option<PathBuf>,
+        selections: Vec<Range>,
+    },
+    GetVoltPermissionsResponse {
+        granted: Option<VoltPermissions>,
+    },
     GlobalSearchResponse {
         matches: IndexMap<PathBuf, Vec<SearchMatch>>,
     },
@@ -629,6 +751,35 @@ pub fn enable_volt(&self, volt: VoltInfo) {
         self.notification(ProxyNotification::EnableVolt { volt });
     }
 
+    pub fn grant_volt_permissions(&self, volt: VoltMetadata) {
+        self.notification(ProxyNotification::GrantVoltPermissions { volt });
+    }
+
+    pub fn revoke_volt_permissions(&self, volt: VoltMetadata) {
+        self.notification(ProxyNotification::RevokeVoltPermissions { volt });
+    }
+
+    pub fn execute_plugin_command(
+        &self,
+        volt: VoltID,
+        command: String,
+        arguments: Vec<serde_json::Value>,
+    ) {
+        self.notification(ProxyNotification::ExecutePluginCommand {
+            volt,
+            command,
+            arguments,
+        });
+    }
+
+    pub fn get_volt_permissions(
+        &self,
+        volt: VoltID,
+        f: impl ProxyCallback + 'static,
+    ) {
+        self.request_async(ProxyRequest::GetVoltPermissions { volt }, f);
+    }
+
     pub fn shutdown(&self) {
         self.notification(ProxyNotification::Shutdown {});
         if let Err(err) = self.tx.send(ProxyRpc::Shutdown) {
@@ -707,15 +858,93 @@ pub fn new_buffer(
         &self,
         buffer_id: BufferId,
         path: PathBuf,
+        large_file_threshold: Option<usize>,
+        f: impl ProxyCallback + 'static,
+    ) {
+        self.request_async(
+            ProxyRequest::NewBuffer {
+                buffer_id,
+                path,
+                large_file_threshold,
+            },
+            f,
+        );
+    }
+
+    pub fn read_file_range(
+        &self,
+        path: PathBuf,
+        offset: u64,
+        len: u64,
+        f: impl ProxyCallback + 'static,
+    ) {
+        self.request_async(ProxyRequest::ReadFileRange { path, offset, len }, f);
+    }
+
+    pub fn write_file(
+        &self,
+        path: PathBuf,
+        pieces: Vec<FilePiece>,
+        f: impl ProxyCallback + 'static,
+    ) {
+        self.request_async(ProxyRequest::WriteFile { path, pieces }, f);
+    }
+
+    pub fn find_bytes(
+        &self,
+        path: PathBuf,
+        pieces: Vec<FilePiece>,
+        pattern: Vec<u8>,
         f: impl ProxyCallback + 'static,
     ) {
-        self.request_async(ProxyRequest::NewBuffer { buffer_id, path }, f);
+        self.request_async(
+            ProxyRequest::FindBytes {
+                path,
+                pieces,
+                pattern,
+            },
+            f,
+        );
+    }
+
+    pub fn get_buffer_page(&self, path: PathBuf, f: impl ProxyCallback + 'static) {
+        self.request_async(ProxyRequest::BufferPage { path }, f);
+    }
+
+    pub fn find_in_buffer(
+        &self,
+        path: PathBuf,
+        pattern: String,
+        case_sensitive: bool,
+        whole_word: bool,
+        is_regex: bool,
+        f: impl ProxyCallback + 'static,
+    ) {
+        self.request_async(
+            ProxyRequest::FindInBuffer {
+                path,
+                pattern,
+                case_sensitive,
+                whole_word,
+                is_regex,
+            },
+            f,
+        );
     }
 
     pub fn get_buffer_head(&self, path: PathBuf, f: impl ProxyCallback + 'static) {
         self.request_async(ProxyRequest::BufferHead { path }, f);
     }
 
+    pub fn reopen_buffer(
+        &self,
+        path: PathBuf,
+        encoding: FileEncoding,
+        f: impl ProxyCallback + 'static,
+    ) {
+        self.request_async(ProxyRequest::ReopenBuffer { path, encoding }, f);
+    }
+
     pub fn create_file(&self, path: PathBuf, f: impl ProxyCallback + 'static) {
         self.request_async(ProxyRequest::CreateFile { path }, f);
     }
@@ -767,6 +996,7 @@ pub fn save_buffer_as(
         rev: u64,
         content: String,
         create_parents: bool,
+        encoding: FileEncoding,
         f: impl ProxyCallback + 'static,
     ) {
         self.request_async(
@@ -776,6 +1006,7 @@ pub fn save_buffer_as(
                 rev,
                 content,
                 create_parents,
+                encoding,
             },
             f,
         );
@@ -805,6 +1036,7 @@ pub fn save(
         rev: u64,
         path: PathBuf,
         create_parents: bool,
+        encoding: FileEncoding,
         f: impl ProxyCallback + 'static,
     ) {
         self.request_async(
@@ -812,6 +1044,7 @@ pub fn save(
                 rev,
                 path,
                 create_parents,
+                encoding,
             },
             f,
         );
@@ -830,6 +1063,10 @@ pub fn get_open_files_content(&self) -> Result<ProxyResponse, RpcError> {
         self.request(ProxyRequest::GetOpenFilesContent {})
     }
 
+    pub fn get_active_editor(&self) -> Result<ProxyResponse, RpcError> {
+        self.request(ProxyRequest::GetActiveEditor {})
+    }
+
     pub fn read_dir(&self, path: PathBuf, f: impl ProxyCallback + 'static) {
         self.request_async(ProxyRequest::ReadDir { path }, f);
     }
@@ -922,6 +1159,19 @@ pub fn call_hierarchy_incoming(
         );
     }
 
+    pub fn get_plugin_tree_children(
+        &self,
+        volt: VoltID,
+        view: String,
+        parent: Option<String>,
+        f: impl ProxyCallback + 'static,
+    ) {
+        self.request_async(
+            ProxyRequest::GetPluginTreeChildren { volt, view, parent },
+            f,
+        );
+    }
+
     pub fn get_type_definition(
         &self,
         request_id: usize,
@@ -1090,10 +1340,25 @@ pub fn get_inline_completions(
         );
     }
 
+    pub fn active_editor_changed(
+        &self,
+        path: Option<PathBuf>,
+        selections: Vec<Range>,
+    ) {
+        self.notification(ProxyNotification::ActiveEditorChanged {
+            path,
+            selections,
+        });
+    }
+
     pub fn update(&self, path: PathBuf, delta: RopeDelta, rev: u64) {
         self.notification(ProxyNotification::Update { path, delta, rev });
     }
 
+    pub fn buffer_page_loaded(&self, path: PathBuf, len: usize, rev: u64) {
+        self.notification(ProxyNotification::BufferPageLoaded { path, len, rev });
+    }
+
     pub fn update_plugin_configs(
         &self,
         configs: HashMap<String, HashMap<String, serde_json::Value>>,